@@ -5,15 +5,36 @@ import (
     "io/ioutil"
     "os"
     "path/filepath"
+    "strconv"
+    "strings"
 
     "github.com/tinyrange/cc/internal/codegen/x86_64"
     "github.com/tinyrange/cc/internal/ir"
     "github.com/tinyrange/cc/internal/parser"
 )
 
+// maxErrors caps how many parse diagnostics are printed.
+const maxErrors = 20
+
 func main() {
     var outPath string
     var srcPath string
+    werror := false
+    wuninit := false
+    wconst := false
+    emitIR := false
+    emitDom := false
+    emitLive := false
+    // -g marks the code with the source lines it came from
+    debug := false
+    // --dump-ir-after, -fstats and -fverbose-regalloc write to stderr, or a
+    // file in --dump-dir
+    dumpAfter, dumpDir := "", ""
+    stats, verboseRegAlloc := false, false
+    optLevel := 1
+    inlineThreshold := ir.DefaultInlineThreshold
+    var passes, disabled []string
+    var opts x86_64.Options
     // Minimal arg parsing supporting -o anywhere
     args := os.Args[1:]
     for i := 0; i < len(args); i++ {
@@ -23,13 +44,102 @@ func main() {
             i++
             continue
         }
+        if a == "-Werror" {
+            werror = true
+            continue
+        }
+        if a == "-Wuninitialized" {
+            wuninit = true
+            continue
+        }
+        if a == "-Wconstant-condition" {
+            wconst = true
+            continue
+        }
+        if a == "-O0" || a == "-O1" || a == "-O2" {
+            optLevel = int(a[2] - '0')
+            continue
+        }
+        // -fpass=a,b runs just the passes named; -fno-x leaves pass x out
+        if strings.HasPrefix(a, "-fpass=") {
+            passes = []string{}
+            for _, n := range strings.Split(strings.TrimPrefix(a, "-fpass="), ",") {
+                if n != "" { passes = append(passes, n) }
+            }
+            continue
+        }
+        if strings.HasPrefix(a, "-fno-") {
+            disabled = append(disabled, strings.TrimPrefix(a, "-fno-"))
+            continue
+        }
+        if strings.HasPrefix(a, "-finline-threshold=") {
+            n, err := strconv.Atoi(strings.TrimPrefix(a, "-finline-threshold="))
+            if err != nil || n < 0 {
+                fmt.Fprintf(os.Stderr, "bad inline threshold %q\n", a)
+                os.Exit(2)
+            }
+            inlineThreshold = n
+            continue
+        }
+        if strings.HasPrefix(a, "-fregalloc=") {
+            opts.RegAlloc = strings.TrimPrefix(a, "-fregalloc=")
+            if opts.RegAlloc != "linear" && opts.RegAlloc != "color" {
+                fmt.Fprintf(os.Stderr, "unknown register allocator %q (known: linear, color)\n", opts.RegAlloc)
+                os.Exit(2)
+            }
+            continue
+        }
+        if a == "--emit=ir" {
+            emitIR = true
+            continue
+        }
+        if a == "--emit=dom" {
+            emitDom = true
+            continue
+        }
+        if strings.HasPrefix(a, "--dump-ir-after=") {
+            dumpAfter = strings.TrimPrefix(a, "--dump-ir-after=")
+            continue
+        }
+        if strings.HasPrefix(a, "--dump-dir=") {
+            dumpDir = strings.TrimPrefix(a, "--dump-dir=")
+            continue
+        }
+        if a == "-fstats" {
+            stats = true
+            continue
+        }
+        if a == "-fpic" || a == "-fPIC" {
+            opts.PIC = true
+            continue
+        }
+        if strings.HasPrefix(a, "--target=") {
+            opts.Target = strings.TrimPrefix(a, "--target=")
+            if opts.Target != "x86_64-linux" && opts.Target != "x86_64-darwin" {
+                fmt.Fprintf(os.Stderr, "unknown target %q (known: x86_64-linux, x86_64-darwin)\n", opts.Target)
+                os.Exit(2)
+            }
+            continue
+        }
+        if a == "-g" {
+            debug = true
+            continue
+        }
+        if a == "-fverbose-regalloc" {
+            verboseRegAlloc = true
+            continue
+        }
+        if a == "--emit=live" {
+            emitLive = true
+            continue
+        }
         if len(srcPath) == 0 && len(a) > 0 && a[0] != '-' {
             srcPath = a
             continue
         }
     }
     if srcPath == "" {
-        fmt.Fprintln(os.Stderr, "usage: ccomp [-o out.s] <file.c>")
+        fmt.Fprintln(os.Stderr, "usage: ccomp [-Werror] [-Wuninitialized] [-Wconstant-condition] [-O0|-O1|-O2] [-fpass=p,...] [-fno-p] [-finline-threshold=n] [-fregalloc=linear|color] [-fpic] [-g] [--target=x86_64-linux|x86_64-darwin] [--dump-ir-after=p|all] [-fstats] [-fverbose-regalloc] [--dump-dir=d] [--emit=ir|--emit=dom|--emit=live] [-o out.s] <file.c>")
         os.Exit(2)
     }
     data, err := ioutil.ReadFile(srcPath)
@@ -38,35 +148,130 @@ func main() {
         os.Exit(1)
     }
 
-    astFile, perr := parser.ParseFile(srcPath, string(data))
-    if perr != nil {
-        fmt.Fprintf(os.Stderr, "parse error: %v\n", perr)
-        os.Exit(1)
+    var m *ir.Module
+    first := "build"
+    if filepath.Ext(srcPath) == ".ir" {
+        // textual IR skips the front end, to test the later phases directly
+        if m, err = ir.Parse(filepath.Base(srcPath), string(data)); err != nil {
+            fmt.Fprintf(os.Stderr, "ir parse error: %v\n", err)
+            os.Exit(1)
+        }
+        first = "parse"
+    } else {
+        m = buildC(srcPath, string(data), wuninit)
     }
 
-    m := ir.NewModule(filepath.Base(srcPath))
-    if err := ir.BuildModule(astFile, m); err != nil {
-        fmt.Fprintf(os.Stderr, "ir error: %v\n", err)
-        os.Exit(1)
+    // --emit=dom and --emit=live print the dominators and liveness of the
+    // IR as built, for testing them
+    if emitDom || emitLive {
+        var sb strings.Builder
+        for _, f := range m.Funcs {
+            if emitDom { sb.WriteString(ir.ComputeDominators(f).String()) } else { sb.WriteString(ir.Liveness(f).String()) }
+        }
+        write(outPath, sb.String())
+        return
     }
 
+    // --emit=ir prints the IR after each phase instead of assembly
+    var dump strings.Builder
+    phase := func(name string) {
+        if emitIR { fmt.Fprintf(&dump, ";; after %s\n%s\n", name, m) }
+    }
+    phase(first)
     // Phase 2: basic optimizations
-    ir.Optimize(m)
+    m.WarnConstantCondition = wconst
+    m.OptLevel = optLevel
+    m.InlineThreshold = inlineThreshold
+    m.Passes, m.DisabledPasses = passes, disabled
+    m.DumpAfter, m.Stats = dumpAfter, stats
+    if dumpAfter != "" || stats || verboseRegAlloc {
+        m.Log = os.Stderr
+        if dumpDir != "" {
+            // one file per source, named after it
+            log, err := os.Create(filepath.Join(dumpDir, filepath.Base(srcPath)+".dump"))
+            if err != nil {
+                fmt.Fprintf(os.Stderr, "dump error: %v\n", err)
+                os.Exit(1)
+            }
+            defer log.Close()
+            m.Log = log
+        }
+    }
+    if err := ir.Optimize(m); err != nil {
+        fmt.Fprintf(os.Stderr, "%v\n", err)
+        os.Exit(2)
+    }
+    if stats { m.WriteStats(m.Log) }
+    if verboseRegAlloc { opts.Log = m.Log }
+    if debug { opts.DebugSource = srcPath }
+    phase("optimize")
+    verify(m, "optimization")
+    // warnings come from building and from folding, which finds constant conditions
+    for _, w := range m.Warnings { fmt.Fprintf(os.Stderr, "warning: %s\n", w) }
+    if werror && len(m.Warnings) > 0 {
+        fmt.Fprintln(os.Stderr, "error: warnings treated as errors (-Werror)")
+        os.Exit(1)
+    }
     // SSA destruction groundwork: phi elimination (CFG-aware, no-op if no branches)
     for _, f := range m.Funcs { ir.PhiEliminate(f) }
+    phase("phi elimination")
+    verify(m, "phi elimination")
+    for _, f := range m.Funcs { ir.CleanupCFG(f) }
+    phase("cfg cleanup")
+    verify(m, "cfg cleanup")
 
-    asm, err := x86_64.EmitModule(m)
-    if err != nil {
+    var asm string
+    if emitIR {
+        asm = dump.String()
+    } else if asm, err = x86_64.EmitModule(m, opts); err != nil {
         fmt.Fprintf(os.Stderr, "codegen error: %v\n", err)
         os.Exit(1)
     }
 
+    write(outPath, asm)
+}
+
+// write writes out to outPath, or to stdout without one.
+func write(outPath, out string) {
     if outPath == "" {
-        fmt.Print(asm)
+        fmt.Print(out)
         return
     }
-    if err := os.WriteFile(outPath, []byte(asm), 0644); err != nil {
+    if err := os.WriteFile(outPath, []byte(out), 0644); err != nil {
         fmt.Fprintf(os.Stderr, "write error: %v\n", err)
         os.Exit(1)
     }
 }
+
+// verify exits if a pass left the IR inconsistent, which is a compiler bug.
+func verify(m *ir.Module, after string) {
+    if err := m.Verify(); err != nil {
+        fmt.Fprintf(os.Stderr, "internal error: invalid IR after %s: %v\n", after, err)
+        os.Exit(1)
+    }
+}
+
+// buildC parses the C source and builds its IR, exiting on errors.
+func buildC(srcPath, src string, wuninit bool) *ir.Module {
+    astFile, perr := parser.ParseFile(srcPath, src)
+    if perr != nil {
+        errs, ok := perr.(parser.ErrorList)
+        if !ok { errs = parser.ErrorList{perr} }
+        for i, e := range errs {
+            if i == maxErrors {
+                fmt.Fprintf(os.Stderr, "too many errors (%d total)\n", len(errs))
+                break
+            }
+            fmt.Fprintf(os.Stderr, "parse error: %v\n", e)
+        }
+        os.Exit(1)
+    }
+
+    m := ir.NewModule(filepath.Base(srcPath))
+    m.WarnUninitialized = wuninit
+    if err := ir.BuildModule(astFile, m); err != nil {
+        fmt.Fprintf(os.Stderr, "ir error: %v\n", err)
+        os.Exit(1)
+    }
+    return m
+}
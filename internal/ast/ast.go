@@ -6,11 +6,16 @@ type File struct {
 
 type Decl interface{ isDecl() }
 
+// FuncDecl is a function definition, or a prototype when Body is nil: int f(int x);
+// A Variadic prototype ends its parameters with ...: int printf(char *fmt, ...);
 type FuncDecl struct {
     Name string
     Params []Param
     Body *BlockStmt
     Ret  BasicType
+    Static bool // internal linkage: no .globl
+    Variadic bool
+    Pos  Pos // position of the name
 }
 func (*FuncDecl) isDecl() {}
 
@@ -18,47 +23,62 @@ type Param struct {
     Name string
     Typ  BasicType
     Ptr  bool
+    Pos  Pos
+    StructType string // pointee struct name for struct S *p
 }
 
 type Stmt interface{ isStmt() }
 
-type BlockStmt struct { Stmts []Stmt }
+type BlockStmt struct { Stmts []Stmt; Pos Pos }
 func (*BlockStmt) isStmt() {}
 
 type ReturnStmt struct { Expr Expr; Pos Pos }
 func (*ReturnStmt) isStmt() {}
 
-type ExprStmt struct { X Expr }
+type ExprStmt struct { X Expr; Pos Pos }
 func (*ExprStmt) isStmt() {}
 
-type DeclStmt struct { Name string; Init Expr; Typ BasicType; Ptr bool; Pos Pos; TypedefName string }
+// DeclStmt declares a local. A Static local lives in module storage and its
+// Init is a folded constant; an Extern one refers to a global of that name.
+// StructType names the pointee of a struct S *p local. A Func local is a
+// pointer to a function returning Typ: int (*fp)(int);
+type DeclStmt struct { Name string; Init Expr; Typ BasicType; Ptr bool; Pos Pos; TypedefName string; Static, Extern, Const bool; StructType string; Func bool }
 func (*DeclStmt) isStmt() {}
 
-type ArrayDeclStmt struct { Name string; Size int; Elem BasicType }
+// ArrayDeclStmt declares a local array, optionally initialized: int a[3] = {1, 2};
+// With Func set its elements point to functions returning Elem: int (*t[2])(int);
+type ArrayDeclStmt struct { Name string; Size int; Elem BasicType; Init []Expr; Pos Pos; Func bool }
 func (*ArrayDeclStmt) isStmt() {}
 
-type StructVarDeclStmt struct { Name string; StructType string }
+type StructVarDeclStmt struct { Name string; StructType string; Pos Pos }
 func (*StructVarDeclStmt) isStmt() {}
 
 type AssignStmt struct { Name string; Value Expr; Pos Pos }
 func (*AssignStmt) isStmt() {}
 
-type ArrayAssignStmt struct { Name string; Index Expr; Value Expr }
+type ArrayAssignStmt struct { Name string; Index Expr; Value Expr; Pos Pos }
 func (*ArrayAssignStmt) isStmt() {}
 
-type FieldAssignStmt struct { Base string; Field string; Value Expr }
+// FieldAssignStmt assigns a struct member: Base.Field = Value;
+type FieldAssignStmt struct { Base Expr; Field string; Arrow bool; Value Expr; Pos Pos }
 func (*FieldAssignStmt) isStmt() {}
 
+// DerefAssignStmt stores through a pointer: *Ptr = Value;
+type DerefAssignStmt struct { Ptr Expr; Value Expr; Pos Pos }
+func (*DerefAssignStmt) isStmt() {}
+
 type IfStmt struct {
     Cond Expr
     Then *BlockStmt
     Else *BlockStmt
+    Pos  Pos
 }
 func (*IfStmt) isStmt() {}
 
 type WhileStmt struct {
     Cond Expr
     Body *BlockStmt
+    Pos  Pos
 }
 func (*WhileStmt) isStmt() {}
 
@@ -67,25 +87,28 @@ type ForStmt struct {
     Cond Expr // may be nil (treated as true)
     Post Stmt // may be nil
     Body *BlockStmt
+    Pos  Pos
 }
 func (*ForStmt) isStmt() {}
 
 type DoWhileStmt struct {
     Body *BlockStmt
     Cond Expr
+    Pos  Pos
 }
 func (*DoWhileStmt) isStmt() {}
 
-type BreakStmt struct{}
+type BreakStmt struct{ Pos Pos }
 func (*BreakStmt) isStmt() {}
 
-type ContinueStmt struct{}
+type ContinueStmt struct{ Pos Pos }
 func (*ContinueStmt) isStmt() {}
 
 type SwitchStmt struct {
     Tag Expr
     Cases []CaseClause
     Default *BlockStmt // may be nil
+    Pos Pos
 }
 func (*SwitchStmt) isStmt() {}
 
@@ -96,19 +119,19 @@ type CaseClause struct {
 
 type Expr interface{ isExpr() }
 
-type Ident struct { Name string }
+type Ident struct { Name string; Pos Pos }
 func (*Ident) isExpr() {}
 
-type IntLit struct { Value int64 }
+type IntLit struct { Value int64; Pos Pos }
 func (*IntLit) isExpr() {}
 
-type FloatLit struct { Value float64 }
+type FloatLit struct { Value float64; Pos Pos }
 func (*FloatLit) isExpr() {}
 
-type StringLit struct { Value string }
+type StringLit struct { Value string; Pos Pos }
 func (*StringLit) isExpr() {}
 
-type BinaryExpr struct { Op BinOp; Left, Right Expr }
+type BinaryExpr struct { Op BinOp; Left, Right Expr; Pos Pos }
 func (*BinaryExpr) isExpr() {}
 
 type BinOp int
@@ -132,9 +155,18 @@ const (
     OpShr
 )
 
+// AssignExpr is an assignment used as a value, as in while ((n = n / 10) != 0).
+// Its value is the one stored.
+type AssignExpr struct { Name string; Value Expr; Pos Pos }
+func (*AssignExpr) isExpr() {}
+
+// CallExpr calls the function Name, or when Fn is set the function pointer
+// it evaluates to: (*fp)(x), t[i](x).
 type CallExpr struct {
     Name string
+    Fn   Expr
     Args []Expr
+    Pos  Pos
 }
 func (*CallExpr) isExpr() {}
 
@@ -147,29 +179,45 @@ const (
     OpLogicalNot
 )
 
-type UnaryExpr struct { Op UnOp; X Expr }
+type UnaryExpr struct { Op UnOp; X Expr; Pos Pos }
 func (*UnaryExpr) isExpr() {}
 
-type IndexExpr struct { Base Expr; Index Expr }
+type IndexExpr struct { Base Expr; Index Expr; Pos Pos }
 func (*IndexExpr) isExpr() {}
 
-type CastExpr struct { To BasicType; Ptr bool; X Expr }
+type CastExpr struct { To BasicType; Ptr bool; X Expr; TypedefName string; Pos Pos }
 func (*CastExpr) isExpr() {}
 
-type FieldExpr struct { Base Expr; Field string }
+// FieldExpr is Base.Field, or Base->Field when Arrow is set.
+type FieldExpr struct { Base Expr; Field string; Arrow bool; Pos Pos }
 func (*FieldExpr) isExpr() {}
 
-type GlobalDecl struct { Name string; Init *IntLit; Typ BasicType; Ptr bool }
+// GlobalDecl is a global scalar. Static globals are not exported; Extern ones
+// only declare a symbol defined elsewhere. Const is recorded, not enforced.
+// A pointer may instead be initialized with an address, in AddrInit.
+type GlobalDecl struct { Name string; Init *IntLit; AddrInit *AddrConst; Typ BasicType; Ptr bool; Static, Extern, Const bool; Pos Pos }
 func (*GlobalDecl) isDecl() {}
 
+// AddrConst is an address known at link time: a string literal when IsStr,
+// else the global Name (&x, or with Decay a bare array a), Index elements on.
+type AddrConst struct { Name string; Str string; IsStr, Decay bool; Index int64; Pos Pos }
+
 // GlobalArrayDecl represents a global array like: int g[N]; (zero-initialized)
-type GlobalArrayDecl struct { Name string; Size int; Elem BasicType }
+// a char array initialized from a string: char s[] = "hi"; or a constant
+// list: int g[4] = {1, 2}; Ptr makes the elements pointers to Elem.
+type GlobalArrayDecl struct { Name string; Size int; Elem BasicType; Ptr bool; Str string; HasStr bool; Elems []int64; Static, Extern bool; Pos Pos }
 func (*GlobalArrayDecl) isDecl() {}
 
+// GlobalStructDecl is a zero-initialized global struct: struct S s;
+type GlobalStructDecl struct { Name string; StructType string; Static, Extern bool; Pos Pos }
+func (*GlobalStructDecl) isDecl() {}
+
 // StructDecl represents a struct definition: struct S { int x; int y; };
+// Forward is set for a bare declaration without a body: struct S;
 type StructDecl struct {
-    Name   string
-    Fields []StructField
+    Name    string
+    Fields  []StructField
+    Forward bool
 }
 func (*StructDecl) isDecl() {}
 
@@ -177,6 +225,7 @@ type StructField struct {
     Name string
     Typ  BasicType
     Ptr  bool
+    StructType string // pointee struct name for members like: struct S *next;
 }
 
 // EnumDecl represents an enum definition: enum E { A=1, B=2 };
@@ -199,11 +248,63 @@ type TypedefDecl struct {
 }
 func (*TypedefDecl) isDecl() {}
 
+// BasicType is a combined type specifier such as unsigned short. Plain char
+// is unsigned; long long is the same as long.
 type BasicType int
 const (
     BTInt BasicType = iota
     BTChar
     BTDouble
+    BTShort
+    BTLong
+    BTSChar
+    BTUChar
+    BTUShort
+    BTUInt
+    BTULong
 )
 
+// Pos is the line and column of the token a node starts at.
 type Pos struct { Line int; Col int }
+
+// ExprPos returns the starting position of any expression.
+func ExprPos(e Expr) Pos {
+    switch e := e.(type) {
+    case *Ident: return e.Pos
+    case *IntLit: return e.Pos
+    case *FloatLit: return e.Pos
+    case *StringLit: return e.Pos
+    case *BinaryExpr: return e.Pos
+    case *CallExpr: return e.Pos
+    case *AssignExpr: return e.Pos
+    case *UnaryExpr: return e.Pos
+    case *IndexExpr: return e.Pos
+    case *CastExpr: return e.Pos
+    case *FieldExpr: return e.Pos
+    }
+    return Pos{}
+}
+
+// StmtPos returns the starting position of any statement.
+func StmtPos(s Stmt) Pos {
+    switch s := s.(type) {
+    case *BlockStmt: return s.Pos
+    case *ReturnStmt: return s.Pos
+    case *ExprStmt: return s.Pos
+    case *DeclStmt: return s.Pos
+    case *ArrayDeclStmt: return s.Pos
+    case *StructVarDeclStmt: return s.Pos
+    case *AssignStmt: return s.Pos
+    case *ArrayAssignStmt: return s.Pos
+    case *FieldAssignStmt: return s.Pos
+    case *DerefAssignStmt: return s.Pos
+    case *IfStmt: return s.Pos
+    case *WhileStmt: return s.Pos
+    case *ForStmt: return s.Pos
+    case *DoWhileStmt: return s.Pos
+    case *BreakStmt: return s.Pos
+    case *ContinueStmt: return s.Pos
+    case *SwitchStmt: return s.Pos
+    }
+    return Pos{}
+}
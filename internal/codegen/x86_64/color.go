@@ -0,0 +1,211 @@
+package x86_64
+
+import (
+    "sort"
+    "github.com/tinyrange/cc/internal/ir"
+)
+
+// Chaitin-Briggs graph-coloring register allocation, chosen with
+// -fregalloc=color. Two values interfere when one is defined while the
+// other is live, by the liveness of each instruction; the result of an
+// instruction also interferes with its operands, since the emitter may
+// write the result before it has read them all. Copies whose ends do not
+// interfere are coalesced into one node, so the copy disappears. Nodes are
+// then simplified off the graph while one has fewer neighbours than there
+// are registers, and when none has, the one whose spill costs least for its
+// degree is pushed anyway, in the hope it still finds a color (Briggs).
+// Popping them back, each takes a register none of its neighbours has, or
+// stays in memory. A use or definition costs 10 per enclosing loop.
+
+// colorNode is a value, or several coalesced, in the interference graph.
+type colorNode struct {
+    adj         map[ir.ValueID]bool
+    cost        int
+    crossesCall bool
+    avoid       map[string]bool
+}
+
+func colorRegisters(f *ir.Function) allocation {
+    alloc := allocation{regOf: make(map[ir.ValueID]string), saveAt: make(map[*ir.Instr][]ir.ValueID)}
+    live := ir.Liveness(f)
+    depth := make(map[*ir.BasicBlock]int)
+    for _, l := range ir.FindLoops(f) {
+        for b := range l.Blocks { depth[b]++ }
+    }
+
+    // a value is allocated if something reads it; an alloca is a frame
+    // region, never a register
+    used := make(map[ir.ValueID]bool)
+    for _, b := range f.Blocks {
+        for i := range b.Instrs {
+            for _, a := range valueArgs(&b.Instrs[i]) { used[a] = true }
+        }
+    }
+    nodes := make(map[ir.ValueID]*colorNode)
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs {
+            if ins.Res >= 0 && used[ins.Res] && ins.Val.Op != ir.OpAlloca && nodes[ins.Res] == nil {
+                nodes[ins.Res] = &colorNode{adj: make(map[ir.ValueID]bool), avoid: make(map[string]bool)}
+            }
+        }
+    }
+    interfere := func(a, b ir.ValueID) {
+        if a == b || nodes[a] == nil || nodes[b] == nil { return }
+        nodes[a].adj[b] = true
+        nodes[b].adj[a] = true
+    }
+
+    // walk each block backward from what is live out of it
+    var copies []*ir.Instr
+    for _, b := range f.Blocks {
+        weight := 1
+        for i := 0; i < depth[b]; i++ { weight *= 10 }
+        now := make(map[ir.ValueID]bool)
+        for id := range live.Out[b] { now[id] = true }
+        for i := len(b.Instrs) - 1; i >= 0; i-- {
+            ins := &b.Instrs[i]
+            args := valueArgs(ins)
+            def := ins.Res
+            if nodes[def] == nil { def = -1 }
+            isCopy := ins.Val.Op == ir.OpCopy && def >= 0
+            if isCopy { copies = append(copies, ins) }
+            for id := range now {
+                if id == def || nodes[id] == nil { continue }
+                if ins.Val.Op == ir.OpCall || ins.Val.Op == ir.OpCallIndirect { nodes[id].crossesCall = true }
+                for _, reg := range clobbers[ins.Val.Op] { nodes[id].avoid[reg] = true }
+                if def >= 0 && !(isCopy && id == args[0]) { interfere(def, id) }
+            }
+            if def >= 0 {
+                nodes[def].cost += weight
+                if !isCopy {
+                    for _, a := range args { interfere(def, a) }
+                }
+                delete(now, def)
+            }
+            for _, a := range args {
+                if nodes[a] != nil { nodes[a].cost += weight }
+                now[a] = true
+            }
+        }
+    }
+
+    // coalesce: a copy between values that do not interfere merges them
+    // into the node of the lower id
+    root := make(map[ir.ValueID]ir.ValueID)
+    find := func(id ir.ValueID) ir.ValueID {
+        for {
+            r, ok := root[id]
+            if !ok { return id }
+            id = r
+        }
+    }
+    for _, ins := range copies {
+        a, b := find(ins.Res), find(ins.Val.Args[0])
+        if a == b || nodes[b] == nil || nodes[a].adj[b] { continue }
+        if b < a { a, b = b, a }
+        na, nb := nodes[a], nodes[b]
+        for n := range nb.adj {
+            delete(nodes[n].adj, b)
+            interfere(a, n)
+        }
+        na.cost += nb.cost
+        na.crossesCall = na.crossesCall || nb.crossesCall
+        for reg := range nb.avoid { na.avoid[reg] = true }
+        delete(nodes, b)
+        root[b] = a
+    }
+
+    // simplify, pushing each node off the graph
+    ids := make([]ir.ValueID, 0, len(nodes))
+    for id := range nodes { ids = append(ids, id) }
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    k := len(allocableRegs) + len(calleeSavedRegs)
+    removed := make(map[ir.ValueID]bool)
+    degree := func(id ir.ValueID) int {
+        d := 0
+        for n := range nodes[id].adj {
+            if !removed[n] { d++ }
+        }
+        return d
+    }
+    var stack []ir.ValueID
+    for len(stack) < len(ids) {
+        pick := ir.ValueID(-1)
+        for _, id := range ids {
+            if !removed[id] && degree(id) < k { pick = id; break }
+        }
+        if pick < 0 {
+            // the cheapest to spill for the neighbours it frees
+            best := 0.0
+            for _, id := range ids {
+                if removed[id] { continue }
+                c := float64(nodes[id].cost) / float64(degree(id))
+                if pick < 0 || c < best { pick, best = id, c }
+            }
+        }
+        removed[pick] = true
+        stack = append(stack, pick)
+    }
+
+    // select, in the reverse order
+    anyRegs := append(append([]string(nil), allocableRegs...), calleeSavedRegs...)
+    acrossRegs := append(append([]string(nil), calleeSavedRegs...), allocableRegs...)
+    color := make(map[ir.ValueID]string)
+    for i := len(stack) - 1; i >= 0; i-- {
+        id := stack[i]
+        n := nodes[id]
+        taken := make(map[string]bool)
+        for reg := range n.avoid { taken[reg] = true }
+        for m := range n.adj {
+            if reg, ok := color[m]; ok { taken[reg] = true }
+        }
+        regs := anyRegs
+        if n.crossesCall { regs = acrossRegs }
+        for _, reg := range regs {
+            if !taken[reg] { color[id] = reg; break }
+        }
+    }
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs {
+            if reg, ok := color[find(ins.Res)]; ok && ins.Res >= 0 && used[ins.Res] { alloc.regOf[ins.Res] = reg }
+        }
+    }
+
+    // the values live across each call in registers it clobbers
+    for call, ids := range liveAcrossCalls(f, live) {
+        for _, id := range ids {
+            if reg, ok := alloc.regOf[id]; ok && callClobberedRegs[reg] { alloc.saveAt[call] = append(alloc.saveAt[call], id) }
+        }
+    }
+
+    inUse := make(map[string]bool)
+    for _, reg := range alloc.regOf { inUse[reg] = true }
+    for _, reg := range calleeSavedRegs {
+        if inUse[reg] { alloc.saved = append(alloc.saved, reg) }
+    }
+    return alloc
+}
+
+// liveAcrossCalls returns the values live across each call, bar its result,
+// in value order.
+func liveAcrossCalls(f *ir.Function, live *ir.Live) map[*ir.Instr][]ir.ValueID {
+    across := make(map[*ir.Instr][]ir.ValueID)
+    for _, b := range f.Blocks {
+        now := make(map[ir.ValueID]bool)
+        for id := range live.Out[b] { now[id] = true }
+        for i := len(b.Instrs) - 1; i >= 0; i-- {
+            ins := &b.Instrs[i]
+            if ins.Val.Op == ir.OpCall || ins.Val.Op == ir.OpCallIndirect {
+                var ids []ir.ValueID
+                for id := range now {
+                    if id != ins.Res { ids = append(ids, id) }
+                }
+                sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+                across[ins] = ids
+            }
+            delete(now, ins.Res)
+            for _, a := range valueArgs(ins) { now[a] = true }
+        }
+    }
+    return across
+}
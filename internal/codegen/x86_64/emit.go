@@ -2,74 +2,212 @@ package x86_64
 
 import (
     "fmt"
+    "io"
+    "math"
     "strings"
-    "unsafe"
 
+    "github.com/tinyrange/cc/internal/ast"
     "github.com/tinyrange/cc/internal/ir"
 )
 
+// Options choose how EmitModule generates code.
+type Options struct {
+    // RegAlloc is the register allocator: "linear" (linear scan, the
+    // default when empty) or "color" (graph coloring).
+    RegAlloc string
+    // PIC makes code that works in a shared object or PIE (-fpic): a
+    // function or global that is not static, which another object may
+    // define, is called through the PLT and addressed through the GOT.
+    PIC bool
+    // Log, if set, gets a report of each function's register allocation
+    // (-fverbose-regalloc).
+    Log io.Writer
+    // DebugSource, if set, is the path of the C source, for -g: the code
+    // then carries .file and .loc directives, from which the assembler
+    // builds a DWARF line table.
+    DebugSource string
+    // Target is the system the assembly is for: "x86_64-linux", the
+    // default when empty, or "x86_64-darwin" (macOS).
+    Target string
+}
+
 // EmitModule emits AT&T syntax x86_64 assembly for System V AMD64.
-func EmitModule(m *ir.Module) (string, error) {
+func EmitModule(m *ir.Module, opts Options) (string, error) {
+    tgt, err := newTarget(opts.Target)
+    if err != nil { return "", err }
     var b strings.Builder
+    // jump tables are read-only data, collected while emitting the code
+    var tables strings.Builder
+    if opts.DebugSource != "" { fmt.Fprintf(&b, ".file 1 %s\n", asmString(opts.DebugSource)) }
     b.WriteString(".text\n")
+    // the symbols no other object can define instead, which are reached
+    // directly even under -fpic: in a shared object, an exported symbol
+    // may be preempted by one of the same name
+    local := map[string]bool{}
+    for _, f := range m.Funcs {
+        if f.Static { local[f.Name] = true }
+    }
+    for _, g := range m.Globals {
+        if g.Static && !g.Extern { local[g.Name] = true }
+    }
+    for _, s := range m.StrLits { local[s.Name] = true }
     for _, f := range m.Funcs {
-        if err := emitFunc(&b, f); err != nil { return "", err }
+        if err := emitFunc(&b, &tables, f, opts, tgt, local); err != nil { return "", err }
+    }
+    // on ELF, both are in .rodata
+    if tables.Len() > 0 {
+        b.WriteString(tgt.constData + "\n")
+        b.WriteString(tables.String())
     }
     if len(m.StrLits) > 0 {
-        b.WriteString(".section .rodata\n")
+        if tables.Len() == 0 || tgt.cstrings != tgt.constData { b.WriteString(tgt.cstrings + "\n") }
         for _, s := range m.StrLits {
-            fmt.Fprintf(&b, "%s:\n", s.Name)
+            fmt.Fprintf(&b, "%s:\n", tgt.sym(s.Name))
             // emit NUL-terminated string
-            fmt.Fprintf(&b, "  .asciz %q\n", s.Data)
+            fmt.Fprintf(&b, "  .asciz %s\n", asmString(s.Data))
         }
     }
-    if len(m.Globals) > 0 {
-        b.WriteString(".data\n")
+    // a global with no initializer, or a zero one, goes in .bss, which
+    // takes no room in the object
+    for _, section := range []string{".data", ".bss"} {
+        header := false
         for _, g := range m.Globals {
-            fmt.Fprintf(&b, ".globl %s\n%s:\n", g.Name, g.Name)
-            if g.Array {
-                // Reserve elementSize * Length bytes zero-initialized
-                esz := g.ElemSize
-                if esz == 0 { esz = 8 }
-                fmt.Fprintf(&b, "  .zero %d\n", g.Length*esz)
+            // extern declarations are defined by another object
+            if g.Extern || zeroGlobal(g) != (section == ".bss") { continue }
+            if !header { b.WriteString(section + "\n"); header = true }
+            emitGlobal(&b, g, tgt)
+        }
+    }
+    return b.String(), nil
+}
+
+// zeroGlobal reports whether g is all zeros: a struct, which has no
+// initializer, an array without one, or a scalar initialized to 0.
+func zeroGlobal(g ir.Global) bool {
+    if g.Struct != "" { return true }
+    if g.Array { return len(g.Data) == 0 && len(g.Elems) == 0 }
+    return g.Init == 0 && g.InitSym == ""
+}
+
+// emitGlobal emits g's label and its contents, which for one in .bss can
+// only be zeros.
+func emitGlobal(b *strings.Builder, g ir.Global, tgt target) {
+    name := tgt.sym(g.Name)
+    if !g.Static { fmt.Fprintf(b, ".globl %s\n", name) }
+    if !tgt.macho { fmt.Fprintf(b, ".type %s, @object\n", name) }
+    if g.Struct != "" {
+        // a struct is zero-filled at its widest field's alignment
+        if !tgt.macho { fmt.Fprintf(b, ".size %s, %d\n", name, g.Length) }
+        fmt.Fprintf(b, "  .balign %d\n", g.Align)
+        fmt.Fprintf(b, "%s:\n", name)
+        fmt.Fprintf(b, "  .zero %d\n", g.Length)
+        return
+    }
+    // scalars and array elements are naturally aligned
+    esz := g.ElemSize
+    if esz == 0 { esz = 8 }
+    size := esz
+    if g.Array { size = g.Length*esz }
+    if !tgt.macho { fmt.Fprintf(b, ".size %s, %d\n", name, size) }
+    if esz > 1 { fmt.Fprintf(b, "  .balign %d\n", esz) }
+    fmt.Fprintf(b, "%s:\n", name)
+    if g.Array {
+        // Reserve elementSize * Length bytes zero-initialized
+        if len(g.Data) > 0 {
+            fmt.Fprintf(b, "  .ascii %s\n", asmString(string(g.Data)))
+            size -= len(g.Data)
+        }
+        for _, v := range g.Elems {
+            fmt.Fprintf(b, "  %s %d\n", dataDirectives[esz], truncate(v, esz))
+            size -= esz
+        }
+        if size > 0 { fmt.Fprintf(b, "  .zero %d\n", size) }
+    } else {
+        if g.InitSym != "" {
+            // an address, resolved by the linker
+            if g.Init == 0 {
+                fmt.Fprintf(b, "  .quad %s\n", tgt.sym(g.InitSym))
             } else {
-                if g.ElemSize == 1 {
-                    // byte scalar
-                    fmt.Fprintf(&b, "  .byte %d\n", int(g.Init)&0xFF)
-                } else {
-                    fmt.Fprintf(&b, "  .quad %d\n", g.Init)
-                }
+                fmt.Fprintf(b, "  .quad %s%+d\n", tgt.sym(g.InitSym), g.Init)
             }
+        } else if zeroGlobal(g) {
+            fmt.Fprintf(b, "  .zero %d\n", esz)
+        } else {
+            fmt.Fprintf(b, "  %s %d\n", dataDirectives[esz], truncate(g.Init, esz))
         }
     }
-    return b.String(), nil
+}
+
+// dataDirectives emit an integer of each size.
+var dataDirectives = map[int]string{1: ".byte", 2: ".short", 4: ".long", 8: ".quad"}
+
+// truncate keeps the low size bytes of v, as the unsigned value the
+// assembler expects for a narrow directive.
+func truncate(v int64, size int) int64 {
+    if size >= 8 { return v }
+    return v & (1<<(8*uint(size)) - 1)
+}
+
+// asmString quotes s for .ascii and .asciz byte by byte. Go's %q is not
+// safe here: the assembler reads \x escapes greedily and has no \u, so any
+// byte other than printable ASCII is written as a three-digit octal escape.
+func asmString(s string) string {
+    var sb strings.Builder
+    sb.WriteByte('"')
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case c == '"' || c == '\\': sb.WriteByte('\\'); sb.WriteByte(c)
+        case c >= ' ' && c <= '~': sb.WriteByte(c)
+        default: fmt.Fprintf(&sb, "\\%03o", c)
+        }
+    }
+    sb.WriteByte('"')
+    return sb.String()
 }
 
 var argRegs = []string{"%rdi", "%rsi", "%rdx", "%rcx", "%r8", "%r9"}
 
-func emitFunc(b *strings.Builder, f *ir.Function) error {
-    fmt.Fprintf(b, ".globl %s\n%s:\n", f.Name, f.Name)
+// emitFunc emits f's code to b, and the jump tables of its switches to
+// tables. local holds the symbols only the module can define.
+func emitFunc(b, tables *strings.Builder, f *ir.Function, opts Options, tgt target, local map[string]bool) error {
+    name := tgt.sym(f.Name)
+    label := func(i int) string { return tgt.sym(blockLabel(f, f.Blocks[i])) }
+    // functions start on a 16-byte boundary, and on ELF carry their type
+    // and size for debuggers, profilers and the linker
+    b.WriteString(".p2align 4\n")
+    if !f.Static { fmt.Fprintf(b, ".globl %s\n", name) }
+    if !tgt.macho { fmt.Fprintf(b, ".type %s, @function\n", name) }
+    fmt.Fprintf(b, "%s:\n", name)
+    // with -g, each instruction is marked with the line it came from when
+    // that changes; the prologue belongs to the function's own line
+    var last ast.Pos
+    loc := func(pos ast.Pos) {
+        if opts.DebugSource == "" || pos.Line == 0 || pos == last { return }
+        fmt.Fprintf(b, "  .loc 1 %d %d\n", pos.Line, pos.Col)
+        last = pos
+    }
+    loc(f.Pos)
     // Prologue
     b.WriteString("  push %rbp\n")
     b.WriteString("  mov %rsp, %rbp\n")
 
-    // Allocate registers (simple linear scan, avoid %rax)
-    alloc := allocateRegisters(f)
-
-    // Assign stack slots for SSA values
-    // Reserve 8 bytes per SSA value id used in function
-    // Find max ID
-    maxID := ir.ValueID(-1)
-    for _, bb := range f.Blocks {
-        for _, ins := range bb.Instrs {
-            if ins.Res > maxID { maxID = ins.Res }
-        }
+    // Allocate registers (avoiding %rax)
+    var alloc allocation
+    switch opts.RegAlloc {
+    case "", "linear": alloc = allocateRegisters(f)
+    case "color": alloc = colorRegisters(f)
+    default: return fmt.Errorf("unknown register allocator %q (known: linear, color)", opts.RegAlloc)
     }
-    // params handled via OpParam results, which also need slots
-    numSlots := int(maxID) + 1
-    frameSize := align(numSlots*8, 16)
-    if frameSize > 0 {
-        fmt.Fprintf(b, "  sub $%d, %%rsp\n", frameSize)
+
+    // Save the callee-saved registers the allocator used, just below %rbp,
+    // then assign stack slots for SSA values and regions for allocas
+    for _, r := range alloc.saved { fmt.Fprintf(b, "  push %s\n", r) }
+    imm := immediateConsts(f)
+    fr := layoutFrame(f, alloc, imm)
+    if opts.Log != nil { writeAllocation(opts.Log, f, opts.RegAlloc, alloc, fr, imm) }
+    if n := fr.size - 8*len(alloc.saved); n > 0 {
+        fmt.Fprintf(b, "  sub $%d, %%rsp\n", n)
     }
 
     // Move params into their home (reg or spill)
@@ -80,78 +218,114 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
             paramIDs = append(paramIDs, ins.Res)
         }
     }
-    for i, id := range paramIDs {
-        if i >= len(argRegs) {
-            return fmt.Errorf("more than 6 integer params not supported")
+    // a param's home may be another param's arg register, so stage them all
+    // on the stack first; params past the sixth are already there, above
+    // the return address
+    nreg := len(paramIDs)
+    if nreg > len(argRegs) { nreg = len(argRegs) }
+    for i := 0; i < nreg; i++ { fmt.Fprintf(b, "  push %s\n", argRegs[i]) }
+    for i := len(paramIDs) - 1; i >= 0; i-- {
+        id := paramIDs[i]
+        if i < nreg {
+            b.WriteString("  pop %rax\n")
+        } else {
+            fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", 16+8*(i-nreg))
+        }
+        // only the low byte of a char argument is defined, so widen it
+        if i < len(f.Params) && f.Params[i].Type.Size() == 1 {
+            if f.Params[i].Type.IsSigned() {
+                b.WriteString("  movsbq %al, %rax\n")
+            } else {
+                b.WriteString("  movzbq %al, %rax\n")
+            }
         }
         if r, ok := alloc.regOf[id]; ok {
-            fmt.Fprintf(b, "  mov %s, %s\n", argRegs[i], r)
+            fmt.Fprintf(b, "  mov %%rax, %s\n", r)
         } else {
-            off := slotOffset(id, frameSize)
-            fmt.Fprintf(b, "  mov %s, %d(%%rbp)\n", argRegs[i], off)
+            off := fr.slot(id)
+            fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
         }
     }
 
-    // Emit body
-    for _, bb := range f.Blocks {
+    // Emit body, in the order of f.Blocks: a jump to the block emitted
+    // next is left out, control falling into it
+    for bi, bb := range f.Blocks {
+        next := func(t int) bool { return t == bi+1 }
         // Labels only for non-entry blocks (not used in phase 1)
         if bb != f.Blocks[0] {
-            fmt.Fprintf(b, "%s: \n", bb.Name)
+            fmt.Fprintf(b, "%s: \n", label(bi))
         }
+        alloc := alloc.in(bb)
+        // an instruction an optimization made without a position, such as
+        // a copy from phi elimination, belongs to the statement of the one
+        // before it in the block, or else of the first one after
+        var pos ast.Pos
         for _, ins := range bb.Instrs {
+            if ins.Pos.Line > 0 { pos = ins.Pos; break }
+        }
+        for i := range bb.Instrs {
+            ins := bb.Instrs[i]
+            if ins.Pos.Line > 0 { pos = ins.Pos }
+            // immediates and allocas have no code to mark
+            if !imm[ins.Res] && ins.Val.Op != ir.OpAlloca { loc(pos) }
             switch ins.Val.Op {
             case ir.OpConst:
+                if imm[ins.Res] { continue }
                 if r, ok := alloc.regOf[ins.Res]; ok {
                     fmt.Fprintf(b, "  mov $%d, %s\n", ins.Val.Const, r)
                 } else {
-                    off := slotOffset(ins.Res, frameSize)
+                    off := fr.slot(ins.Res)
                     fmt.Fprintf(b, "  mov $%d, %%rax\n", ins.Val.Const)
                     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
                 }
             case ir.OpCopy:
                 src := ins.Val.Args[0]
                 if dr, okd := alloc.regOf[ins.Res]; okd {
-                    if sr, oks := alloc.regOf[src]; oks {
-                        fmt.Fprintf(b, "  mov %s, %s\n", sr, dr)
-                    } else if cst, isC := isConst(bb, src); isC {
+                    if cst, isC := isConst(bb, src); isC {
                         fmt.Fprintf(b, "  mov $%d, %s\n", cst, dr)
+                    } else if sr, oks := alloc.regOf[src]; oks {
+                        // coalesced copies share a register
+                        if sr != dr { fmt.Fprintf(b, "  mov %s, %s\n", sr, dr) }
                     } else {
-                        offS := slotOffset(src, frameSize)
+                        offS := fr.slot(src)
                         fmt.Fprintf(b, "  mov %d(%%rbp), %s\n", offS, dr)
                     }
                 } else {
-                    offD := slotOffset(ins.Res, frameSize)
-                    if sr, oks := alloc.regOf[src]; oks {
-                        fmt.Fprintf(b, "  mov %s, %%rax\n", sr)
-                        fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", offD)
-                    } else if cst, isC := isConst(bb, src); isC {
+                    offD := fr.slot(ins.Res)
+                    if cst, isC := isConst(bb, src); isC {
                         fmt.Fprintf(b, "  mov $%d, %%rax\n", cst)
                         fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", offD)
+                    } else if sr, oks := alloc.regOf[src]; oks {
+                        fmt.Fprintf(b, "  mov %s, %%rax\n", sr)
+                        fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", offD)
                     } else {
-                        offS := slotOffset(src, frameSize)
+                        offS := fr.slot(src)
                         fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", offS)
                         fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", offD)
                     }
                 }
             case ir.OpAdd, ir.OpSub, ir.OpMul:
-                emitArith(b, alloc, bb, frameSize, ins)
+                emitArith(b, alloc, bb, fr, ins)
             case ir.OpAnd, ir.OpOr, ir.OpXor:
-                emitBitwise(b, alloc, bb, frameSize, ins)
-            case ir.OpShl, ir.OpShr:
-                emitShift(b, alloc, bb, frameSize, ins)
+                emitBitwise(b, alloc, bb, fr, ins)
+            case ir.OpShl, ir.OpShr, ir.OpUShr:
+                emitShift(b, alloc, bb, fr, ins)
             case ir.OpNot:
-                emitBitwiseNot(b, alloc, bb, frameSize, ins)
+                emitBitwiseNot(b, alloc, bb, fr, ins)
             case ir.OpLogicalNot:
-                emitLogicalNot(b, alloc, bb, frameSize, ins)
-            case ir.OpDiv:
-                // signed division rdx:rax / rcx -> rax (special path)
+                emitLogicalNot(b, alloc, bb, fr, ins)
+            case ir.OpSext, ir.OpZext, ir.OpTrunc:
+                emitExtend(b, alloc, bb, fr, ins)
+            case ir.OpDiv, ir.OpUDiv:
+                // division rdx:rax / rcx -> rax (special path), with the
+                // dividend sign-extended into rdx, or zero-extended if unsigned
                 lhs := ins.Val.Args[0]
                 rhs := ins.Val.Args[1]
                 // load lhs into rax
                 if lr, ok := alloc.regOf[lhs]; ok {
                     fmt.Fprintf(b, "  mov %s, %%rax\n", lr)
                 } else {
-                    offL := slotOffset(lhs, frameSize)
+                    offL := fr.slot(lhs)
                     fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", offL)
                 }
                 // load rhs into rcx
@@ -160,18 +334,23 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
                 } else if rr, ok := alloc.regOf[rhs]; ok {
                     fmt.Fprintf(b, "  mov %s, %%rcx\n", rr)
                 } else {
-                    offR := slotOffset(rhs, frameSize)
+                    offR := fr.slot(rhs)
                     fmt.Fprintf(b, "  mov %d(%%rbp), %%rcx\n", offR)
                 }
-                b.WriteString("  cqo\n")
-                b.WriteString("  idiv %rcx\n")
+                if ins.Val.Op == ir.OpUDiv {
+                    b.WriteString("  xor %edx, %edx\n")
+                    b.WriteString("  div %rcx\n")
+                } else {
+                    b.WriteString("  cqo\n")
+                    b.WriteString("  idiv %rcx\n")
+                }
                 if r, ok := alloc.regOf[ins.Res]; ok {
                     fmt.Fprintf(b, "  mov %%rax, %s\n", r)
                 } else {
-                    off := slotOffset(ins.Res, frameSize)
+                    off := fr.slot(ins.Res)
                     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
                 }
-            case ir.OpEq, ir.OpNe, ir.OpLt, ir.OpLe, ir.OpGt, ir.OpGe:
+            case ir.OpEq, ir.OpNe, ir.OpLt, ir.OpLe, ir.OpGt, ir.OpGe, ir.OpULt, ir.OpULe, ir.OpUGt, ir.OpUGe:
                 // Compute comparison result 0/1
                 // Load lhs into rax, rhs into rcx/immediate
                 lhs := ins.Val.Args[0]
@@ -179,32 +358,33 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
                 if lr, ok := alloc.regOf[lhs]; ok {
                     fmt.Fprintf(b, "  mov %s, %%rax\n", lr)
                 } else {
-                    offL := slotOffset(lhs, frameSize)
+                    offL := fr.slot(lhs)
                     fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", offL)
                 }
-                if cst, isC := isConst(bb, rhs); isC {
+                if cst, isC := isImm32(bb, rhs); isC {
                     fmt.Fprintf(b, "  cmp $%d, %%rax\n", cst)
                 } else if rr, ok := alloc.regOf[rhs]; ok {
                     fmt.Fprintf(b, "  cmp %s, %%rax\n", rr)
                 } else {
-                    offR := slotOffset(rhs, frameSize)
+                    offR := fr.slot(rhs)
                     fmt.Fprintf(b, "  cmp %d(%%rbp), %%rax\n", offR)
                 }
-                cc := map[ir.Op]string{ir.OpEq: "e", ir.OpNe: "ne", ir.OpLt: "l", ir.OpLe: "le", ir.OpGt: "g", ir.OpGe: "ge"}[ins.Val.Op]
-                fmt.Fprintf(b, "  set%s %%al\n", cc)
+                fmt.Fprintf(b, "  set%s %%al\n", condCodes[ins.Val.Op])
                 b.WriteString("  movzx %al, %rax\n")
                 if r, ok := alloc.regOf[ins.Res]; ok {
                     fmt.Fprintf(b, "  mov %%rax, %s\n", r)
                 } else {
-                    off := slotOffset(ins.Res, frameSize)
+                    off := fr.slot(ins.Res)
                     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
                 }
             case ir.OpParam:
                 // already spilled in prologue
+            case ir.OpAlloca:
+                // a region of the frame, which layoutFrame placed
             case ir.OpAddr:
                 // address of SSA slot of arg0 -> dest; ensure base value is materialized to its slot
                 base := ins.Val.Args[0]
-                offBase := slotOffset(base, frameSize)
+                offBase := fr.slot(base)
                 // materialize base to its slot if needed
                 if cst, isC := isConst(bb, base); isC {
                     fmt.Fprintf(b, "  mov $%d, %%rax\n", cst)
@@ -215,26 +395,30 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
                 if r, ok := alloc.regOf[ins.Res]; ok {
                     fmt.Fprintf(b, "  lea %d(%%rbp), %s\n", offBase, r)
                 } else {
-                    off := slotOffset(ins.Res, frameSize)
+                    off := fr.slot(ins.Res)
                     fmt.Fprintf(b, "  lea %d(%%rbp), %%rax\n", offBase)
                     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
                 }
             case ir.OpSlotAddr:
                 base := ins.Val.Args[0]
-                offBase := slotOffset(base, frameSize)
+                offBase := fr.slot(base)
                 if r, ok := alloc.regOf[ins.Res]; ok {
                     fmt.Fprintf(b, "  lea %d(%%rbp), %s\n", offBase, r)
                 } else {
-                    off := slotOffset(ins.Res, frameSize)
+                    off := fr.slot(ins.Res)
                     fmt.Fprintf(b, "  lea %d(%%rbp), %%rax\n", offBase)
                     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
                 }
             case ir.OpGlobalAddr:
+                // the address of a symbol another object may define is in
+                // the GOT under -fpic
+                addr := "  lea %s(%%rip), %s\n"
+                if opts.PIC && !local[ins.Val.Sym] { addr = "  mov %s@GOTPCREL(%%rip), %s\n" }
                 if r, ok := alloc.regOf[ins.Res]; ok {
-                    fmt.Fprintf(b, "  lea %s(%%rip), %s\n", ins.Val.Sym, r)
+                    fmt.Fprintf(b, addr, tgt.sym(ins.Val.Sym), r)
                 } else {
-                    off := slotOffset(ins.Res, frameSize)
-                    fmt.Fprintf(b, "  lea %s(%%rip), %%rax\n", ins.Val.Sym)
+                    off := fr.slot(ins.Res)
+                    fmt.Fprintf(b, addr, tgt.sym(ins.Val.Sym), "%rax")
                     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
                 }
             case ir.OpLoad:
@@ -246,16 +430,34 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
                     // treat as absolute? we don't support immediate addresses
                     fmt.Fprintf(b, "  mov $%d, %%rcx\n", cst)
                 } else {
-                    off := slotOffset(ptr, frameSize)
+                    off := fr.slot(ptr)
                     fmt.Fprintf(b, "  mov %d(%%rbp), %%rcx\n", off)
                 }
                 if r, ok := alloc.regOf[ins.Res]; ok {
                     fmt.Fprintf(b, "  mov (%%rcx), %s\n", r)
                 } else {
-                    off := slotOffset(ins.Res, frameSize)
+                    off := fr.slot(ins.Res)
                     fmt.Fprintf(b, "  mov (%%rcx), %%rax\n")
                     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
                 }
+            case ir.OpLoadIdx:
+                mem := indexedOperand(b, alloc, fr, ins.Val)
+                if r, ok := alloc.regOf[ins.Res]; ok {
+                    fmt.Fprintf(b, "  mov %s, %s\n", mem, r)
+                } else {
+                    fmt.Fprintf(b, "  mov %s, %%rax\n", mem)
+                    fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", fr.slot(ins.Res))
+                }
+            case ir.OpStoreIdx:
+                val := ins.Val.Args[2]
+                if cst, isC := isConst(bb, val); isC {
+                    fmt.Fprintf(b, "  mov $%d, %%rax\n", cst)
+                } else if vr, ok := alloc.regOf[val]; ok {
+                    fmt.Fprintf(b, "  mov %s, %%rax\n", vr)
+                } else {
+                    fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", fr.slot(val))
+                }
+                fmt.Fprintf(b, "  mov %%rax, %s\n", indexedOperand(b, alloc, fr, ins.Val))
             case ir.OpLoad8:
                 ptr := ins.Val.Args[0]
                 if rr, ok := alloc.regOf[ptr]; ok {
@@ -263,13 +465,13 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
                 } else if cst, isC := isConst(bb, ptr); isC {
                     fmt.Fprintf(b, "  mov $%d, %%rcx\n", cst)
                 } else {
-                    off := slotOffset(ptr, frameSize)
+                    off := fr.slot(ptr)
                     fmt.Fprintf(b, "  mov %d(%%rbp), %%rcx\n", off)
                 }
                 if r, ok := alloc.regOf[ins.Res]; ok {
                     fmt.Fprintf(b, "  movzbq (%%rcx), %s\n", r)
                 } else {
-                    off := slotOffset(ins.Res, frameSize)
+                    off := fr.slot(ins.Res)
                     b.WriteString("  movzbq (%rcx), %rax\n")
                     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
                 }
@@ -283,7 +485,7 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
                 } else if cst, isC := isConst(bb, ptr); isC {
                     fmt.Fprintf(b, "  mov $%d, %%rcx\n", cst)
                 } else {
-                    off := slotOffset(ptr, frameSize)
+                    off := fr.slot(ptr)
                     fmt.Fprintf(b, "  mov %d(%%rbp), %%rcx\n", off)
                 }
                 // rax <- val
@@ -292,7 +494,7 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
                 } else if vr, ok := alloc.regOf[val]; ok {
                     fmt.Fprintf(b, "  mov %s, %%rax\n", vr)
                 } else {
-                    off := slotOffset(val, frameSize)
+                    off := fr.slot(val)
                     fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", off)
                 }
                 b.WriteString("  mov %rax, (%rcx)\n")
@@ -304,7 +506,7 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
                 } else if cst, isC := isConst(bb, ptr); isC {
                     fmt.Fprintf(b, "  mov $%d, %%rcx\n", cst)
                 } else {
-                    off := slotOffset(ptr, frameSize)
+                    off := fr.slot(ptr)
                     fmt.Fprintf(b, "  mov %d(%%rbp), %%rcx\n", off)
                 }
                 if cst, isC := isConst(bb, val); isC {
@@ -312,75 +514,152 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
                 } else if vr, ok := alloc.regOf[val]; ok {
                     fmt.Fprintf(b, "  mov %s, %%rax\n", vr)
                 } else {
-                    off := slotOffset(val, frameSize)
+                    off := fr.slot(val)
                     fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", off)
                 }
                 b.WriteString("  movb %al, (%rcx)\n")
-            case ir.OpCall:
-                if len(ins.Val.Args) > len(argRegs) {
-                    return fmt.Errorf("more than 6 integer args not supported")
-                }
-                // move args into registers
-                for i, a := range ins.Val.Args {
-                    if cst, isC := isConst(bb, a); isC {
-                        fmt.Fprintf(b, "  mov $%d, %s\n", cst, argRegs[i])
-                    } else if rr, ok := alloc.regOf[a]; ok {
-                        fmt.Fprintf(b, "  mov %s, %s\n", rr, argRegs[i])
+            case ir.OpCall, ir.OpCallIndirect:
+                // args past the sixth go on the stack, the seventh at the
+                // lowest address; pad first so %rsp is 16-byte aligned at
+                // the call with them pushed
+                // the values live across the call in registers it clobbers
+                // wait in their slots, stored before the args are set up
+                // since those may overwrite them
+                across := alloc.saveAt[&bb.Instrs[i]]
+                for _, id := range across {
+                    fmt.Fprintf(b, "  mov %s, %d(%%rbp)\n", alloc.regOf[id], fr.slot(id))
+                }
+                args := ins.Val.Args
+                if ins.Val.Op == ir.OpCallIndirect { args = args[1:] }
+                nreg := len(args)
+                if nreg > len(argRegs) { nreg = len(argRegs) }
+                stackBytes := 8 * (len(args) - nreg)
+                if stackBytes%16 != 0 {
+                    b.WriteString("  sub $8, %rsp\n")
+                    stackBytes += 8
+                }
+                for i := len(args) - 1; i >= nreg; i-- {
+                    pushArg(b, alloc, bb, fr, args[i])
+                }
+                // an arg may live in another arg's register, and the callee
+                // address in one too, so they all move at once into the arg
+                // registers and %r11, which no arg uses
+                dsts := append([]string(nil), argRegs[:nreg]...)
+                srcs := append([]ir.ValueID(nil), args[:nreg]...)
+                if ins.Val.Op == ir.OpCallIndirect {
+                    dsts = append(dsts, "%r11")
+                    srcs = append(srcs, ins.Val.Args[0])
+                }
+                moveArgs(b, alloc, bb, fr, dsts, srcs)
+                // variadic callees read the number of vector registers used
+                // from %al, and one called through a pointer may be variadic
+                if ins.Val.Const == 1 || ins.Val.Op == ir.OpCallIndirect { b.WriteString("  xor %eax, %eax\n") }
+                if ins.Val.Op == ir.OpCallIndirect {
+                    b.WriteString("  call *%r11\n")
+                } else {
+                    // the Mach-O linker makes a stub for a call into another
+                    // image without being asked
+                    if opts.PIC && !local[ins.Val.Sym] && !tgt.macho {
+                        fmt.Fprintf(b, "  call %s@PLT\n", ins.Val.Sym)
                     } else {
-                        off := slotOffset(a, frameSize)
-                        fmt.Fprintf(b, "  mov %d(%%rbp), %s\n", off, argRegs[i])
+                        fmt.Fprintf(b, "  call %s\n", tgt.sym(ins.Val.Sym))
                     }
                 }
-                // align stack and call
-                b.WriteString("  sub $8, %rsp\n")
-                fmt.Fprintf(b, "  call %s\n", ins.Val.Sym)
-                b.WriteString("  add $8, %rsp\n")
+                if stackBytes > 0 { fmt.Fprintf(b, "  add $%d, %%rsp\n", stackBytes) }
+                for _, id := range across {
+                    fmt.Fprintf(b, "  mov %d(%%rbp), %s\n", fr.slot(id), alloc.regOf[id])
+                }
                 if ins.Res >= 0 {
                     if r, ok := alloc.regOf[ins.Res]; ok {
                         fmt.Fprintf(b, "  mov %%rax, %s\n", r)
                     } else {
-                        off := slotOffset(ins.Res, frameSize)
+                        off := fr.slot(ins.Res)
                         fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
                     }
                 }
             case ir.OpRet:
                 // Arg0 -> rax
                 id := ins.Val.Args[0]
-                if r, ok := alloc.regOf[id]; ok {
+                if cst, isC := isConst(bb, id); isC {
+                    fmt.Fprintf(b, "  mov $%d, %%rax\n", cst)
+                } else if r, ok := alloc.regOf[id]; ok {
                     fmt.Fprintf(b, "  mov %s, %%rax\n", r)
                 } else {
-                    off := slotOffset(id, frameSize)
+                    off := fr.slot(id)
                     fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", off)
                 }
-                // Epilogue
-                if frameSize > 0 {
-                    fmt.Fprintf(b, "  add $%d, %%rsp\n", frameSize)
-                }
-                b.WriteString("  pop %rbp\n")
-                b.WriteString("  ret\n")
+                emitEpilogue(b, alloc, fr)
             case ir.OpJmp:
+                // a jump into a loop loads the values split into registers
+                // for it
+                for _, r := range alloc.reloadAt[bb] {
+                    fmt.Fprintf(b, "  mov %d(%%rbp), %s\n", fr.slot(r.id), r.reg)
+                }
                 t := int(ins.Val.Args[0])
-                if t >= 0 && t < len(f.Blocks) {
-                    fmt.Fprintf(b, "  jmp %s\n", f.Blocks[t].Name)
+                if t >= 0 && t < len(f.Blocks) && !next(t) {
+                    fmt.Fprintf(b, "  jmp %s\n", label(t))
                 }
             case ir.OpJnz:
                 cond := ins.Val.Args[0]
                 if r, ok := alloc.regOf[cond]; ok {
                     fmt.Fprintf(b, "  test %s, %s\n", r, r)
                 } else {
-                    off := slotOffset(cond, frameSize)
-                    fmt.Fprintf(b, "  cmp $0, %d(%%rbp)\n", off)
+                    off := fr.slot(cond)
+                    fmt.Fprintf(b, "  cmpq $0, %d(%%rbp)\n", off)
+                }
+                emitBranch(b, label, "ne", "e", int(ins.Val.Args[1]), int(ins.Val.Args[2]), next)
+            case ir.OpBr:
+                // compare and branch without materializing the condition,
+                // lhs compared where it is when that is a register
+                lhs, rhs := ins.Val.Args[0], ins.Val.Args[1]
+                lr, ok := alloc.regOf[lhs]
+                if !ok {
+                    fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", fr.slot(lhs))
+                    lr = "%rax"
+                }
+                if cst, isC := isImm32(bb, rhs); isC {
+                    fmt.Fprintf(b, "  cmp $%d, %s\n", cst, lr)
+                } else if rr, ok := alloc.regOf[rhs]; ok {
+                    fmt.Fprintf(b, "  cmp %s, %s\n", rr, lr)
+                } else {
+                    fmt.Fprintf(b, "  cmp %d(%%rbp), %s\n", fr.slot(rhs), lr)
+                }
+                op := ir.Op(ins.Val.Const)
+                emitBranch(b, label, condCodes[op], negCondCodes[op], int(ins.Val.Args[2]), int(ins.Val.Args[3]), next)
+            case ir.OpSwitchTable:
+                // rax = value - low, which as unsigned is in the table's range
+                // only for the values it has entries for: one comparison
+                x := ins.Val.Args[0]
+                if r, ok := alloc.regOf[x]; ok {
+                    fmt.Fprintf(b, "  mov %s, %%rax\n", r)
+                } else {
+                    fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", fr.slot(x))
+                }
+                if ins.Val.Const != 0 { fmt.Fprintf(b, "  sub $%d, %%rax\n", ins.Val.Const) }
+                entries := ins.Val.Args[2:]
+                fmt.Fprintf(b, "  cmp $%d, %%rax\n", len(entries))
+                fmt.Fprintf(b, "  jae %s\n", label(int(ins.Val.Args[1])))
+                table := label(bi) + ".table"
+                fmt.Fprintf(b, "  lea %s(%%rip), %%rcx\n", table)
+                if opts.PIC {
+                    // under -fpic the entries are offsets from the table,
+                    // which the dynamic linker has nothing to relocate in
+                    b.WriteString("  movslq (%rcx,%rax,4), %rax\n")
+                    b.WriteString("  add %rcx, %rax\n")
+                    b.WriteString("  jmp *%rax\n")
+                    fmt.Fprintf(tables, "  .balign 4\n%s:\n", table)
+                    for _, t := range entries { fmt.Fprintf(tables, "  .long %s-%s\n", label(int(t)), table) }
+                } else {
+                    b.WriteString("  jmp *(%rcx,%rax,8)\n")
+                    fmt.Fprintf(tables, "  .balign 8\n%s:\n", table)
+                    for _, t := range entries { fmt.Fprintf(tables, "  .quad %s\n", label(int(t))) }
                 }
-                ti := int(ins.Val.Args[1])
-                fi := int(ins.Val.Args[2])
-                if ti >= 0 && ti < len(f.Blocks) { fmt.Fprintf(b, "  jne %s\n", f.Blocks[ti].Name) }
-                if fi >= 0 && fi < len(f.Blocks) { fmt.Fprintf(b, "  jmp %s\n", f.Blocks[fi].Name) }
             case ir.OpFConst:
                 // Float constant - for now, just store the bits (not used directly)
                 if r, ok := alloc.regOf[ins.Res]; ok {
                     fmt.Fprintf(b, "  mov $%d, %s\n", ins.Val.Const, r)
                 } else {
-                    off := slotOffset(ins.Res, frameSize)
+                    off := fr.slot(ins.Res)
                     fmt.Fprintf(b, "  mov $%d, %%rax\n", ins.Val.Const)
                     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
                 }
@@ -391,14 +670,12 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
                 // After optimization, the source should be a float constant (OpFConst)
                 if srcInstr, ok := findInstr(bb, src); ok && srcInstr.Val.Op == ir.OpFConst {
                     // Convert float constant to integer at compile time
-                    bits := uint64(srcInstr.Val.Const)
-                    floatVal := *(*float64)(unsafe.Pointer(&bits))
-                    intVal := int64(floatVal)
+                    intVal := int64(math.Float64frombits(uint64(srcInstr.Val.Const)))
                     
                     if r, ok := alloc.regOf[ins.Res]; ok {
                         fmt.Fprintf(b, "  mov $%d, %s\n", intVal, r)
                     } else {
-                        off := slotOffset(ins.Res, frameSize)
+                        off := fr.slot(ins.Res)
                         fmt.Fprintf(b, "  mov $%d, %%rax\n", intVal)
                         fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
                     }
@@ -413,34 +690,153 @@ func emitFunc(b *strings.Builder, f *ir.Function) error {
                 // They should have been replaced with OpFConst
                 return fmt.Errorf("floating point arithmetic operations should have been constant-folded")
             default:
-                // ignore
+                // dropping an instruction would leave its result garbage
+                return fmt.Errorf("%s: cannot emit %s (%s)", f.Name, ins.Val.Op, ins.Res)
             }
         }
+        // a block with no terminator falls off the end of the function,
+        // which the builder warned about, and returns 0 there; one with
+        // successors always ends in a jump, so no block falls into the next
+        if !bb.Terminated() {
+            b.WriteString("  mov $0, %eax\n")
+            emitEpilogue(b, alloc, fr)
+        }
     }
+    if !tgt.macho { fmt.Fprintf(b, ".size %s, .-%s\n", name, name) }
+    return nil
+}
 
-    // In case no return found, emit default 0
-    // This keeps assembler happy for empty functions
-    b.WriteString("  mov $0, %eax\n")
-    if frameSize > 0 {
-        fmt.Fprintf(b, "  add $%d, %%rsp\n", frameSize)
+// emitEpilogue frees the frame, restores the callee-saved registers the
+// prologue saved and returns.
+func emitEpilogue(b *strings.Builder, alloc allocation, fr *frame) {
+    if n := fr.size - 8*len(alloc.saved); n > 0 {
+        fmt.Fprintf(b, "  add $%d, %%rsp\n", n)
     }
+    for i := len(alloc.saved) - 1; i >= 0; i-- { fmt.Fprintf(b, "  pop %s\n", alloc.saved[i]) }
     b.WriteString("  pop %rbp\n")
     b.WriteString("  ret\n")
+}
 
-    return nil
+// indexedOperand returns the memory operand of an OpLoadIdx or OpStoreIdx,
+// disp(base,index,scale). Whichever of base and index is not in a register
+// is loaded into %rcx; when neither is, %rcx gets the whole address but the
+// displacement.
+func indexedOperand(b *strings.Builder, alloc allocation, fr *frame, v ir.Value) string {
+    disp := ""
+    if v.Const != 0 { disp = fmt.Sprintf("%d", v.Const) }
+    base, bok := alloc.regOf[v.Args[0]]
+    index, iok := alloc.regOf[v.Args[1]]
+    switch {
+    case bok && iok:
+    case bok:
+        fmt.Fprintf(b, "  mov %d(%%rbp), %%rcx\n", fr.slot(v.Args[1]))
+        index = "%rcx"
+    case iok:
+        fmt.Fprintf(b, "  mov %d(%%rbp), %%rcx\n", fr.slot(v.Args[0]))
+        base = "%rcx"
+    default:
+        fmt.Fprintf(b, "  mov %d(%%rbp), %%rcx\n", fr.slot(v.Args[1]))
+        for s := v.Scale; s > 1; s >>= 1 { b.WriteString("  add %rcx, %rcx\n") }
+        fmt.Fprintf(b, "  add %d(%%rbp), %%rcx\n", fr.slot(v.Args[0]))
+        return disp + "(%rcx)"
+    }
+    return fmt.Sprintf("%s(%s,%s,%d)", disp, base, index, v.Scale)
+}
+
+// blockLabel returns an assembler-local label for bb. Block names are only
+// unique within a function, so the function name is folded in.
+func blockLabel(f *ir.Function, bb *ir.BasicBlock) string { return ".L" + f.Name + "." + bb.Name }
+
+// frame is the stack layout of a function: the saved callee-saved
+// registers, then an 8-byte slot for each value that lives in memory, and a
+// region for each alloca, at negative offsets from %rbp. size covers them
+// all.
+type frame struct {
+    size int
+    off  map[ir.ValueID]int
 }
 
-func slotOffset(id ir.ValueID, frameSize int) int {
-    // Layout: rbp is base, we place slots at negative offsets.
-    // We'll assign offset = - (8*(id+1))
-    off := -8 * (int(id) + 1)
-    // Ensure within allocated frame (debug safety)
-    _ = frameSize
+// layoutFrame gives slots, below the saved registers, only to the values
+// that need memory: those alloc left without a register, bar the constants
+// only ever taken as immediates, and those it stores around calls. The
+// rest, and ids freed by the optimizer, cost nothing. An alloca's offset is the lowest address of its region, which
+// extends upward.
+func layoutFrame(f *ir.Function, alloc allocation, imm map[ir.ValueID]bool) *frame {
+    fr := &frame{off: map[ir.ValueID]int{}}
+    used := 8 * len(alloc.saved)
+    place := func(id ir.ValueID, bytes int) {
+        if _, ok := fr.off[id]; ok { return }
+        used += align(bytes, 8)
+        fr.off[id] = -used
+    }
+    for _, bb := range f.Blocks {
+        for _, ins := range bb.Instrs {
+            if ins.Val.Op == ir.OpAlloca { place(ins.Res, int(ins.Val.Const)) }
+        }
+    }
+    memory := func(id ir.ValueID) {
+        if _, ok := alloc.regOf[id]; !ok && !imm[id] { place(id, 8) }
+    }
+    for _, bb := range f.Blocks {
+        for i := range bb.Instrs {
+            ins := &bb.Instrs[i]
+            // stores and terminators have ids but no value to keep
+            switch ins.Val.Op {
+            case ir.OpStore, ir.OpStore8, ir.OpStoreIdx, ir.OpRet, ir.OpJmp, ir.OpJnz, ir.OpBr, ir.OpSwitchTable:
+            default:
+                if ins.Res >= 0 { memory(ins.Res) }
+            }
+            for _, a := range valueArgs(ins) { memory(a) }
+            for _, id := range alloc.saveAt[ins] { place(id, 8) }
+        }
+    }
+    fr.size = align(used, 16)
+    return fr
+}
+
+// slot returns the offset of id's slot. Asking for one id was not given
+// is a bug in the emitter, which would otherwise read the saved %rbp.
+func (fr *frame) slot(id ir.ValueID) int {
+    off, ok := fr.off[id]
+    if !ok { panic(fmt.Sprintf("no stack slot for %s", id)) }
     return off
 }
 
 func align(n, a int) int { return (n + (a-1)) &^ (a - 1) }
 
+// immediateConsts finds the constants whose every use is in their own block
+// and takes them as an immediate (returns, copies, call arguments, shift
+// counts and the right side of a compare-and-branch that fits 32 bits), so
+// they need not be materialized at all.
+func immediateConsts(f *ir.Function) map[ir.ValueID]bool {
+    home := map[ir.ValueID]*ir.BasicBlock{}
+    for _, bb := range f.Blocks {
+        for _, ins := range bb.Instrs {
+            if ins.Val.Op == ir.OpConst { home[ins.Res] = bb }
+        }
+    }
+    imm := map[ir.ValueID]bool{}
+    for id := range home { imm[id] = true }
+    for _, bb := range f.Blocks {
+        for i := range bb.Instrs {
+            ins := &bb.Instrs[i]
+            for j, a := range valueArgs(ins) {
+                if home[a] == nil { continue }
+                switch ins.Val.Op {
+                case ir.OpRet, ir.OpCopy, ir.OpCall, ir.OpCallIndirect:
+                    if home[a] == bb { continue }
+                case ir.OpShl, ir.OpShr, ir.OpUShr:
+                    if j == 1 && home[a] == bb { continue }
+                case ir.OpBr:
+                    if _, ok := isImm32(bb, a); j == 1 && ok { continue }
+                }
+                imm[a] = false
+            }
+        }
+    }
+    return imm
+}
+
 func isConst(bb *ir.BasicBlock, id ir.ValueID) (int64, bool) {
     if bb == nil { return 0, false }
     for _, ins := range bb.Instrs {
@@ -449,26 +845,44 @@ func isConst(bb *ir.BasicBlock, id ir.ValueID) (int64, bool) {
     return 0, false
 }
 
-func emitArith(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, frameSize int, ins ir.Instr) {
+// isImm32 reports whether id is a constant of bb that fits the sign-extended
+// 32-bit immediate of an arithmetic or compare instruction.
+func isImm32(bb *ir.BasicBlock, id ir.ValueID) (int64, bool) {
+    cst, ok := isConst(bb, id)
+    return cst, ok && cst == int64(int32(cst))
+}
+
+func emitArith(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fr *frame, ins ir.Instr) {
     destReg, hasDestReg := alloc.regOf[ins.Res]
     lhs := ins.Val.Args[0]
     rhs := ins.Val.Args[1]
+    // imul by an immediate has three operands: it reads lhs from its
+    // register or slot and writes the product straight to a register
+    if cst, isC := isImm32(bb, rhs); isC && ins.Val.Op == ir.OpMul {
+        src, ok := alloc.regOf[lhs]
+        if !ok { src = fmt.Sprintf("%d(%%rbp)", fr.slot(lhs)) }
+        if hasDestReg {
+            fmt.Fprintf(b, "  imul $%d, %s, %s\n", cst, src, destReg)
+        } else {
+            fmt.Fprintf(b, "  imul $%d, %s, %%rax\n", cst, src)
+            fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", fr.slot(ins.Res))
+        }
+        return
+    }
     if hasDestReg {
         if lr, ok := alloc.regOf[lhs]; ok {
             if lr != destReg { fmt.Fprintf(b, "  mov %s, %s\n", lr, destReg) }
         } else {
-            offL := slotOffset(lhs, frameSize)
+            offL := fr.slot(lhs)
             fmt.Fprintf(b, "  mov %d(%%rbp), %s\n", offL, destReg)
         }
         // rhs
-        if cst, isC := isConst(bb, rhs); isC {
+        if cst, isC := isImm32(bb, rhs); isC {
             switch ins.Val.Op {
             case ir.OpAdd:
                 fmt.Fprintf(b, "  add $%d, %s\n", cst, destReg)
             case ir.OpSub:
                 fmt.Fprintf(b, "  sub $%d, %s\n", cst, destReg)
-            case ir.OpMul:
-                fmt.Fprintf(b, "  imul $%d, %s\n", cst, destReg)
             }
         } else if rr, ok := alloc.regOf[rhs]; ok {
             switch ins.Val.Op {
@@ -480,7 +894,7 @@ func emitArith(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, frameSiz
                 fmt.Fprintf(b, "  imul %s, %s\n", rr, destReg)
             }
         } else {
-            offR := slotOffset(rhs, frameSize)
+            offR := fr.slot(rhs)
             switch ins.Val.Op {
             case ir.OpAdd:
                 fmt.Fprintf(b, "  add %d(%%rbp), %s\n", offR, destReg)
@@ -493,21 +907,19 @@ func emitArith(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, frameSiz
         return
     }
     // Spilled destination: use %rax as temp
-    offDest := slotOffset(ins.Res, frameSize)
+    offDest := fr.slot(ins.Res)
     if lr, ok := alloc.regOf[lhs]; ok {
         fmt.Fprintf(b, "  mov %s, %%rax\n", lr)
     } else {
-        offL := slotOffset(lhs, frameSize)
+        offL := fr.slot(lhs)
         fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", offL)
     }
-    if cst, isC := isConst(bb, rhs); isC {
+    if cst, isC := isImm32(bb, rhs); isC {
         switch ins.Val.Op {
         case ir.OpAdd:
             fmt.Fprintf(b, "  add $%d, %%rax\n", cst)
         case ir.OpSub:
             fmt.Fprintf(b, "  sub $%d, %%rax\n", cst)
-        case ir.OpMul:
-            fmt.Fprintf(b, "  imul $%d, %%rax\n", cst)
         }
     } else if rr, ok := alloc.regOf[rhs]; ok {
         switch ins.Val.Op {
@@ -519,7 +931,7 @@ func emitArith(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, frameSiz
             fmt.Fprintf(b, "  imul %s, %%rax\n", rr)
         }
     } else {
-        offR := slotOffset(rhs, frameSize)
+        offR := fr.slot(rhs)
         switch ins.Val.Op {
         case ir.OpAdd:
             fmt.Fprintf(b, "  add %d(%%rbp), %%rax\n", offR)
@@ -532,7 +944,7 @@ func emitArith(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, frameSiz
     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", offDest)
 }
 
-func emitBitwise(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, frameSize int, ins ir.Instr) {
+func emitBitwise(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fr *frame, ins ir.Instr) {
     destReg, hasDestReg := alloc.regOf[ins.Res]
     lhs := ins.Val.Args[0]
     rhs := ins.Val.Args[1]
@@ -541,100 +953,92 @@ func emitBitwise(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, frameS
         if lr, ok := alloc.regOf[lhs]; ok {
             if lr != destReg { fmt.Fprintf(b, "  mov %s, %s\n", lr, destReg) }
         } else {
-            offL := slotOffset(lhs, frameSize)
+            offL := fr.slot(lhs)
             fmt.Fprintf(b, "  mov %d(%%rbp), %s\n", offL, destReg)
         }
-        if cst, isC := isConst(bb, rhs); isC {
+        if cst, isC := isImm32(bb, rhs); isC {
             fmt.Fprintf(b, "  %s $%d, %s\n", opInstr, cst, destReg)
         } else if rr, ok := alloc.regOf[rhs]; ok {
             fmt.Fprintf(b, "  %s %s, %s\n", opInstr, rr, destReg)
         } else {
-            offR := slotOffset(rhs, frameSize)
+            offR := fr.slot(rhs)
             fmt.Fprintf(b, "  %s %d(%%rbp), %s\n", opInstr, offR, destReg)
         }
         return
     }
-    offDest := slotOffset(ins.Res, frameSize)
+    offDest := fr.slot(ins.Res)
     if lr, ok := alloc.regOf[lhs]; ok {
         fmt.Fprintf(b, "  mov %s, %%rax\n", lr)
     } else {
-        offL := slotOffset(lhs, frameSize)
+        offL := fr.slot(lhs)
         fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", offL)
     }
-    if cst, isC := isConst(bb, rhs); isC {
+    if cst, isC := isImm32(bb, rhs); isC {
         fmt.Fprintf(b, "  %s $%d, %%rax\n", opInstr, cst)
     } else if rr, ok := alloc.regOf[rhs]; ok {
         fmt.Fprintf(b, "  %s %s, %%rax\n", opInstr, rr)
     } else {
-        offR := slotOffset(rhs, frameSize)
+        offR := fr.slot(rhs)
         fmt.Fprintf(b, "  %s %d(%%rbp), %%rax\n", opInstr, offR)
     }
     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", offDest)
 }
 
-func emitShift(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, frameSize int, ins ir.Instr) {
+// shiftInsn maps the shift ops to their instructions: a signed right shift
+// is arithmetic and an unsigned one logical.
+var shiftInsn = map[ir.Op]string{ir.OpShl: "shl", ir.OpShr: "sar", ir.OpUShr: "shr"}
+
+func emitShift(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fr *frame, ins ir.Instr) {
     destReg, hasDestReg := alloc.regOf[ins.Res]
     lhs := ins.Val.Args[0]
     rhs := ins.Val.Args[1]
     if hasDestReg {
+        cst, isC := isConst(bb, rhs)
+        if !isC {
+            // load count into cl first: the destination may be the
+            // count's register
+            if rr, ok := alloc.regOf[rhs]; ok {
+                fmt.Fprintf(b, "  mov %s, %%rcx\n", rr)
+            } else {
+                offR := fr.slot(rhs)
+                fmt.Fprintf(b, "  mov %d(%%rbp), %%rcx\n", offR)
+            }
+        }
         if lr, ok := alloc.regOf[lhs]; ok {
             if lr != destReg { fmt.Fprintf(b, "  mov %s, %s\n", lr, destReg) }
         } else {
-            offL := slotOffset(lhs, frameSize)
+            offL := fr.slot(lhs)
             fmt.Fprintf(b, "  mov %d(%%rbp), %s\n", offL, destReg)
         }
-        if cst, isC := isConst(bb, rhs); isC {
-            if ins.Val.Op == ir.OpShl {
-                fmt.Fprintf(b, "  shl $%d, %s\n", cst, destReg)
-            } else {
-                fmt.Fprintf(b, "  sar $%d, %s\n", cst, destReg)
-            }
+        if isC {
+            fmt.Fprintf(b, "  %s $%d, %s\n", shiftInsn[ins.Val.Op], cst, destReg)
         } else {
-            // load count into cl
-            if rr, ok := alloc.regOf[rhs]; ok {
-                fmt.Fprintf(b, "  mov %s, %%rcx\n", rr)
-            } else {
-                offR := slotOffset(rhs, frameSize)
-                fmt.Fprintf(b, "  mov %d(%%rbp), %%rcx\n", offR)
-            }
-            if ins.Val.Op == ir.OpShl {
-                b.WriteString("  shl %cl, " + destReg + "\n")
-            } else {
-                b.WriteString("  sar %cl, " + destReg + "\n")
-            }
+            fmt.Fprintf(b, "  %s %%cl, %s\n", shiftInsn[ins.Val.Op], destReg)
         }
         return
     }
-    offDest := slotOffset(ins.Res, frameSize)
+    offDest := fr.slot(ins.Res)
     if lr, ok := alloc.regOf[lhs]; ok {
         fmt.Fprintf(b, "  mov %s, %%rax\n", lr)
     } else {
-        offL := slotOffset(lhs, frameSize)
+        offL := fr.slot(lhs)
         fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", offL)
     }
     if cst, isC := isConst(bb, rhs); isC {
-        if ins.Val.Op == ir.OpShl {
-            fmt.Fprintf(b, "  shl $%d, %%rax\n", cst)
-        } else {
-            fmt.Fprintf(b, "  sar $%d, %%rax\n", cst)
-        }
+        fmt.Fprintf(b, "  %s $%d, %%rax\n", shiftInsn[ins.Val.Op], cst)
     } else {
         if rr, ok := alloc.regOf[rhs]; ok {
             fmt.Fprintf(b, "  mov %s, %%rcx\n", rr)
         } else {
-            offR := slotOffset(rhs, frameSize)
+            offR := fr.slot(rhs)
             fmt.Fprintf(b, "  mov %d(%%rbp), %%rcx\n", offR)
         }
-        if ins.Val.Op == ir.OpShl {
-            b.WriteString("  shl %cl, %rax\n")
-        } else {
-            b.WriteString("  sar %cl, %rax\n")
-        }
+        fmt.Fprintf(b, "  %s %%cl, %%rax\n", shiftInsn[ins.Val.Op])
     }
     fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", offDest)
 }
 
-func emitBitwiseNot(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, frameSize int, ins ir.Instr) {
+func emitBitwiseNot(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fr *frame, ins ir.Instr) {
     // Bitwise NOT: ~x - invert all bits
     src := ins.Val.Args[0]
     
@@ -644,7 +1048,7 @@ func emitBitwiseNot(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fra
     } else if r, ok := alloc.regOf[src]; ok {
         fmt.Fprintf(b, "  mov %s, %%rax\n", r)
     } else {
-        off := slotOffset(src, frameSize)
+        off := fr.slot(src)
         fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", off)
     }
     
@@ -655,12 +1059,121 @@ func emitBitwiseNot(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fra
     if r, ok := alloc.regOf[ins.Res]; ok {
         fmt.Fprintf(b, "  mov %%rax, %s\n", r)
     } else {
-        off := slotOffset(ins.Res, frameSize)
+        off := fr.slot(ins.Res)
         fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
     }
 }
 
-func emitLogicalNot(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, frameSize int, ins ir.Instr) {
+// condCodes maps the comparison ops to x86 condition code suffixes.
+var condCodes = map[ir.Op]string{ir.OpEq: "e", ir.OpNe: "ne", ir.OpLt: "l", ir.OpLe: "le", ir.OpGt: "g", ir.OpGe: "ge",
+    ir.OpULt: "b", ir.OpULe: "be", ir.OpUGt: "a", ir.OpUGe: "ae"}
+
+// negCondCodes maps them to the suffix of the opposite comparison.
+var negCondCodes = map[ir.Op]string{ir.OpEq: "ne", ir.OpNe: "e", ir.OpLt: "ge", ir.OpLe: "g", ir.OpGt: "le", ir.OpGe: "l",
+    ir.OpULt: "ae", ir.OpULe: "a", ir.OpUGt: "be", ir.OpUGe: "b"}
+
+// emitBranch jumps to block ti if the flags meet cc, and to fi otherwise,
+// whose opposite is neg; label names a block. When ti is the block emitted
+// next, the jump goes to fi on neg instead, and a jump to the next block is
+// left out.
+func emitBranch(b *strings.Builder, label func(int) string, cc, neg string, ti, fi int, next func(int) bool) {
+    if next(ti) {
+        if !next(fi) { fmt.Fprintf(b, "  j%s %s\n", neg, label(fi)) }
+        return
+    }
+    fmt.Fprintf(b, "  j%s %s\n", cc, label(ti))
+    if !next(fi) { fmt.Fprintf(b, "  jmp %s\n", label(fi)) }
+}
+
+// extendInsn maps a width in bits to the sign- and zero-extending moves of
+// %rax onto itself.
+var extendInsn = map[int64][2]string{
+    8:  {"movsbq %al, %rax", "movzbq %al, %rax"},
+    16: {"movswq %ax, %rax", "movzwq %ax, %rax"},
+    32: {"movslq %eax, %rax", "mov %eax, %eax"},
+}
+
+// pushArg pushes the value a for a call.
+func pushArg(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fr *frame, a ir.ValueID) {
+    if cst, isC := isConst(bb, a); isC {
+        if cst == int64(int32(cst)) {
+            fmt.Fprintf(b, "  push $%d\n", cst)
+        } else {
+            fmt.Fprintf(b, "  mov $%d, %%rax\n  push %%rax\n", cst)
+        }
+    } else if rr, ok := alloc.regOf[a]; ok {
+        fmt.Fprintf(b, "  push %s\n", rr)
+    } else {
+        fmt.Fprintf(b, "  pushq %d(%%rbp)\n", fr.slot(a))
+    }
+}
+
+// moveArgs puts each of srcs into the register of dsts at the same index, as
+// if all at once. A register is written once no pending move still reads it;
+// a cycle, such as %rdi and %rsi swapping, is broken by saving one register
+// in %rax first. Constants and values in memory read no register, so they
+// are loaded last.
+func moveArgs(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fr *frame, dsts []string, srcs []ir.ValueID) {
+    type move struct{ dst, src string }
+    var pending []move
+    for i, a := range srcs {
+        if _, isC := isConst(bb, a); isC { continue }
+        if r, ok := alloc.regOf[a]; ok && r != dsts[i] { pending = append(pending, move{dsts[i], r}) }
+    }
+    for len(pending) > 0 {
+        emitted := false
+        for i, m := range pending {
+            read := false
+            for j, o := range pending {
+                if j != i && o.src == m.dst { read = true }
+            }
+            if read { continue }
+            fmt.Fprintf(b, "  mov %s, %s\n", m.src, m.dst)
+            pending = append(pending[:i], pending[i+1:]...)
+            emitted = true
+            break
+        }
+        if emitted { continue }
+        // every destination is still read: save the first one's old value
+        saved := pending[0].dst
+        fmt.Fprintf(b, "  mov %s, %%rax\n", saved)
+        for j := range pending {
+            if pending[j].src == saved { pending[j].src = "%rax" }
+        }
+    }
+    for i, a := range srcs {
+        if cst, isC := isConst(bb, a); isC {
+            fmt.Fprintf(b, "  mov $%d, %s\n", cst, dsts[i])
+        } else if _, ok := alloc.regOf[a]; !ok {
+            fmt.Fprintf(b, "  mov %d(%%rbp), %s\n", fr.slot(a), dsts[i])
+        }
+    }
+}
+
+func emitExtend(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fr *frame, ins ir.Instr) {
+    src := ins.Val.Args[0]
+    if cst, isC := isConst(bb, src); isC {
+        fmt.Fprintf(b, "  mov $%d, %%rax\n", cst)
+    } else if r, ok := alloc.regOf[src]; ok {
+        fmt.Fprintf(b, "  mov %s, %%rax\n", r)
+    } else {
+        fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", fr.slot(src))
+    }
+    // truncating leaves the low bits zero-extended, like zext
+    insn := extendInsn[ins.Val.Const]
+    if ins.Val.Op == ir.OpSext {
+        fmt.Fprintf(b, "  %s\n", insn[0])
+    } else {
+        fmt.Fprintf(b, "  %s\n", insn[1])
+    }
+    if r, ok := alloc.regOf[ins.Res]; ok {
+        fmt.Fprintf(b, "  mov %%rax, %s\n", r)
+    } else {
+        fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", fr.slot(ins.Res))
+    }
+}
+
+func emitLogicalNot(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fr *frame, ins ir.Instr) {
     // Logical NOT: !x - convert 0 to 1, non-zero to 0
     src := ins.Val.Args[0]
     
@@ -670,7 +1183,7 @@ func emitLogicalNot(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fra
     } else if r, ok := alloc.regOf[src]; ok {
         fmt.Fprintf(b, "  mov %s, %%rax\n", r)
     } else {
-        off := slotOffset(src, frameSize)
+        off := fr.slot(src)
         fmt.Fprintf(b, "  mov %d(%%rbp), %%rax\n", off)
     }
     
@@ -683,7 +1196,7 @@ func emitLogicalNot(b *strings.Builder, alloc allocation, bb *ir.BasicBlock, fra
     if r, ok := alloc.regOf[ins.Res]; ok {
         fmt.Fprintf(b, "  mov %%rax, %s\n", r)
     } else {
-        off := slotOffset(ins.Res, frameSize)
+        off := fr.slot(ins.Res)
         fmt.Fprintf(b, "  mov %%rax, %d(%%rbp)\n", off)
     }
 }
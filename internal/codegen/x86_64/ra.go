@@ -9,25 +9,78 @@ import (
 // Avoids using %rax so division and return can use it freely.
 
 // Reserve %rcx for emitter scratch (loads/stores, shifts), so exclude it here.
-// Call-preserved registers: %rbx, %r12-r15 (we don't use these for simplicity)
 // Call-clobbered registers: %rdx, %r8-r11, %rsi, %rdi (we use these)
 var allocableRegs = []string{"%rdx", "%r8", "%r9", "%r10", "%r11", "%rsi", "%rdi"}
 
+// Call-preserved registers: a function must save one before using it, but a
+// value in one survives the calls it makes.
+var calleeSavedRegs = []string{"%rbx", "%r12", "%r13", "%r14", "%r15"}
+
 // Call-clobbered registers that need to be saved/restored around calls
+// holding values live across them
 var callClobberedRegs = map[string]bool{
     "%rdx": true, "%r8": true, "%r9": true, "%r10": true, "%r11": true, 
     "%rsi": true, "%rdi": true,
 }
 
+// clobbers lists the registers the code for an op overwrites besides its
+// result, which a value live across it must not be in: idiv and div take
+// their dividend in %rdx:%rax and leave the remainder in %rdx, and a
+// variable shift takes its count in %cl.
+var clobbers = map[ir.Op][]string{
+    ir.OpDiv: {"%rdx"},
+    ir.OpUDiv: {"%rdx"},
+    ir.OpShl: {"%rcx"},
+    ir.OpShr: {"%rcx"},
+    ir.OpUShr: {"%rcx"},
+}
+
 type allocation struct {
     regOf map[ir.ValueID]string
+    saved []string // the callee-saved registers used, for the prologue to save
+    // the values in caller-saved registers live across each call, for the
+    // emitter to save to their slots before it and restore after
+    saveAt map[*ir.Instr][]ir.ValueID
+    // values left in memory but split into a register for a loop: the
+    // register each has in the blocks of the loop, and the loads into it at
+    // the end of the blocks jumping into the loop
+    inLoop   map[*ir.BasicBlock]map[ir.ValueID]string
+    reloadAt map[*ir.BasicBlock][]reload
+}
+
+// reload loads a value split into a register for a loop from its slot.
+type reload struct {
+    id  ir.ValueID
+    reg string
+}
+
+// in returns the allocation as the code of bb sees it, with the values
+// split into registers for a loop holding bb in them.
+func (a allocation) in(bb *ir.BasicBlock) allocation {
+    split := a.inLoop[bb]
+    if len(split) == 0 { return a }
+    regOf := make(map[ir.ValueID]string, len(a.regOf)+len(split))
+    for id, reg := range a.regOf { regOf[id] = reg }
+    for id, reg := range split { regOf[id] = reg }
+    a.regOf = regOf
+    return a
 }
 
 type liveInterval struct {
     id    ir.ValueID
     start int
     end   int
-    spill bool  // true if this interval should be spilled
+    crossesCall bool // live across a call, so a callee-saved register is best
+    avoid map[string]bool // registers clobbered while it is live
+    liveIn bool // starts at a block it is live into, rather than its definition
+}
+
+// spans reports whether the value of iv is live across the instruction at n.
+// The instruction at its start is the one that defines it, unless it starts
+// live into the block that instruction begins.
+func (iv liveInterval) spans(n int) bool {
+    if iv.liveIn { return n >= iv.start && n < iv.end }
+    return n > iv.start && n < iv.end
 }
 
 func allocateRegisters(f *ir.Function) allocation {
@@ -48,12 +101,16 @@ func allocateRegisters(f *ir.Function) allocation {
         return allocation{regOf: map[ir.ValueID]string{}}
     }
 
-    // Find all calls for later clobber handling
-    var callInstrNums []int
+    // Find all calls for later clobber handling, and the instructions that
+    // clobber fixed registers
+    var callInstrNums, clobberInstrNums []int
     for _, ins := range allInstrs {
-        if ins.Val.Op == ir.OpCall {
+        if ins.Val.Op == ir.OpCall || ins.Val.Op == ir.OpCallIndirect {
             callInstrNums = append(callInstrNums, instrToNum[ins])
         }
+        if len(clobbers[ins.Val.Op]) > 0 {
+            clobberInstrNums = append(clobberInstrNums, instrToNum[ins])
+        }
     }
 
     // Compute live intervals using def-use analysis
@@ -61,54 +118,93 @@ func allocateRegisters(f *ir.Function) allocation {
     lastUseAt := make(map[ir.ValueID]int)
     
     for i, ins := range allInstrs {
-        // Record definition
-        if ins.Res >= 0 {
+        // Record definition; an alloca is a frame region, never a register
+        if ins.Res >= 0 && ins.Val.Op != ir.OpAlloca {
             if _, exists := defAt[ins.Res]; !exists {
                 defAt[ins.Res] = i
                 lastUseAt[ins.Res] = i // initialize with def point
             }
         }
         // Record uses
-        for _, arg := range ins.Val.Args {
+        for _, arg := range valueArgs(ins) {
             lastUseAt[arg] = i
         }
     }
 
+    // A value live into or out of a block must hold its register across the
+    // block boundary too, or a loop back edge or a block laid out before its
+    // definition would find the register reused.
+    startAt := make(map[ir.ValueID]int)
+    for id, def := range defAt { startAt[id] = def }
+    pos := 0
+    blockStart := make([]int, len(f.Blocks))
+    blockEnd := make([]int, len(f.Blocks))
+    for bi, b := range f.Blocks {
+        blockStart[bi] = pos
+        pos += len(b.Instrs)
+        blockEnd[bi] = pos - 1
+    }
+    live := ir.Liveness(f)
+    extend := func(id ir.ValueID, at int) {
+        if _, ok := defAt[id]; !ok { return }
+        if at < startAt[id] { startAt[id] = at }
+        if at > lastUseAt[id] { lastUseAt[id] = at }
+    }
+    for bi, b := range f.Blocks {
+        for id := range live.In[b] { extend(id, blockStart[bi]) }
+        for id := range live.Out[b] { extend(id, blockEnd[bi]) }
+    }
+
     // Build live intervals
     var intervals []liveInterval
-    for id, def := range defAt {
+    for id := range defAt {
+        start := startAt[id]
         end, hasUse := lastUseAt[id]
-        if !hasUse || end <= def {
+        if !hasUse || end <= start {
             continue // Dead value, no uses
         }
         
         interval := liveInterval{
             id:    id,
-            start: def,
+            start: start,
             end:   end,
+            liveIn: start < defAt[id],
         }
         
         // Check if this interval spans any calls
         spansCall := false
         for _, callNum := range callInstrNums {
-            if callNum > def && callNum < end {
+            if interval.spans(callNum) {
                 spansCall = true
                 break
             }
         }
         
-        // If interval spans a call, it needs to be spilled (for simplicity)
-        // A more sophisticated approach would save/restore around calls
+        // A call clobbers the caller-saved registers, so a value live across
+        // one is best in a callee-saved register, which costs one save in
+        // the prologue rather than one at every call
         if spansCall {
-            interval.spill = true
+            interval.crossesCall = true
+        }
+
+        // Nor may it be in a register an instruction clobbers while it is
+        // live; its operands are read before, and its result set after
+        for _, n := range clobberInstrNums {
+            if interval.spans(n) {
+                if interval.avoid == nil { interval.avoid = make(map[string]bool) }
+                for _, reg := range clobbers[allInstrs[n].Val.Op] { interval.avoid[reg] = true }
+            }
         }
         
         intervals = append(intervals, interval)
     }
 
-    // Sort intervals by start position
+    // Sort intervals by start position, and those starting together by id:
+    // they were gathered from a map, whose order changes from run to run,
+    // and the assembly must not
     sort.Slice(intervals, func(i, j int) bool {
-        return intervals[i].start < intervals[j].start
+        if intervals[i].start != intervals[j].start { return intervals[i].start < intervals[j].start }
+        return intervals[i].id < intervals[j].id
     })
 
     // Linear scan allocation
@@ -119,6 +215,8 @@ func allocateRegisters(f *ir.Function) allocation {
     
     var active []activeInterval
     alloc := allocation{regOf: make(map[ir.ValueID]string)}
+    anyRegs := append(append([]string(nil), allocableRegs...), calleeSavedRegs...)
+    acrossRegs := append(append([]string(nil), calleeSavedRegs...), allocableRegs...)
     
     expireOldIntervals := func(position int) {
         // Remove intervals that have ended
@@ -131,13 +229,13 @@ func allocateRegisters(f *ir.Function) allocation {
         active = newActive
     }
     
-    findFreeRegister := func() (string, bool) {
+    findFreeRegister := func(regs []string) (string, bool) {
         usedRegs := make(map[string]bool)
         for _, a := range active {
             usedRegs[a.reg] = true
         }
         
-        for _, reg := range allocableRegs {
+        for _, reg := range regs {
             if !usedRegs[reg] {
                 return reg, true
             }
@@ -145,16 +243,16 @@ func allocateRegisters(f *ir.Function) allocation {
         return "", false
     }
     
-    spillCandidate := func() *activeInterval {
-        // Simple spill heuristic: spill the interval that ends last
-        if len(active) == 0 {
-            return nil
-        }
+    spillCandidate := func(regs []string) *activeInterval {
+        // Simple spill heuristic: spill the interval that ends last, of
+        // those holding a register current may take
+        allowed := make(map[string]bool)
+        for _, reg := range regs { allowed[reg] = true }
         
         maxEnd := -1
         var candidate *activeInterval
         for i := range active {
-            if active[i].interval.end > maxEnd {
+            if allowed[active[i].reg] && active[i].interval.end > maxEnd {
                 maxEnd = active[i].interval.end
                 candidate = &active[i]
             }
@@ -166,13 +264,21 @@ func allocateRegisters(f *ir.Function) allocation {
     for _, current := range intervals {
         expireOldIntervals(current.start)
         
-        // Force spill if interval spans calls
-        if current.spill {
-            // Leave unassigned (will spill to stack)
-            continue
+        // Values live across calls prefer callee-saved registers; the rest
+        // prefer caller-saved ones, which cost no save in the prologue
+        regs := anyRegs
+        if current.crossesCall {
+            regs = acrossRegs
+        }
+        if current.avoid != nil {
+            var ok []string
+            for _, reg := range regs {
+                if !current.avoid[reg] { ok = append(ok, reg) }
+            }
+            regs = ok
         }
         
-        if reg, available := findFreeRegister(); available {
+        if reg, available := findFreeRegister(regs); available {
             // Assign free register
             alloc.regOf[current.id] = reg
             active = append(active, activeInterval{
@@ -181,15 +287,17 @@ func allocateRegisters(f *ir.Function) allocation {
             })
         } else if len(active) > 0 {
             // Try to spill an existing interval
-            if candidate := spillCandidate(); candidate != nil && candidate.interval.end > current.end {
+            if candidate := spillCandidate(regs); candidate != nil && candidate.interval.end > current.end {
+                // Copy the victim out: candidate points into active, which is filtered in place below
+                victim := *candidate
                 // Spill the candidate and assign its register to current
-                delete(alloc.regOf, candidate.interval.id)
-                alloc.regOf[current.id] = candidate.reg
+                delete(alloc.regOf, victim.interval.id)
+                alloc.regOf[current.id] = victim.reg
                 
                 // Remove candidate from active
                 newActive := active[:0]
                 for _, a := range active {
-                    if a.interval.id != candidate.interval.id {
+                    if a.interval.id != victim.interval.id {
                         newActive = append(newActive, a)
                     }
                 }
@@ -198,16 +306,143 @@ func allocateRegisters(f *ir.Function) allocation {
                 // Add current to active
                 active = append(active, activeInterval{
                     interval: current,
-                    reg:     candidate.reg,
+                    reg:     victim.reg,
                 })
             }
             // If we can't find a good spill candidate, leave current unassigned (spilled)
         }
     }
+
+    // the instructions each register is taken over or clobbered at, for
+    // splitting
+    taken := make(map[string][][2]int)
+    for _, iv := range intervals {
+        if reg, ok := alloc.regOf[iv.id]; ok { taken[reg] = append(taken[reg], [2]int{iv.start, iv.end}) }
+    }
+    for _, n := range clobberInstrNums {
+        for _, reg := range clobbers[allInstrs[n].Val.Op] { taken[reg] = append(taken[reg], [2]int{n, n}) }
+    }
+    splitLoops(f, &alloc, taken, defAt, blockStart, blockEnd, callInstrNums)
+
+    alloc.saveAt = make(map[*ir.Instr][]ir.ValueID)
+    for _, iv := range intervals {
+        reg, ok := alloc.regOf[iv.id]
+        if !ok || !callClobberedRegs[reg] { continue }
+        for _, callNum := range callInstrNums {
+            if iv.spans(callNum) {
+                call := allInstrs[callNum]
+                alloc.saveAt[call] = append(alloc.saveAt[call], iv.id)
+            }
+        }
+    }
+    for _, ids := range alloc.saveAt {
+        sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    }
+
+    used := make(map[string]bool)
+    for _, reg := range alloc.regOf { used[reg] = true }
+    for _, split := range alloc.inLoop {
+        for _, reg := range split { used[reg] = true }
+    }
+    for _, reg := range calleeSavedRegs {
+        if used[reg] { alloc.saved = append(alloc.saved, reg) }
+    }
     
     return alloc
 }
 
+// splitLoops gives the values the scan left in memory a second chance, loop
+// by loop, innermost first: a value a loop reads but does not define gets a
+// register no interval takes anywhere from the loop's first instruction to
+// its last, and the edges into the loop load it there from its slot. Being
+// SSA, the value does not change in the loop, so its slot stays right and
+// nothing need be stored on the way out. The values a loop reads most go
+// first. A register must be callee-saved if there is a call in the loop, and
+// the edges into the loop must be jumps, so that the loads are on them
+// alone.
+func splitLoops(f *ir.Function, alloc *allocation, taken map[string][][2]int, defAt map[ir.ValueID]int, blockStart, blockEnd []int, calls []int) {
+    alloc.inLoop = make(map[*ir.BasicBlock]map[ir.ValueID]string)
+    alloc.reloadAt = make(map[*ir.BasicBlock][]reload)
+    index := make(map[*ir.BasicBlock]int)
+    for i, b := range f.Blocks { index[b] = i }
+    free := func(reg string, lo, hi int) bool {
+        for _, r := range taken[reg] {
+            if r[0] <= hi && r[1] >= lo { return false }
+        }
+        return true
+    }
+    for _, l := range ir.FindLoops(f) {
+        var entries []*ir.BasicBlock
+        ok := true
+        for _, p := range l.Header.Preds {
+            if l.Blocks[p] { continue }
+            last := p.Instrs[len(p.Instrs)-1].Val
+            if last.Op != ir.OpJmp { ok = false }
+            entries = append(entries, p)
+        }
+        if !ok || len(entries) == 0 { continue }
+        lo, hi := -1, -1
+        span := func(b *ir.BasicBlock, start int) {
+            if lo < 0 || start < lo { lo = start }
+            if e := blockEnd[index[b]]; e > hi { hi = e }
+        }
+        defined := make(map[ir.ValueID]bool)
+        reads := make(map[ir.ValueID]int)
+        for _, b := range f.Blocks {
+            if !l.Blocks[b] { continue }
+            span(b, blockStart[index[b]])
+            for i := range b.Instrs {
+                ins := &b.Instrs[i]
+                if ins.Res >= 0 { defined[ins.Res] = true }
+                for _, a := range valueArgs(ins) { reads[a]++ }
+            }
+        }
+        for _, p := range entries { span(p, blockEnd[index[p]]) }
+        var cands []ir.ValueID
+        for id := range reads {
+            if _, inReg := alloc.regOf[id]; inReg || defined[id] { continue }
+            if _, ok := defAt[id]; !ok { continue }
+            split := false
+            for b := range l.Blocks {
+                if _, ok := alloc.inLoop[b][id]; ok { split = true }
+            }
+            if !split { cands = append(cands, id) }
+        }
+        sort.Slice(cands, func(i, j int) bool {
+            if reads[cands[i]] != reads[cands[j]] { return reads[cands[i]] > reads[cands[j]] }
+            return cands[i] < cands[j]
+        })
+        regs := append(append([]string(nil), allocableRegs...), calleeSavedRegs...)
+        for _, c := range calls {
+            if c >= lo && c <= hi { regs = calleeSavedRegs }
+        }
+        for _, id := range cands {
+            for _, reg := range regs {
+                if !free(reg, lo, hi) { continue }
+                taken[reg] = append(taken[reg], [2]int{lo, hi})
+                for b := range l.Blocks {
+                    if alloc.inLoop[b] == nil { alloc.inLoop[b] = make(map[ir.ValueID]string) }
+                    alloc.inLoop[b][id] = reg
+                }
+                for _, p := range entries { alloc.reloadAt[p] = append(alloc.reloadAt[p], reload{id, reg}) }
+                break
+            }
+        }
+    }
+}
+
+// valueArgs returns the operands of ins that are values; jump targets are
+// block indices.
+func valueArgs(ins *ir.Instr) []ir.ValueID {
+    switch ins.Val.Op {
+    case ir.OpJmp: return nil
+    case ir.OpJnz: return ins.Val.Args[:1]
+    case ir.OpBr: return ins.Val.Args[:2]
+    case ir.OpSwitchTable: return ins.Val.Args[:1]
+    }
+    return ins.Val.Args
+}
+
 func max(a, b int) int {
     if a > b { return a }
     return b
@@ -0,0 +1,112 @@
+package x86_64
+
+import (
+    "fmt"
+    "io"
+    "sort"
+    "strings"
+
+    "github.com/tinyrange/cc/internal/ir"
+)
+
+// writeAllocation prints what the allocator decided for f, for
+// -fverbose-regalloc: how many values went where, those left in memory
+// though live across a call, those in caller-saved registers stored around
+// one, those split into registers for loops, the callee-saved registers
+// pushed, the frame size, and then every value's home. Everything is in
+// value order, so the report can be checked against a golden file.
+func writeAllocation(w io.Writer, f *ir.Function, allocator string, alloc allocation, fr *frame, imm map[ir.ValueID]bool) {
+    // after phi elimination a value may be assigned in several blocks
+    var ids []ir.ValueID
+    seen := make(map[ir.ValueID]bool)
+    allocas := make(map[ir.ValueID]int64)
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs {
+            // stores and terminators have ids but no value to keep
+            switch ins.Val.Op {
+            case ir.OpStore, ir.OpStore8, ir.OpStoreIdx, ir.OpRet, ir.OpJmp, ir.OpJnz, ir.OpBr, ir.OpSwitchTable:
+                continue
+            case ir.OpAlloca:
+                allocas[ins.Res] = ins.Val.Const
+            }
+            if ins.Res >= 0 && !seen[ins.Res] { ids = append(ids, ins.Res) }
+            seen[ins.Res] = true
+        }
+    }
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+    // a constant only taken as an immediate may have a register it never
+    // uses
+    inReg := func(id ir.ValueID) bool {
+        _, ok := alloc.regOf[id]
+        return ok && !imm[id]
+    }
+    inMemory := func(id ir.ValueID) bool {
+        _, isAlloca := allocas[id]
+        return !inReg(id) && !isAlloca && !imm[id]
+    }
+    regs, mem, imms := 0, 0, 0
+    for _, id := range ids {
+        if inReg(id) { regs++ }
+        if inMemory(id) { mem++ }
+        if imm[id] { imms++ }
+    }
+    spilled := map[ir.ValueID]bool{}
+    for _, across := range liveAcrossCalls(f, ir.Liveness(f)) {
+        for _, id := range across {
+            if inMemory(id) { spilled[id] = true }
+        }
+    }
+    saved := map[ir.ValueID]bool{}
+    for _, across := range alloc.saveAt {
+        for _, id := range across { saved[id] = true }
+    }
+    split := map[string]bool{}
+    for _, byID := range alloc.inLoop {
+        for id, reg := range byID { split[fmt.Sprintf("%s %s", id, reg)] = true }
+    }
+    list := func(set map[ir.ValueID]bool) string {
+        var s []ir.ValueID
+        for id := range set { s = append(s, id) }
+        sort.Slice(s, func(i, j int) bool { return s[i] < s[j] })
+        var names string
+        for _, id := range s { names += " " + id.String() }
+        return names
+    }
+    var splits []string
+    for s := range split { splits = append(splits, s) }
+    sort.Slice(splits, func(i, j int) bool {
+        var a, b int
+        fmt.Sscanf(splits[i], "v%d", &a)
+        fmt.Sscanf(splits[j], "v%d", &b)
+        if a != b { return a < b }
+        return splits[i] < splits[j]
+    })
+
+    if allocator == "" { allocator = "linear" }
+    fmt.Fprintf(w, ";; regalloc %s %s\n", allocator, f.Name)
+    fmt.Fprintf(w, "values %d: %d in registers, %d in memory, %d immediate, %d alloca\n", len(ids), regs, mem, imms, len(allocas))
+    fmt.Fprintf(w, "spilled across calls:%s\n", list(spilled))
+    fmt.Fprintf(w, "saved around calls:%s\n", list(saved))
+    fmt.Fprintf(w, "split for loops:%s\n", prefixed(splits, ","))
+    fmt.Fprintf(w, "callee-saved:%s\n", prefixed(alloc.saved, ""))
+    fmt.Fprintf(w, "frame: %d bytes\n", fr.size)
+    for _, id := range ids {
+        if imm[id] {
+            fmt.Fprintf(w, "%s immediate\n", id)
+        } else if inReg(id) {
+            fmt.Fprintf(w, "%s %s\n", id, alloc.regOf[id])
+        } else if size, ok := allocas[id]; ok {
+            fmt.Fprintf(w, "%s alloca %d at %d(%%rbp)\n", id, size, fr.off[id])
+        } else {
+            fmt.Fprintf(w, "%s %d(%%rbp)\n", id, fr.off[id])
+        }
+    }
+    fmt.Fprintln(w)
+}
+
+// prefixed joins items by sep, with a space before each.
+func prefixed(items []string, sep string) string {
+    if len(items) == 0 { return "" }
+    return " " + strings.Join(items, sep+" ")
+}
@@ -0,0 +1,36 @@
+package x86_64
+
+import (
+    "fmt"
+    "strings"
+)
+
+// target is what the assembly differs in between the object formats it can
+// be for: ELF, on Linux, and Mach-O, on macOS, whose assembler wants C names
+// with a leading underscore, assembler-local labels starting L rather than
+// .L, its own section names, and no .type or .size.
+type target struct {
+    macho bool
+    // the sections for jump tables, which hold absolute addresses unless
+    // the code is position-independent, and for string literals
+    constData, cstrings string
+}
+
+func newTarget(name string) (target, error) {
+    switch name {
+    case "", "x86_64-linux":
+        return target{constData: ".section .rodata", cstrings: ".section .rodata"}, nil
+    case "x86_64-darwin":
+        // what the dynamic linker relocates cannot be in __TEXT
+        return target{macho: true, constData: ".section __DATA,__const", cstrings: ".section __TEXT,__cstring,cstring_literals"}, nil
+    }
+    return target{}, fmt.Errorf("unknown target %q (known: x86_64-linux, x86_64-darwin)", name)
+}
+
+// sym returns the assembler name of the IR symbol s, a C name or, for a
+// string literal or block, a local label starting .L.
+func (t target) sym(s string) string {
+    if !t.macho { return s }
+    if strings.HasPrefix(s, ".L") { return s[1:] }
+    return "_" + s
+}
@@ -0,0 +1,71 @@
+package ir
+
+import "math"
+
+// combineAddressing folds the arithmetic computing a load's or store's
+// address into it, as an OpLoadIdx or OpStoreIdx of base + index*scale +
+// disp that x86 addresses in one operand. The address is taken apart
+// through adds, shifts by up to 3 and multiplies by 1, 2, 4 or 8 that
+// nothing else uses and that are in the same block, so that base and index
+// are read where they were; they are left for DCE. An address with no
+// index, or more than two values in it, is left alone.
+func combineAddressing(f *Function) bool {
+    changed := false
+    ui := buildUses(f)
+    consts := f.consts()
+    for _, b := range f.Blocks {
+        defs := map[ValueID]Value{}
+        for i := range b.Instrs {
+            ins := &b.Instrs[i]
+            if ins.Res >= 0 { defs[ins.Res] = ins.Val }
+            if ins.Val.Op != OpLoad && ins.Val.Op != OpStore { continue }
+            a := ins.Val.Args[0]
+            if defs[a].Op != OpAdd || ui.uses[a] != 1 { continue }
+            base, index := ValueID(-1), ValueID(-1)
+            scale, disp := int64(1), int64(0)
+            var walk func(id ValueID) bool
+            walk = func(id ValueID) bool {
+                if k, ok := consts[id]; ok { disp += k; return true }
+                d, local := defs[id]
+                if local && ui.uses[id] == 1 {
+                    switch d.Op {
+                    case OpAdd: return walk(d.Args[0]) && walk(d.Args[1])
+                    case OpShl, OpMul:
+                        x, s, ok := scaled(d, consts)
+                        if ok && index < 0 { index, scale = x, s; return true }
+                    }
+                }
+                if base < 0 { base = id; return true }
+                if index < 0 { index = id; return true }
+                return false
+            }
+            if !walk(a) || base < 0 || index < 0 || disp < math.MinInt32 || disp > math.MaxInt32 { continue }
+            v := Value{ID: ins.Val.ID, Op: OpLoadIdx, Args: []ValueID{base, index}, Const: disp, Scale: scale}
+            if ins.Val.Op == OpStore {
+                v.Op = OpStoreIdx
+                v.Args = append(v.Args, ins.Val.Args[1])
+            }
+            ins.Val = v
+            changed = true
+        }
+    }
+    return changed
+}
+
+// scaled returns x and s when v is x << k or x * s for a scale s of 1, 2, 4
+// or 8.
+func scaled(v Value, consts map[ValueID]int64) (ValueID, int64, bool) {
+    k, ok := consts[v.Args[1]]
+    x := v.Args[0]
+    if v.Op == OpMul && !ok {
+        k, ok = consts[v.Args[0]]
+        x = v.Args[1]
+    }
+    if !ok { return 0, 0, false }
+    if v.Op == OpShl {
+        if k < 0 || k > 3 { return 0, 0, false }
+        return x, 1 << k, true
+    }
+    if k != 1 && k != 2 && k != 4 && k != 8 { return 0, 0, false }
+    return x, k, true
+}
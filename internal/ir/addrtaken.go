@@ -0,0 +1,82 @@
+package ir
+
+import "github.com/tinyrange/cc/internal/ast"
+
+// addrTakenVars returns the names of locals whose address is taken with &x.
+// Such variables must live in a frame slot rather than in SSA values so that
+// stores through a pointer are visible to later reads of the variable.
+func addrTakenVars(body *ast.BlockStmt) map[string]bool {
+    out := map[string]bool{}
+    walkStmt(body, out)
+    return out
+}
+
+func walkStmt(s ast.Stmt, out map[string]bool) {
+    switch s := s.(type) {
+    case nil:
+    case *ast.BlockStmt:
+        for _, st := range s.Stmts { walkStmt(st, out) }
+    case *ast.ReturnStmt:
+        walkExpr(s.Expr, out)
+    case *ast.ExprStmt:
+        walkExpr(s.X, out)
+    case *ast.DeclStmt:
+        walkExpr(s.Init, out)
+    case *ast.AssignStmt:
+        walkExpr(s.Value, out)
+    case *ast.ArrayAssignStmt:
+        walkExpr(s.Index, out)
+        walkExpr(s.Value, out)
+    case *ast.FieldAssignStmt:
+        walkExpr(s.Base, out)
+        walkExpr(s.Value, out)
+    case *ast.DerefAssignStmt:
+        walkExpr(s.Ptr, out)
+        walkExpr(s.Value, out)
+    case *ast.IfStmt:
+        walkExpr(s.Cond, out)
+        walkStmt(s.Then, out)
+        if s.Else != nil { walkStmt(s.Else, out) }
+    case *ast.WhileStmt:
+        walkExpr(s.Cond, out)
+        walkStmt(s.Body, out)
+    case *ast.ForStmt:
+        walkStmt(s.Init, out)
+        walkExpr(s.Cond, out)
+        walkStmt(s.Post, out)
+        walkStmt(s.Body, out)
+    case *ast.DoWhileStmt:
+        walkStmt(s.Body, out)
+        walkExpr(s.Cond, out)
+    case *ast.SwitchStmt:
+        walkExpr(s.Tag, out)
+        for _, cc := range s.Cases { walkStmt(cc.Body, out) }
+        if s.Default != nil { walkStmt(s.Default, out) }
+    }
+}
+
+func walkExpr(e ast.Expr, out map[string]bool) {
+    switch e := e.(type) {
+    case nil:
+    case *ast.BinaryExpr:
+        walkExpr(e.Left, out)
+        walkExpr(e.Right, out)
+    case *ast.CallExpr:
+        walkExpr(e.Fn, out)
+        for _, a := range e.Args { walkExpr(a, out) }
+    case *ast.AssignExpr:
+        walkExpr(e.Value, out)
+    case *ast.UnaryExpr:
+        if id, ok := e.X.(*ast.Ident); ok && e.Op == ast.OpAddr {
+            out[id.Name] = true
+        }
+        walkExpr(e.X, out)
+    case *ast.IndexExpr:
+        walkExpr(e.Base, out)
+        walkExpr(e.Index, out)
+    case *ast.CastExpr:
+        walkExpr(e.X, out)
+    case *ast.FieldExpr:
+        walkExpr(e.Base, out)
+    }
+}
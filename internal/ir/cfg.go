@@ -0,0 +1,103 @@
+package ir
+
+// CleanupCFG simplifies the control flow of f after phi elimination: jumps
+// to a block that only jumps on go straight to its target, and a block
+// whose only predecessor jumps straight to it is merged into that
+// predecessor, dropping the jump and the label.
+func CleanupCFG(f *Function) {
+    // merging first keeps the names of blocks that would otherwise be
+    // threaded past, and again after for the chains threading leaves
+    mergeBlocks(f)
+    threadJumps(f)
+    removeUnreachable(f)
+    mergeBlocks(f)
+    // a branch threading turned into a jump leaves its condition unused
+    dceFunc(f)
+}
+
+// threadJumps retargets each jump to a forwarding block, one holding nothing
+// but a jump, to where the forwarder leads, through chains of them. A phi in
+// the final target gets an operand for the new predecessor, the one it had
+// for the forwarder; where the new predecessor already reaches the target
+// directly, the two operands could differ, so the jump is left alone. A
+// switch table is left alone too, as it has one edge for all its entries.
+func threadJumps(f *Function) {
+    forward := func(b *BasicBlock) (*BasicBlock, bool) {
+        if b == f.entry || len(b.Instrs) != 1 || b.Instrs[0].Val.Op != OpJmp { return nil, false }
+        t := f.Blocks[b.Instrs[0].Val.Args[0]]
+        return t, t != b
+    }
+    for _, p := range f.Blocks {
+        if !p.Terminated() { continue }
+        v := &p.Instrs[len(p.Instrs)-1].Val
+        var slots []int
+        switch v.Op {
+        case OpJmp: slots = []int{0}
+        case OpJnz: slots = []int{1, 2}
+        case OpBr: slots = []int{2, 3}
+        }
+        for _, k := range slots {
+            // a cycle of forwarders is an empty infinite loop; stop going round
+            for hops := 0; hops < len(f.Blocks); hops++ {
+                fw := f.Blocks[v.Args[k]]
+                t, ok := forward(fw)
+                if !ok || t == p { break }
+                if t.hasPhis() && t.predIndex(p) >= 0 { break }
+                for _, phi := range t.phis() { phi.Args = append(phi.Args, phi.Args[t.predIndex(fw)]) }
+                removeEdge(p, fw)
+                f.addEdge(p, t)
+                v.Args[k] = ValueID(blockIndexOf(f, t))
+            }
+        }
+        // both arms may now lead to the same place
+        if len(slots) == 2 && v.Args[slots[0]] == v.Args[slots[1]] && !f.Blocks[v.Args[slots[0]]].hasPhis() {
+            t := v.Args[slots[0]]
+            removeEdge(p, f.Blocks[t])
+            *v = Value{Op: OpJmp, Args: []ValueID{t}}
+        }
+    }
+}
+
+// phis returns the phis at the start of b.
+func (b *BasicBlock) phis() []*Value {
+    var out []*Value
+    for i := range b.Instrs {
+        if b.Instrs[i].Val.Op != OpPhi { break }
+        out = append(out, &b.Instrs[i].Val)
+    }
+    return out
+}
+
+func (b *BasicBlock) hasPhis() bool { return len(b.phis()) > 0 }
+
+// predIndex returns the position of p among b's predecessors, or -1.
+func (b *BasicBlock) predIndex(p *BasicBlock) int {
+    for i, q := range b.Preds { if q == p { return i } }
+    return -1
+}
+
+// mergeBlocks appends each block B to its predecessor A when A ends in a
+// jump to B and nothing else reaches B. Phis must be gone, as B's would have
+// to become copies.
+func mergeBlocks(f *Function) {
+    dead := map[*BasicBlock]bool{}
+    for _, a := range f.Blocks {
+        if dead[a] { continue }
+        for a.Terminated() {
+            last := a.Instrs[len(a.Instrs)-1].Val
+            if last.Op != OpJmp { break }
+            b := f.Blocks[last.Args[0]]
+            if b == a || b == f.entry || len(b.Preds) != 1 { break }
+            a.Instrs = append(a.Instrs[:len(a.Instrs)-1], b.Instrs...)
+            a.Succs = b.Succs
+            for _, s := range b.Succs {
+                for i, p := range s.Preds {
+                    if p == b { s.Preds[i] = a }
+                }
+            }
+            b.Preds, b.Succs = nil, nil
+            dead[b] = true
+        }
+    }
+    f.removeBlocks(dead)
+}
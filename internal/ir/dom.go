@@ -0,0 +1,142 @@
+package ir
+
+import (
+    "fmt"
+    "strings"
+)
+
+// DomTree is the dominator tree of a function's blocks reachable from its
+// entry; blocks the entry cannot reach are not in it.
+type DomTree struct {
+    f        *Function
+    idom     map[*BasicBlock]*BasicBlock
+    children map[*BasicBlock][]*BasicBlock
+    frontier map[*BasicBlock][]*BasicBlock
+    // entry and exit times of a walk over the tree: a dominates b when b's
+    // interval nests in a's
+    in, out map[*BasicBlock]int
+}
+
+// ComputeDominators builds f's dominator tree by the iterative algorithm of
+// Cooper, Harvey and Kennedy over the blocks in reverse postorder, and the
+// dominance frontiers from it.
+func ComputeDominators(f *Function) *DomTree {
+    order := f.reversePostorder()
+    num := map[*BasicBlock]int{}
+    for i, b := range order { num[b] = i }
+    idom := map[*BasicBlock]*BasicBlock{f.entry: f.entry}
+    intersect := func(a, b *BasicBlock) *BasicBlock {
+        for a != b {
+            for num[a] > num[b] { a = idom[a] }
+            for num[b] > num[a] { b = idom[b] }
+        }
+        return a
+    }
+    for changed := true; changed; {
+        changed = false
+        for _, b := range order[1:] {
+            var d *BasicBlock
+            for _, p := range b.Preds {
+                if idom[p] == nil { continue }
+                if d == nil { d = p } else { d = intersect(p, d) }
+            }
+            if idom[b] != d { idom[b], changed = d, true }
+        }
+    }
+    t := &DomTree{f: f, idom: idom, children: map[*BasicBlock][]*BasicBlock{}, frontier: map[*BasicBlock][]*BasicBlock{},
+        in: map[*BasicBlock]int{}, out: map[*BasicBlock]int{}}
+    // in block order, so that children and frontiers come out that way
+    for _, b := range f.Blocks {
+        if d, ok := idom[b]; ok && b != f.entry { t.children[d] = append(t.children[d], b) }
+    }
+    for _, b := range f.Blocks {
+        if _, ok := idom[b]; !ok || len(b.Preds) < 2 { continue }
+        for _, p := range b.Preds {
+            if _, ok := idom[p]; !ok { continue }
+            for r := p; r != idom[b]; r = idom[r] {
+                if !containsBlock(t.frontier[r], b) { t.frontier[r] = append(t.frontier[r], b) }
+                if r == f.entry { break }
+            }
+        }
+    }
+    clock := 0
+    var walk func(b *BasicBlock)
+    walk = func(b *BasicBlock) {
+        t.in[b] = clock
+        clock++
+        for _, c := range t.children[b] { walk(c) }
+        t.out[b] = clock
+        clock++
+    }
+    walk(f.entry)
+    return t
+}
+
+// Idom returns b's immediate dominator, or nil for the entry and blocks
+// outside the tree.
+func (t *DomTree) Idom(b *BasicBlock) *BasicBlock {
+    if b == t.f.entry { return nil }
+    return t.idom[b]
+}
+
+// Dominates reports whether every path from the entry to b goes through a.
+// A block dominates itself.
+func (t *DomTree) Dominates(a, b *BasicBlock) bool {
+    ia, ok := t.in[a]
+    ib, ok2 := t.in[b]
+    return ok && ok2 && ia <= ib && t.out[b] <= t.out[a]
+}
+
+// Children returns the blocks b immediately dominates, in block order.
+func (t *DomTree) Children(b *BasicBlock) []*BasicBlock { return t.children[b] }
+
+// Frontier returns b's dominance frontier: the blocks where b's dominance
+// ends, those with a predecessor b dominates that b does not strictly
+// dominate themselves.
+func (t *DomTree) Frontier(b *BasicBlock) []*BasicBlock { return t.frontier[b] }
+
+// String lists each block's immediate dominator and dominance frontier.
+func (t *DomTree) String() string {
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "func %s\n", t.f.Name)
+    names := func(bs []*BasicBlock) string {
+        var s string
+        for _, b := range bs { s += " " + b.Name }
+        return s
+    }
+    for _, b := range t.f.Blocks {
+        if _, ok := t.idom[b]; !ok {
+            fmt.Fprintf(&sb, "  %s: unreachable\n", b.Name)
+            continue
+        }
+        idom := "-"
+        if d := t.Idom(b); d != nil { idom = d.Name }
+        fmt.Fprintf(&sb, "  %s: idom %s; frontier%s\n", b.Name, idom, names(t.frontier[b]))
+    }
+    return sb.String()
+}
+
+func containsBlock(bs []*BasicBlock, b *BasicBlock) bool {
+    for _, x := range bs {
+        if x == b { return true }
+    }
+    return false
+}
+
+// reversePostorder lists the blocks reachable from the entry so that each
+// comes before its successors, back edges aside.
+func (f *Function) reversePostorder() []*BasicBlock {
+    seen := map[*BasicBlock]bool{}
+    var post []*BasicBlock
+    var visit func(b *BasicBlock)
+    visit = func(b *BasicBlock) {
+        seen[b] = true
+        for _, s := range b.Succs {
+            if !seen[s] { visit(s) }
+        }
+        post = append(post, b)
+    }
+    visit(f.entry)
+    for i, j := 0, len(post)-1; i < j; i, j = i+1, j-1 { post[i], post[j] = post[j], post[i] }
+    return post
+}
@@ -0,0 +1,121 @@
+package ir
+
+import (
+    "fmt"
+    "strings"
+)
+
+// eliminateDeadStores removes stores nothing can read: one overwritten by a
+// later store to the same address in its block with no load, call or
+// return in between, and every store into an alloca whose address is only
+// ever stored through. Two addresses are the same when they are computed
+// the same way from the same values; anything else may or may not alias,
+// and is kept.
+func eliminateDeadStores(f *Function) bool {
+    changed := false
+    addr := addressKeys(f)
+    unread := unreadAllocas(f)
+    for _, b := range f.Blocks {
+        // the addresses a later store overwrites, and how many bytes
+        overwritten := map[string]int{}
+        dead := map[int]bool{}
+        for i := len(b.Instrs) - 1; i >= 0; i-- {
+            v := b.Instrs[i].Val
+            switch v.Op {
+            case OpStore, OpStore8:
+                width := 8
+                if v.Op == OpStore8 { width = 1 }
+                k := addr(v.Args[0])
+                if overwritten[k] >= width { dead[i] = true; continue }
+                overwritten[k] = width
+            case OpLoad, OpLoad8, OpLoadIdx, OpCall, OpCallIndirect, OpRet:
+                overwritten = map[string]int{}
+            }
+        }
+        for _, a := range unread {
+            for i, ins := range b.Instrs {
+                if (ins.Val.Op == OpStore || ins.Val.Op == OpStore8) && a[ins.Val.Args[0]] { dead[i] = true }
+            }
+        }
+        if len(dead) == 0 { continue }
+        out := b.Instrs[:0]
+        for i, ins := range b.Instrs {
+            if !dead[i] { out = append(out, ins) }
+        }
+        b.Instrs = out
+        changed = true
+    }
+    return changed
+}
+
+// addressKeys returns a function naming the address a value holds, so that
+// two values with the same name hold the same address: pure values are named
+// by their op and the names of their operands, constants by their value, and
+// the rest by their id.
+func addressKeys(f *Function) func(ValueID) string {
+    defs := map[ValueID]Value{}
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs {
+            if ins.Res >= 0 { defs[ins.Res] = ins.Val }
+        }
+    }
+    memo := map[ValueID]string{}
+    var key func(id ValueID) string
+    key = func(id ValueID) string {
+        if k, ok := memo[id]; ok { return k }
+        // a phi may lead back here; until it is named, it is itself
+        memo[id] = id.String()
+        v := defs[id]
+        if _, pure := valueKey(v, nil); pure || v.Op == OpSlotAddr || v.Op == OpConst {
+            args := make([]string, len(v.Args))
+            for i, a := range v.Args { args[i] = key(a) }
+            if v.Op == OpAdd && args[0] > args[1] { args[0], args[1] = args[1], args[0] }
+            memo[id] = fmt.Sprintf("(%s %d @%s %s)", v.Op, v.Const, v.Sym, strings.Join(args, ","))
+        }
+        return memo[id]
+    }
+    return key
+}
+
+// unreadAllocas returns, for each alloca whose address is only ever stored
+// through, the values holding addresses into it. Such an address is the
+// alloca's slotaddr, or one computed from another by adding, subtracting or
+// copying.
+func unreadAllocas(f *Function) []map[ValueID]bool {
+    uses := map[ValueID][]Instr{}
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs {
+            for _, a := range operands(&ins) { uses[a] = append(uses[a], ins) }
+        }
+    }
+    var out []map[ValueID]bool
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs {
+            if ins.Val.Op != OpAlloca { continue }
+            ptrs := map[ValueID]bool{}
+            read := false
+            work := []ValueID{}
+            for _, u := range uses[ins.Res] {
+                if u.Val.Op != OpSlotAddr { read = true; break }
+                work = append(work, u.Res)
+            }
+            for len(work) > 0 && !read {
+                p := work[len(work)-1]
+                work = work[:len(work)-1]
+                if ptrs[p] { continue }
+                ptrs[p] = true
+                for _, u := range uses[p] {
+                    switch {
+                    case (u.Val.Op == OpStore || u.Val.Op == OpStore8) && u.Val.Args[1] != p:
+                    case u.Val.Op == OpAdd || u.Val.Op == OpCopy || u.Val.Op == OpSub && u.Val.Args[0] == p:
+                        work = append(work, u.Res)
+                    default:
+                        read = true
+                    }
+                }
+            }
+            if !read { out = append(out, ptrs) }
+        }
+    }
+    return out
+}
@@ -0,0 +1,235 @@
+package ir
+
+import (
+    "fmt"
+
+    "github.com/tinyrange/cc/internal/ast"
+)
+
+// reachable returns the blocks control can reach from the entry. Given the
+// constants of f, a branch on one only follows the arm it takes, so the exit
+// of while (1) { } is not reachable; given nil, every edge is followed.
+func (f *Function) reachable(consts map[ValueID]int64) map[*BasicBlock]bool {
+    seen := map[*BasicBlock]bool{}
+    work := []*BasicBlock{f.entry}
+    for len(work) > 0 {
+        b := work[len(work)-1]
+        work = work[:len(work)-1]
+        if seen[b] { continue }
+        seen[b] = true
+        succs := b.Succs
+        if b.Terminated() {
+            if arm, ok := constArm(b.Instrs[len(b.Instrs)-1].Val, consts); ok {
+                succs = []*BasicBlock{f.Blocks[arm]}
+            }
+        }
+        work = append(work, succs...)
+    }
+    return seen
+}
+
+// consts maps each constant value of f to its value.
+func (f *Function) consts() map[ValueID]int64 {
+    consts := map[ValueID]int64{}
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs {
+            if ins.Val.Op == OpConst { consts[ins.Res] = ins.Val.Const }
+        }
+    }
+    return consts
+}
+
+// constArm returns the block index a conditional branch always takes when
+// its condition is a constant.
+func constArm(v Value, consts map[ValueID]int64) (ValueID, bool) {
+    switch v.Op {
+    case OpJnz:
+        k, ok := consts[v.Args[0]]
+        if !ok { return 0, false }
+        if k != 0 { return v.Args[1], true }
+        return v.Args[2], true
+    case OpBr:
+        l, lok := consts[v.Args[0]]
+        r, rok := consts[v.Args[1]]
+        if !lok || !rok { return 0, false }
+        if compare(Op(v.Const), l, r) { return v.Args[2], true }
+        return v.Args[3], true
+    case OpSwitchTable:
+        k, ok := consts[v.Args[0]]
+        if !ok { return 0, false }
+        // the default unless k - Const indexes the table
+        if i := uint64(k - v.Const); i < uint64(len(v.Args)-2) { return v.Args[2+i], true }
+        return v.Args[1], true
+    }
+    return 0, false
+}
+
+// warnConstConds warns about each branch on a source condition that folded to
+// a constant, so that one of its arms is never taken.
+func warnConstConds(m *Module, f *Function) {
+    consts := f.consts()
+    for _, b := range f.Blocks {
+        pos, ok := f.conds[b]
+        if !ok || !b.Terminated() { continue }
+        last := b.Instrs[len(b.Instrs)-1].Val
+        arm, ok := constArm(last, consts)
+        if !ok { continue }
+        always := "false"
+        if arm == last.Args[len(last.Args)-2] { always = "true" }
+        m.Warnings = append(m.Warnings, fmt.Sprintf("%s:%d:%d: condition is always %s", f.Name, pos.Line, pos.Col, always))
+    }
+}
+
+// compare evaluates the comparison op on two constants.
+func compare(op Op, l, r int64) bool {
+    switch op {
+    case OpEq: return l == r
+    case OpNe: return l != r
+    case OpLt: return l < r
+    case OpLe: return l <= r
+    case OpGt: return l > r
+    case OpULt: return uint64(l) < uint64(r)
+    case OpULe: return uint64(l) <= uint64(r)
+    case OpUGt: return uint64(l) > uint64(r)
+    case OpUGe: return uint64(l) >= uint64(r)
+    }
+    return l >= r
+}
+
+// checkFallOff warns when a reachable block ends without a terminator, which
+// means the function can return without a value. pos is the function name.
+func (c *buildCtx) checkFallOff(pos ast.Pos) {
+    live := c.f.reachable(c.f.consts())
+    for _, b := range c.f.Blocks {
+        if live[b] && !b.Terminated() {
+            c.warnf(pos, "control reaches end of non-void function")
+            return
+        }
+    }
+}
+
+// foldBranches turns each conditional branch on a constant into a jump to
+// the arm it takes, leaving the untaken arm to removeUnreachable.
+func foldBranches(f *Function) bool {
+    changed := false
+    consts := f.consts()
+    for _, b := range f.Blocks {
+        if !b.Terminated() { continue }
+        last := &b.Instrs[len(b.Instrs)-1]
+        arm, ok := constArm(last.Val, consts)
+        if !ok { continue }
+        taken := f.Blocks[arm]
+        for _, s := range b.Succs {
+            if s != taken { s.removePred(b) }
+        }
+        b.Succs = []*BasicBlock{taken}
+        last.Val = Value{Op: OpJmp, Args: []ValueID{arm}}
+        changed = true
+    }
+    return changed
+}
+
+// removeUnreachable deletes the blocks control cannot reach from the entry:
+// those cut off by a folded branch, such as a loop only the untaken arm led
+// to, and those nothing jumps to, such as the join after an if whose arms
+// both return, or a loop's step when its body always does.
+func removeUnreachable(f *Function) bool {
+    // by the edges alone: a branch foldBranches left is still taken both ways
+    live := f.reachable(nil)
+    dead := map[*BasicBlock]bool{}
+    for _, b := range f.Blocks {
+        if !live[b] { dead[b] = true }
+    }
+    f.removeBlocks(dead)
+    return len(dead) > 0
+}
+
+// removeTrivialPhis deletes each phi whose operands other than itself are
+// all one value, such as phi(v3, v7) for v7 at a loop header the loop never
+// changes, or phi(v3, v3) once an edge is gone, and rewrites its uses to
+// that value, so that phi elimination makes no copies for it. Removing one
+// may make a phi that used it trivial, so this repeats until none is left.
+// A phi with no other operand is left alone, as the builder does.
+func removeTrivialPhis(f *Function) bool {
+    changed := false
+    for {
+        same := map[ValueID]ValueID{}
+        resolve := func(id ValueID) ValueID {
+            for {
+                v, ok := same[id]
+                if !ok { return id }
+                id = v
+            }
+        }
+        for _, b := range f.Blocks {
+            n := len(b.phis())
+            kept := b.Instrs[:0]
+            for i, ins := range b.Instrs {
+                if i < n {
+                    // of phis only merging each other, in a cycle cut off
+                    // from the entry, one is kept
+                    if v, ok := trivialPhi(ins); ok && resolve(v) != ins.Res { same[ins.Res] = v; continue }
+                }
+                kept = append(kept, ins)
+            }
+            b.Instrs = kept
+        }
+        if len(same) == 0 { return changed }
+        changed = true
+        for _, b := range f.Blocks {
+            for i := range b.Instrs {
+                args := operands(&b.Instrs[i])
+                for j := range args { args[j] = resolve(args[j]) }
+            }
+        }
+    }
+}
+
+// trivialPhi returns the one value other than itself phi ins merges, if it
+// merges just one.
+func trivialPhi(ins Instr) (ValueID, bool) {
+    same := ValueID(-1)
+    for _, a := range ins.Val.Args {
+        if a == same || a == ins.Res { continue }
+        if same >= 0 { return 0, false }
+        same = a
+    }
+    return same, same >= 0
+}
+
+// removePred drops the edge from p, with the phi operands that came along it.
+func (b *BasicBlock) removePred(p *BasicBlock) {
+    for i := 0; i < len(b.Preds); i++ {
+        if b.Preds[i] != p { continue }
+        b.Preds = append(b.Preds[:i], b.Preds[i+1:]...)
+        for j := range b.Instrs {
+            phi := &b.Instrs[j].Val
+            if phi.Op != OpPhi { break }
+            if i < len(phi.Args) { phi.Args = append(phi.Args[:i], phi.Args[i+1:]...) }
+        }
+        i--
+    }
+}
+
+// removeBlocks deletes the dead blocks, which no live block may still jump
+// to, dropping the edges and phi operands they contributed, and renumbers
+// the jump targets of the rest.
+func (f *Function) removeBlocks(dead map[*BasicBlock]bool) {
+    if len(dead) == 0 { return }
+    index := make([]ValueID, len(f.Blocks))
+    var live []*BasicBlock
+    for i, b := range f.Blocks {
+        if dead[b] { delete(f.conds, b); continue }
+        index[i] = ValueID(len(live))
+        live = append(live, b)
+        for _, p := range append([]*BasicBlock(nil), b.Preds...) {
+            if dead[p] { b.removePred(p) }
+        }
+    }
+    f.Blocks = live
+    for _, b := range live {
+        if !b.Terminated() { continue }
+        ts := targets(&b.Instrs[len(b.Instrs)-1].Val)
+        for k, t := range ts { ts[k] = index[t] }
+    }
+}
@@ -0,0 +1,136 @@
+package ir
+
+import (
+    "fmt"
+    "strings"
+)
+
+// gvnFunc numbers the pure values of f so that a value recomputed in a
+// block its first computation dominates becomes a copy of it. It first
+// hoists a computation that both arms of a branch repeat into the branching
+// block, where it dominates both. Loads, stores and calls are never
+// numbered: memory may change between two of them.
+func gvnFunc(f *Function) bool {
+    changed := false
+    for _, b := range f.Blocks {
+        if hoistArms(f, b) { changed = true }
+    }
+    dom := ComputeDominators(f)
+    consts := f.consts()
+    // the table is scoped: what a block adds is only seen by the blocks it
+    // dominates
+    table := map[string]ValueID{}
+    var walk func(b *BasicBlock)
+    walk = func(b *BasicBlock) {
+        var added []string
+        for i := range b.Instrs {
+            ins := &b.Instrs[i]
+            key, ok := valueKey(ins.Val, consts)
+            if !ok { continue }
+            if id, seen := table[key]; seen {
+                ins.Val = Value{ID: ins.Val.ID, Op: OpCopy, Args: []ValueID{id}}
+                changed = true
+                continue
+            }
+            table[key] = ins.Res
+            added = append(added, key)
+        }
+        for _, c := range dom.Children(b) { walk(c) }
+        for _, key := range added { delete(table, key) }
+    }
+    walk(f.entry)
+    propagateCopies(f)
+    return changed
+}
+
+// hoistArms moves a pure computation found in both arms of b's two-way
+// branch, whose operands are all available in b, to the end of b, and makes
+// the one in the second arm a copy of it. Each arm must have b as its only
+// predecessor, so that b dominates it. A constant operand is recreated in b.
+func hoistArms(f *Function, b *BasicBlock) bool {
+    if len(b.Succs) != 2 || b.Succs[0] == b.Succs[1] { return false }
+    s1, s2 := b.Succs[0], b.Succs[1]
+    if len(s1.Preds) != 1 || len(s2.Preds) != 1 || s1 == b || s2 == b { return false }
+    hoisted := false
+    for hoistOne(f, b, s1, s2) { propagateCopies(f); hoisted = true }
+    return hoisted
+}
+
+// hoistOne hoists the first computation of s1 that s2 repeats, reporting
+// whether there was one.
+func hoistOne(f *Function, b, s1, s2 *BasicBlock) bool {
+    consts := f.consts()
+    local := func(s *BasicBlock) map[ValueID]bool {
+        defs := map[ValueID]bool{}
+        for _, ins := range s.Instrs {
+            if ins.Res >= 0 { defs[ins.Res] = true }
+        }
+        return defs
+    }
+    in1, in2 := local(s1), local(s2)
+    // an operand is available in b if neither arm defines it, or if it is a
+    // constant, which b can define again
+    available := func(ins Instr, defs map[ValueID]bool) bool {
+        for _, a := range ins.Val.Args {
+            if _, k := consts[a]; defs[a] && !k { return false }
+        }
+        return true
+    }
+    inS2 := map[string]int{}
+    for j, ins := range s2.Instrs {
+        if !hoistable(ins.Val.Op) || !available(ins, in2) { continue }
+        if key, ok := valueKey(ins.Val, consts); ok { inS2[key] = j }
+    }
+    for i, ins := range s1.Instrs {
+        if !hoistable(ins.Val.Op) || !available(ins, in1) { continue }
+        key, ok := valueKey(ins.Val, consts)
+        if !ok { continue }
+        j, ok := inS2[key]
+        if !ok { continue }
+        next := f.maxValueID() + 1
+        var moved []Instr
+        v := ins.Val
+        v.Args = append([]ValueID(nil), v.Args...)
+        for k, a := range v.Args {
+            if c, isK := consts[a]; isK && in1[a] {
+                moved = append(moved, Instr{Res: next, Val: Value{ID: next, Op: OpConst, Const: c}, Pos: ins.Pos})
+                v.Args[k] = next
+                next++
+            }
+        }
+        moved = append(moved, Instr{Res: ins.Res, Val: v, Pos: ins.Pos})
+        term := b.Instrs[len(b.Instrs)-1]
+        b.Instrs = append(append(b.Instrs[:len(b.Instrs)-1], moved...), term)
+        s1.Instrs = append(s1.Instrs[:i], s1.Instrs[i+1:]...)
+        s2.Instrs[j].Val = Value{ID: s2.Instrs[j].Val.ID, Op: OpCopy, Args: []ValueID{ins.Res}}
+        return true
+    }
+    return false
+}
+
+// hoistable reports whether op may be computed earlier than written. A
+// division is left alone since it can trap, and that must not happen before
+// the arm's other side effects.
+func hoistable(op Op) bool { return op != OpDiv && op != OpUDiv }
+
+// valueKey identifies the value v computes, for pure ops: two values with
+// the same key are equal. Constant operands go by their value rather than
+// their id, and the operands of a commutative op are put in order.
+func valueKey(v Value, consts map[ValueID]int64) (string, bool) {
+    switch v.Op {
+    case OpAdd, OpSub, OpMul, OpDiv, OpAnd, OpOr, OpXor, OpShl, OpShr, OpNot, OpLogicalNot,
+        OpEq, OpNe, OpLt, OpLe, OpGt, OpGe, OpSext, OpZext, OpTrunc, OpGlobalAddr,
+        OpFAdd, OpFSub, OpFMul, OpFDiv, OpF2I, OpI2F, OpULt, OpULe, OpUGt, OpUGe, OpUDiv, OpUShr:
+    default:
+        return "", false
+    }
+    args := make([]string, len(v.Args))
+    for i, a := range v.Args {
+        if k, ok := consts[a]; ok { args[i] = fmt.Sprintf("#%d", k) } else { args[i] = a.String() }
+    }
+    switch v.Op {
+    case OpAdd, OpMul, OpAnd, OpOr, OpXor, OpEq, OpNe, OpFAdd, OpFMul:
+        if args[0] > args[1] { args[0], args[1] = args[1], args[0] }
+    }
+    return fmt.Sprintf("%s %d @%s %s", v.Op, v.Const, v.Sym, strings.Join(args, ",")), true
+}
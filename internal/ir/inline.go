@@ -0,0 +1,186 @@
+package ir
+
+import "fmt"
+
+// DefaultInlineThreshold is the largest callee, in instructions, that is
+// inlined unless -finline-threshold says otherwise.
+const DefaultInlineThreshold = 12
+
+// inliner is the inline pass. It replaces each direct call to a function
+// of its module with at most m.InlineThreshold instructions by a copy of its
+// body. A callee has its own calls inlined before it is copied, so that a
+// caller inlines the already inlined body. A function that can reach itself
+// through calls is never inlined, which keeps this finite, nor is a
+// variadic one.
+type inliner struct {
+    m         *Module
+    byName    map[string]*Function
+    recursive map[*Function]bool
+    done      map[*Function]bool
+}
+
+func (in *inliner) Name() string { return "inline" }
+
+func (in *inliner) Run(f *Function) bool {
+    if in.m.InlineThreshold <= 0 || in.done[f] { return false }
+    // the call graph is read on first use, after the passes before this one
+    // have run on every function: a recursion made a loop no longer counts
+    if in.byName == nil { in.scan() }
+    in.done[f] = true
+    changed := false
+    // only the blocks f has now, and the continuations that take the rest
+    // of them; inlined bodies hold no more candidates
+    for n, i := len(f.Blocks), 0; i < n; i++ {
+        b := f.Blocks[i]
+        for j := 0; j < len(b.Instrs); j++ {
+            v := b.Instrs[j].Val
+            g := in.byName[v.Sym]
+            if v.Op != OpCall || g == nil || g == f || in.recursive[g] || v.Const != 0 { continue }
+            in.Run(g)
+            if g.size() > in.m.InlineThreshold || len(g.paramValues()) != len(v.Args) { continue }
+            b, j = inlineCall(f, b, j, g), -1
+            changed = true
+        }
+    }
+    return changed
+}
+
+// scan finds the module's functions by name and those that are recursive,
+// by a walk over the call graph: a callee still on the stack when it is
+// reached again is recursive, as is everything on the stack above it.
+func (in *inliner) scan() {
+    in.byName, in.recursive, in.done = map[string]*Function{}, map[*Function]bool{}, map[*Function]bool{}
+    for _, f := range in.m.Funcs { in.byName[f.Name] = f }
+    state := map[*Function]int{} // 1 on the stack, 2 done
+    var stack []*Function
+    var visit func(f *Function)
+    visit = func(f *Function) {
+        state[f] = 1
+        stack = append(stack, f)
+        for _, b := range f.Blocks {
+            for _, ins := range b.Instrs {
+                g := in.byName[ins.Val.Sym]
+                if ins.Val.Op != OpCall || g == nil { continue }
+                switch state[g] {
+                case 0: visit(g)
+                case 1:
+                    for i := len(stack) - 1; i >= 0; i-- {
+                        in.recursive[stack[i]] = true
+                        if stack[i] == g { break }
+                    }
+                }
+            }
+        }
+        stack = stack[:len(stack)-1]
+        state[f] = 2
+    }
+    for _, f := range in.m.Funcs {
+        if state[f] == 0 { visit(f) }
+    }
+}
+
+// size is the number of instructions in f.
+func (f *Function) size() int {
+    n := 0
+    for _, b := range f.Blocks { n += len(b.Instrs) }
+    return n
+}
+
+// paramValues returns the values of f's params, in order.
+func (f *Function) paramValues() []ValueID {
+    var ps []ValueID
+    for _, ins := range f.entry.Instrs {
+        if ins.Val.Op == OpParam { ps = append(ps, ins.Res) }
+    }
+    return ps
+}
+
+// inlineCall replaces the call b.Instrs[j] to g with a copy of g's blocks.
+// The instructions after the call move to a continuation block, which each
+// return of the copy jumps to; the call's result becomes the returned value,
+// through a phi when there are several returns. A block of g that falls off
+// its end returns 0, as the emitted code does. It returns the continuation.
+func inlineCall(f *Function, b *BasicBlock, j int, g *Function) *BasicBlock {
+    call := b.Instrs[j]
+    offset := f.maxValueID() + 1
+    next := offset + g.maxValueID() + 1
+    newID := func() ValueID { next++; return next - 1 }
+    params := map[ValueID]ValueID{}
+    for k, p := range g.paramValues() { params[p] = call.Val.Args[k] }
+
+    names := map[string]bool{}
+    for _, x := range f.Blocks { names[x.Name] = true }
+    fresh := func(name string) *BasicBlock {
+        n := len(f.Blocks)
+        for names[fmt.Sprintf("%s_%d", name, n)] { n++ }
+        nb := &BasicBlock{Name: fmt.Sprintf("%s_%d", name, n), sealed: true}
+        names[nb.Name] = true
+        f.Blocks = append(f.Blocks, nb)
+        return nb
+    }
+    blocks := map[*BasicBlock]*BasicBlock{}
+    for _, gb := range g.Blocks { blocks[gb] = fresh(g.Name + "." + trimIndex(gb.Name)) }
+    cont := fresh(g.Name + ".ret")
+
+    // the rest of b follows the call in cont, which takes over b's successors
+    cont.Instrs = append([]Instr(nil), b.Instrs[j+1:]...)
+    cont.Succs = b.Succs
+    for _, s := range b.Succs {
+        for k, p := range s.Preds {
+            if p == b { s.Preds[k] = cont }
+        }
+    }
+    b.Succs = nil
+    b.Instrs = append(b.Instrs[:j], Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(blockIndexOf(f, blocks[g.entry]))}}, Pos: call.Pos})
+    f.addEdge(b, blocks[g.entry])
+
+    var rets []ValueID
+    for _, gb := range g.Blocks {
+        nb := blocks[gb]
+        for _, p := range gb.Preds { nb.Preds = append(nb.Preds, blocks[p]) }
+        for _, s := range gb.Succs { nb.Succs = append(nb.Succs, blocks[s]) }
+        for _, ins := range gb.Instrs {
+            ins.Val.Args = append([]ValueID(nil), ins.Val.Args...)
+            args := operands(&ins)
+            for k := range args { args[k] += offset }
+            for k := len(args); k < len(ins.Val.Args); k++ {
+                ins.Val.Args[k] = ValueID(blockIndexOf(f, blocks[g.Blocks[ins.Val.Args[k]]]))
+            }
+            if ins.Val.Op == OpParam { ins.Val = Value{Op: OpCopy, Args: []ValueID{params[ins.Res]}} }
+            if ins.Res >= 0 { ins.Res += offset }
+            ins.Val.ID = ins.Res
+            if ins.Val.Op == OpRet {
+                rets = append(rets, ins.Val.Args[0])
+                ins = Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(blockIndexOf(f, cont))}}, Pos: ins.Pos}
+                f.addEdge(nb, cont)
+            }
+            nb.Instrs = append(nb.Instrs, ins)
+        }
+        if !nb.Terminated() {
+            zero := newID()
+            nb.Instrs = append(nb.Instrs, Instr{Res: zero, Val: Value{ID: zero, Op: OpConst}},
+                Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(blockIndexOf(f, cont))}}})
+            rets = append(rets, zero)
+            f.addEdge(nb, cont)
+        }
+    }
+    for id, t := range g.Types {
+        if f.Types != nil { f.Types[id+offset] = t }
+    }
+
+    if call.Res >= 0 && len(rets) > 0 {
+        res := Instr{Res: call.Res, Val: Value{ID: call.Res, Op: OpCopy, Args: rets[:1]}, Pos: call.Pos}
+        if len(rets) > 1 { res.Val = Value{ID: call.Res, Op: OpPhi, Args: rets} }
+        cont.Instrs = append([]Instr{res}, cont.Instrs...)
+    }
+    return cont
+}
+
+// trimIndex drops the _N suffix newBlock gives a block's name.
+func trimIndex(name string) string {
+    for i := len(name) - 1; i >= 0; i-- {
+        if name[i] == '_' { return name[:i] }
+        if name[i] < '0' || name[i] > '9' { break }
+    }
+    return name
+}
@@ -2,7 +2,10 @@ package ir
 
 import (
     "fmt"
-    "unsafe"
+    "io"
+    "math"
+    "sort"
+    "strings"
     "github.com/tinyrange/cc/internal/ast"
     ty "github.com/tinyrange/cc/internal/types"
 )
@@ -15,6 +18,50 @@ type Module struct {
     EnumConstants map[string]int64
     StructDefs map[string]*StructDef
     Typedefs map[string]*TypedefDef
+    FuncSigs map[string]*FuncSig
+    // Warnings collects non-fatal diagnostics from BuildModule, formatted
+    // like its errors.
+    Warnings []string
+    // WarnUninitialized enables warnings for reads of locals that were
+    // declared without an initializer and not assigned on some path.
+    WarnUninitialized bool
+    // WarnConstantCondition enables warnings for if and loop conditions that
+    // fold to a constant.
+    WarnConstantCondition bool
+    // OptLevel is the optimization level: 0 runs no passes, 1 the usual
+    // ones, and 2 adds global value numbering.
+    OptLevel int
+    // Passes, when not nil, names the passes to run in place of OptLevel's
+    // pipeline, in order.
+    Passes []string
+    // DisabledPasses names passes to leave out of OptLevel's pipeline.
+    DisabledPasses []string
+    // DumpAfter names a pass, or is "all", after which Optimize writes each
+    // function's IR to Log.
+    DumpAfter string
+    // Stats makes Optimize count, in PassStats, the instructions each pass
+    // removes and adds in each function.
+    Stats     bool
+    PassStats []*PassStat
+    // Log receives the dumps DumpAfter asks for.
+    Log io.Writer
+    // InlineThreshold is the size, in instructions, of the largest callee
+    // inlined; 0 turns inlining off.
+    InlineThreshold int
+    // strLabels maps the contents of each string literal to its label, so
+    // that identical literals share one.
+    strLabels map[string]string
+}
+
+// FuncSig records a function's signature, from a prototype or a definition.
+type FuncSig struct {
+    Name    string
+    Params  []ty.Type
+    Ret     ty.Type
+    Defined bool // a body has been seen
+    Static  bool // any declaration was static
+    Variadic bool // takes arguments beyond Params
+    DefPos  ast.Pos // position of the definition, if Defined
 }
 
 type TypedefDef struct {
@@ -26,6 +73,7 @@ type StructDef struct {
     Name   string
     Fields []StructField
     Size   int // total size in bytes
+    Align  int // alignment of the widest field
 }
 
 type StructField struct {
@@ -40,27 +88,55 @@ func NewModule(name string) *Module {
         EnumConstants: make(map[string]int64),
         StructDefs: make(map[string]*StructDef),
         Typedefs: make(map[string]*TypedefDef),
+        FuncSigs: make(map[string]*FuncSig),
+        strLabels: make(map[string]string),
     }
 }
 
 type Global struct {
     Name string
-    Init int64
+    Init int64 // the value, or with InitSym the addend
+    InitSym string // symbol whose address initializes a pointer
     Array bool
-    Length int // number of elements if Array; element size is 8 for now
+    Length int // number of elements if Array, each ElemSize bytes
     ElemSize int
+    Elem ty.Type // type of an array's elements; unset when read from textual IR
+    Type ty.Type // type of a scalar, likewise
+    Data []byte // initial bytes of an array; the rest of it is zero
+    Elems []int64 // initial elements of an array; the rest of it is zero
+    Static bool // not exported
+    Extern bool // declared only; defined elsewhere
+    Struct string // struct tag of a struct variable, which takes Length bytes
+    Align int // alignment of a struct variable in bytes
 }
 
 type StrLit struct {
     Name string // label
-    Data string // bytes, zero-terminated when emitted
+    Data string // raw bytes, which may include quotes, newlines and NULs; zero-terminated when emitted
 }
 
 type Function struct {
     Name string
-    Params []string
+    Params []ParamInfo
+    Ret ty.Type
     Blocks []*BasicBlock
     entry *BasicBlock
+    Static bool
+    Pos ast.Pos // where it is defined; zero for parsed IR
+    // Types holds the C type of each value the builder gave one: params,
+    // expression results and phis. Values made later, and those of parsed
+    // IR, have none.
+    Types map[ValueID]ty.Type
+    // blocks ending in a branch on a source condition -> its position, to
+    // warn if it turns out constant
+    conds map[*BasicBlock]ast.Pos
+}
+
+// ParamInfo is a named, typed function parameter.
+type ParamInfo struct {
+    Name string
+    Type ty.Type
+    Pos  ast.Pos
 }
 
 type BasicBlock struct {
@@ -71,12 +147,20 @@ type BasicBlock struct {
     Succs []*BasicBlock
 }
 
-func (b *BasicBlock) terminated() bool {
+// Terminated reports whether b ends in a jump, branch or return. A block
+// that does not falls off the end of the function.
+func (b *BasicBlock) Terminated() bool {
     if len(b.Instrs) == 0 { return false }
-    op := b.Instrs[len(b.Instrs)-1].Val.Op
-    return op == OpJmp || op == OpJnz || op == OpRet
+    return isTerminator(b.Instrs[len(b.Instrs)-1].Val.Op)
+}
+
+func isTerminator(op Op) bool {
+    return op == OpJmp || op == OpJnz || op == OpBr || op == OpSwitchTable || op == OpRet
 }
 
+// isCompare reports whether op is a comparison, which an OpBr may apply.
+func isCompare(op Op) bool { return op >= OpEq && op <= OpGe || op >= OpULt && op <= OpUGe }
+
 type ValueID int
 
 type Value struct {
@@ -85,6 +169,7 @@ type Value struct {
     Args []ValueID
     Const int64
     Sym string
+    Scale int64 // the index's multiplier, for OpLoadIdx and OpStoreIdx
 }
 
 type Op int
@@ -121,7 +206,7 @@ const (
     OpPhi  // phi nodes at start of a block; args aligned with Preds
     OpJmp  // unconditional jump; Args[0] holds target block index
     OpJnz  // conditional jump; Args[0]=cond, Args[1]=true blk idx, Args[2]=false blk idx
-    OpCall // function call; Sym=callee, Args[] = arg value ids
+    OpCall // function call; Sym=callee, Args[] = arg value ids; Const=1 if callee is variadic
     OpAddr // address-of local SSA slot; Args[0]=value id whose slot address to take
     OpGlobalAddr // address of global; Sym=name
     OpSlotAddr // address of a frame slot for SSA id; no materialize
@@ -129,11 +214,36 @@ const (
     OpLogicalNot // logical NOT (!); converts 0 to 1, non-zero to 0
     OpF2I        // float to int conversion
     OpI2F        // int to float conversion
+    OpAlloca     // frame region of Const bytes, for arrays, structs and address-taken locals; OpSlotAddr of it is its address
+    // Integer width changes. Values are held in 64 bits, extended according
+    // to the signedness of their type; Const is a width in bits.
+    OpSext  // sign-extend the low Const bits of Args[0]
+    OpZext  // zero-extend the low Const bits of Args[0]
+    OpTrunc // truncate Args[0] to its low Const bits, held zero-extended
+    // compare-and-branch; Const=comparison op (OpEq..OpGe) applied to
+    // Args[0] and Args[1], Args[2]=true blk idx, Args[3]=false blk idx
+    OpBr
+    OpCallIndirect // call through a pointer; Args[0]=callee address, Args[1:] = arg value ids
+    // jump through a table; Args[0]=value, Args[1]=default blk idx, and
+    // Args[2+i]=blk idx for the value Const+i, the default taken outside them
+    OpSwitchTable
+    // memory at Args[0] + Args[1]*Scale + Const, for a Scale of 1, 2, 4 or 8:
+    // OpLoadIdx loads 8 bytes from it and OpStoreIdx stores Args[2] there
+    OpLoadIdx
+    OpStoreIdx
+    // the comparisons, division and right shift of unsigned operands
+    OpULt
+    OpULe
+    OpUGt
+    OpUGe
+    OpUDiv
+    OpUShr
 )
 
 type Instr struct {
     Res ValueID // -1 if none
     Val Value
+    Pos ast.Pos // source position it was lowered from; zero if none
 }
 
 func (f *Function) newBlock(name string) *BasicBlock {
@@ -151,36 +261,75 @@ func (f *Function) addEdge(pred, succ *BasicBlock) {
 
 // BuildModule creates basic SSA IR for Phase 1 (expressions, variables, return)
 func BuildModule(file *ast.File, m *Module) error {
-    // First collect globals
+    // First collect globals; each may be initialized once. A declaration
+    // without an initializer is a tentative definition, which may be
+    // repeated, and extern declarations define nothing
+    defined := map[string]ast.Pos{}
+    define := func(name string, pos ast.Pos, init bool) error {
+        if !init { return nil }
+        if prev, ok := defined[name]; ok {
+            return fmt.Errorf("redefinition of %s at %d:%d (previous definition at %d:%d)", name, pos.Line, pos.Col, prev.Line, prev.Col)
+        }
+        defined[name] = pos
+        return nil
+    }
     for _, d := range file.Decls {
         switch gd := d.(type) {
         case *ast.GlobalDecl:
+            if !gd.Extern {
+                if err := define(gd.Name, gd.Pos, gd.Init != nil || gd.AddrInit != nil); err != nil { return err }
+            }
+            globalType := basicType(gd.Typ, gd.Ptr)
             init := int64(0)
-            if gd.Init != nil { init = gd.Init.Value }
-            globalType := ty.FromBasicType(int(gd.Typ), gd.Ptr)
+            if gd.Init != nil { init = convertConst(gd.Init.Value, globalType) }
             esz := globalType.Size()
-            m.Globals = append(m.Globals, Global{Name: gd.Name, Init: init, ElemSize: esz})
+            g := Global{Name: gd.Name, Init: init, ElemSize: esz, Type: globalType, Static: gd.Static, Extern: gd.Extern}
+            if gd.AddrInit != nil {
+                sym, off, err := m.addrConst(gd.Name, gd.AddrInit, globalType)
+                if err != nil { return err }
+                g.InitSym, g.Init = sym, off
+            }
+            m.addGlobal(g)
         case *ast.GlobalArrayDecl:
-            elemType := ty.FromBasicType(int(gd.Elem), false)
+            if !gd.Extern {
+                if err := define(gd.Name, gd.Pos, gd.HasStr || len(gd.Elems) > 0); err != nil { return err }
+            }
+            elemType := basicType(gd.Elem, gd.Ptr)
             esz := elemType.Size()
-            m.Globals = append(m.Globals, Global{Name: gd.Name, Array: true, Length: gd.Size, ElemSize: esz})
+            g := Global{Name: gd.Name, Array: true, Length: gd.Size, ElemSize: esz, Elem: elemType, Static: gd.Static, Extern: gd.Extern}
+            if gd.HasStr { g.Data = []byte(gd.Str) }
+            for _, k := range gd.Elems { g.Elems = append(g.Elems, convertConst(k, elemType)) }
+            m.addGlobal(g)
+        case *ast.GlobalStructDecl:
+            sd, ok := m.StructDefs[gd.StructType]
+            if !ok {
+                return fmt.Errorf("variable %s has incomplete type struct %s at %d:%d", gd.Name, gd.StructType, gd.Pos.Line, gd.Pos.Col)
+            }
+            m.addGlobal(Global{Name: gd.Name, Struct: gd.StructType, Length: sd.Size, Align: sd.Align, Static: gd.Static, Extern: gd.Extern})
         case *ast.StructDecl:
-            // Calculate struct layout and field offsets
+            // forward declarations carry no layout
+            if gd.Forward { continue }
+            // Calculate struct layout: each field is aligned to its size,
+            // and the whole struct to its widest field
             var fields []StructField
-            offset := 0
+            offset, align := 0, 1
             for _, astField := range gd.Fields {
-                fieldType := ty.FromBasicType(int(astField.Typ), astField.Ptr)
+                fieldType := declType(astField.Typ, astField.Ptr, astField.StructType)
+                sz := fieldType.Size()
+                offset = alignUp(offset, sz)
                 fields = append(fields, StructField{
                     Name:   astField.Name,
                     Type:   fieldType,
                     Offset: offset,
                 })
-                offset += fieldType.Size()
+                offset += sz
+                if sz > align { align = sz }
             }
             m.StructDefs[gd.Name] = &StructDef{
                 Name:   gd.Name,
                 Fields: fields,
-                Size:   offset,
+                Size:   alignUp(offset, align),
+                Align:  align,
             }
         case *ast.EnumDecl:
             // Register enum constants at module level
@@ -189,38 +338,98 @@ func BuildModule(file *ast.File, m *Module) error {
             }
         case *ast.TypedefDecl:
             // Register the typedef
-            targetType := ty.FromBasicType(int(gd.Typ), gd.Ptr)
+            targetType := basicType(gd.Typ, gd.Ptr)
             m.Typedefs[gd.Name] = &TypedefDef{
                 Name: gd.Name,
                 Type: targetType,
             }
+        case *ast.FuncDecl:
+            if err := m.declareFunc(gd); err != nil { return err }
         }
     }
-    // Then build functions
+    // Then build functions; prototypes only contribute their signature
     for _, d := range file.Decls {
         fd, ok := d.(*ast.FuncDecl)
-        if !ok { continue }
-        f := &Function{Name: fd.Name}
-        for _, p := range fd.Params { f.Params = append(f.Params, p.Name) }
+        if !ok || fd.Body == nil { continue }
+        sig := m.FuncSigs[fd.Name]
+        f := &Function{Name: fd.Name, Ret: sig.Ret, Static: sig.Static, Pos: fd.Pos}
+        for i, p := range fd.Params { f.Params = append(f.Params, ParamInfo{Name: p.Name, Type: sig.Params[i], Pos: p.Pos}) }
         b := f.newBlock("entry")
-        ctx := &buildCtx{f: f, b: b, m: m}
-        ctx.initParams()
-        // Set param types from AST
-        for _, p := range fd.Params {
-            if p.Ptr {
-                if p.Typ == ast.BTChar { ctx.varTypes[p.Name] = ty.PointerTo(ty.ByteT()) } else { ctx.varTypes[p.Name] = ty.PointerTo(ty.Int()) }
-            } else {
-                if p.Typ == ast.BTChar { ctx.varTypes[p.Name] = ty.ByteT() } else { ctx.varTypes[p.Name] = ty.Int() }
-            }
-        }
-        // Set function return type
-        if fd.Ret == ast.BTChar { ctx.retType = ty.ByteT() } else { ctx.retType = ty.Int() }
-        if err := ctx.buildBlock(fd.Body); err != nil { return err }
+        ctx := &buildCtx{f: f, b: b, m: m, addrTaken: addrTakenVars(fd.Body), retType: f.Ret}
+        if err := ctx.initParams(); err != nil { return err }
+        if err := ctx.buildStmts(fd.Body.Stmts); err != nil { return err }
+        ctx.checkUninit()
+        ctx.checkFallOff(fd.Pos)
         m.Funcs = append(m.Funcs, f)
     }
     return nil
 }
 
+// declareFunc registers the signature of a prototype or definition. A later
+// declaration of the same function must agree on the parameter count.
+func (m *Module) declareFunc(fd *ast.FuncDecl) error {
+    sig := &FuncSig{Name: fd.Name, Ret: basicType(fd.Ret, false), Defined: fd.Body != nil, Static: fd.Static, Variadic: fd.Variadic, DefPos: fd.Pos}
+    for _, p := range fd.Params { sig.Params = append(sig.Params, declType(p.Typ, p.Ptr, p.StructType)) }
+    if prev, ok := m.FuncSigs[fd.Name]; ok {
+        if len(prev.Params) != len(sig.Params) {
+            return fmt.Errorf("conflicting declarations of %s: %d vs %d parameters", fd.Name, len(prev.Params), len(sig.Params))
+        }
+        if prev.Variadic != sig.Variadic {
+            return fmt.Errorf("conflicting declarations of %s: only one is variadic", fd.Name)
+        }
+        if prev.Defined && sig.Defined {
+            return fmt.Errorf("redefinition of %s at %d:%d (previous definition at %d:%d)", fd.Name, fd.Pos.Line, fd.Pos.Col, prev.DefPos.Line, prev.DefPos.Col)
+        }
+        if prev.Defined { sig.DefPos = prev.DefPos }
+        sig.Defined = sig.Defined || prev.Defined
+        sig.Static = sig.Static || prev.Static
+    }
+    m.FuncSigs[fd.Name] = sig
+    return nil
+}
+
+// addGlobal records a global. An extern declaration only stands in until a
+// definition of the same name arrives, and never replaces one; of repeated
+// definitions, at most one has an initializer, and it is the one kept.
+func (m *Module) addGlobal(g Global) {
+    for i := range m.Globals {
+        prev := &m.Globals[i]
+        if prev.Name != g.Name { continue }
+        if g.Extern { return }
+        if prev.Extern || g.initialized() { g.Static = g.Static || prev.Static; *prev = g }
+        return
+    }
+    m.Globals = append(m.Globals, g)
+}
+
+// elemType is the type of an element of the array g; one read from textual
+// IR has only a size, and is a byte or an int.
+func (g Global) elemType() ty.Type {
+    if g.Elem.K != ty.Invalid { return g.Elem }
+    if g.ElemSize == 1 { return ty.ByteT() }
+    return ty.Int()
+}
+
+// valueType is the type of the scalar g; one read from textual IR has only
+// a size, and is a char or an int.
+func (g Global) valueType() ty.Type {
+    if g.Type.K != ty.Invalid { return g.Type }
+    if g.ElemSize == 1 { return ty.CharT() }
+    return ty.Int()
+}
+
+// initialized reports whether g has an initializer other than zeros.
+func (g Global) initialized() bool {
+    return g.Init != 0 || g.InitSym != "" || len(g.Data) > 0 || len(g.Elems) > 0
+}
+
+// localArray is a local array: its alloca, length and element type.
+type localArray struct {
+    base ValueID
+    size int
+    elem ty.Type
+}
+
 type buildCtx struct {
     f *Function
     b *BasicBlock
@@ -230,53 +439,152 @@ type buildCtx struct {
     breakTargets []*BasicBlock
     contTargets  []*BasicBlock
     m *Module
-    arrays map[string]struct{ base ValueID; size int; elemSize int }
+    arrays map[string]localArray
     // minimal type info
     varTypes map[string]ty.Type
-    // interned string literal labels
-    strLabels map[string]string
     // enum constants
     enumConstants map[string]int64
     // struct variables: varname -> struct type name
     structVars map[string]string
     retType ty.Type
+    // locals whose address is taken live in a frame slot instead of SSA values
+    addrTaken map[string]bool
+    memVars map[string]ValueID // name -> alloca holding it
+    // static and extern locals: variable -> module global holding its value
+    statics map[string]string
+    // scopes maps each visible source name to its variable, innermost last.
+    // A shadowing declaration gets a fresh variable so that the maps above,
+    // which are keyed by variable, never mix up same-named locals.
+    scopes []map[string]string
+    declCount map[string]int
+    declPos map[string]ast.Pos // variable -> where it was declared
+    // source position of the statement or expression being lowered, for
+    // the instructions made for it
+    pos ast.Pos
+    // removed trivial phis -> the value each was replaced by
+    replaced map[ValueID]ValueID
+    // phis -> the variable each was made for
+    phiVars map[ValueID]string
+    // uninitialized use check: markers for unassigned locals, and reads
+    uninit map[ValueID]bool
+    reads []uninitRead
 }
 
-func (c *buildCtx) initParams() {
+// errorf reports an error at pos, prefixed with the enclosing function name.
+func (c *buildCtx) errorf(pos ast.Pos, format string, args ...interface{}) error {
+    return fmt.Errorf("%s:%d:%d: %s", c.f.Name, pos.Line, pos.Col, fmt.Sprintf(format, args...))
+}
+
+// warnf records a warning at pos in the same format as errorf.
+func (c *buildCtx) warnf(pos ast.Pos, format string, args ...interface{}) {
+    c.m.Warnings = append(c.m.Warnings, fmt.Sprintf("%s:%d:%d: %s", c.f.Name, pos.Line, pos.Col, fmt.Sprintf(format, args...)))
+}
+
+func (c *buildCtx) initParams() error {
     c.curDef = map[*BasicBlock]map[string]ValueID{}
     c.pending = map[*BasicBlock]map[string]ValueID{}
-    c.arrays = map[string]struct{ base ValueID; size int; elemSize int }{}
+    c.arrays = map[string]localArray{}
     c.varTypes = map[string]ty.Type{}
-    c.strLabels = map[string]string{}
     c.enumConstants = map[string]int64{}
     c.structVars = map[string]string{}
+    c.memVars = map[string]ValueID{}
+    c.statics = map[string]string{}
+    c.declCount = map[string]int{}
+    c.declPos = map[string]ast.Pos{}
     c.curDef[c.b] = map[string]ValueID{}
+    // params share the outermost scope with the function body
+    c.pushScope()
+    var paramIDs []ValueID
     for _, p := range c.f.Params {
+        c.pos = p.Pos
         id := c.newValue(OpParam, nil, 0)
-        c.writeVar(p, c.b, id)
-        // default int for now; parser now carries types but Function.Params is []string only.
-        // Keep int until function signature typing is added to IR.
-        c.varTypes[p] = ty.Int()
+        v, err := c.declare(p.Name, p.Pos)
+        if err != nil { return err }
+        c.writeVar(v, c.b, id)
+        paramIDs = append(paramIDs, id)
+        c.varTypes[v] = p.Type
+        c.setType(id, p.Type)
+    }
+    // spill address-taken params to their frame slots after all OpParams
+    for i, p := range c.f.Params {
+        if c.addrTaken[p.Name] { c.newMemVar(c.resolve(p.Name), paramIDs[i], p.Type) }
+    }
+    return nil
+}
+
+// alloca reserves a frame region of size bytes. Its contents start out
+// undefined; OpSlotAddr of the result is the region's lowest address.
+func (c *buildCtx) alloca(size int) ValueID {
+    if size < 1 { size = 1 }
+    return c.newValue(OpAlloca, nil, int64(size))
+}
+
+// newMemVar reserves a frame slot for an address-taken local and stores v into it.
+func (c *buildCtx) newMemVar(name string, v ValueID, t ty.Type) {
+    slot := c.alloca(8)
+    c.memVars[name] = slot
+    c.storeTyped(c.add(OpSlotAddr, slot), v, t)
+}
+
+// storeTyped stores v through ptr using the access width of t.
+func (c *buildCtx) storeTyped(ptr, v ValueID, t ty.Type) {
+    if t.Size() == 1 { c.add(OpStore8, ptr, v) } else { c.add(OpStore, ptr, v) }
+}
+
+// convert changes the integer v from type from to type to. A value is already
+// extended for its own type, so only a narrower target, or a change of
+// signedness below 64 bits, needs an instruction.
+func (c *buildCtx) convert(v ValueID, from, to ty.Type) ValueID {
+    if from.IsPointer() || to.IsPointer() || from.IsFloat() || to.IsFloat() { return v }
+    w, fw := to.Bits(), from.Bits()
+    switch {
+    case w >= 64 || (w > fw && from.IsSigned() == to.IsSigned()):
+        return v
+    case to.IsSigned():
+        if w > fw { return v } // a zero-extended value fits
+        return c.newValue(OpSext, []ValueID{v}, int64(w))
+    case w < fw:
+        return c.newValue(OpTrunc, []ValueID{v}, int64(w))
+    }
+    return c.newValue(OpZext, []ValueID{v}, int64(w))
+}
+
+// convertConst is convert for the constant k, as it is emitted as data.
+func convertConst(k int64, t ty.Type) int64 {
+    if t.IsPointer() || t.IsFloat() || t.Bits() >= 64 { return k }
+    if t.IsSigned() { return extendConst(OpSext, k, int64(t.Bits())) }
+    return extendConst(OpZext, k, int64(t.Bits()))
+}
+
+// loadTyped loads a value of type t through ptr.
+func (c *buildCtx) loadTyped(ptr ValueID, t ty.Type) ValueID {
+    if t.Size() == 1 {
+        v := c.add(OpLoad8, ptr)
+        if t.IsSigned() { v = c.newValue(OpSext, []ValueID{v}, 8) }
+        return v
     }
+    return c.add(OpLoad, ptr)
 }
 
 func (c *buildCtx) newValue(op Op, args []ValueID, k int64) ValueID {
     id := c.nextID
     c.nextID++
     v := Value{ID: id, Op: op, Args: append([]ValueID(nil), args...), Const: k}
-    instr := Instr{Res: id, Val: v}
+    instr := Instr{Res: id, Val: v, Pos: c.pos}
     c.b.Instrs = append(c.b.Instrs, instr)
     return id
 }
 
+// emit appends v, which has no result, such as a store or a terminator.
+func (c *buildCtx) emit(v Value) {
+    c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: v, Pos: c.pos})
+}
+
 func (c *buildCtx) add(op Op, args ...ValueID) ValueID { return c.newValue(op, args, 0) }
 func (c *buildCtx) iconst(v int64) ValueID { return c.newValue(OpConst, nil, v) }
 
-func (c *buildCtx) fconst(v float64) ValueID { 
-    // Store float64 bits as int64
-    bits := int64(*(*uint64)(unsafe.Pointer(&v)))
-    return c.newValue(OpFConst, nil, bits) 
-}
+// fconst adds a float constant, held as its bits in Const.
+func (c *buildCtx) fconst(v float64) ValueID { return c.newValue(OpFConst, nil, int64(math.Float64bits(v))) }
 
 func (c *buildCtx) writeVar(name string, blk *BasicBlock, id ValueID) {
     if c.curDef[blk] == nil { c.curDef[blk] = map[string]ValueID{} }
@@ -295,7 +603,7 @@ func (c *buildCtx) readVar(name string, blk *BasicBlock) (ValueID, error) {
         case 1:
             return c.readVar(name, blk.Preds[0])
         default:
-            phi := c.newPhi(blk)
+            phi := c.newPhi(blk, name)
             c.writeVar(name, blk, phi)
             if c.pending[blk] == nil { c.pending[blk] = map[string]ValueID{} }
             c.pending[blk][name] = phi
@@ -303,174 +611,355 @@ func (c *buildCtx) readVar(name string, blk *BasicBlock) (ValueID, error) {
         }
     }
     if len(blk.Preds) == 0 {
-        return 0, fmt.Errorf("undefined variable %s", name)
+        if blk == c.f.entry { return 0, fmt.Errorf("undefined variable %s", name) }
+        // nothing jumps here, as to a loop's step when its body always
+        // returns; the code is unreachable and any value will do
+        return c.unreachableValue(name, blk), nil
     } else if len(blk.Preds) == 1 {
         return c.readVar(name, blk.Preds[0])
     }
-    // multiple predecessors: create phi
-    phi := c.newPhi(blk)
+    // multiple predecessors: create phi; it is recorded before its operands
+    // are read so that a loop reaching back here finds it
+    phi := c.newPhi(blk, name)
     c.writeVar(name, blk, phi)
-    if blk.sealed {
-        // fill operands now
-        c.addPhiOperands(blk, phi, name)
-    }
-    return phi, nil
+    v, err := c.addPhiOperands(blk, phi, name)
+    if err != nil { return 0, err }
+    c.writeVar(name, blk, v)
+    return v, nil
 }
 
-func (c *buildCtx) newPhi(blk *BasicBlock) ValueID {
+// unreachableValue stands in for name in blk, which has no predecessors.
+func (c *buildCtx) unreachableValue(name string, blk *BasicBlock) ValueID {
+    id := c.nextID
+    c.nextID++
+    ins := Instr{Res: id, Val: Value{ID: id, Op: OpConst}, Pos: c.pos}
+    blk.Instrs = append([]Instr{ins}, blk.Instrs...)
+    c.setType(id, c.varTypes[name])
+    c.writeVar(name, blk, id)
+    return id
+}
+
+// newPhi makes an empty phi for the variable name at the start of blk. It
+// has the variable's type until its operands are known.
+func (c *buildCtx) newPhi(blk *BasicBlock, name string) ValueID {
     id := c.nextID
     c.nextID++
     v := Value{ID: id, Op: OpPhi}
-    ins := Instr{Res: id, Val: v}
+    ins := Instr{Res: id, Val: v, Pos: c.pos}
     // insert at block start
     blk.Instrs = append([]Instr{ins}, blk.Instrs...)
+    if c.phiVars == nil { c.phiVars = map[ValueID]string{} }
+    c.phiVars[id] = name
+    c.setType(id, c.varTypes[name])
     return id
 }
 
-func (c *buildCtx) addPhiOperands(blk *BasicBlock, phi ValueID, name string) {
-    // locate phi instr
+// setType records t as the type of v, unless v already has one: a cast that
+// needs no instruction hands back its operand, which keeps its own type.
+func (c *buildCtx) setType(v ValueID, t ty.Type) {
+    if c.f.Types == nil { c.f.Types = map[ValueID]ty.Type{} }
+    if _, ok := c.f.Types[v]; !ok && t.K != ty.Invalid { c.f.Types[v] = t }
+}
+
+// joinPhiType sets the type of phi from its operands: the wider of integer
+// types, while pointers keep the variable's pointer type. A pointer on one
+// path and an integer on another is reported.
+func (c *buildCtx) joinPhiType(phi ValueID, args []ValueID) {
+    t, ok := c.f.Types[phi]
+    for _, a := range args {
+        at, known := c.f.Types[a]
+        if !known || a == phi { continue }
+        switch {
+        case !ok:
+            t, ok = at, true
+        case t.IsPointer() != at.IsPointer():
+            // shadowing declarations are numbered name#n
+            name := c.phiVars[phi]
+            src := strings.SplitN(name, "#", 2)[0]
+            c.warnf(c.declPos[name], "%s is a pointer on one path and an integer on another", src)
+            return
+        case !t.IsPointer() && at.Size() > t.Size():
+            t = at
+        }
+    }
+    if ok { c.f.Types[phi] = t }
+}
+
+// addPhiOperands fills phi from the predecessors of blk and returns the value
+// that stands for it, which is another value if the phi turned out trivial.
+func (c *buildCtx) addPhiOperands(blk *BasicBlock, phi ValueID, name string) (ValueID, error) {
+    var args []ValueID
+    for _, p := range blk.Preds {
+        v, err := c.readVar(name, p)
+        if err != nil { return 0, err }
+        args = append(args, v)
+    }
     for i := range blk.Instrs {
         if blk.Instrs[i].Res == phi && blk.Instrs[i].Val.Op == OpPhi {
-            var args []ValueID
-            for _, p := range blk.Preds {
-                v, _ := c.readVar(name, p)
-                args = append(args, v)
-            }
             blk.Instrs[i].Val.Args = args
-            return
+            c.joinPhiType(phi, args)
+            return c.tryRemoveTrivialPhi(blk, phi), nil
+        }
+    }
+    // reading the operands may have replaced phi already
+    return c.replacement(phi), nil
+}
+
+// tryRemoveTrivialPhi removes phi if all its operands other than itself are
+// one value, and rewrites every use to that value (Braun et al. 2013). Phis
+// that used it may become trivial in turn and are retried. A phi with no
+// such operand is left alone: it is incomplete or unreachable.
+func (c *buildCtx) tryRemoveTrivialPhi(blk *BasicBlock, phi ValueID) ValueID {
+    at := -1
+    for i := range blk.Instrs {
+        if blk.Instrs[i].Res == phi && blk.Instrs[i].Val.Op == OpPhi { at = i; break }
+    }
+    if at < 0 { return c.replacement(phi) }
+    same := ValueID(-1)
+    for _, a := range blk.Instrs[at].Val.Args {
+        if a == same || a == phi { continue }
+        if same >= 0 { return phi }
+        same = a
+    }
+    if same < 0 { return phi }
+    blk.Instrs = append(blk.Instrs[:at], blk.Instrs[at+1:]...)
+    for _, u := range c.replaceValue(phi, same) { c.tryRemoveTrivialPhi(u.blk, u.id) }
+    return same
+}
+
+type phiRef struct {
+    blk *BasicBlock
+    id  ValueID
+}
+
+// replaceValue rewrites every use of old to new, in instructions and in the
+// builder's variable maps, and returns the phis that used old.
+func (c *buildCtx) replaceValue(old, new ValueID) []phiRef {
+    if c.replaced == nil { c.replaced = map[ValueID]ValueID{} }
+    c.replaced[old] = new
+    var users []phiRef
+    for _, b := range c.f.Blocks {
+        for i := range b.Instrs {
+            ins := &b.Instrs[i]
+            // jump targets are block indices, not values
+            args := operands(ins)
+            used := false
+            for j := range args {
+                if args[j] == old { args[j] = new; used = true }
+            }
+            if used && ins.Val.Op == OpPhi && ins.Res != new { users = append(users, phiRef{b, ins.Res}) }
         }
     }
+    for _, defs := range c.curDef {
+        for name, v := range defs { if v == old { defs[name] = new } }
+    }
+    for _, defs := range c.pending {
+        for name, v := range defs { if v == old { defs[name] = new } }
+    }
+    return users
+}
+
+// replacement follows the values removed phis were replaced by.
+func (c *buildCtx) replacement(v ValueID) ValueID {
+    for {
+        n, ok := c.replaced[v]
+        if !ok { return v }
+        v = n
+    }
 }
 
-func (c *buildCtx) sealBlock(blk *BasicBlock) {
-    if blk.sealed { return }
+func (c *buildCtx) sealBlock(blk *BasicBlock) error {
+    if blk.sealed { return nil }
     blk.sealed = true
+    // fill the phis in creation order, so that any phis this creates in turn
+    // are numbered the same on every run
     pend := c.pending[blk]
-    for name, phi := range pend {
-        c.addPhiOperands(blk, phi, name)
+    names := make([]string, 0, len(pend))
+    for name := range pend { names = append(names, name) }
+    sort.Slice(names, func(i, j int) bool { return pend[names[i]] < pend[names[j]] })
+    for _, name := range names {
+        if _, err := c.addPhiOperands(blk, pend[name], name); err != nil { return err }
     }
     delete(c.pending, blk)
+    return nil
+}
+
+func (c *buildCtx) pushScope() { c.scopes = append(c.scopes, map[string]string{}) }
+
+// popScope ends the innermost scope. Its variables are forgotten so that a
+// later use of the same name resolves outward again.
+func (c *buildCtx) popScope() {
+    for _, v := range c.scopes[len(c.scopes)-1] {
+        delete(c.varTypes, v)
+        delete(c.memVars, v)
+        delete(c.arrays, v)
+        delete(c.structVars, v)
+        delete(c.statics, v)
+    }
+    c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+// declare introduces name in the innermost scope and returns its variable:
+// the name itself the first time, then name#N for each shadowing one. A name
+// may only be declared once per scope.
+func (c *buildCtx) declare(name string, pos ast.Pos) (string, error) {
+    scope := c.scopes[len(c.scopes)-1]
+    if prev, ok := scope[name]; ok {
+        at := c.declPos[prev]
+        return "", c.errorf(pos, "redeclaration of %s (previous declaration at %d:%d)", name, at.Line, at.Col)
+    }
+    v := name
+    if n := c.declCount[name]; n > 0 { v = fmt.Sprintf("%s#%d", name, n) }
+    c.declCount[name]++
+    c.declPos[v] = pos
+    scope[name] = v
+    return v, nil
+}
+
+// resolve returns the variable a name refers to, searching scopes outward.
+// Names with no local declaration (globals, enum constants) come back as is.
+func (c *buildCtx) resolve(name string) string {
+    for i := len(c.scopes) - 1; i >= 0; i-- {
+        if v, ok := c.scopes[i][name]; ok { return v }
+    }
+    return name
 }
 
+// isLocal reports whether name currently refers to a local declaration.
+func (c *buildCtx) isLocal(name string) bool {
+    for i := len(c.scopes) - 1; i >= 0; i-- {
+        if _, ok := c.scopes[i][name]; ok { return true }
+    }
+    return false
+}
+
+// buildBlock builds a compound statement in a scope of its own.
 func (c *buildCtx) buildBlock(b *ast.BlockStmt) error {
-    for _, s := range b.Stmts {
+    c.pushScope()
+    err := c.buildStmts(b.Stmts)
+    c.popScope()
+    return err
+}
+
+func (c *buildCtx) buildStmts(stmts []ast.Stmt) error {
+    for _, s := range stmts {
+        // nothing may follow a return, break or continue in its block; the
+        // dead statements are dropped
+        if c.b.Terminated() {
+            c.warnf(ast.StmtPos(s), "unreachable code")
+            return nil
+        }
+        c.pos = ast.StmtPos(s)
         switch s := s.(type) {
         case *ast.ReturnStmt:
             v, t, err := c.buildExprWithType(s.Expr)
             if err != nil { return err }
             // simple type check: disallow pointer returns for now
             if t.IsPointer() {
-                return fmt.Errorf("%s:%d:%d: type error: returning pointer not supported", c.f.Name, s.Pos.Line, s.Pos.Col)
+                return c.errorf(s.Pos, "type error: returning pointer not supported")
             }
-            c.add(OpRet, v)
+            c.add(OpRet, c.convert(v, t, c.retType))
         case *ast.DeclStmt:
-            if s.Init != nil {
-                v, t, err := c.buildExprWithType(s.Init)
-                if err != nil { return err }
-                c.writeVar(s.Name, c.b, v)
-                c.varTypes[s.Name] = t
-            } else {
-                c.writeVar(s.Name, c.b, c.iconst(0))
-                
-                // Determine variable type
-                var varType ty.Type
-                if s.TypedefName != "" {
-                    // Look up typedef
-                    if typedef, exists := c.m.Typedefs[s.TypedefName]; exists {
-                        varType = typedef.Type
-                        if s.Ptr {
-                            varType = ty.PointerTo(varType)
-                        }
-                    } else {
-                        return fmt.Errorf("unknown typedef: %s", s.TypedefName)
-                    }
-                } else {
-                    // Regular type
+            if s.Static || s.Extern {
+                if err := c.declareGlobalLocal(s); err != nil { return err }
+                break
+            }
+            // Determine variable type
+            var varType ty.Type
+            if s.TypedefName != "" {
+                // Look up typedef
+                if typedef, exists := c.m.Typedefs[s.TypedefName]; exists {
+                    varType = typedef.Type
                     if s.Ptr {
-                        if s.Typ == ast.BTChar { varType = ty.PointerTo(ty.ByteT()) } else { varType = ty.PointerTo(ty.Int()) }
-                    } else {
-                        if s.Typ == ast.BTChar { varType = ty.ByteT() } else { varType = ty.Int() }
+                        varType = ty.PointerTo(varType)
                     }
+                } else {
+                    return c.errorf(s.Pos, "unknown typedef: %s", s.TypedefName)
                 }
-                c.varTypes[s.Name] = varType
+            } else {
+                // Regular type
+                varType = declType(s.Typ, s.Ptr, s.StructType)
             }
-        case *ast.AssignStmt:
-            // If assigning to a global (and no local of same name), emit store to global
-            if g, ok := c.lookupGlobal(s.Name); ok {
-                if _, isLocal := c.varTypes[s.Name]; !isLocal {
-                    val, _, err := c.buildExprWithType(s.Value)
-                    if err != nil { return err }
-                    addr := c.newValue(OpGlobalAddr, nil, 0)
-                    c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = g.Name
-                    if g.ElemSize == 1 { c.add(OpStore8, addr, val) } else { c.add(OpStore, addr, val) }
-                    break
-                }
+            if s.Func { varType = ty.PointerTo(ty.FuncOf(varType)) }
+            var v ValueID
+            if s.Init != nil {
+                iv, it, err := c.buildExprWithType(s.Init)
+                if err != nil { return err }
+                v = c.convert(iv, it, varType)
+                // a null pointer constant is a pointer, not an int 0
+                if varType.IsPointer() && isNullConst(s.Init) { c.f.Types[v] = varType }
+            } else {
+                v = c.iconst(0)
+                c.markUninit(v)
             }
-            v, t, err := c.buildExprWithType(s.Value)
+            // declared after the initializer, which still sees any outer x
+            name, err := c.declare(s.Name, s.Pos)
             if err != nil { return err }
-            // simple type checks for locals: pointer vs non-pointer, char vs pointer
-            if vt, ok := c.varTypes[s.Name]; ok {
-                if vt.IsPointer() != t.IsPointer() {
-                    return fmt.Errorf("%s:%d:%d: type error: cannot assign %s to %s", c.f.Name, s.Pos.Line, s.Pos.Col, typeStr(t), typeStr(vt))
-                }
+            c.varTypes[name] = varType
+            if c.addrTaken[s.Name] {
+                c.newMemVar(name, v, varType)
+            } else {
+                c.writeVar(name, c.b, v)
             }
-            c.writeVar(s.Name, c.b, v)
-            // update visible type
-            c.varTypes[s.Name] = t
+        case *ast.AssignStmt:
+            if _, _, err := c.buildAssign(s.Name, s.Value, s.Pos); err != nil { return err }
         case *ast.ArrayDeclStmt:
-            // Reserve contiguous stack slots by creating 'size' SSA values
-            var base ValueID = -1
-            for i := 0; i < s.Size; i++ {
-                id := c.iconst(0)
-                if i == 0 { base = id }
-            }
-            elemType := ty.FromBasicType(int(s.Elem), false)
+            // Reserve one frame region for the whole array
+            elemType := basicType(s.Elem, false)
+            if s.Func { elemType = ty.PointerTo(ty.FuncOf(elemType)) }
             esz := elemType.Size()
-            c.arrays[s.Name] = struct{ base ValueID; size int; elemSize int }{base: base, size: s.Size, elemSize: esz}
+            base := c.alloca(s.Size * esz)
+            name, err := c.declare(s.Name, s.Pos)
+            if err != nil { return err }
+            c.arrays[name] = localArray{base: base, size: s.Size, elem: elemType}
+            // an initializer list stores every element, zero-filling the tail
+            if s.Init != nil {
+                basePtr := c.add(OpSlotAddr, base)
+                for i := 0; i < s.Size; i++ {
+                    var v ValueID
+                    if i < len(s.Init) {
+                        iv, it, err := c.buildExprWithType(s.Init[i])
+                        if err != nil { return err }
+                        v = c.convert(iv, it, elemType)
+                    } else {
+                        v = c.iconst(0)
+                    }
+                    ptr := c.add(OpAdd, basePtr, c.iconst(int64(i*esz)))
+                    c.storeTyped(ptr, v, elemType)
+                }
+            }
         case *ast.ArrayAssignStmt:
             // Compute address base + index*8 and store value
-            if arr, ok := c.arrays[s.Name]; ok {
+            if arr, ok := c.arrays[c.resolve(s.Name)]; ok {
                 basePtr := c.add(OpSlotAddr, arr.base)
                 idxVal, _, err := c.buildExprWithType(s.Index)
                 if err != nil { return err }
-                scale := c.iconst(int64(arr.elemSize))
+                scale := c.iconst(int64(arr.elem.Size()))
                 off := c.add(OpMul, idxVal, scale)
                 ptr := c.add(OpAdd, basePtr, off)
-                val, _, err := c.buildExprWithType(s.Value)
+                val, vt, err := c.buildExprWithType(s.Value)
                 if err != nil { return err }
-                if arr.elemSize == 1 { c.add(OpStore8, ptr, val) } else { c.add(OpStore, ptr, val) }
+                if val, err = c.storeConv(s.Value, val, vt, arr.elem); err != nil { return err }
+                c.storeTyped(ptr, val, arr.elem)
                 break
             }
-            // global array
-            if c.m != nil {
-                for _, g := range c.m.Globals {
-                    if g.Name == s.Name && g.Array {
-                        base := c.newValue(OpGlobalAddr, nil, 0)
-                        c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = g.Name
-                        idxVal, _, err := c.buildExprWithType(s.Index)
-                        if err != nil { return err }
-                        esz := 8
-                        if g.Array && g.Length >= 0 && g.Name == s.Name {
-                            // g is the target; ElemSize isn't stored yet; assume 8 for int for now
-                        }
-                        scale := c.iconst(int64(esz))
-                        off := c.add(OpMul, idxVal, scale)
-                        ptr := c.add(OpAdd, base, off)
-                        val, _, err := c.buildExprWithType(s.Value)
-                        if err != nil { return err }
-                        // we don't track elem size on Global yet; default 8
-                        c.add(OpStore, ptr, val)
-                        break
-                    }
-                }
-                // if not found, error
-                // Note: fallthrough if found; otherwise return error
-                found := false
-                for _, g := range c.m.Globals { if g.Name == s.Name && g.Array { found = true; break } }
-                if !found { return fmt.Errorf("unknown array %s", s.Name) }
-            } else {
-                return fmt.Errorf("unknown array %s", s.Name)
+            // global array, unless a local of that name hides it
+            if c.isLocal(s.Name) {
+                return c.errorf(s.Pos, "%s is not an array", s.Name)
             }
+            g, ok := c.lookupGlobal(s.Name)
+            if !ok || !g.Array { return c.errorf(s.Pos, "unknown array %s", s.Name) }
+            et := g.elemType()
+            base := c.newValue(OpGlobalAddr, nil, 0)
+            c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = g.Name
+            idxVal, _, err := c.buildExprWithType(s.Index)
+            if err != nil { return err }
+            off := c.add(OpMul, idxVal, c.iconst(int64(et.Size())))
+            ptr := c.add(OpAdd, base, off)
+            val, vt, err := c.buildExprWithType(s.Value)
+            if err != nil { return err }
+            if val, err = c.storeConv(s.Value, val, vt, et); err != nil { return err }
+            c.storeTyped(ptr, val, et)
         case *ast.IfStmt:
             if err := c.buildIf(s); err != nil { return err }
         case *ast.WhileStmt:
@@ -480,16 +969,16 @@ func (c *buildCtx) buildBlock(b *ast.BlockStmt) error {
         case *ast.DoWhileStmt:
             if err := c.buildDoWhile(s); err != nil { return err }
         case *ast.BreakStmt:
-            if len(c.breakTargets) == 0 { return fmt.Errorf("break outside loop") }
+            if len(c.breakTargets) == 0 { return c.errorf(s.Pos, "break outside loop") }
             t := c.breakTargets[len(c.breakTargets)-1]
             ti := blockIndexOf(c.f, t)
-            c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ti)}}})
+            c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(ti)}})
             c.f.addEdge(c.b, t)
         case *ast.ContinueStmt:
-            if len(c.contTargets) == 0 { return fmt.Errorf("continue outside loop") }
+            if len(c.contTargets) == 0 { return c.errorf(s.Pos, "continue outside loop") }
             t := c.contTargets[len(c.contTargets)-1]
             ti := blockIndexOf(c.f, t)
-            c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ti)}}})
+            c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(ti)}})
             c.f.addEdge(c.b, t)
         case *ast.SwitchStmt:
             if err := c.buildSwitch(s); err != nil { return err }
@@ -500,77 +989,40 @@ func (c *buildCtx) buildBlock(b *ast.BlockStmt) error {
         case *ast.StructVarDeclStmt:
             // Allocate space for struct on stack by creating a slot address
             if structDef, ok := c.m.StructDefs[s.StructType]; ok {
-                // Create a placeholder value to get a slot, then get its address
-                // Initialize with zero
-                structBase := c.iconst(0)
-                // Get the address of this slot - this will be our struct base address
+                // Reserve a frame region to hold the whole struct
+                structBase := c.alloca(structDef.Size)
+                // Get the address of the region - this will be our struct base address
                 structAddr := c.add(OpSlotAddr, structBase)
-                c.writeVar(s.Name, c.b, structAddr)
+                name, err := c.declare(s.Name, s.Pos)
+                if err != nil { return err }
+                c.writeVar(name, c.b, structAddr)
                 // Track which variables are structs and what type
-                c.structVars[s.Name] = s.StructType
-                // Set type information
-                c.varTypes[s.Name] = ty.PointerTo(ty.Int()) // pointer to struct (simplified)
-                _ = structDef // use variable
+                c.structVars[name] = s.StructType
+                // the variable's value is the struct's address
+                c.varTypes[name] = ty.PointerTo(ty.StructOf(s.StructType))
             } else {
-                return fmt.Errorf("unknown struct type: %s", s.StructType)
+                return c.errorf(s.Pos, "unknown struct type: %s", s.StructType)
             }
         case *ast.FieldAssignStmt:
-            // Look up struct type
-            structTypeName, isStruct := c.structVars[s.Base]
-            if !isStruct {
-                return fmt.Errorf("%s is not a struct variable", s.Base)
-            }
-            
-            // Get struct definition
-            structDef, exists := c.m.StructDefs[structTypeName]
-            if !exists {
-                return fmt.Errorf("struct type %s not defined", structTypeName)
-            }
-            
-            // Find field
-            var field *StructField
-            for i := range structDef.Fields {
-                if structDef.Fields[i].Name == s.Field {
-                    field = &structDef.Fields[i]
-                    break
-                }
-            }
-            if field == nil {
-                return fmt.Errorf("field %s not found in struct %s", s.Field, structTypeName)
-            }
-            
-            // Get base struct variable
-            baseVar, err := c.readVar(s.Base, c.b)
-            if err != nil {
-                return err
-            }
-            
+            addr, field, err := c.fieldAddr(s.Base, s.Field, s.Arrow)
+            if err != nil { return err }
             // Build value expression
-            val, _, err := c.buildExprWithType(s.Value)
-            if err != nil {
-                return err
-            }
-            
-            // Calculate field address and store
-            if field.Offset == 0 {
-                // First field, no offset needed
-                if field.Type.Size() == 1 {
-                    c.add(OpStore8, baseVar, val)
-                } else {
-                    c.add(OpStore, baseVar, val)
-                }
-            } else {
-                // Add offset
-                offsetConst := c.iconst(int64(field.Offset))
-                fieldAddr := c.add(OpAdd, baseVar, offsetConst)
-                if field.Type.Size() == 1 {
-                    c.add(OpStore8, fieldAddr, val)
-                } else {
-                    c.add(OpStore, fieldAddr, val)
-                }
-            }
+            val, vt, err := c.buildExprWithType(s.Value)
+            if err != nil { return err }
+            if val, err = c.storeConv(s.Value, val, vt, field.Type); err != nil { return err }
+            c.storeTyped(addr, val, field.Type)
+        case *ast.DerefAssignStmt:
+            ptr, pt, err := c.buildExprWithType(s.Ptr)
+            if err != nil { return err }
+            val, vt, err := c.buildExprWithType(s.Value)
+            if err != nil { return err }
+            // store width follows the pointee type (default int)
+            et := ty.Int()
+            if pt.IsPointer() && pt.Elem != nil { et = *pt.Elem }
+            if val, err = c.storeConv(s.Value, val, vt, et); err != nil { return err }
+            c.storeTyped(ptr, val, et)
         default:
-            return fmt.Errorf("unsupported stmt type")
+            return c.errorf(ast.StmtPos(s), "unsupported stmt type")
         }
     }
     return nil
@@ -582,8 +1034,18 @@ func (c *buildCtx) buildExpr(e ast.Expr) (ValueID, error) {
     return v, err
 }
 
-// buildExprWithType builds the expression and returns its SSA value and a minimal type.
+// buildExprWithType builds e, returning its value and C type, and records
+// the type for the value.
 func (c *buildCtx) buildExprWithType(e ast.Expr) (ValueID, ty.Type, error) {
+    outer := c.pos
+    if p := ast.ExprPos(e); p.Line > 0 { c.pos = p }
+    v, t, err := c.buildTypedExpr(e)
+    c.pos = outer
+    if err == nil { c.setType(v, t) }
+    return v, t, err
+}
+
+func (c *buildCtx) buildTypedExpr(e ast.Expr) (ValueID, ty.Type, error) {
     switch e := e.(type) {
     case *ast.IntLit:
         return c.iconst(e.Value), ty.Int(), nil
@@ -592,35 +1054,61 @@ func (c *buildCtx) buildExprWithType(e ast.Expr) (ValueID, ty.Type, error) {
         return c.fconst(e.Value), ty.DoubleT(), nil
     case *ast.StringLit:
         // materialize string literal in module rodata and return its address
-        lbl := c.internString(e.Value)
+        lbl := c.m.internString(e.Value)
         id := c.newValue(OpGlobalAddr, nil, 0)
         c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = lbl
         // type: pointer to byte
         return id, ty.PointerTo(ty.ByteT()), nil
     case *ast.Ident:
-        if v, err := c.readVar(e.Name, c.b); err == nil {
-            // obtain variable type if known; default int
-            t := c.varTypes[e.Name]
-            if t.K == 0 && !t.IsPointer() { t = ty.Int() }
-            return v, t, nil
+        name := c.resolve(e.Name)
+        if slot, ok := c.memVars[name]; ok {
+            t := c.varTypes[name]
+            return c.loadTyped(c.add(OpSlotAddr, slot), t), t, nil
+        }
+        // only declared names are read as locals; reading anything else
+        // from a loop body would otherwise yield a phi of nothing
+        if t, declared := c.varTypes[name]; declared {
+            if v, err := c.readVar(name, c.b); err == nil {
+                c.noteRead(e.Name, v, e.Pos)
+                // a phi knows which type reaches it, which may differ from
+                // the last one assigned
+                if _, ok := c.phiVars[v]; ok { t = c.f.Types[v] }
+                // default int when the type is unknown
+                if t.K == ty.Invalid { t = ty.Int() }
+                return v, t, nil
+            }
         }
         // fall back to global
         if c.m != nil {
+            sym := c.globalName(name)
             for _, g := range c.m.Globals {
-                if g.Name == e.Name {
+                if g.Name == sym {
                     addr := c.newValue(OpGlobalAddr, nil, 0)
                     c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = g.Name
-                    if g.ElemSize == 1 { return c.add(OpLoad8, addr), ty.Int(), nil }
-                    return c.add(OpLoad, addr), ty.Int(), nil
+                    // an array is its address
+                    if g.Array { return addr, ty.PointerTo(g.elemType()), nil }
+                    t := g.valueType()
+                    return c.loadTyped(addr, t), t, nil
                 }
             }
             // check enum constants
             if val, ok := c.m.EnumConstants[e.Name]; ok {
                 return c.iconst(val), ty.Int(), nil
             }
+            // a function used as a value is its address
+            if sig, ok := c.m.FuncSigs[e.Name]; ok {
+                return c.funcAddr(sig), ty.PointerTo(ty.FuncOf(sig.Ret)), nil
+            }
         }
-        return 0, ty.Int(), fmt.Errorf("undefined variable %s", e.Name)
+        return 0, ty.Int(), c.errorf(e.Pos, "undefined variable %s", e.Name)
+    case *ast.AssignExpr:
+        return c.buildAssign(e.Name, e.Value, e.Pos)
     case *ast.BinaryExpr:
+        // && and || evaluate their right operand only on demand
+        if e.Op == ast.OpLAnd || e.Op == ast.OpLOr {
+            v, err := c.buildLogical(e.Op == ast.OpLAnd, e.Left, e.Right)
+            return v, ty.Int(), err
+        }
         l, lt, err := c.buildExprWithType(e.Left)
         if err != nil { return 0, ty.Int(), err }
         r, rt, err := c.buildExprWithType(e.Right)
@@ -649,7 +1137,7 @@ func (c *buildCtx) buildExprWithType(e ast.Expr) (ValueID, ty.Type, error) {
                 }
                 return c.add(OpAdd, l, r), rt, nil
             }
-            return c.add(OpAdd, l, r), ty.Int(), nil
+            return c.add(OpAdd, l, r), usualType(lt, rt), nil
         case ast.OpSub:
             // floating point subtraction
             if lt.IsFloat() || rt.IsFloat() {
@@ -665,6 +1153,9 @@ func (c *buildCtx) buildExprWithType(e ast.Expr) (ValueID, ty.Type, error) {
             }
             // ptr - ptr -> element count difference (byte diff / element size)
             if lt.IsPointer() && rt.IsPointer() {
+                if lt.ElemSize() != rt.ElemSize() {
+                    return 0, ty.Int(), c.errorf(e.Pos, "type error: cannot subtract %s from %s", typeName(rt), typeName(lt))
+                }
                 byteDiff := c.add(OpSub, l, r)
                 sz := lt.ElemSize()
                 if sz > 1 {
@@ -673,187 +1164,148 @@ func (c *buildCtx) buildExprWithType(e ast.Expr) (ValueID, ty.Type, error) {
                 }
                 return byteDiff, ty.Int(), nil
             }
-            return c.add(OpSub, l, r), ty.Int(), nil
+            return c.add(OpSub, l, r), usualType(lt, rt), nil
         case ast.OpMul:
             // floating point multiplication
             if lt.IsFloat() || rt.IsFloat() {
                 return c.add(OpFMul, l, r), ty.DoubleT(), nil
             }
-            return c.add(OpMul, l, r), ty.Int(), nil
+            return c.add(OpMul, l, r), usualType(lt, rt), nil
         case ast.OpDiv:
             // floating point division
             if lt.IsFloat() || rt.IsFloat() {
                 return c.add(OpFDiv, l, r), ty.DoubleT(), nil
             }
-            return c.add(OpDiv, l, r), ty.Int(), nil
-        case ast.OpEq:
-            return c.add(OpEq, l, r), ty.Int(), nil
-        case ast.OpNe:
-            return c.add(OpNe, l, r), ty.Int(), nil
-        case ast.OpLt:
-            return c.add(OpLt, l, r), ty.Int(), nil
-        case ast.OpLe:
-            return c.add(OpLe, l, r), ty.Int(), nil
-        case ast.OpGt:
-            return c.add(OpGt, l, r), ty.Int(), nil
-        case ast.OpGe:
-            return c.add(OpGe, l, r), ty.Int(), nil
+            // a divisor that is only zero at run time still traps there
+            if isNullConst(e.Right) {
+                return 0, ty.Int(), c.errorf(ast.ExprPos(e.Right), "division by zero")
+            }
+            t := usualType(lt, rt)
+            return c.add(signedness(OpDiv, t), l, r), t, nil
+        case ast.OpEq, ast.OpNe, ast.OpLt, ast.OpLe, ast.OpGt, ast.OpGe:
+            return c.add(signedness(cmpOps[e.Op], usualType(lt, rt)), l, r), ty.Int(), nil
         case ast.OpAnd:
-            return c.add(OpAnd, l, r), ty.Int(), nil
+            return c.add(OpAnd, l, r), usualType(lt, rt), nil
         case ast.OpOr:
-            return c.add(OpOr, l, r), ty.Int(), nil
+            return c.add(OpOr, l, r), usualType(lt, rt), nil
         case ast.OpXor:
-            return c.add(OpXor, l, r), ty.Int(), nil
+            return c.add(OpXor, l, r), usualType(lt, rt), nil
         case ast.OpShl:
-            return c.add(OpShl, l, r), ty.Int(), nil
+            // a shift has the type of its left operand
+            return c.add(OpShl, l, r), usualType(lt, lt), nil
         case ast.OpShr:
-            return c.add(OpShr, l, r), ty.Int(), nil
-        case ast.OpLAnd:
-            v, err := c.buildLogical(true, e.Left, e.Right)
-            return v, ty.Int(), err
-        case ast.OpLOr:
-            v, err := c.buildLogical(false, e.Left, e.Right)
-            return v, ty.Int(), err
+            t := usualType(lt, lt)
+            return c.add(signedness(OpShr, t), l, r), t, nil
         }
     case *ast.CallExpr:
+        // a local named like a function hides it
+        if e.Fn != nil || c.isLocal(e.Name) { return c.buildIndirectCall(e) }
+        sig, known := c.m.FuncSigs[e.Name]
+        if known {
+            if err := c.checkArity(e, sig); err != nil { return 0, ty.Int(), err }
+        } else {
+            // most likely a typo; a prototype declares a legitimate external
+            c.warnf(e.Pos, "implicit declaration of function %s", e.Name)
+        }
         // Evaluate args
         var argv []ValueID
-        for _, a := range e.Args {
-            v, _, err := c.buildExprWithType(a)
+        for i, a := range e.Args {
+            v, t, err := c.buildExprWithType(a)
             if err != nil { return 0, ty.Int(), err }
+            // only the fixed parameters have a type to check against
+            if known && i < len(sig.Params) && !isNullConst(a) && sig.Params[i].IsPointer() != t.IsPointer() {
+                return 0, ty.Int(), c.errorf(ast.ExprPos(a), "type error: argument %d of %s: cannot pass %s as %s", i+1, e.Name, typeStr(t), typeStr(sig.Params[i]))
+            }
+            if known && i < len(sig.Params) { v = c.convert(v, t, sig.Params[i]) }
             argv = append(argv, v)
         }
-        id := c.newValue(OpCall, argv, 0)
+        variadic := int64(0)
+        ret := ty.Int()
+        if known {
+            if sig.Variadic { variadic = 1 }
+            ret = sig.Ret
+        }
+        id := c.newValue(OpCall, argv, variadic)
         // attach callee symbol
         // patch the last inserted instruction's Sym
         c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = e.Name
-        return id, ty.Int(), nil
+        // the ABI leaves the bits above a narrow return value undefined, so
+        // the caller extends it as for a cast
+        return c.convert(id, ty.Int(), ret), ret, nil
     case *ast.IndexExpr:
-        // Local named array
-        if b, ok := e.Base.(*ast.Ident); ok {
-            if arr, ok := c.arrays[b.Name]; ok {
-                basePtr := c.add(OpSlotAddr, arr.base)
-                idxVal, _, err := c.buildExprWithType(e.Index)
-                if err != nil { return 0, ty.Int(), err }
-                scale := c.iconst(int64(arr.elemSize))
-                off := c.add(OpMul, idxVal, scale)
-                ptr := c.add(OpAdd, basePtr, off)
-                if arr.elemSize == 1 { return c.add(OpLoad8, ptr), ty.Int(), nil }
-                return c.add(OpLoad, ptr), ty.Int(), nil
-            }
-            // try global array
-            if c.m != nil {
-                for _, g := range c.m.Globals {
-                    if g.Name == b.Name && g.Array {
-                        addr := c.newValue(OpGlobalAddr, nil, 0)
-                        c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = g.Name
-                        idxVal, _, err := c.buildExprWithType(e.Index)
-                        if err != nil { return 0, ty.Int(), err }
-                        scale := c.iconst(int64(g.ElemSize))
-                        off := c.add(OpMul, idxVal, scale)
-                        ptr := c.add(OpAdd, addr, off)
-                        if g.ElemSize == 1 { return c.add(OpLoad8, ptr), ty.Int(), nil }
-                        return c.add(OpLoad, ptr), ty.Int(), nil
-                    }
-                }
-            }
-            // fallthrough to generic pointer indexing on unknown ident
-        }
-        // Generic pointer indexing: base must be pointer
-        base, bt, err := c.buildExprWithType(e.Base)
-        if err != nil { return 0, ty.Int(), err }
-        idxVal, _, err := c.buildExprWithType(e.Index)
+        ptr, et, err := c.indexAddr(e)
         if err != nil { return 0, ty.Int(), err }
-        sz := 1
-        if bt.IsPointer() { sz = bt.ElemSize() }
-        scale := c.iconst(int64(sz))
-        off := c.add(OpMul, idxVal, scale)
-        ptr := c.add(OpAdd, base, off)
-        if sz == 1 { return c.add(OpLoad8, ptr), ty.ByteT(), nil }
-        return c.add(OpLoad, ptr), ty.Int(), nil
+        return c.loadTyped(ptr, et), et, nil
     case *ast.FieldExpr:
-        // Get the base variable (must be a struct)
-        baseIdent, ok := e.Base.(*ast.Ident)
-        if !ok {
-            return 0, ty.Int(), fmt.Errorf("field access on non-identifier not supported")
-        }
-        
-        // Look up struct type
-        structTypeName, isStruct := c.structVars[baseIdent.Name]
-        if !isStruct {
-            return 0, ty.Int(), fmt.Errorf("%s is not a struct variable", baseIdent.Name)
-        }
-        
-        // Get struct definition
-        structDef, exists := c.m.StructDefs[structTypeName]
-        if !exists {
-            return 0, ty.Int(), fmt.Errorf("struct type %s not defined", structTypeName)
-        }
-        
-        // Find field
-        var field *StructField
-        for i := range structDef.Fields {
-            if structDef.Fields[i].Name == e.Field {
-                field = &structDef.Fields[i]
-                break
-            }
-        }
-        if field == nil {
-            return 0, ty.Int(), fmt.Errorf("field %s not found in struct %s", e.Field, structTypeName)
-        }
-        
-        // Get base struct variable
-        baseVar, err := c.readVar(baseIdent.Name, c.b)
-        if err != nil {
-            return 0, ty.Int(), err
-        }
-        
-        // Calculate field address: base + offset
-        if field.Offset == 0 {
-            // First field, no offset needed
-            if field.Type.Size() == 1 {
-                return c.add(OpLoad8, baseVar), field.Type, nil
-            }
-            return c.add(OpLoad, baseVar), field.Type, nil
-        } else {
-            // Add offset
-            offsetConst := c.iconst(int64(field.Offset))
-            fieldAddr := c.add(OpAdd, baseVar, offsetConst)
-            if field.Type.Size() == 1 {
-                return c.add(OpLoad8, fieldAddr), field.Type, nil
-            }
-            return c.add(OpLoad, fieldAddr), field.Type, nil
-        }
+        addr, field, err := c.fieldAddr(e.Base, e.Field, e.Arrow)
+        if err != nil { return 0, ty.Int(), err }
+        return c.loadTyped(addr, field.Type), field.Type, nil
     case *ast.UnaryExpr:
         switch e.Op {
         case ast.OpAddr:
             if idn, ok := e.X.(*ast.Ident); ok {
-                v, err := c.readVar(idn.Name, c.b)
-                if err != nil { return 0, ty.Int(), err }
+                name := c.resolve(idn.Name)
+                // a struct variable already holds its address
+                if _, ok := c.structVars[name]; ok {
+                    v, err := c.readVar(name, c.b)
+                    if err != nil { return 0, ty.Int(), c.errorf(idn.Pos, "%v", err) }
+                    return v, c.varTypes[name], nil
+                }
+                if slot, ok := c.memVars[name]; ok {
+                    return c.add(OpSlotAddr, slot), ty.PointerTo(c.varTypes[name]), nil
+                }
+                // globals, and static or extern locals, live at their symbol
+                if _, local := c.varTypes[name]; !local {
+                    if g, ok := c.lookupGlobal(c.globalName(name)); ok {
+                        addr := c.newValue(OpGlobalAddr, nil, 0)
+                        c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = g.Name
+                        et := g.valueType()
+                        if g.Array { et = g.elemType() }
+                        if g.Struct != "" { et = ty.StructOf(g.Struct) }
+                        return addr, ty.PointerTo(et), nil
+                    }
+                    // &f is the same address as f
+                    if sig, ok := c.m.FuncSigs[idn.Name]; ok {
+                        return c.funcAddr(sig), ty.PointerTo(ty.FuncOf(sig.Ret)), nil
+                    }
+                }
+                v, err := c.readVar(name, c.b)
+                if err != nil { return 0, ty.Int(), c.errorf(idn.Pos, "%v", err) }
                 // pointer to whatever the variable is (default int)
-                bt := c.varTypes[idn.Name]
-                if bt.K == 0 && !bt.IsPointer() { bt = ty.Int() }
+                bt := c.varTypes[name]
+                if bt.K == ty.Invalid { bt = ty.Int() }
                 return c.add(OpAddr, v), ty.PointerTo(bt), nil
             }
-            return 0, ty.Int(), fmt.Errorf("address-of unsupported operand")
+            // &a[i] is the element's address, computed as for a load
+            if ix, ok := e.X.(*ast.IndexExpr); ok {
+                ptr, et, err := c.indexAddr(ix)
+                if err != nil { return 0, ty.Int(), err }
+                return ptr, ty.PointerTo(et), nil
+            }
+            if fe, ok := e.X.(*ast.FieldExpr); ok {
+                addr, field, err := c.fieldAddr(fe.Base, fe.Field, fe.Arrow)
+                if err != nil { return 0, ty.Int(), err }
+                return addr, ty.PointerTo(field.Type), nil
+            }
+            return 0, ty.Int(), c.errorf(e.Pos, "address-of unsupported operand")
         case ast.OpDeref:
             ptr, pt, err := c.buildExprWithType(e.X)
             if err != nil { return 0, ty.Int(), err }
+            // *fp names the function, which is again its address
+            if pt.IsFuncPointer() { return ptr, pt, nil }
             // result type is pointee if known
             rt := ty.Int()
             if pt.IsPointer() && pt.Elem != nil { rt = *pt.Elem }
-            if rt.Size() == 1 {
-                return c.add(OpLoad8, ptr), rt, nil
-            }
-            return c.add(OpLoad, ptr), rt, nil
+            return c.loadTyped(ptr, rt), rt, nil
         case ast.OpNeg:
-            x, _, err := c.buildExprWithType(e.X)
+            // the result has the promoted type of the operand
+            x, xt, err := c.buildExprWithType(e.X)
             if err != nil { return 0, ty.Int(), err }
-            return c.add(OpSub, c.iconst(0), x), ty.Int(), nil
+            return c.add(OpSub, c.iconst(0), x), usualType(xt, xt), nil
         case ast.OpBitNot:
-            x, _, err := c.buildExprWithType(e.X)
+            x, xt, err := c.buildExprWithType(e.X)
             if err != nil { return 0, ty.Int(), err }
-            return c.add(OpNot, x), ty.Int(), nil
+            return c.add(OpNot, x), usualType(xt, xt), nil
         case ast.OpLogicalNot:
             x, _, err := c.buildExprWithType(e.X)
             if err != nil { return 0, ty.Int(), err }
@@ -864,42 +1316,26 @@ func (c *buildCtx) buildExprWithType(e ast.Expr) (ValueID, ty.Type, error) {
         if err != nil { return 0, ty.Int(), err }
         // Build target type
         var tt ty.Type
-        if e.Ptr {
-            switch e.To {
-            case ast.BTChar:
-                tt = ty.PointerTo(ty.ByteT())
-            case ast.BTDouble:
-                tt = ty.PointerTo(ty.DoubleT())
-            default:
-                tt = ty.PointerTo(ty.Int())
-            }
+        if e.TypedefName != "" {
+            td, ok := c.m.Typedefs[e.TypedefName]
+            if !ok { return 0, ty.Int(), c.errorf(e.Pos, "unknown typedef: %s", e.TypedefName) }
+            tt = td.Type
+            if e.Ptr { tt = ty.PointerTo(tt) }
         } else {
-            switch e.To {
-            case ast.BTChar:
-                tt = ty.ByteT()
-            case ast.BTDouble:
-                tt = ty.DoubleT()
-            default:
-                tt = ty.Int()
-            }
+            tt = basicType(e.To, e.Ptr)
         }
         // Handle float-to-int conversion
         if st.IsFloat() && !tt.IsFloat() && !tt.IsPointer() {
             // float to int: use F2I conversion
             conv := c.add(OpF2I, v)
-            if tt.Size() == 1 {
-                // mask low byte for char
-                m := c.iconst(0xFF)
-                return c.add(OpAnd, conv, m), tt, nil
-            }
-            return conv, tt, nil
+            return c.convert(conv, ty.Int(), tt), tt, nil
         }
         // Handle int-to-float conversion
         if !st.IsFloat() && !st.IsPointer() && tt.IsFloat() {
             // int to float: use I2F conversion
             return c.add(OpI2F, v), tt, nil
         }
-        // For now, other casts are mostly no-ops; if narrowing to char, mask to 0xFF
+        // Other casts are no-ops, apart from integer width changes
         if !tt.IsPointer() && st.IsPointer() {
             // pointer to int: no-op
             return v, tt, nil
@@ -909,27 +1345,226 @@ func (c *buildCtx) buildExprWithType(e ast.Expr) (ValueID, ty.Type, error) {
             return v, tt, nil
         }
         if !tt.IsPointer() && !st.IsPointer() {
-            if tt.Size() == 1 {
-                // mask low byte
-                m := c.iconst(0xFF)
-                return c.add(OpAnd, v, m), tt, nil
-            }
-            return v, tt, nil
+            return c.convert(v, st, tt), tt, nil
         }
         // pointer to pointer
         return v, tt, nil
     }
-    return 0, ty.Int(), fmt.Errorf("unsupported expr")
+    return 0, ty.Int(), c.errorf(ast.ExprPos(e), "unsupported expr")
+}
+
+// indexAddr computes the address of Base[Index] and the element type. Base
+// is a local or global array by name, or else any pointer expression.
+func (c *buildCtx) indexAddr(e *ast.IndexExpr) (ValueID, ty.Type, error) {
+    var base ValueID
+    var et ty.Type
+    if b, ok := e.Base.(*ast.Ident); ok {
+        if arr, ok := c.arrays[c.resolve(b.Name)]; ok {
+            base, et = c.add(OpSlotAddr, arr.base), arr.elem
+        } else if g, ok := c.lookupGlobal(b.Name); ok && g.Array && !c.isLocal(b.Name) {
+            // a global array, unless a local pointer of that name hides it
+            base, et = c.newValue(OpGlobalAddr, nil, 0), g.elemType()
+            c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = g.Name
+        }
+    }
+    if et.K == ty.Invalid {
+        // generic pointer indexing: base must be pointer
+        v, bt, err := c.buildExprWithType(e.Base)
+        if err != nil { return 0, ty.Int(), err }
+        base, et = v, ty.ByteT()
+        if bt.IsPointer() && bt.Elem != nil { et = *bt.Elem }
+    }
+    idxVal, _, err := c.buildExprWithType(e.Index)
+    if err != nil { return 0, ty.Int(), err }
+    off := c.add(OpMul, idxVal, c.iconst(int64(et.Size())))
+    return c.add(OpAdd, base, off), et, nil
 }
 
-func (c *buildCtx) internString(s string) string {
-    if lbl, ok := c.strLabels[s]; ok { return lbl }
-    lbl := fmt.Sprintf(".Lstr%d", len(c.m.StrLits))
-    c.strLabels[s] = lbl
-    c.m.StrLits = append(c.m.StrLits, StrLit{Name: lbl, Data: s})
+// fieldAddr computes the address of base.field for a local struct variable,
+// or of base->field for a pointer to a struct.
+func (c *buildCtx) fieldAddr(base ast.Expr, fieldName string, arrow bool) (ValueID, *StructField, error) {
+    pos := ast.ExprPos(base)
+    var baseVar ValueID
+    var structTypeName string
+    if arrow {
+        v, t, err := c.buildExprWithType(base)
+        if err != nil { return 0, nil, err }
+        if !t.IsPointer() || t.Elem == nil || t.Elem.K != ty.Struct {
+            return 0, nil, c.errorf(pos, "-> applied to a value that is not a struct pointer")
+        }
+        baseVar, structTypeName = v, t.Elem.Tag
+    } else {
+        // Get the base variable (must be a struct)
+        baseIdent, ok := base.(*ast.Ident)
+        if !ok {
+            return 0, nil, c.errorf(pos, "field access on non-identifier not supported")
+        }
+        
+        // Look up struct type
+        baseName := c.resolve(baseIdent.Name)
+        var isStruct bool
+        structTypeName, isStruct = c.structVars[baseName]
+        if isStruct {
+            // Get base struct variable, which holds the struct's address
+            v, err := c.readVar(baseName, c.b)
+            if err != nil {
+                return 0, nil, c.errorf(pos, "%v", err)
+            }
+            baseVar = v
+        } else if g, ok := c.lookupGlobal(c.globalName(baseName)); ok && g.Struct != "" && !c.isLocal(baseIdent.Name) {
+            // a global struct lives at its symbol
+            baseVar = c.newValue(OpGlobalAddr, nil, 0)
+            c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = g.Name
+            structTypeName = g.Struct
+        } else {
+            return 0, nil, c.errorf(pos, "%s is not a struct variable", baseIdent.Name)
+        }
+    }
+    
+    // Get struct definition
+    structDef, exists := c.m.StructDefs[structTypeName]
+    if !exists {
+        return 0, nil, c.errorf(pos, "struct type %s not defined", structTypeName)
+    }
+    
+    // Find field
+    var field *StructField
+    for i := range structDef.Fields {
+        if structDef.Fields[i].Name == fieldName {
+            field = &structDef.Fields[i]
+            break
+        }
+    }
+    if field == nil {
+        return 0, nil, c.errorf(pos, "field %s not found in struct %s", fieldName, structTypeName)
+    }
+    
+    // Calculate field address: base + offset
+    if field.Offset == 0 {
+        // First field, no offset needed
+        return baseVar, field, nil
+    }
+    offsetConst := c.iconst(int64(field.Offset))
+    return c.add(OpAdd, baseVar, offsetConst), field, nil
+}
+
+// internString returns the label of the string literal s, adding it to the
+// module's string literals the first time it is seen in any function.
+func (m *Module) internString(s string) string {
+    if lbl, ok := m.strLabels[s]; ok { return lbl }
+    lbl := fmt.Sprintf(".Lstr%d", len(m.StrLits))
+    m.StrLits = append(m.StrLits, StrLit{Name: lbl, Data: s})
+    m.strLabels[s] = lbl
     return lbl
 }
 
+// addrConst resolves the address initializer of the pointer global name, of
+// type t, to a symbol and a byte offset from it.
+func (m *Module) addrConst(name string, a *ast.AddrConst, t ty.Type) (string, int64, error) {
+    if a.IsStr { return m.internString(a.Str), a.Index, nil }
+    var g *Global
+    for i := range m.Globals {
+        if m.Globals[i].Name == a.Name { g = &m.Globals[i] }
+    }
+    if g == nil {
+        return "", 0, fmt.Errorf("initializer of %s refers to undeclared %s at %d:%d", name, a.Name, a.Pos.Line, a.Pos.Col)
+    }
+    if a.Decay && !g.Array {
+        return "", 0, fmt.Errorf("initializer element of %s is not constant at %d:%d", name, a.Pos.Line, a.Pos.Col)
+    }
+    // offsets count elements of what the global holds; &x + k steps over
+    // whole xs, which is what t points at
+    esz := t.ElemSize()
+    if g.Array && g.ElemSize > 0 { esz = g.ElemSize }
+    return g.Name, a.Index * int64(esz), nil
+}
+
+// checkArity reports a call whose argument count does not fit the callee's
+// signature; a variadic callee only needs its fixed parameters.
+func (c *buildCtx) checkArity(e *ast.CallExpr, sig *FuncSig) error {
+    want, got := len(sig.Params), len(e.Args)
+    switch {
+    case got < want:
+        return c.errorf(e.Pos, "too few arguments to %s: want %d, got %d", e.Name, want, got)
+    case got > want && !sig.Variadic:
+        return c.errorf(e.Pos, "too many arguments to %s: want %d, got %d", e.Name, want, got)
+    }
+    return nil
+}
+
+// buildIndirectCall calls through a function pointer: (*fp)(x), t[i](x), or
+// fp(x) for a local fp. The pointer's type has no parameters to check the
+// arguments against, so they are passed as they are.
+func (c *buildCtx) buildIndirectCall(e *ast.CallExpr) (ValueID, ty.Type, error) {
+    fn := e.Fn
+    if fn == nil { fn = &ast.Ident{Name: e.Name, Pos: e.Pos} }
+    callee, ft, err := c.buildExprWithType(fn)
+    if err != nil { return 0, ty.Int(), err }
+    if !ft.IsFuncPointer() {
+        return 0, ty.Int(), c.errorf(e.Pos, "type error: called object of type %s is not a function pointer", typeName(ft))
+    }
+    argv := []ValueID{callee}
+    for _, a := range e.Args {
+        v, err := c.buildExpr(a)
+        if err != nil { return 0, ty.Int(), err }
+        argv = append(argv, v)
+    }
+    ret := *ft.Elem.Elem
+    id := c.add(OpCallIndirect, argv...)
+    return c.convert(id, ty.Int(), ret), ret, nil
+}
+
+// funcAddr materializes the address of the function sig names.
+func (c *buildCtx) funcAddr(sig *FuncSig) ValueID {
+    id := c.newValue(OpGlobalAddr, nil, 0)
+    c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = sig.Name
+    return id
+}
+
+// isNullConst reports whether e is the literal 0, which may stand for a null pointer.
+func isNullConst(e ast.Expr) bool {
+    lit, ok := e.(*ast.IntLit)
+    return ok && lit.Value == 0
+}
+
+// declType is the type of a declaration with basic type bt, or of a pointer
+// to struct tag when tag is set.
+func declType(bt ast.BasicType, ptr bool, tag string) ty.Type {
+    if tag != "" { return ty.PointerTo(ty.StructOf(tag)) }
+    return basicType(bt, ptr)
+}
+
+// basicType is the type of the basic type bt, or of a pointer to it. Integers
+// wider than a byte are all 64-bit in storage until codegen learns narrower
+// loads and stores; a short keeps its 16-bit width in its value, and int and
+// long, which are 64-bit, their signedness.
+func basicType(bt ast.BasicType, ptr bool) ty.Type {
+    var t ty.Type
+    switch bt {
+    case ast.BTChar:
+        t = ty.CharT()
+    case ast.BTDouble:
+        t = ty.DoubleT()
+    case ast.BTSChar:
+        t = ty.Int8T()
+    case ast.BTUChar:
+        t = ty.Uint8T()
+    case ast.BTShort:
+        t = ty.Int16T()
+    case ast.BTUShort:
+        t = ty.Uint16T()
+    case ast.BTUInt, ast.BTULong:
+        t = ty.Uint64T()
+    default: // ast.BTInt, ast.BTLong
+        t = ty.Int()
+    }
+    if ptr { return ty.PointerTo(t) }
+    return t
+}
+
+// alignUp rounds n up to a multiple of a.
+func alignUp(n, a int) int { return (n + a - 1) / a * a }
+
 func typeStr(t ty.Type) string {
     if t.IsPointer() {
         return "pointer"
@@ -939,6 +1574,18 @@ func typeStr(t ty.Type) string {
         return "int"
     case ty.Byte:
         return "char"
+    case ty.Int8:
+        return "signed char"
+    case ty.Uint8:
+        return "unsigned char"
+    case ty.Int16:
+        return "short"
+    case ty.Uint16:
+        return "unsigned short"
+    case ty.Uint64:
+        return "unsigned"
+    case ty.Float64:
+        return "double"
     default:
         return "unknown"
     }
@@ -959,7 +1606,7 @@ func (c *buildCtx) buildLogical(isAnd bool, left, right ast.Expr) (ValueID, erro
         // if l!=0 -> right, else -> end
         ri := blockIndexOf(f, rightB)
         ei := blockIndexOf(f, endB)
-        c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJnz, Args: []ValueID{l, ValueID(ri), ValueID(ei)}}})
+        c.emit(Value{Op: OpJnz, Args: []ValueID{l, ValueID(ri), ValueID(ei)}})
         f.addEdge(c.b, rightB)
         f.addEdge(c.b, endB)
         // right path
@@ -971,7 +1618,7 @@ func (c *buildCtx) buildLogical(isAnd bool, left, right ast.Expr) (ValueID, erro
         c.writeVar(tmp, c.b, one)
         // jump to end
         ei2 := blockIndexOf(f, endB)
-        c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ei2)}}})
+        c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(ei2)}})
         f.addEdge(c.b, endB)
     } else {
         // OR: default true
@@ -981,7 +1628,7 @@ func (c *buildCtx) buildLogical(isAnd bool, left, right ast.Expr) (ValueID, erro
         ei := blockIndexOf(f, endB)
         // Need cond != 0
         // Use l directly for jnz (nonzero true)
-        c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJnz, Args: []ValueID{l, ValueID(ei), ValueID(ri)}}})
+        c.emit(Value{Op: OpJnz, Args: []ValueID{l, ValueID(ei), ValueID(ri)}})
         f.addEdge(c.b, endB)
         f.addEdge(c.b, rightB)
         // right path
@@ -993,20 +1640,102 @@ func (c *buildCtx) buildLogical(isAnd bool, left, right ast.Expr) (ValueID, erro
         c.writeVar(tmp, c.b, one)
         // jump to end
         ei2 := blockIndexOf(f, endB)
-        c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ei2)}}})
+        c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(ei2)}})
         f.addEdge(c.b, endB)
     }
     // seal end and read result
-    c.sealBlock(endB)
+    if err := c.sealBlock(endB); err != nil { return 0, err }
     c.b = endB
     v, err := c.readVar(tmp, endB)
     if err != nil { return 0, err }
     return v, nil
 }
 
-func (c *buildCtx) buildIf(s *ast.IfStmt) error {
-    cond, err := c.buildExpr(s.Cond)
+// cmpOps maps the source comparisons to their IR ops.
+var cmpOps = map[ast.BinOp]Op{
+    ast.OpEq: OpEq, ast.OpNe: OpNe, ast.OpLt: OpLt,
+    ast.OpLe: OpLe, ast.OpGt: OpGt, ast.OpGe: OpGe,
+}
+
+// unsignedOps maps the ops whose result depends on signedness to their
+// unsigned forms.
+var unsignedOps = map[Op]Op{OpLt: OpULt, OpLe: OpULe, OpGt: OpUGt, OpGe: OpUGe, OpDiv: OpUDiv, OpShr: OpUShr}
+
+// signedness returns op as it applies to operands of type t: its unsigned
+// form if t is unsigned and it has one.
+func signedness(op Op, t ty.Type) Op {
+    if u, ok := unsignedOps[op]; ok && t.IsUnsigned() { return u }
+    return op
+}
+
+// usualType is the type integer arithmetic on operands of types lt and rt
+// is done in. A type narrower than int is promoted to int, which holds all
+// its values, and since int is 64-bit only an unsigned long, int or long
+// long operand makes the arithmetic unsigned.
+func usualType(lt, rt ty.Type) ty.Type {
+    if lt.K == ty.Uint64 || rt.K == ty.Uint64 { return ty.Uint64T() }
+    return ty.Int()
+}
+
+// branch ends the current block with a jump to block ti when cond holds and
+// to block fi otherwise, adding the edges. A comparison branches on its
+// operands directly rather than first producing a 0/1 value, and && and ||
+// branch on each operand in turn, leaving c.b at the last. The condition is
+// checked for being constant after folding, except for a literal loop
+// condition: while (1) is meant to be.
+func (c *buildCtx) branch(cond ast.Expr, ti, fi int, loop bool) error {
+    _, lit := cond.(*ast.IntLit)
+    if e, ok := cond.(*ast.BinaryExpr); ok && (e.Op == ast.OpLAnd || e.Op == ast.OpLOr) {
+        // the first operand's branch is not the whole condition's
+    } else if !loop || !lit {
+        if c.f.conds == nil { c.f.conds = map[*BasicBlock]ast.Pos{} }
+        c.f.conds[c.b] = ast.ExprPos(cond)
+    }
+    return c.branchOn(cond, ti, fi)
+}
+
+func (c *buildCtx) branchOn(cond ast.Expr, ti, fi int) error {
+    if e, ok := cond.(*ast.UnaryExpr); ok && e.Op == ast.OpLogicalNot {
+        return c.branchOn(e.X, fi, ti)
+    }
+    if e, ok := cond.(*ast.BinaryExpr); ok && (e.Op == ast.OpLAnd || e.Op == ast.OpLOr) {
+        // the right operand is only reached when the left does not decide
+        rhs := c.f.newBlock("log.rhs")
+        ri := blockIndexOf(c.f, rhs)
+        if e.Op == ast.OpLAnd {
+            if err := c.branchOn(e.Left, ri, fi); err != nil { return err }
+        } else {
+            if err := c.branchOn(e.Left, ti, ri); err != nil { return err }
+        }
+        if err := c.sealBlock(rhs); err != nil { return err }
+        c.b = rhs
+        return c.branchOn(e.Right, ti, fi)
+    }
+    // building the operands may have left c.b at a later block, such as
+    // the end of a && inside them, which is the one that branches
+    branch := func(v Value) {
+        c.emit(v)
+        c.f.addEdge(c.b, c.f.Blocks[ti])
+        c.f.addEdge(c.b, c.f.Blocks[fi])
+    }
+    if e, ok := cond.(*ast.BinaryExpr); ok {
+        if op, ok := cmpOps[e.Op]; ok {
+            l, lt, err := c.buildExprWithType(e.Left)
+            if err != nil { return err }
+            r, rt, err := c.buildExprWithType(e.Right)
+            if err != nil { return err }
+            op = signedness(op, usualType(lt, rt))
+            branch(Value{Op: OpBr, Args: []ValueID{l, r, ValueID(ti), ValueID(fi)}, Const: int64(op)})
+            return nil
+        }
+    }
+    v, err := c.buildExpr(cond)
     if err != nil { return err }
+    branch(Value{Op: OpJnz, Args: []ValueID{v, ValueID(ti), ValueID(fi)}})
+    return nil
+}
+
+func (c *buildCtx) buildIf(s *ast.IfStmt) error {
     f := c.f
     thenB := f.newBlock("then")
     elseB := f.newBlock("else")
@@ -1014,29 +1743,29 @@ func (c *buildCtx) buildIf(s *ast.IfStmt) error {
     // current block branches to then/else
     tIdx := blockIndexOf(f, thenB)
     eIdx := blockIndexOf(f, elseB)
-    c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJnz, Args: []ValueID{cond, ValueID(tIdx), ValueID(eIdx)}}})
-    f.addEdge(c.b, thenB)
-    f.addEdge(c.b, elseB)
+    if err := c.branch(s.Cond, tIdx, eIdx, false); err != nil { return err }
+    if err := c.sealBlock(thenB); err != nil { return err }
+    if err := c.sealBlock(elseB); err != nil { return err }
     // build then
     c.b = thenB
     if err := c.buildBlock(s.Then); err != nil { return err }
     // jump to join
     jIdx := blockIndexOf(f, joinB)
-    if !c.b.terminated() {
-        c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(jIdx)}}})
+    if !c.b.Terminated() {
+        c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(jIdx)}})
         f.addEdge(c.b, joinB)
     }
     thenEnd := c.b
     // build else
     c.b = elseB
     if s.Else != nil { if err := c.buildBlock(s.Else); err != nil { return err } }
-    if !c.b.terminated() {
-        c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(jIdx)}}})
+    if !c.b.Terminated() {
+        c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(jIdx)}})
         f.addEdge(c.b, joinB)
     }
     elseEnd := c.b
     // seal join and move current block
-    c.sealBlock(joinB)
+    if err := c.sealBlock(joinB); err != nil { return err }
     c.b = joinB
     _ = thenEnd; _ = elseEnd
     return nil
@@ -1049,19 +1778,16 @@ func (c *buildCtx) buildWhile(s *ast.WhileStmt) error {
     exitB := f.newBlock("while.end")
     // jump to cond
     ci := blockIndexOf(f, condB)
-    c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ci)}}})
+    c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(ci)}})
     f.addEdge(c.b, condB)
     // Predeclare backedge in CFG so cond reads create phis
     f.addEdge(bodyB, condB)
     // build cond
     c.b = condB
-    cond, err := c.buildExpr(s.Cond)
-    if err != nil { return err }
     bi := blockIndexOf(f, bodyB)
     ei := blockIndexOf(f, exitB)
-    c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJnz, Args: []ValueID{cond, ValueID(bi), ValueID(ei)}}})
-    f.addEdge(c.b, bodyB)
-    f.addEdge(c.b, exitB)
+    if err := c.branch(s.Cond, bi, ei, true); err != nil { return err }
+    if err := c.sealBlock(bodyB); err != nil { return err }
     // body
     c.b = bodyB
     // push loop context
@@ -1072,37 +1798,50 @@ func (c *buildCtx) buildWhile(s *ast.WhileStmt) error {
     c.breakTargets = c.breakTargets[:len(c.breakTargets)-1]
     c.contTargets = c.contTargets[:len(c.contTargets)-1]
     // Emit backedge jump from the current block (could be a join inside body)
-    endB := c.b
-    if !endB.terminated() {
-        endB.Instrs = append(endB.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ci)}}})
-    }
-    // Fix CFG: redirect predeclared body->cond to actual endB->cond if different
-    if endB != bodyB {
-        // remove bodyB -> condB
-        // bodyB.Succs
-        var ns []*BasicBlock
-        for _, s := range bodyB.Succs { if s != condB { ns = append(ns, s) } }
-        bodyB.Succs = ns
-        // condB.Preds
-        var np []*BasicBlock
-        for _, p := range condB.Preds { if p != bodyB { np = append(np, p) } }
-        condB.Preds = np
-        // add endB -> condB
-        f.addEdge(endB, condB)
-    }
+    c.closeBackedge(bodyB, c.b, condB)
     // continue at exit
     c.b = exitB
     // Seal header now that backedge exists; fill any pending phis
-    c.sealBlock(condB)
-    c.sealBlock(exitB)
+    if err := c.sealBlock(condB); err != nil { return err }
+    if err := c.sealBlock(exitB); err != nil { return err }
     return nil
 }
 
+// closeBackedge ends a loop at endB with a jump back to head. The edge from
+// latch to head was predeclared so that reads in head create phis; it moves
+// to endB, or is dropped when endB already left the loop via return or break.
+func (c *buildCtx) closeBackedge(latch, endB, head *BasicBlock) {
+    removeEdge(latch, head)
+    if endB.Terminated() { return }
+    hi := blockIndexOf(c.f, head)
+    endB.Instrs = append(endB.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(hi)}}, Pos: c.pos})
+    c.f.addEdge(endB, head)
+}
+
+// removeEdge deletes one pred->succ edge.
+func removeEdge(pred, succ *BasicBlock) {
+    for i, s := range pred.Succs {
+        if s == succ { pred.Succs = append(pred.Succs[:i], pred.Succs[i+1:]...); break }
+    }
+    for i, p := range succ.Preds {
+        if p == pred { succ.Preds = append(succ.Preds[:i], succ.Preds[i+1:]...); break }
+    }
+}
+
+// clauseStmts flattens a for clause, which the parser hands over as a block
+// when it is a comma list, without giving it a scope of its own.
+func clauseStmts(s ast.Stmt) []ast.Stmt {
+    if b, ok := s.(*ast.BlockStmt); ok { return b.Stmts }
+    return []ast.Stmt{s}
+}
+
 func (c *buildCtx) buildFor(s *ast.ForStmt) error {
     f := c.f
-    // handle init in current block
+    // the init clause declares into a scope that covers the whole loop
+    c.pushScope()
+    defer c.popScope()
     if s.Init != nil {
-        if err := c.buildBlock(&ast.BlockStmt{Stmts: []ast.Stmt{s.Init}}); err != nil { return err }
+        if err := c.buildStmts(clauseStmts(s.Init)); err != nil { return err }
     }
     condB := f.newBlock("for.cond")
     bodyB := f.newBlock("for.body")
@@ -1110,27 +1849,26 @@ func (c *buildCtx) buildFor(s *ast.ForStmt) error {
     exitB := f.newBlock("for.end")
     // jump to cond
     ci := blockIndexOf(f, condB)
-    c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ci)}}})
+    c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(ci)}})
     f.addEdge(c.b, condB)
-    // Predeclare backedges to cond for SSA
-    f.addEdge(bodyB, condB)
-    f.addEdge(postB, condB)
+    // Predeclare the backedge to cond for SSA; it comes from post when
+    // there is one, else from the body
+    latchB := bodyB
+    if s.Post != nil { latchB = postB }
+    f.addEdge(latchB, condB)
     // build cond
     c.b = condB
     if s.Cond != nil {
-        cond, err := c.buildExpr(s.Cond)
-        if err != nil { return err }
         bi := blockIndexOf(f, bodyB)
         ei := blockIndexOf(f, exitB)
-        c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJnz, Args: []ValueID{cond, ValueID(bi), ValueID(ei)}}})
-        f.addEdge(c.b, bodyB)
-        f.addEdge(c.b, exitB)
+        if err := c.branch(s.Cond, bi, ei, true); err != nil { return err }
     } else {
         // no cond => always true
         bi := blockIndexOf(f, bodyB)
-        c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(bi)}}})
+        c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(bi)}})
         f.addEdge(c.b, bodyB)
     }
+    if err := c.sealBlock(bodyB); err != nil { return err }
     // body
     c.b = bodyB
     // loop context: continue -> post (if any) else cond
@@ -1144,30 +1882,22 @@ func (c *buildCtx) buildFor(s *ast.ForStmt) error {
     // jump to post/cond
     if s.Post != nil {
         pi := blockIndexOf(f, postB)
-        if !c.b.terminated() {
-            c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(pi)}}})
+        if !c.b.Terminated() {
+            c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(pi)}})
             f.addEdge(c.b, postB)
         }
-        // post
+        // post; the body end and every continue have jumped here by now
         c.b = postB
-        if err := c.buildBlock(&ast.BlockStmt{Stmts: []ast.Stmt{s.Post}}); err != nil { return err }
-        // back to cond
-        if !c.b.terminated() {
-            c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ci)}}})
-            f.addEdge(c.b, condB)
-        }
-    } else {
-        // no post: jump directly to cond
-        if !c.b.terminated() {
-            c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ci)}}})
-            f.addEdge(c.b, condB)
-        }
+        if err := c.sealBlock(postB); err != nil { return err }
+        if err := c.buildStmts(clauseStmts(s.Post)); err != nil { return err }
     }
+    // back to cond
+    c.closeBackedge(latchB, c.b, condB)
     // continue at exit
     c.b = exitB
     // Seal header and exit
-    c.sealBlock(condB)
-    c.sealBlock(exitB)
+    if err := c.sealBlock(condB); err != nil { return err }
+    if err := c.sealBlock(exitB); err != nil { return err }
     return nil
 }
 
@@ -1179,14 +1909,14 @@ func (c *buildCtx) buildDoWhile(s *ast.DoWhileStmt) error {
     exitB := f.newBlock("do.end")
     // jump to header first
     hi := blockIndexOf(f, headB)
-    c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(hi)}}})
+    c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(hi)}})
     f.addEdge(c.b, headB)
     // Predeclare backedge to header so reads in header can create phis
     f.addEdge(condB, headB)
     // header falls through to body
     c.b = headB
     bi := blockIndexOf(f, bodyB)
-    c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(bi)}}})
+    c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(bi)}})
     f.addEdge(c.b, bodyB)
     // body
     c.b = bodyB
@@ -1197,26 +1927,24 @@ func (c *buildCtx) buildDoWhile(s *ast.DoWhileStmt) error {
     c.contTargets = c.contTargets[:len(c.contTargets)-1]
     // jump to cond
     ci := blockIndexOf(f, condB)
-    if !c.b.terminated() {
-        c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ci)}}})
+    if !c.b.Terminated() {
+        c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(ci)}})
         f.addEdge(c.b, condB)
     }
     // cond
     c.b = condB
-    cond, err := c.buildExpr(s.Cond)
-    if err != nil { return err }
     // branch: true -> head (already predeclared), false -> exit
     hi2 := blockIndexOf(f, headB)
     ei := blockIndexOf(f, exitB)
-    c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJnz, Args: []ValueID{cond, ValueID(hi2), ValueID(ei)}}})
-    // Do not add head edge here to avoid duplicate; exit edge is new
-    f.addEdge(c.b, exitB)
+    // the branch adds the real back edge, from whichever block decides
+    removeEdge(condB, headB)
+    if err := c.branch(s.Cond, hi2, ei, true); err != nil { return err }
     // Now preds of header are entry and cond; seal to fill phis
-    c.sealBlock(headB)
+    if err := c.sealBlock(headB); err != nil { return err }
     // continue at exit
     c.b = exitB
-    c.sealBlock(condB)
-    c.sealBlock(exitB)
+    if err := c.sealBlock(condB); err != nil { return err }
+    if err := c.sealBlock(exitB); err != nil { return err }
     return nil
 }
 
@@ -1231,59 +1959,93 @@ func (c *buildCtx) buildSwitch(s *ast.SwitchStmt) error {
     for i := range s.Cases { caseBlocks[i] = f.newBlock(fmt.Sprintf("case.%d", i)) }
     var defaultB *BasicBlock
     if s.Default != nil { defaultB = f.newBlock("default") }
-    // Build compare chain
-    // Start from a dispatch block (current)
-    nextB := defaultB
-    if nextB == nil { nextB = exitB }
-    // We'll create a sequence of cmp blocks in reverse to chain else branches
-    for i := len(s.Cases) - 1; i >= 0; i-- {
-        cmpB := f.newBlock(fmt.Sprintf("sw.cmp.%d", i))
-        // jump from current to first cmp if building first, else link previous
-        if i == len(s.Cases)-1 {
-            // from current block to cmpB
-            ci := blockIndexOf(f, cmpB)
-            c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ci)}}})
-            f.addEdge(c.b, cmpB)
+    // a miss goes to default, or the exit when there is none
+    missB := defaultB
+    if missB == nil { missB = exitB }
+    if lo, table, ok := jumpTable(s); ok {
+        // one bounds check and an indirect jump, however many cases
+        args := []ValueID{tag, ValueID(blockIndexOf(f, missB))}
+        for _, i := range table {
+            t := missB
+            if i >= 0 { t = caseBlocks[i] }
+            args = append(args, ValueID(blockIndexOf(f, t)))
         }
-        // In cmpB, compare tag equals any of the case values (chain OR inside the block)
-        c.b = cmpB
-        var fall *BasicBlock = nextB
-        // For each value in this case
-        for vi, v := range s.Cases[i].Values {
-            tblock := caseBlocks[i]
-            // build compare
-            cv := c.iconst(v)
-            cond := c.add(OpEq, tag, cv)
-            ti := blockIndexOf(f, tblock)
-            fi := -1
-            // false target is either next comparison within this same case-values list or the overall nextB
-            if vi == len(s.Cases[i].Values)-1 {
-                fi = blockIndexOf(f, fall)
-            } else {
-                // create an inner cmp block for next value
-                inner := f.newBlock(fmt.Sprintf("sw.cmp.%d.%d", i, vi))
-                fi = blockIndexOf(f, inner)
-                fall = inner
-            }
-            c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJnz, Args: []ValueID{cond, ValueID(ti), ValueID(fi)}}})
-            f.addEdge(c.b, tblock)
-            f.addEdge(c.b, f.Blocks[fi])
-            // move to inner for next value if any
-            if vi < len(s.Cases[i].Values)-1 {
-                c.b = f.Blocks[fi]
-            }
+        c.emit(Value{Op: OpSwitchTable, Args: args, Const: lo})
+        f.addTargetEdges(c.b)
+        return c.buildSwitchBodies(s, caseBlocks, defaultB, exitB)
+    }
+    // Build compare chain: one block per case value, tested in source order;
+    // the last miss goes to missB.
+    cmpB := f.newBlock("sw.cmp")
+    ci := blockIndexOf(f, cmpB)
+    c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(ci)}})
+    f.addEdge(c.b, cmpB)
+    c.b = cmpB
+    if err := c.sealBlock(cmpB); err != nil { return err }
+    for i, cc := range s.Cases {
+        for _, v := range cc.Values {
+            cond := c.add(OpEq, tag, c.iconst(v))
+            // the false edge continues the chain in a fresh block
+            nextB := f.newBlock(fmt.Sprintf("sw.cmp.%d", i))
+            ti := blockIndexOf(f, caseBlocks[i])
+            ni := blockIndexOf(f, nextB)
+            c.emit(Value{Op: OpJnz, Args: []ValueID{cond, ValueID(ti), ValueID(ni)}})
+            f.addEdge(c.b, caseBlocks[i])
+            f.addEdge(c.b, nextB)
+            c.b = nextB
+            if err := c.sealBlock(nextB); err != nil { return err }
         }
-        nextB = cmpB
     }
-    // At this point, control reaches nextB to start comparisons; we already linked entry to first cmp
-    // Build case bodies
+    mi := blockIndexOf(f, missB)
+    c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(mi)}})
+    f.addEdge(c.b, missB)
+    return c.buildSwitchBodies(s, caseBlocks, defaultB, exitB)
+}
+
+// Jump tables are used for switches of at least jumpTableMinCases values
+// spanning at most jumpTableMaxSpan times as many; a shorter compare chain
+// is as quick, and a sparser table mostly holds the default.
+const (
+    jumpTableMinCases = 4
+    jumpTableMaxSpan  = 2
+)
+
+// jumpTable decides whether s's case values are dense enough for a jump
+// table, returning the lowest and, for each value from it to the highest,
+// the index of its case or -1 for none.
+func jumpTable(s *ast.SwitchStmt) (int64, []int, bool) {
+    n := 0
+    lo, hi := int64(math.MaxInt64), int64(math.MinInt64)
+    for _, cc := range s.Cases {
+        for _, v := range cc.Values {
+            n++
+            if v < lo { lo = v }
+            if v > hi { hi = v }
+        }
+    }
+    // the bounds check subtracts lo and compares with an immediate
+    if n < jumpTableMinCases || lo < math.MinInt32 || hi > math.MaxInt32 || hi-lo+1 > int64(jumpTableMaxSpan*n) { return 0, nil, false }
+    table := make([]int, hi-lo+1)
+    for i := range table { table[i] = -1 }
+    for i, cc := range s.Cases {
+        for _, v := range cc.Values { table[v-lo] = i }
+    }
+    return lo, table, true
+}
+
+// buildSwitchBodies builds the case and default bodies of s into their
+// blocks, which the dispatch already jumps to, and continues at exitB.
+func (c *buildCtx) buildSwitchBodies(s *ast.SwitchStmt, caseBlocks []*BasicBlock, defaultB, exitB *BasicBlock) error {
+    f := c.f
     // Push break target
     c.breakTargets = append(c.breakTargets, exitB)
     for i, cc := range s.Cases {
         c.b = caseBlocks[i]
+        // all predecessors (compares and fallthrough from i-1) are known now
+        if err := c.sealBlock(c.b); err != nil { return err }
         if err := c.buildBlock(cc.Body); err != nil { return err }
         // If body not terminated, fall through to next case or default/exit
-        if !c.b.terminated() {
+        if !c.b.Terminated() {
             var ft *BasicBlock
             if i+1 < len(caseBlocks) {
                 ft = caseBlocks[i+1]
@@ -1293,17 +2055,18 @@ func (c *buildCtx) buildSwitch(s *ast.SwitchStmt) error {
                 ft = exitB
             }
             fi := blockIndexOf(f, ft)
-            c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(fi)}}})
+            c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(fi)}})
             f.addEdge(c.b, ft)
         }
     }
     // default body
     if defaultB != nil {
         c.b = defaultB
+        if err := c.sealBlock(c.b); err != nil { return err }
         if err := c.buildBlock(s.Default); err != nil { return err }
-        if !c.b.terminated() {
+        if !c.b.Terminated() {
             ei := blockIndexOf(f, exitB)
-            c.b.Instrs = append(c.b.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ei)}}})
+            c.emit(Value{Op: OpJmp, Args: []ValueID{ValueID(ei)}})
             f.addEdge(c.b, exitB)
         }
     }
@@ -1311,9 +2074,107 @@ func (c *buildCtx) buildSwitch(s *ast.SwitchStmt) error {
     c.breakTargets = c.breakTargets[:len(c.breakTargets)-1]
     // continue at exit
     c.b = exitB
-    c.sealBlock(exitB)
+    if err := c.sealBlock(exitB); err != nil { return err }
     return nil
 }
+// buildAssign stores value into the named variable and returns the stored
+// value, for both assignment statements and assignment expressions.
+func (c *buildCtx) buildAssign(name string, value ast.Expr, pos ast.Pos) (ValueID, ty.Type, error) {
+    name = c.resolve(name)
+    // If assigning to a global (and no local of same name), emit store to global
+    if g, ok := c.lookupGlobal(c.globalName(name)); ok {
+        if _, isLocal := c.varTypes[name]; !isLocal {
+            val, t, err := c.buildExprWithType(value)
+            if err != nil { return 0, ty.Int(), err }
+            // an integer global keeps its declared type, as a local does
+            if gt := g.valueType(); !gt.IsPointer() && !t.IsPointer() { val, t = c.convert(val, t, gt), gt }
+            addr := c.newValue(OpGlobalAddr, nil, 0)
+            c.b.Instrs[len(c.b.Instrs)-1].Val.Sym = g.Name
+            c.storeTyped(addr, val, g.valueType())
+            return val, t, nil
+        }
+    }
+    // writing an unknown name would quietly start a new variable
+    _, declared := c.varTypes[name]
+    if _, isArray := c.arrays[name]; !declared && !isArray {
+        return 0, ty.Int(), c.errorf(pos, "assignment to undeclared variable '%s'", name)
+    }
+    v, t, err := c.buildExprWithType(value)
+    if err != nil { return 0, ty.Int(), err }
+    // simple type checks for locals: pointer vs non-pointer, char vs pointer
+    if vt, ok := c.varTypes[name]; ok {
+        if vt.IsPointer() != t.IsPointer() {
+            return 0, ty.Int(), c.errorf(pos, "type error: cannot assign %s to %s", typeStr(t), typeStr(vt))
+        }
+        // an integer variable keeps its declared type
+        if !vt.IsPointer() && vt.K != ty.Invalid { v, t = c.convert(v, t, vt), vt }
+    }
+    if slot, ok := c.memVars[name]; ok {
+        c.storeTyped(c.add(OpSlotAddr, slot), v, c.varTypes[name])
+        return v, t, nil
+    }
+    c.writeVar(name, c.b, v)
+    // update visible type
+    c.varTypes[name] = t
+    return v, t, nil
+}
+
+// storeConv checks that the value v of type vt, from the expression e, may be
+// stored into an object of type t, and converts an integer to t. As for
+// assignment, pointers and integers don't mix, except for a null constant;
+// and a pointer must point to the same type. A cast says otherwise.
+func (c *buildCtx) storeConv(e ast.Expr, v ValueID, vt, t ty.Type) (ValueID, error) {
+    if t.IsPointer() && isNullConst(e) { return v, nil }
+    if vt.IsPointer() != t.IsPointer() || (t.IsPointer() && !sameType(vt, t)) {
+        return 0, c.errorf(ast.ExprPos(e), "type error: cannot store %s into %s", typeName(vt), typeName(t))
+    }
+    return c.convert(v, vt, t), nil
+}
+
+// sameType reports whether a and b are the same type, through pointers and
+// function return types.
+func sameType(a, b ty.Type) bool {
+    if a.K != b.K || a.Tag != b.Tag { return false }
+    if a.Elem != nil && b.Elem != nil { return sameType(*a.Elem, *b.Elem) }
+    return true
+}
+
+// typeName spells t for diagnostics, with pointers as in C.
+func typeName(t ty.Type) string {
+    if t.IsFuncPointer() { return typeName(*t.Elem.Elem) + " (*)()" }
+    if t.IsPointer() && t.Elem != nil { return typeName(*t.Elem) + "*" }
+    if t.K == ty.Struct { return "struct " + t.Tag }
+    return typeStr(t)
+}
+
+// declareGlobalLocal handles a block-scope static or extern declaration. A
+// static local becomes a module global under a function-qualified name, so it
+// keeps its value across calls; an extern one names a file-scope global.
+func (c *buildCtx) declareGlobalLocal(s *ast.DeclStmt) error {
+    name, err := c.declare(s.Name, s.Pos)
+    if err != nil { return err }
+    t := basicType(s.Typ, s.Ptr)
+    esz := t.Size()
+    if s.Extern {
+        c.m.addGlobal(Global{Name: s.Name, ElemSize: esz, Type: t, Extern: true})
+        c.statics[name] = s.Name
+        return nil
+    }
+    sym := fmt.Sprintf("%s.%s.%d", c.f.Name, s.Name, len(c.m.Globals))
+    g := Global{Name: sym, ElemSize: esz, Type: t, Static: true}
+    if lit, ok := s.Init.(*ast.IntLit); ok { g.Init = lit.Value }
+    c.m.addGlobal(g)
+    c.statics[name] = sym
+    return nil
+}
+
+// globalName maps a variable to the symbol of the global it refers to,
+// which differs from the name itself only for static and extern locals.
+func (c *buildCtx) globalName(name string) string {
+    if sym, ok := c.statics[name]; ok { return sym }
+    return name
+}
+
 func (c *buildCtx) lookupGlobal(name string) (*Global, bool) {
     if c.m == nil { return nil, false }
     for i := range c.m.Globals {
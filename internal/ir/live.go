@@ -0,0 +1,82 @@
+package ir
+
+import (
+    "fmt"
+    "sort"
+    "strings"
+)
+
+// Live holds the values live into and out of each block of a function.
+type Live struct {
+    f       *Function
+    In, Out map[*BasicBlock]map[ValueID]bool
+}
+
+// Liveness computes which values are live at each block's boundaries, by
+// the usual backward dataflow to a fixed point over the blocks' uses and
+// definitions. A phi's operand is used at the end of the predecessor it
+// comes from, not in the phi's block. After phi elimination a value may be
+// assigned in several blocks, so a use is upward exposed unless the same
+// block assigned the value before it.
+func Liveness(f *Function) *Live {
+    uses := map[*BasicBlock]map[ValueID]bool{}
+    defs := map[*BasicBlock]map[ValueID]bool{}
+    // phi operands, by the predecessor they come from
+    edgeUses := map[*BasicBlock]map[ValueID]bool{}
+    l := &Live{f: f, In: map[*BasicBlock]map[ValueID]bool{}, Out: map[*BasicBlock]map[ValueID]bool{}}
+    for _, b := range f.Blocks {
+        uses[b], defs[b], edgeUses[b] = map[ValueID]bool{}, map[ValueID]bool{}, map[ValueID]bool{}
+        l.In[b], l.Out[b] = map[ValueID]bool{}, map[ValueID]bool{}
+    }
+    for _, b := range f.Blocks {
+        for i := range b.Instrs {
+            ins := &b.Instrs[i]
+            if ins.Val.Op == OpPhi {
+                for k, a := range ins.Val.Args {
+                    if k < len(b.Preds) { edgeUses[b.Preds[k]][a] = true }
+                }
+            } else {
+                for _, a := range operands(ins) {
+                    if !defs[b][a] { uses[b][a] = true }
+                }
+            }
+            if ins.Res >= 0 { defs[b][ins.Res] = true }
+        }
+    }
+    for changed := true; changed; {
+        changed = false
+        for i := len(f.Blocks) - 1; i >= 0; i-- {
+            b := f.Blocks[i]
+            add := func(set map[ValueID]bool, id ValueID) {
+                if !set[id] { set[id], changed = true, true }
+            }
+            for _, s := range b.Succs {
+                for id := range l.In[s] { add(l.Out[b], id) }
+            }
+            for id := range edgeUses[b] { add(l.Out[b], id) }
+            for id := range uses[b] { add(l.In[b], id) }
+            for id := range l.Out[b] {
+                if !defs[b][id] { add(l.In[b], id) }
+            }
+        }
+    }
+    return l
+}
+
+// String lists the values live into and out of each block.
+func (l *Live) String() string {
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "func %s\n", l.f.Name)
+    ids := func(set map[ValueID]bool) string {
+        var s []int
+        for id := range set { s = append(s, int(id)) }
+        sort.Ints(s)
+        var out string
+        for _, id := range s { out += " " + ValueID(id).String() }
+        return out
+    }
+    for _, b := range l.f.Blocks {
+        fmt.Fprintf(&sb, "  %s: in%s; out%s\n", b.Name, ids(l.In[b]), ids(l.Out[b]))
+    }
+    return sb.String()
+}
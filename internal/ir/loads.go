@@ -0,0 +1,39 @@
+package ir
+
+// eliminateRedundantLoads makes a load from an address already loaded from,
+// or stored to by a full-width store, earlier in its block a copy of the
+// value found there, so that `g + g` loads g once. Any store may write
+// through another address to the same memory, and a call may write
+// anywhere, so each forgets what was known; a store then records the value
+// it wrote.
+func eliminateRedundantLoads(f *Function) bool {
+    changed := false
+    addr := addressKeys(f)
+    type known struct {
+        op  Op // the load, or OpLoad for a store
+        val ValueID
+    }
+    for _, b := range f.Blocks {
+        mem := map[string]known{}
+        for i := range b.Instrs {
+            ins := &b.Instrs[i]
+            switch ins.Val.Op {
+            case OpLoad, OpLoad8:
+                k := addr(ins.Val.Args[0])
+                if m, ok := mem[k]; ok && m.op == ins.Val.Op {
+                    ins.Val = Value{ID: ins.Val.ID, Op: OpCopy, Args: []ValueID{m.val}}
+                    changed = true
+                    continue
+                }
+                mem[k] = known{ins.Val.Op, ins.Res}
+            case OpStore, OpStore8:
+                mem = map[string]known{}
+                if ins.Val.Op == OpStore { mem[addr(ins.Val.Args[0])] = known{OpLoad, ins.Val.Args[1]} }
+            case OpCall, OpCallIndirect, OpStoreIdx:
+                mem = map[string]known{}
+            }
+        }
+    }
+    propagateCopies(f)
+    return changed
+}
@@ -0,0 +1,42 @@
+package ir
+
+import "sort"
+
+// Loop is a natural loop: the header, and the blocks of its body, the
+// header included.
+type Loop struct {
+    Header *BasicBlock
+    Blocks map[*BasicBlock]bool
+}
+
+// FindLoops returns the natural loops of f, one per header, innermost
+// first: a loop comes before any loop holding more blocks. An edge from p to
+// a block h that dominates p is a back edge, and h's loop is every block
+// that reaches p without going through h. Blocks the entry cannot reach are
+// in none.
+func FindLoops(f *Function) []*Loop {
+    dom := ComputeDominators(f)
+    byHeader := map[*BasicBlock]*Loop{}
+    var loops []*Loop
+    for _, p := range f.Blocks {
+        for _, h := range p.Succs {
+            if !dom.Dominates(h, p) { continue }
+            l := byHeader[h]
+            if l == nil {
+                l = &Loop{Header: h, Blocks: map[*BasicBlock]bool{h: true}}
+                byHeader[h] = l
+                loops = append(loops, l)
+            }
+            work := []*BasicBlock{p}
+            for len(work) > 0 {
+                b := work[len(work)-1]
+                work = work[:len(work)-1]
+                if l.Blocks[b] { continue }
+                l.Blocks[b] = true
+                work = append(work, b.Preds...)
+            }
+        }
+    }
+    sort.SliceStable(loops, func(i, j int) bool { return len(loops[i].Blocks) < len(loops[j].Blocks) })
+    return loops
+}
@@ -1,17 +1,20 @@
 package ir
 
 import (
-    "unsafe"
+    "math"
 )
 
 // Phase 2 basic optimizations: constant folding/propagation and DCE.
 
-// Optimize applies simple SSA-based optimizations to all functions.
-func Optimize(m *Module) {
-    for _, f := range m.Funcs {
-        constFoldFunc(f)
-        dceFunc(f)
+// Optimize runs m's pipeline over its functions, each pass over every
+// function before the next pass starts.
+func Optimize(m *Module) error {
+    passes, err := m.Pipeline()
+    if err != nil { return err }
+    for _, p := range passes {
+        for _, f := range m.Funcs { m.runPass(p, f) }
     }
+    return nil
 }
 
 type useInfo struct {
@@ -24,18 +27,21 @@ func buildUses(f *Function) useInfo {
     for _, b := range f.Blocks {
         for _, ins := range b.Instrs {
             ui.byInst = append(ui.byInst, struct{ args []ValueID }{args: append([]ValueID(nil), ins.Val.Args...)})
-            for _, a := range ins.Val.Args { ui.uses[a]++ }
+            // jump targets are block indices, not uses
+            for _, a := range operands(&ins) { ui.uses[a]++ }
         }
     }
     return ui
 }
 
-func constFoldFunc(f *Function) {
+func constFoldFunc(f *Function) bool {
+    changed := false
     // Local rewrite when both operands are constants.
     for _, b := range f.Blocks {
         for i, ins := range b.Instrs {
             switch ins.Val.Op {
-            case OpAdd, OpSub, OpMul, OpDiv, OpAnd, OpOr, OpXor, OpShl, OpShr:
+            case OpAdd, OpSub, OpMul, OpDiv, OpAnd, OpOr, OpXor, OpShl, OpShr, OpEq, OpNe, OpLt, OpLe, OpGt, OpGe,
+                OpULt, OpULe, OpUGt, OpUGe, OpUDiv, OpUShr:
                 if len(ins.Val.Args) != 2 { continue }
                 a := findConst(b, ins.Val.Args[0])
                 c := findConst(b, ins.Val.Args[1])
@@ -48,22 +54,50 @@ func constFoldFunc(f *Function) {
                 case OpDiv:
                     if *c == 0 { continue }
                     k = *a / *c
+                case OpUDiv:
+                    if *c == 0 { continue }
+                    k = int64(uint64(*a) / uint64(*c))
                 case OpAnd: k = *a & *c
                 case OpOr:  k = *a | *c
                 case OpXor: k = *a ^ *c
                 case OpShl: k = *a << uint64(*c)
                 case OpShr: k = *a >> uint64(*c)
+                case OpUShr: k = int64(uint64(*a) >> uint64(*c))
+                default:
+                    if compare(ins.Val.Op, *a, *c) { k = 1 }
                 }
                 // Replace with const
                 b.Instrs[i].Val.Op = OpConst
                 b.Instrs[i].Val.Args = nil
                 b.Instrs[i].Val.Const = k
+                changed = true
+            case OpNot, OpLogicalNot:
+                a := findConst(b, ins.Val.Args[0])
+                if a == nil { continue }
+                k := ^*a
+                if ins.Val.Op == OpLogicalNot {
+                    k = 0
+                    if *a == 0 { k = 1 }
+                }
+                b.Instrs[i].Val.Op = OpConst
+                b.Instrs[i].Val.Args = nil
+                b.Instrs[i].Val.Const = k
+                changed = true
+            case OpSext, OpZext, OpTrunc:
+                a := findConst(b, ins.Val.Args[0])
+                if a == nil { continue }
+                b.Instrs[i].Val.Op = OpConst
+                b.Instrs[i].Val.Args = nil
+                b.Instrs[i].Val.Const = extendConst(ins.Val.Op, *a, ins.Val.Const)
+                changed = true
             case OpFAdd, OpFSub, OpFMul, OpFDiv:
                 // Floating point constant folding
                 if len(ins.Val.Args) != 2 { continue }
                 a := findFConst(b, ins.Val.Args[0])
                 c := findFConst(b, ins.Val.Args[1])
-                if a == nil || c == nil { continue }
+                // NaN folds the same as it runs, but the target's NaN bits
+                // may differ, so leave it to run time until that is decided
+                if a == nil || c == nil || math.IsNaN(*a) || math.IsNaN(*c) { continue }
                 var result float64
                 switch ins.Val.Op {
                 case OpFAdd: result = *a + *c
@@ -73,14 +107,22 @@ func constFoldFunc(f *Function) {
                     if *c == 0.0 { continue }
                     result = *a / *c
                 }
-                // Convert result to bits and replace with FConst
-                bits := int64(*(*uint64)(unsafe.Pointer(&result)))
+                if math.IsNaN(result) { continue }
                 b.Instrs[i].Val.Op = OpFConst
                 b.Instrs[i].Val.Args = nil
-                b.Instrs[i].Val.Const = bits
+                b.Instrs[i].Val.Const = int64(math.Float64bits(result))
+                changed = true
             }
         }
     }
+    return changed
+}
+
+// extendConst applies a width change op to the constant k.
+func extendConst(op Op, k, bits int64) int64 {
+    shift := uint64(64 - bits)
+    if op == OpSext { return k << shift >> shift }
+    return int64(uint64(k) << shift >> shift)
 }
 
 func findConst(b *BasicBlock, id ValueID) *int64 {
@@ -96,31 +138,29 @@ func findConst(b *BasicBlock, id ValueID) *int64 {
 func findFConst(b *BasicBlock, id ValueID) *float64 {
     for _, ins := range b.Instrs {
         if ins.Res == id && ins.Val.Op == OpFConst {
-            // Convert bits back to float64
-            bits := uint64(ins.Val.Const)
-            v := *(*float64)(unsafe.Pointer(&bits))
+            v := math.Float64frombits(uint64(ins.Val.Const))
             return &v
         }
     }
     return nil
 }
 
-func dceFunc(f *Function) {
+func dceFunc(f *Function) bool {
     // Remove instructions whose results are unused and have no side effects.
     // Iterate to fixed point since removing can cascade.
+    removed := false
     changed := true
     for changed {
         changed = false
         ui := buildUses(f)
+        consts := f.consts()
         for _, b := range f.Blocks {
             out := b.Instrs[:0]
             for _, ins := range b.Instrs {
                 if ins.Val.Op == OpRet { out = append(out, ins); continue }
                 if ins.Res < 0 { out = append(out, ins); continue }
-                // No side effects in Phase 1 ops; can delete if unused
-                // Keep params, calls, and stores (including byte stores)
-                if ui.uses[ins.Res] == 0 && ins.Val.Op != OpParam && ins.Val.Op != OpCall && ins.Val.Op != OpStore && ins.Val.Op != OpStore8 {
-                    changed = true
+                if ui.uses[ins.Res] == 0 && !hasEffect(ins, consts) {
+                    changed, removed = true, true
                     continue
                 }
                 out = append(out, ins)
@@ -128,4 +168,25 @@ func dceFunc(f *Function) {
             b.Instrs = out
         }
     }
+    return removed
+}
+
+// hasEffect reports whether ins does more than compute its result, so that
+// DCE must keep it even when the result is unused: params, calls, stores of
+// either width, and divisions that may trap. An op added with an effect of
+// its own belongs here.
+func hasEffect(ins Instr, consts map[ValueID]int64) bool {
+    switch ins.Val.Op {
+    case OpParam, OpCall, OpCallIndirect, OpStore, OpStore8, OpStoreIdx: return true
+    }
+    return mayTrap(ins, consts)
+}
+
+// mayTrap reports whether ins is an integer division whose divisor is not a
+// known constant that is safe: zero faults, and so does -1 with the most
+// negative dividend.
+func mayTrap(ins Instr, consts map[ValueID]int64) bool {
+    if ins.Val.Op != OpDiv && ins.Val.Op != OpUDiv { return false }
+    k, ok := consts[ins.Val.Args[1]]
+    return !ok || k == 0 || k == -1 && ins.Val.Op == OpDiv
 }
@@ -0,0 +1,359 @@
+package ir
+
+import (
+    "fmt"
+    "math"
+    "strconv"
+    "strings"
+
+    ty "github.com/tinyrange/cc/internal/types"
+)
+
+// opByName maps the textual IR mnemonics back to their ops.
+var opByName = func() map[string]Op {
+    m := map[string]Op{}
+    for op, name := range opNames { m[name] = op }
+    return m
+}()
+
+// Parse reads a module in the textual IR that Module.String prints. Text
+// after a ';' is a comment. Block edges are rebuilt from the terminators, in
+// block order, and phi operands are matched to the predecessors they name.
+// Every operand must be defined somewhere in its function.
+func Parse(name, src string) (*Module, error) {
+    m := NewModule(name)
+    p := &irParser{lines: strings.Split(src, "\n")}
+    for p.i < len(p.lines) {
+        if p.text() == "" { p.i++; continue }
+        f, err := p.function()
+        if err != nil { return nil, err }
+        m.Funcs = append(m.Funcs, f)
+    }
+    return m, nil
+}
+
+type irParser struct {
+    lines []string
+    i     int // current line
+}
+
+// text is the current line without its comment.
+func (p *irParser) text() string {
+    s := p.lines[p.i]
+    if k := strings.IndexByte(s, ';'); k >= 0 { s = s[:k] }
+    return strings.TrimSpace(s)
+}
+
+func (p *irParser) errorf(line int, format string, args ...interface{}) error {
+    return fmt.Errorf("ir:%d: %s", line+1, fmt.Sprintf(format, args...))
+}
+
+// parsedInstr is an instruction with the source line it came from and, for
+// a phi, the predecessor named by each operand.
+type parsedInstr struct {
+    line  int
+    preds []string
+}
+
+func (p *irParser) function() (*Function, error) {
+    head, line := p.text(), p.i
+    f := &Function{}
+    if strings.HasPrefix(head, "static ") { f.Static, head = true, strings.TrimPrefix(head, "static ") }
+    open, close := strings.IndexByte(head, '('), strings.LastIndexByte(head, ')')
+    if !strings.HasPrefix(head, "func ") || !strings.HasSuffix(head, "{") || open < 0 || close < open {
+        return nil, p.errorf(line, "expected func name(params) {")
+    }
+    f.Name = strings.TrimSpace(head[len("func "):open])
+    for _, n := range splitList(head[open+1 : close]) {
+        f.Params = append(f.Params, ParamInfo{Name: n, Type: ty.Int()})
+    }
+    // labels first, so that jumps may go forward
+    p.i++
+    start := p.i
+    index := map[string]int{}
+    var labelLines []int
+    for ; p.i < len(p.lines) && p.text() != "}"; p.i++ {
+        s := p.text()
+        if !strings.HasSuffix(s, ":") { continue }
+        label := strings.TrimSuffix(s, ":")
+        if _, dup := index[label]; dup { return nil, p.errorf(p.i, "duplicate label %s", label) }
+        index[label] = len(f.Blocks)
+        labelLines = append(labelLines, p.i)
+        f.Blocks = append(f.Blocks, &BasicBlock{Name: label})
+    }
+    if p.i == len(p.lines) { return nil, p.errorf(line, "missing } at end of %s", f.Name) }
+    end := p.i
+    p.i++
+    if len(f.Blocks) == 0 { return nil, p.errorf(line, "%s has no blocks", f.Name) }
+    f.entry = f.Blocks[0]
+
+    info := map[*BasicBlock][]parsedInstr{}
+    var b *BasicBlock
+    for l := start; l < end; l++ {
+        p.i = l
+        s := p.text()
+        if s == "" { continue }
+        if strings.HasSuffix(s, ":") {
+            b = f.Blocks[index[strings.TrimSuffix(s, ":")]]
+            continue
+        }
+        if b == nil { return nil, p.errorf(l, "instruction before the first label") }
+        if b.Terminated() { return nil, p.errorf(l, "instruction after the terminator of %s", b.Name) }
+        ins, preds, err := parseInstr(s, index)
+        if err != nil { return nil, p.errorf(l, "%v", err) }
+        b.Instrs = append(b.Instrs, ins)
+        info[b] = append(info[b], parsedInstr{line: l, preds: preds})
+    }
+    p.i = end + 1
+
+    // edges follow the terminators, which every block must end in; then
+    // each phi's operands are put in the order of its block's predecessors
+    for i, b := range f.Blocks {
+        if !b.Terminated() { return nil, p.errorf(labelLines[i], "%s does not end in a terminator", b.Name) }
+        f.addTargetEdges(b)
+    }
+    defined := map[ValueID]bool{}
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs {
+            if ins.Res >= 0 { defined[ins.Res] = true }
+        }
+    }
+    for _, b := range f.Blocks {
+        for i := range b.Instrs {
+            ins := &b.Instrs[i]
+            pi := info[b][i]
+            if ins.Val.Op == OpPhi {
+                if err := orderPhi(ins, pi.preds, b); err != nil { return nil, p.errorf(pi.line, "%v", err) }
+            }
+            for _, a := range operands(ins) {
+                if !defined[a] { return nil, p.errorf(pi.line, "%s is not defined", a) }
+            }
+        }
+    }
+    return f, nil
+}
+
+// operands are the values ins reads; jump targets are block indices.
+func operands(ins *Instr) []ValueID {
+    switch ins.Val.Op {
+    case OpJmp: return nil
+    case OpJnz: return ins.Val.Args[:1]
+    case OpBr: return ins.Val.Args[:2]
+    case OpSwitchTable: return ins.Val.Args[:1]
+    }
+    return ins.Val.Args
+}
+
+// targets are the block indices the terminator v jumps to, a switch table's
+// default first; changing them retargets the jumps.
+func targets(v *Value) []ValueID {
+    switch v.Op {
+    case OpJmp: return v.Args[:1]
+    case OpJnz: return v.Args[1:3]
+    case OpBr: return v.Args[2:4]
+    case OpSwitchTable: return v.Args[1:]
+    }
+    return nil
+}
+
+// addTargetEdges adds an edge from b to each block its terminator jumps to.
+// The blocks of a switch table get one edge each, however many entries
+// name them.
+func (f *Function) addTargetEdges(b *BasicBlock) {
+    v := &b.Instrs[len(b.Instrs)-1].Val
+    for _, t := range targets(v) {
+        if v.Op == OpSwitchTable && containsBlock(b.Succs, f.Blocks[t]) { continue }
+        f.addEdge(b, f.Blocks[t])
+    }
+}
+
+// orderPhi puts the operands of phi in the order of b's predecessors, going
+// by the predecessor each one names.
+func orderPhi(phi *Instr, names []string, b *BasicBlock) error {
+    if len(phi.Val.Args) != len(b.Preds) {
+        return fmt.Errorf("phi has %d operands but %s has %d predecessors", len(phi.Val.Args), b.Name, len(b.Preds))
+    }
+    if names == nil { return nil }
+    byPred := map[string]ValueID{}
+    for i, n := range names { byPred[n] = phi.Val.Args[i] }
+    args := make([]ValueID, len(b.Preds))
+    for i, pred := range b.Preds {
+        v, ok := byPred[pred.Name]
+        if !ok { return fmt.Errorf("phi has no operand for predecessor %s", pred.Name) }
+        args[i] = v
+    }
+    phi.Val.Args = args
+    return nil
+}
+
+// parseInstr parses one instruction. For a phi it also returns the
+// predecessor each operand names, or nil when none do.
+func parseInstr(s string, index map[string]int) (Instr, []string, error) {
+    ins := Instr{Res: -1}
+    if k := strings.Index(s, "="); k >= 0 {
+        res, err := parseValue(strings.TrimSpace(s[:k]))
+        if err != nil { return ins, nil, err }
+        ins.Res, s = res, strings.TrimSpace(s[k+1:])
+    }
+    mnemonic, rest := s, ""
+    if k := strings.IndexByte(s, ' '); k >= 0 { mnemonic, rest = s[:k], strings.TrimSpace(s[k+1:]) }
+    op, ok := opByName[mnemonic]
+    if !ok {
+        // an op with no name prints as opN, and reads back as that op;
+        // nothing the compiler builds has one, but a test can hand the
+        // back end an op it cannot lower
+        n, err := strconv.Atoi(strings.TrimPrefix(mnemonic, "op"))
+        if _, named := opNames[Op(n)]; err != nil || !strings.HasPrefix(mnemonic, "op") || n < 0 || named {
+            return ins, nil, fmt.Errorf("unknown op %s", mnemonic)
+        }
+        op = Op(n)
+    }
+    ins.Val.Op = op
+    label := func(s string) (ValueID, error) {
+        i, ok := index[s]
+        if !ok { return 0, fmt.Errorf("unknown label %s", s) }
+        return ValueID(i), nil
+    }
+    var err error
+    switch op {
+    case OpConst, OpAlloca:
+        ins.Val.Const, err = strconv.ParseInt(rest, 10, 64)
+    case OpFConst:
+        var x float64
+        x, err = strconv.ParseFloat(rest, 64)
+        ins.Val.Const = int64(math.Float64bits(x))
+    case OpParam:
+    case OpGlobalAddr:
+        if !strings.HasPrefix(rest, "@") { return ins, nil, fmt.Errorf("expected @symbol") }
+        ins.Val.Sym = rest[1:]
+    case OpSext, OpZext, OpTrunc:
+        parts := splitList(rest)
+        if len(parts) != 2 { return ins, nil, fmt.Errorf("%s takes a value and a width", op) }
+        var a ValueID
+        if a, err = parseValue(parts[0]); err != nil { return ins, nil, err }
+        ins.Val.Args = []ValueID{a}
+        ins.Val.Const, err = strconv.ParseInt(parts[1], 10, 64)
+    case OpCall:
+        if strings.HasSuffix(rest, " variadic") { ins.Val.Const, rest = 1, strings.TrimSuffix(rest, " variadic") }
+        open := strings.IndexByte(rest, '(')
+        if !strings.HasPrefix(rest, "@") || open < 0 || !strings.HasSuffix(rest, ")") {
+            return ins, nil, fmt.Errorf("expected call @name(args)")
+        }
+        ins.Val.Sym = rest[1:open]
+        ins.Val.Args, err = parseValues(splitList(rest[open+1 : len(rest)-1]))
+    case OpCallIndirect:
+        open := strings.IndexByte(rest, '(')
+        if open < 0 || !strings.HasSuffix(rest, ")") { return ins, nil, fmt.Errorf("expected callind callee(args)") }
+        callee, err := parseValue(rest[:open])
+        if err != nil { return ins, nil, err }
+        args, err := parseValues(splitList(rest[open+1 : len(rest)-1]))
+        if err != nil { return ins, nil, err }
+        ins.Val.Args = append([]ValueID{callee}, args...)
+    case OpPhi:
+        var names []string
+        for _, opnd := range strings.Split(rest, "]") {
+            opnd = strings.Trim(strings.TrimSpace(opnd), ",")
+            opnd = strings.TrimSpace(opnd)
+            if opnd == "" { continue }
+            if !strings.HasPrefix(opnd, "[") { return ins, nil, fmt.Errorf("expected [value, pred]") }
+            parts := splitList(opnd[1:])
+            if len(parts) == 0 || len(parts) > 2 { return ins, nil, fmt.Errorf("expected [value, pred]") }
+            a, err := parseValue(parts[0])
+            if err != nil { return ins, nil, err }
+            ins.Val.Args = append(ins.Val.Args, a)
+            if len(parts) == 2 {
+                if _, ok := index[parts[1]]; !ok { return ins, nil, fmt.Errorf("unknown label %s", parts[1]) }
+                names = append(names, parts[1])
+            }
+        }
+        if len(names) != 0 && len(names) != len(ins.Val.Args) {
+            return ins, nil, fmt.Errorf("either every phi operand names its predecessor or none does")
+        }
+        return ins, names, nil
+    case OpJmp:
+        var t ValueID
+        t, err = label(rest)
+        ins.Val.Args = []ValueID{t}
+    case OpJnz, OpBr:
+        parts := splitList(rest)
+        if op == OpBr {
+            // br cmp a, b, then, else
+            k := strings.IndexByte(rest, ' ')
+            if k < 0 { return ins, nil, fmt.Errorf("br needs a comparison") }
+            cmp, ok := opByName[rest[:k]]
+            if !ok || !isCompare(cmp) { return ins, nil, fmt.Errorf("br needs a comparison") }
+            ins.Val.Const = int64(cmp)
+            parts = splitList(rest[k+1:])
+        }
+        want := 3
+        if op == OpBr { want = 4 }
+        if len(parts) != want { return ins, nil, fmt.Errorf("%s takes %d operands", op, want) }
+        if ins.Val.Args, err = parseValues(parts[:want-2]); err != nil { return ins, nil, err }
+        for _, l := range parts[want-2:] {
+            t, err := label(l)
+            if err != nil { return ins, nil, err }
+            ins.Val.Args = append(ins.Val.Args, t)
+        }
+    case OpLoadIdx, OpStoreIdx:
+        parts := splitList(rest)
+        want := 4
+        if op == OpStoreIdx { want = 5 }
+        if len(parts) != want { return ins, nil, fmt.Errorf("%s takes %d operands", op, want) }
+        if ins.Val.Args, err = parseValues(append(parts[:2:2], parts[4:]...)); err != nil { return ins, nil, err }
+        if ins.Val.Scale, err = strconv.ParseInt(parts[2], 10, 64); err != nil || ins.Val.Scale&(ins.Val.Scale-1) != 0 || ins.Val.Scale < 1 || ins.Val.Scale > 8 {
+            return ins, nil, fmt.Errorf("bad scale %q", parts[2])
+        }
+        if ins.Val.Const, err = strconv.ParseInt(parts[3], 10, 64); err != nil { return ins, nil, fmt.Errorf("bad displacement %q", parts[3]) }
+    case OpSwitchTable:
+        // switchtable v, low, default, blocks...
+        parts := splitList(rest)
+        if len(parts) < 3 { return ins, nil, fmt.Errorf("switchtable needs a value, a low bound and a default") }
+        if ins.Val.Args, err = parseValues(parts[:1]); err != nil { return ins, nil, err }
+        if ins.Val.Const, err = strconv.ParseInt(parts[1], 10, 64); err != nil { return ins, nil, fmt.Errorf("bad low bound %q", parts[1]) }
+        for _, l := range parts[2:] {
+            t, err := label(l)
+            if err != nil { return ins, nil, err }
+            ins.Val.Args = append(ins.Val.Args, t)
+        }
+    default:
+        if ins.Val.Args, err = parseValues(splitList(rest)); err != nil { return ins, nil, err }
+        if n, known := arity[op]; known && len(ins.Val.Args) != n { return ins, nil, fmt.Errorf("%s takes %d operands", op, n) }
+    }
+    return ins, nil, err
+}
+
+// arity is the number of operands of each op whose operands are just a
+// list of values.
+var arity = map[Op]int{
+    OpAdd: 2, OpSub: 2, OpMul: 2, OpDiv: 2, OpFAdd: 2, OpFSub: 2, OpFMul: 2, OpFDiv: 2,
+    OpEq: 2, OpNe: 2, OpLt: 2, OpLe: 2, OpGt: 2, OpGe: 2,
+    OpAnd: 2, OpOr: 2, OpXor: 2, OpShl: 2, OpShr: 2, OpStore: 2, OpStore8: 2,
+    OpRet: 1, OpLoad: 1, OpLoad8: 1, OpNot: 1, OpLogicalNot: 1, OpCopy: 1,
+    OpAddr: 1, OpSlotAddr: 1, OpF2I: 1, OpI2F: 1,
+    OpULt: 2, OpULe: 2, OpUGt: 2, OpUGe: 2, OpUDiv: 2, OpUShr: 2,
+}
+
+func parseValue(s string) (ValueID, error) {
+    n, err := strconv.Atoi(strings.TrimPrefix(s, "v"))
+    if err != nil || !strings.HasPrefix(s, "v") || n < 0 { return 0, fmt.Errorf("bad value %q", s) }
+    return ValueID(n), nil
+}
+
+func parseValues(ss []string) ([]ValueID, error) {
+    var ids []ValueID
+    for _, s := range ss {
+        v, err := parseValue(s)
+        if err != nil { return nil, err }
+        ids = append(ids, v)
+    }
+    return ids, nil
+}
+
+// splitList splits a comma separated list, dropping spaces.
+func splitList(s string) []string {
+    var out []string
+    for _, part := range strings.Split(s, ",") {
+        if part = strings.TrimSpace(part); part != "" { out = append(out, part) }
+    }
+    return out
+}
@@ -0,0 +1,187 @@
+package ir
+
+import (
+    "fmt"
+    "io"
+    "strings"
+)
+
+// Pass is an optimization over one function. Run reports whether it changed
+// anything, which lets a group of passes repeat until none does.
+type Pass interface {
+    Name() string
+    Run(f *Function) bool
+}
+
+// funcPass is a pass made of a function.
+type funcPass struct {
+    name string
+    run  func(f *Function) bool
+}
+
+func (p funcPass) Name() string         { return p.name }
+func (p funcPass) Run(f *Function) bool { return p.run(f) }
+
+// maxRounds bounds how often a fixpoint group repeats, in case two of its
+// passes keep undoing each other.
+const maxRounds = 8
+
+// fixpoint is a group of passes run in turn until a round changes nothing.
+type fixpoint struct {
+    name   string
+    passes []Pass
+}
+
+func (g fixpoint) Name() string { return g.name }
+
+func (g fixpoint) Run(f *Function) bool { return g.repeat(f, Pass.Run) }
+
+// repeat runs the group with run, which lets the pass manager see each pass
+// of it run.
+func (g fixpoint) repeat(f *Function, run func(p Pass, f *Function) bool) bool {
+    changed := false
+    for i := 0; i < maxRounds; i++ {
+        round := false
+        for _, p := range g.passes {
+            if run(p, f) { round = true }
+        }
+        if !round { break }
+        changed = true
+    }
+    return changed
+}
+
+// passes returns the passes -fpass and -fno- can name, by name.
+func (m *Module) passes() map[string]Pass {
+    all := []Pass{
+        funcPass{"tail-calls", eliminateTailCalls},
+        &inliner{m: m},
+        funcPass{"const-fold", constFoldFunc},
+        funcPass{"simplify", simplifyFunc},
+        // a branch on a constant is warned about before it is folded away
+        funcPass{"fold-branches", func(f *Function) bool {
+            if m.WarnConstantCondition { warnConstConds(m, f) }
+            return foldBranches(f)
+        }},
+        funcPass{"unreachable", removeUnreachable},
+        funcPass{"phis", removeTrivialPhis},
+        funcPass{"gvn", gvnFunc},
+        funcPass{"loads", eliminateRedundantLoads},
+        funcPass{"dead-stores", eliminateDeadStores},
+        funcPass{"strength", reduceStrength},
+        funcPass{"addressing", combineAddressing},
+        funcPass{"dce", dceFunc},
+    }
+    byName := map[string]Pass{}
+    for _, p := range all { byName[p.Name()] = p }
+    return byName
+}
+
+// Pipeline returns the passes Optimize runs: those m.Passes names, in order,
+// or else the pipeline for m.OptLevel, less those m.DisabledPasses names.
+// -O0 runs nothing; -O1 removes tail calls and inlines first, so that the
+// rest see the inlined bodies, then folds constants, simplifies and removes
+// trivial phis until none finds more to do, and removes trivial phis again
+// once folded branches have cut edges; -O2 adds global value numbering.
+func (m *Module) Pipeline() ([]Pass, error) {
+    byName := m.passes()
+    pick := func(names ...string) []Pass {
+        var ps []Pass
+        for _, n := range names { ps = append(ps, byName[n]) }
+        return ps
+    }
+    names := append(append([]string(nil), m.Passes...), m.DisabledPasses...)
+    if m.DumpAfter != "" && m.DumpAfter != "all" { names = append(names, m.DumpAfter) }
+    for _, n := range names {
+        if byName[n] == nil { return nil, fmt.Errorf("unknown pass %q (known: %s)", n, strings.Join(PassNames(), ", ")) }
+    }
+    if m.Passes != nil { return pick(m.Passes...), nil }
+    if m.OptLevel <= 0 { return nil, nil }
+    disabled := map[string]bool{}
+    for _, n := range m.DisabledPasses { disabled[n] = true }
+    keep := func(ps []Pass) []Pass {
+        var out []Pass
+        for _, p := range ps {
+            if !disabled[p.Name()] { out = append(out, p) }
+        }
+        return out
+    }
+    ps := pick("tail-calls", "inline")
+    ps = append(ps, fixpoint{"fold", keep(pick("const-fold", "simplify", "phis"))})
+    ps = append(ps, pick("fold-branches", "unreachable", "phis")...)
+    if m.OptLevel >= 2 { ps = append(ps, byName["gvn"]) }
+    ps = append(ps, pick("loads", "dead-stores", "strength", "addressing", "dce")...)
+    return keep(ps), nil
+}
+
+// PassNames lists the names of the passes, in the order -O2 runs them.
+func PassNames() []string {
+    return []string{"tail-calls", "inline", "const-fold", "simplify", "fold-branches", "unreachable",
+        "phis", "gvn", "loads", "dead-stores", "strength", "addressing", "dce"}
+}
+
+// PassStat counts the instructions one pass removed from and added to one
+// function, over all the times it ran there. An instruction the pass
+// rewrote counts as both.
+type PassStat struct {
+    Pass, Func     string
+    Removed, Added int
+}
+
+// runPass runs p on f, dumping f afterwards if m.DumpAfter asks for it and
+// counting what changed if m.Stats is set. The passes of a fixpoint group
+// are run, dumped and counted one by one.
+func (m *Module) runPass(p Pass, f *Function) bool {
+    if g, ok := p.(fixpoint); ok { return g.repeat(f, m.runPass) }
+    var before map[string]int
+    if m.Stats { before = f.instrCounts() }
+    changed := p.Run(f)
+    if m.Stats {
+        st := m.stat(p.Name(), f.Name)
+        after := f.instrCounts()
+        for s, n := range before {
+            if d := n - after[s]; d > 0 { st.Removed += d }
+        }
+        for s, n := range after {
+            if d := n - before[s]; d > 0 { st.Added += d }
+        }
+    }
+    if m.Log != nil && (m.DumpAfter == "all" || m.DumpAfter == p.Name()) {
+        fmt.Fprintf(m.Log, ";; after %s on %s\n%s\n", p.Name(), f.Name, f)
+    }
+    return changed
+}
+
+// stat returns the count for pass in fn, adding it if it is new.
+func (m *Module) stat(pass, fn string) *PassStat {
+    for _, st := range m.PassStats {
+        if st.Pass == pass && st.Func == fn { return st }
+    }
+    st := &PassStat{Pass: pass, Func: fn}
+    m.PassStats = append(m.PassStats, st)
+    return st
+}
+
+// instrCounts counts f's instructions by their text, with jump targets
+// named rather than numbered so that renumbering blocks changes nothing.
+func (f *Function) instrCounts() map[string]int {
+    label := func(i int) string {
+        if i >= 0 && i < len(f.Blocks) { return f.Blocks[i].Name }
+        return fmt.Sprintf("b%d", i)
+    }
+    counts := map[string]int{}
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs { counts[formatInstr(ins, label, b.Preds)]++ }
+    }
+    return counts
+}
+
+// WriteStats prints the counts Optimize gathered, a line per pass and
+// function where the pass changed something, in the order they first ran.
+func (m *Module) WriteStats(w io.Writer) {
+    fmt.Fprintf(w, ";; stats\n")
+    for _, st := range m.PassStats {
+        if st.Removed == 0 && st.Added == 0 { continue }
+        fmt.Fprintf(w, "%-14s %-16s -%d +%d\n", st.Pass, st.Func, st.Removed, st.Added)
+    }
+}
@@ -22,19 +22,22 @@ func PhiEliminate(f *Function) {
                 ip = splitCriticalEdge(f, pred, b)
             }
             // Insert copies before terminator (at end)
+            var copies []Instr
             for _, phi := range phis {
                 if pi >= len(phi.Val.Args) { continue }
                 src := phi.Val.Args[pi]
                 dst := phi.Res
                 // copy src -> dst
-                insertBeforeTerminator(ip, Instr{Res: dst, Val: Value{Op: OpCopy, Args: []ValueID{src}}})
+                copies = append(copies, Instr{Res: dst, Val: Value{Op: OpCopy, Args: []ValueID{src}}, Pos: phi.Pos})
             }
+            for _, c := range sequentialize(f, copies) { insertBeforeTerminator(ip, c) }
             // If we created a split block, add jump to successor
             if ip != pred {
-                // emit jump to b using OpJmp with target index of b
-                // find index of b in function blocks
+                // emit jump to b using OpJmp with target index of b,
+                // at the position of the branch it replaces
                 ti := blockIndexOf(f, b)
-                ip.Instrs = append(ip.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ti)}}})
+                pos := pred.Instrs[len(pred.Instrs)-1].Pos
+                ip.Instrs = append(ip.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{ValueID(ti)}}, Pos: pos})
             }
         }
         // Remove phi nodes from b
@@ -42,6 +45,43 @@ func PhiEliminate(f *Function) {
     }
 }
 
+// sequentialize orders copies that happen at once so that none overwrites
+// a value another still reads. A copy goes once no other pending copy reads
+// its destination; a cycle, such as the swap a, b = b, a, is broken by saving
+// one source in a new value first.
+func sequentialize(f *Function, copies []Instr) []Instr {
+    var out []Instr
+    next := f.maxValueID() + 1
+    pending := copies[:0]
+    for _, c := range copies {
+        if c.Res != c.Val.Args[0] { pending = append(pending, c) }
+    }
+    for len(pending) > 0 {
+        emitted := false
+        for i, c := range pending {
+            read := false
+            for j, d := range pending {
+                if j != i && d.Val.Args[0] == c.Res { read = true }
+            }
+            if read { continue }
+            out = append(out, c)
+            pending = append(pending[:i], pending[i+1:]...)
+            emitted = true
+            break
+        }
+        if emitted { continue }
+        // every destination is still read: save the first one's old value
+        c := pending[0]
+        tmp := next
+        next++
+        out = append(out, Instr{Res: tmp, Val: Value{ID: tmp, Op: OpCopy, Args: []ValueID{c.Res}}, Pos: c.Pos})
+        for j := range pending {
+            if pending[j].Val.Args[0] == c.Res { pending[j].Val.Args = []ValueID{tmp} }
+        }
+    }
+    return out
+}
+
 func isCritical(p, s *BasicBlock) bool {
     return len(p.Succs) > 1 && len(s.Preds) > 1
 }
@@ -65,17 +105,9 @@ func splitCriticalEdge(f *Function, p, s *BasicBlock) *BasicBlock {
     if len(p.Instrs) > 0 {
         tiS := blockIndexOf(f, s)
         tiN := blockIndexOf(f, nb)
-        last := &p.Instrs[len(p.Instrs)-1]
-        switch last.Val.Op {
-        case OpJmp:
-            if len(last.Val.Args) == 1 && int(last.Val.Args[0]) == tiS {
-                last.Val.Args[0] = ValueID(tiN)
-            }
-        case OpJnz:
-            if len(last.Val.Args) == 3 {
-                if int(last.Val.Args[1]) == tiS { last.Val.Args[1] = ValueID(tiN) }
-                if int(last.Val.Args[2]) == tiS { last.Val.Args[2] = ValueID(tiN) }
-            }
+        ts := targets(&p.Instrs[len(p.Instrs)-1].Val)
+        for k, t := range ts {
+            if int(t) == tiS { ts[k] = ValueID(tiN) }
         }
     }
     return nb
@@ -87,8 +119,7 @@ func insertBeforeTerminator(b *BasicBlock, ins Instr) {
         b.Instrs = append(b.Instrs, ins)
         return
     }
-    lastOp := b.Instrs[n-1].Val.Op
-    if lastOp == OpJmp || lastOp == OpJnz || lastOp == OpRet {
+    if isTerminator(b.Instrs[n-1].Val.Op) {
         // insert before last
         tmp := append([]Instr(nil), b.Instrs[:n-1]...)
         tmp = append(tmp, ins)
@@ -0,0 +1,144 @@
+package ir
+
+import (
+    "fmt"
+    "math"
+    "strings"
+)
+
+// opNames are the mnemonics of the textual IR.
+var opNames = map[Op]string{
+    OpConst: "const", OpFConst: "fconst",
+    OpAdd: "add", OpSub: "sub", OpMul: "mul", OpDiv: "div",
+    OpFAdd: "fadd", OpFSub: "fsub", OpFMul: "fmul", OpFDiv: "fdiv",
+    OpEq: "eq", OpNe: "ne", OpLt: "lt", OpLe: "le", OpGt: "gt", OpGe: "ge",
+    OpRet: "ret", OpStore: "store", OpLoad: "load", OpLoad8: "load8", OpParam: "param",
+    OpAnd: "and", OpOr: "or", OpXor: "xor", OpShl: "shl", OpShr: "shr", OpNot: "not",
+    OpCopy: "copy", OpPhi: "phi", OpJmp: "jmp", OpJnz: "jnz", OpCall: "call",
+    OpAddr: "addr", OpGlobalAddr: "globaladdr", OpSlotAddr: "slotaddr", OpStore8: "store8",
+    OpLogicalNot: "logicalnot", OpF2I: "f2i", OpI2F: "i2f", OpAlloca: "alloca",
+    OpSext: "sext", OpZext: "zext", OpTrunc: "trunc", OpBr: "br", OpCallIndirect: "callind",
+    OpSwitchTable: "switchtable", OpLoadIdx: "loadidx", OpStoreIdx: "storeidx",
+    OpULt: "ult", OpULe: "ule", OpUGt: "ugt", OpUGe: "uge", OpUDiv: "udiv", OpUShr: "ushr",
+}
+
+func (op Op) String() string {
+    if s, ok := opNames[op]; ok { return s }
+    return fmt.Sprintf("op%d", int(op))
+}
+
+func (v ValueID) String() string { return fmt.Sprintf("v%d", int(v)) }
+
+// String prints the module's functions in the textual IR.
+func (m *Module) String() string {
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "; module %s\n", m.Name)
+    for _, f := range m.Funcs {
+        sb.WriteString("\n")
+        sb.WriteString(f.String())
+    }
+    return sb.String()
+}
+
+// String prints f with its blocks labelled by name. Jump targets are printed
+// as labels, phi operands next to the predecessor they come from, and source
+// positions as line:column comments.
+func (f *Function) String() string {
+    var sb strings.Builder
+    if f.Static { sb.WriteString("static ") }
+    var params []string
+    for _, p := range f.Params { params = append(params, p.Name) }
+    fmt.Fprintf(&sb, "func %s(%s) {\n", f.Name, strings.Join(params, ", "))
+    label := func(i int) string {
+        if i >= 0 && i < len(f.Blocks) { return f.Blocks[i].Name }
+        return fmt.Sprintf("b%d", i)
+    }
+    for _, b := range f.Blocks { writeBlock(&sb, b, label) }
+    sb.WriteString("}\n")
+    return sb.String()
+}
+
+// String prints b on its own; without its function, jump targets are printed
+// as block indices.
+func (b *BasicBlock) String() string {
+    var sb strings.Builder
+    writeBlock(&sb, b, func(i int) string { return fmt.Sprintf("b%d", i) })
+    return sb.String()
+}
+
+// String prints ins on its own, with jump targets as block indices and phi
+// operands without their predecessors.
+func (ins Instr) String() string {
+    return formatInstr(ins, func(i int) string { return fmt.Sprintf("b%d", i) }, nil)
+}
+
+func writeBlock(sb *strings.Builder, b *BasicBlock, label func(int) string) {
+    sb.WriteString(b.Name + ":")
+    if len(b.Preds) > 0 {
+        var preds []string
+        for _, p := range b.Preds { preds = append(preds, p.Name) }
+        sb.WriteString(" ; preds " + strings.Join(preds, ", "))
+    }
+    sb.WriteString("\n")
+    for _, ins := range b.Instrs {
+        sb.WriteString("  " + formatInstr(ins, label, b.Preds))
+        if ins.Pos.Line > 0 { fmt.Fprintf(sb, " ; %d:%d", ins.Pos.Line, ins.Pos.Col) }
+        sb.WriteString("\n")
+    }
+}
+
+// formatInstr prints ins, naming jump targets with label. preds, when given,
+// are the predecessors that the operands of a phi come from.
+func formatInstr(ins Instr, label func(int) string, preds []*BasicBlock) string {
+    v := ins.Val
+    var sb strings.Builder
+    if ins.Res >= 0 { fmt.Fprintf(&sb, "%s = ", ins.Res) }
+    sb.WriteString(v.Op.String())
+    args := func(ids []ValueID) string {
+        var s []string
+        for _, a := range ids { s = append(s, a.String()) }
+        return strings.Join(s, ", ")
+    }
+    switch v.Op {
+    case OpConst, OpAlloca:
+        fmt.Fprintf(&sb, " %d", v.Const)
+    case OpFConst:
+        fmt.Fprintf(&sb, " %v", math.Float64frombits(uint64(v.Const)))
+    case OpParam:
+    case OpGlobalAddr:
+        fmt.Fprintf(&sb, " @%s", v.Sym)
+    case OpSext, OpZext, OpTrunc:
+        fmt.Fprintf(&sb, " %s, %d", v.Args[0], v.Const)
+    case OpCall:
+        fmt.Fprintf(&sb, " @%s(%s)", v.Sym, args(v.Args))
+        if v.Const == 1 { sb.WriteString(" variadic") }
+    case OpCallIndirect:
+        fmt.Fprintf(&sb, " %s(%s)", v.Args[0], args(v.Args[1:]))
+    case OpPhi:
+        for i, a := range v.Args {
+            if i > 0 { sb.WriteString(",") }
+            if i < len(preds) {
+                fmt.Fprintf(&sb, " [%s, %s]", a, preds[i].Name)
+            } else {
+                fmt.Fprintf(&sb, " [%s]", a)
+            }
+        }
+    case OpJmp:
+        fmt.Fprintf(&sb, " %s", label(int(v.Args[0])))
+    case OpJnz:
+        fmt.Fprintf(&sb, " %s, %s, %s", v.Args[0], label(int(v.Args[1])), label(int(v.Args[2])))
+    case OpBr:
+        fmt.Fprintf(&sb, " %s %s, %s, %s, %s", Op(v.Const), v.Args[0], v.Args[1], label(int(v.Args[2])), label(int(v.Args[3])))
+    case OpLoadIdx, OpStoreIdx:
+        // loadidx base, index, scale, disp; storeidx adds the value stored
+        fmt.Fprintf(&sb, " %s, %s, %d, %d", v.Args[0], v.Args[1], v.Scale, v.Const)
+        if v.Op == OpStoreIdx { fmt.Fprintf(&sb, ", %s", v.Args[2]) }
+    case OpSwitchTable:
+        // switchtable v, low, default, the blocks for low, low+1, ...
+        fmt.Fprintf(&sb, " %s, %d", v.Args[0], v.Const)
+        for _, t := range v.Args[1:] { sb.WriteString(", " + label(int(t))) }
+    default:
+        if len(v.Args) > 0 { sb.WriteString(" " + args(v.Args)) }
+    }
+    return sb.String()
+}
@@ -0,0 +1,171 @@
+package ir
+
+// simplifyFunc rewrites arithmetic with an identity or absorbing operand:
+// x + 0, x - 0, x * 1, x / 1, x | 0, x ^ 0 and shifts by 0 become a copy of
+// x; x * 0 and x & 0 become 0, as do x - x and x ^ x. Values have no side
+// effects, so dropping x is safe. Undoing a negation, 0 - (0 - x), or a
+// complement, ~~x, also gives x. The copies are then propagated into their
+// uses, leaving them dead for DCE.
+func simplifyFunc(f *Function) bool {
+    changed := false
+    consts := f.consts()
+    isK := func(id ValueID, k int64) bool {
+        v, ok := consts[id]
+        return ok && v == k
+    }
+    // what each value was defined as; a rewrite below keeps the value the
+    // same, so these stay true
+    defs := map[ValueID]Value{}
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs {
+            if ins.Res >= 0 { defs[ins.Res] = ins.Val }
+        }
+    }
+    // undo returns x when id is op applied to x, with a constant 0 first for
+    // a subtraction
+    undo := func(id ValueID, op Op) (ValueID, bool) {
+        d, ok := defs[id]
+        if !ok || d.Op != op { return 0, false }
+        if op == OpNot { return d.Args[0], true }
+        if isK(d.Args[0], 0) { return d.Args[1], true }
+        return 0, false
+    }
+    for _, b := range f.Blocks {
+        for i := range b.Instrs {
+            ins := &b.Instrs[i]
+            if ins.Val.Op == OpNot {
+                if x, ok := undo(ins.Val.Args[0], OpNot); ok {
+                    ins.Val = Value{ID: ins.Val.ID, Op: OpCopy, Args: []ValueID{x}}
+                    changed = true
+                }
+                continue
+            }
+            if len(ins.Val.Args) != 2 { continue }
+            l, r := ins.Val.Args[0], ins.Val.Args[1]
+            keep := ValueID(-1)
+            zero := false
+            switch ins.Val.Op {
+            case OpAdd, OpOr, OpXor:
+                if isK(r, 0) { keep = l } else if isK(l, 0) { keep = r }
+                if ins.Val.Op == OpXor && l == r { zero = true }
+                if ins.Val.Op == OpOr && l == r { keep = l }
+            case OpSub:
+                if isK(r, 0) { keep = l }
+                if l == r { zero = true }
+                if x, ok := undo(r, OpSub); ok && isK(l, 0) { keep = x }
+            case OpMul:
+                if isK(r, 1) { keep = l } else if isK(l, 1) { keep = r }
+                if isK(l, 0) || isK(r, 0) { zero = true }
+            case OpDiv, OpUDiv:
+                if isK(r, 1) { keep = l }
+            case OpAnd:
+                if isK(l, 0) || isK(r, 0) { zero = true } else if l == r { keep = l }
+            case OpShl, OpShr, OpUShr:
+                if isK(r, 0) { keep = l }
+            }
+            if zero {
+                ins.Val = Value{ID: ins.Val.ID, Op: OpConst}
+                consts[ins.Res] = 0
+                changed = true
+            } else if keep >= 0 {
+                ins.Val = Value{ID: ins.Val.ID, Op: OpCopy, Args: []ValueID{keep}}
+                changed = true
+            }
+        }
+    }
+    return propagateCopies(f) || changed
+}
+
+// propagateCopies makes every use of a copy use its source instead. It must
+// run while f is in SSA form, where each copy is the only definition of its
+// result. It reports whether any use changed.
+func propagateCopies(f *Function) bool {
+    src := map[ValueID]ValueID{}
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs {
+            if ins.Val.Op == OpCopy { src[ins.Res] = ins.Val.Args[0] }
+        }
+    }
+    if len(src) == 0 { return false }
+    resolve := func(id ValueID) ValueID {
+        for {
+            s, ok := src[id]
+            if !ok { return id }
+            id = s
+        }
+    }
+    changed := false
+    for _, b := range f.Blocks {
+        for i := range b.Instrs {
+            args := operands(&b.Instrs[i])
+            for j := range args {
+                if r := resolve(args[j]); r != args[j] { args[j], changed = r, true }
+            }
+        }
+    }
+    return changed
+}
+
+// reduceStrength turns multiplication by a power of two into a left shift,
+// signed division by one into an arithmetic shift of the dividend biased
+// to round toward zero: x / 2^k = (x + ((x >> 63) & (2^k - 1))) >> k, and
+// unsigned division by one into a logical shift.
+func reduceStrength(f *Function) bool {
+    changed := false
+    consts := f.consts()
+    log2 := func(id ValueID) (int64, bool) {
+        k, ok := consts[id]
+        if !ok || k <= 1 || k&(k-1) != 0 { return 0, false }
+        n := int64(0)
+        for k > 1 { k >>= 1; n++ }
+        return n, true
+    }
+    next := f.maxValueID() + 1
+    for _, b := range f.Blocks {
+        var out []Instr
+        for _, ins := range b.Instrs {
+            add := func(op Op, k int64, args ...ValueID) ValueID {
+                id := next
+                next++
+                out = append(out, Instr{Res: id, Val: Value{ID: id, Op: op, Args: args, Const: k}, Pos: ins.Pos})
+                return id
+            }
+            switch ins.Val.Op {
+            case OpMul:
+                x, y := ins.Val.Args[0], ins.Val.Args[1]
+                n, ok := log2(y)
+                if !ok { n, ok = log2(x); x = y }
+                if !ok { break }
+                ins.Val = Value{ID: ins.Val.ID, Op: OpShl, Args: []ValueID{x, add(OpConst, n)}}
+                changed = true
+            case OpDiv:
+                x := ins.Val.Args[0]
+                n, ok := log2(ins.Val.Args[1])
+                if !ok { break }
+                sign := add(OpShr, 0, x, add(OpConst, 63))
+                bias := add(OpAnd, 0, sign, add(OpConst, 1<<n-1))
+                ins.Val = Value{ID: ins.Val.ID, Op: OpShr, Args: []ValueID{add(OpAdd, 0, x, bias), add(OpConst, n)}}
+                changed = true
+            case OpUDiv:
+                n, ok := log2(ins.Val.Args[1])
+                if !ok { break }
+                ins.Val = Value{ID: ins.Val.ID, Op: OpUShr, Args: []ValueID{ins.Val.Args[0], add(OpConst, n)}}
+                changed = true
+            }
+            out = append(out, ins)
+        }
+        b.Instrs = out
+    }
+    return changed
+}
+
+// maxValueID returns the largest value id f defines.
+func (f *Function) maxValueID() ValueID {
+    max := ValueID(-1)
+    for _, b := range f.Blocks {
+        for _, ins := range b.Instrs {
+            if ins.Res > max { max = ins.Res }
+        }
+    }
+    return max
+}
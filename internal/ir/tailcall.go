@@ -0,0 +1,72 @@
+package ir
+
+import "fmt"
+
+// eliminateTailCalls turns each call of f to itself whose result f returns
+// straight away into a jump back to its start, so that such recursion runs
+// in constant stack. The entry is split: a new entry keeps the params and
+// jumps to the old one, which becomes a loop header with a phi per param
+// merging the params with the arguments of each tail call. A function with
+// an alloca is left alone, since a tail call could be passed the address of
+// a local that reusing the frame would overwrite.
+func eliminateTailCalls(f *Function) bool {
+    var tails []*BasicBlock
+    params := f.paramValues()
+    for _, b := range f.Blocks {
+        n := len(b.Instrs)
+        for _, ins := range b.Instrs {
+            if ins.Val.Op == OpAlloca { return false }
+        }
+        if n < 2 { continue }
+        call, ret := b.Instrs[n-2], b.Instrs[n-1]
+        if call.Val.Op != OpCall || call.Val.Sym != f.Name || call.Val.Const != 0 || len(call.Val.Args) != len(params) { continue }
+        if ret.Val.Op != OpRet || ret.Val.Args[0] != call.Res { continue }
+        tails = append(tails, b)
+    }
+    if len(tails) == 0 { return false }
+
+    head := f.entry
+    entry := &BasicBlock{Name: head.Name, sealed: true}
+    head.Name = fmt.Sprintf("tail.head_%d", len(f.Blocks))
+    // every jump target moves up one for the new entry
+    for _, b := range f.Blocks {
+        if !b.Terminated() { continue }
+        ins := &b.Instrs[len(b.Instrs)-1]
+        for k := len(operands(ins)); k < len(ins.Val.Args); k++ { ins.Val.Args[k]++ }
+    }
+    f.Blocks = append([]*BasicBlock{entry}, f.Blocks...)
+    f.entry = entry
+
+    // the params stay in the entry; the head merges them with the arguments
+    next := f.maxValueID() + 1
+    phiOf := map[ValueID]ValueID{}
+    var phis, rest []Instr
+    for _, ins := range head.Instrs {
+        if ins.Val.Op != OpParam { rest = append(rest, ins); continue }
+        entry.Instrs = append(entry.Instrs, ins)
+        phiOf[ins.Res] = next
+        phis = append(phis, Instr{Res: next, Val: Value{ID: next, Op: OpPhi, Args: []ValueID{ins.Res}}, Pos: ins.Pos})
+        if t, ok := f.Types[ins.Res]; ok { f.Types[next] = t }
+        next++
+    }
+    entry.Instrs = append(entry.Instrs, Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{1}}})
+    head.Instrs = append(phis, rest...)
+    f.addEdge(entry, head)
+    for _, b := range f.Blocks[1:] {
+        for i := range b.Instrs {
+            if b.Instrs[i].Val.Op == OpPhi && b == head && i < len(phis) { continue }
+            args := operands(&b.Instrs[i])
+            for k, a := range args {
+                if p, ok := phiOf[a]; ok { args[k] = p }
+            }
+        }
+    }
+    for _, b := range tails {
+        n := len(b.Instrs)
+        call := b.Instrs[n-2]
+        for k := range phis { head.Instrs[k].Val.Args = append(head.Instrs[k].Val.Args, call.Val.Args[k]) }
+        b.Instrs = append(b.Instrs[:n-2], Instr{Res: -1, Val: Value{Op: OpJmp, Args: []ValueID{1}}, Pos: call.Pos})
+        f.addEdge(b, head)
+    }
+    return true
+}
@@ -0,0 +1,65 @@
+package ir
+
+import "github.com/tinyrange/cc/internal/ast"
+
+// uninitRead is a read of a local that was recorded for the uninitialized
+// use check. The check runs once the function is built, when every phi has
+// its operands.
+type uninitRead struct {
+    name string // source name
+    val  ValueID
+    pos  ast.Pos
+}
+
+// markUninit records v, the zero that stands in for a declaration without an
+// initializer, as the value of a variable nobody has assigned yet.
+func (c *buildCtx) markUninit(v ValueID) {
+    if !c.m.WarnUninitialized { return }
+    if c.uninit == nil { c.uninit = map[ValueID]bool{} }
+    c.uninit[v] = true
+}
+
+// noteRead records that name was read as v at pos.
+func (c *buildCtx) noteRead(name string, v ValueID, pos ast.Pos) {
+    if len(c.uninit) == 0 { return }
+    c.reads = append(c.reads, uninitRead{name: name, val: v, pos: pos})
+}
+
+// checkUninit warns about reads that can only see an uninitialized marker,
+// and about reads where some path through the phis does.
+func (c *buildCtx) checkUninit() {
+    if len(c.reads) == 0 { return }
+    phis := map[ValueID][]ValueID{}
+    for _, b := range c.f.Blocks {
+        for _, ins := range b.Instrs {
+            if ins.Val.Op == OpPhi { phis[ins.Res] = ins.Val.Args }
+        }
+    }
+    for _, r := range c.reads {
+        marked, assigned := c.reachingDefs(c.replacement(r.val), phis)
+        if !marked { continue }
+        if assigned {
+            c.warnf(r.pos, "'%s' may be used uninitialized", r.name)
+        } else {
+            c.warnf(r.pos, "'%s' is used uninitialized", r.name)
+        }
+    }
+}
+
+// reachingDefs looks through phis from v and reports whether any definition
+// it reaches is an uninitialized marker and whether any is a real value.
+func (c *buildCtx) reachingDefs(v ValueID, phis map[ValueID][]ValueID) (marked, assigned bool) {
+    seen := map[ValueID]bool{}
+    var walk func(v ValueID)
+    walk = func(v ValueID) {
+        if seen[v] { return }
+        seen[v] = true
+        if args, ok := phis[v]; ok {
+            for _, a := range args { walk(a) }
+            return
+        }
+        if c.uninit[v] { marked = true } else { assigned = true }
+    }
+    walk(v)
+    return marked, assigned
+}
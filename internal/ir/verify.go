@@ -0,0 +1,47 @@
+package ir
+
+import "fmt"
+
+// Verify checks that the CFG of each function is consistent: jump targets
+// name blocks, each block's successors are the targets of its terminator,
+// predecessor lists mirror successor lists, and every phi has one operand
+// per predecessor. Passes that edit the CFG should leave it passing.
+func (m *Module) Verify() error {
+    for _, f := range m.Funcs {
+        if err := f.verify(); err != nil { return fmt.Errorf("%s: %v", f.Name, err) }
+    }
+    return nil
+}
+
+func (f *Function) verify() error {
+    index := map[*BasicBlock]int{}
+    for i, b := range f.Blocks { index[b] = i }
+    count := func(list []*BasicBlock, x *BasicBlock) int {
+        n := 0
+        for _, y := range list { if y == x { n++ } }
+        return n
+    }
+    for _, b := range f.Blocks {
+        var ts []ValueID
+        if b.Terminated() { ts = targets(&b.Instrs[len(b.Instrs)-1].Val) }
+        for _, t := range ts {
+            if t < 0 || int(t) >= len(f.Blocks) { return fmt.Errorf("%s jumps to block %d of %d", b.Name, t, len(f.Blocks)) }
+            if count(b.Succs, f.Blocks[t]) == 0 { return fmt.Errorf("%s jumps to %s, which is not a successor", b.Name, f.Blocks[t].Name) }
+        }
+        for _, s := range b.Succs {
+            if _, ok := index[s]; !ok { return fmt.Errorf("%s has successor %s, which is not in the function", b.Name, s.Name) }
+            if count(s.Preds, b) != count(b.Succs, s) { return fmt.Errorf("%s is a successor of %s but not a predecessor", s.Name, b.Name) }
+        }
+        for _, p := range b.Preds {
+            if _, ok := index[p]; !ok { return fmt.Errorf("%s has predecessor %s, which is not in the function", b.Name, p.Name) }
+            if count(p.Succs, b) == 0 { return fmt.Errorf("%s is a predecessor of %s but not a successor", p.Name, b.Name) }
+        }
+        for _, ins := range b.Instrs {
+            if ins.Val.Op != OpPhi { break }
+            if len(ins.Val.Args) != len(b.Preds) {
+                return fmt.Errorf("phi %s in %s has %d operands for %d predecessors", ins.Res, b.Name, len(ins.Val.Args), len(b.Preds))
+            }
+        }
+    }
+    return nil
+}
@@ -2,6 +2,7 @@ package lexer
 
 import (
     "unicode"
+    "unicode/utf8"
 )
 
 type Lexer struct {
@@ -40,6 +41,39 @@ func (l *Lexer) peek() rune {
     return l.src[l.i]
 }
 
+// escape reads the escape sequence after a backslash and returns the
+// character it stands for: up to three octal digits, \x and hex digits, or
+// one of the usual single letters. An unknown escape stands for itself.
+func (l *Lexer) escape() rune {
+    if l.ch >= '0' && l.ch <= '7' {
+        var r rune
+        for n := 0; n < 3 && l.ch >= '0' && l.ch <= '7'; n++ {
+            r = r*8 + l.ch - '0'
+            l.read()
+        }
+        return r & 0xFF
+    }
+    if l.ch == 'x' {
+        var r rune
+        for l.read(); isHexDigit(l.ch); l.read() {
+            r = r*16 + hexValue(l.ch)
+        }
+        return r & 0xFF
+    }
+    r := l.ch
+    switch l.ch {
+    case 'n': r = '\n'
+    case 't': r = '\t'
+    case 'r': r = '\r'
+    case 'a': r = '\a'
+    case 'b': r = '\b'
+    case 'f': r = '\f'
+    case 'v': r = '\v'
+    }
+    if l.ch != 0 { l.read() }
+    return r
+}
+
 func (l *Lexer) Next() Token {
     // skip spaces and comments
     for {
@@ -81,7 +115,9 @@ func (l *Lexer) Next() Token {
     case ':':
         tok.Type, tok.Lex = COLON, string(ch); l.read()
     case '.':
-        tok.Type, tok.Lex = DOT, string(ch); l.read()
+        if l.peek() == '.' && l.i+1 < len(l.src) && l.src[l.i+1] == '.' {
+            l.read(); l.read(); tok.Type, tok.Lex = ELLIPSIS, "..."; l.read()
+        } else { tok.Type, tok.Lex = DOT, string(ch); l.read() }
     case '&':
         if l.peek() == '&' { l.read(); tok.Type, tok.Lex = ANDAND, "&&"; l.read() } else { tok.Type, tok.Lex = AMP, string(ch); l.read() }
     case '|':
@@ -91,7 +127,7 @@ func (l *Lexer) Next() Token {
     case '+':
         tok.Type, tok.Lex = PLUS, string(ch); l.read()
     case '-':
-        tok.Type, tok.Lex = MINUS, string(ch); l.read()
+        if l.peek() == '>' { l.read(); tok.Type, tok.Lex = ARROW, "->"; l.read() } else { tok.Type, tok.Lex = MINUS, string(ch); l.read() }
     case '*':
         tok.Type, tok.Lex = STAR, string(ch); l.read()
     case '/':
@@ -113,20 +149,11 @@ func (l *Lexer) Next() Token {
         var r rune
         if l.ch == '\\' {
             l.read()
-            switch l.ch {
-            case 'n': r = '\n'
-            case 't': r = '\t'
-            case 'r': r = '\r'
-            case '\\': r = '\\'
-            case '\'': r = '\''
-            case '0': r = '\x00'
-            default:
-                r = l.ch
-            }
+            r = l.escape()
         } else {
             r = l.ch
+            if l.ch != 0 { l.read() }
         }
-        if l.ch != 0 { l.read() }
         if l.ch == '\'' { l.read() } // consume closing '
         return Token{Type: CHAR, Lex: string([]rune{r}), Line: startLine, Col: startCol}
     default:
@@ -134,30 +161,22 @@ func (l *Lexer) Next() Token {
             // string literal
             startLine, startCol := l.line, l.col
             l.read() // consume opening quote
-            var runes []rune
+            // the literal's bytes: an escape is one byte, other characters
+            // are UTF-8 encoded
+            var buf []byte
             for l.ch != 0 && l.ch != '"' {
                 if l.ch == '\\' { // escape
                     l.read()
-                    switch l.ch {
-                    case 'n': runes = append(runes, '\n')
-                    case 't': runes = append(runes, '\t')
-                    case 'r': runes = append(runes, '\r')
-                    case '\\': runes = append(runes, '\\')
-                    case '"': runes = append(runes, '"')
-                    case '0': runes = append(runes, '\x00')
-                    default:
-                        // unknown escape: include as-is
-                        if l.ch != 0 { runes = append(runes, l.ch) }
-                    }
-                    if l.ch != 0 { l.read(); continue }
-                    break
+                    if l.ch == 0 { break }
+                    buf = append(buf, byte(l.escape()))
+                    continue
                 }
-                runes = append(runes, l.ch)
+                buf = utf8.AppendRune(buf, l.ch)
                 l.read()
             }
             // expect closing quote
             if l.ch == '"' { l.read() }
-            return Token{Type: STRING, Lex: string(runes), Line: startLine, Col: startCol}
+            return Token{Type: STRING, Lex: string(buf), Line: startLine, Col: startCol}
         }
         if unicode.IsLetter(ch) || ch == '_' {
             startLine, startCol := l.line, l.col
@@ -187,6 +206,14 @@ func (l *Lexer) Next() Token {
             case "switch": tok.Type = KW_SWITCH
             case "case": tok.Type = KW_CASE
             case "default": tok.Type = KW_DEFAULT
+            case "extern": tok.Type = KW_EXTERN
+            case "sizeof": tok.Type = KW_SIZEOF
+            case "static": tok.Type = KW_STATIC
+            case "const": tok.Type = KW_CONST
+            case "short": tok.Type = KW_SHORT
+            case "long": tok.Type = KW_LONG
+            case "signed": tok.Type = KW_SIGNED
+            case "unsigned": tok.Type = KW_UNSIGNED
             default:
                 tok.Type = IDENT
             }
@@ -195,6 +222,16 @@ func (l *Lexer) Next() Token {
             startLine, startCol := l.line, l.col
             num := []rune{ch}
             l.read()
+            // hexadecimal: 0x1F; the parser converts with base prefix detection
+            if ch == '0' && (l.ch == 'x' || l.ch == 'X') {
+                num = append(num, l.ch)
+                l.read()
+                for isHexDigit(l.ch) {
+                    num = append(num, l.ch)
+                    l.read()
+                }
+                return Token{Type: INT, Lex: string(num), Line: startLine, Col: startCol}
+            }
             for unicode.IsDigit(l.ch) {
                 num = append(num, l.ch)
                 l.read()
@@ -219,3 +256,15 @@ func (l *Lexer) Next() Token {
     }
     return tok
 }
+
+func isHexDigit(r rune) bool {
+    return unicode.IsDigit(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func hexValue(r rune) rune {
+    switch {
+    case r >= 'a' && r <= 'f': return r - 'a' + 10
+    case r >= 'A' && r <= 'F': return r - 'A' + 10
+    }
+    return r - '0'
+}
@@ -32,6 +32,14 @@ const (
 	KW_SWITCH
 	KW_CASE
 	KW_DEFAULT
+	KW_EXTERN
+	KW_SIZEOF
+	KW_STATIC
+	KW_CONST
+	KW_SHORT
+	KW_LONG
+	KW_SIGNED
+	KW_UNSIGNED
 
 	// Symbols
 	LPAREN // (
@@ -44,6 +52,8 @@ const (
 	COMMA  // ,
 	COLON  // :
 	DOT    // .
+	ELLIPSIS // ...
+	ARROW  // ->
 	ASSIGN // =
 	AMP    // &
 
@@ -0,0 +1,200 @@
+package parser
+
+import (
+    "fmt"
+
+    "github.com/tinyrange/cc/internal/ast"
+    "github.com/tinyrange/cc/internal/lexer"
+)
+
+// parseConstExpr parses an expression that must be known at compile time,
+// such as a global initializer, and returns its value.
+func (p *Parser) parseConstExpr() (int64, error) {
+    start := p.tok
+    e, err := p.parseExpr()
+    if err != nil { return 0, err }
+    v, err := p.evalConst(e)
+    if err != nil { return 0, fmt.Errorf("%v at %d:%d", err, start.Line, start.Col) }
+    return v, nil
+}
+
+// addrConst recognizes an address constant: "str", &x, &a[k], a, and any of
+// those plus or minus a constant number of elements.
+func (p *Parser) addrConst(e ast.Expr) (*ast.AddrConst, bool) {
+    switch e := e.(type) {
+    case *ast.StringLit:
+        return &ast.AddrConst{Str: e.Value, IsStr: true, Pos: e.Pos}, true
+    case *ast.Ident:
+        if _, ok := p.enums[e.Name]; ok { return nil, false }
+        return &ast.AddrConst{Name: e.Name, Decay: true, Pos: e.Pos}, true
+    case *ast.UnaryExpr:
+        if e.Op != ast.OpAddr { return nil, false }
+        switch x := e.X.(type) {
+        case *ast.Ident:
+            return &ast.AddrConst{Name: x.Name, Pos: x.Pos}, true
+        case *ast.IndexExpr:
+            b, ok := x.Base.(*ast.Ident)
+            if !ok { return nil, false }
+            k, err := p.evalConst(x.Index)
+            if err != nil { return nil, false }
+            return &ast.AddrConst{Name: b.Name, Index: k, Pos: b.Pos}, true
+        }
+    case *ast.BinaryExpr:
+        if e.Op != ast.OpAdd && e.Op != ast.OpSub { return nil, false }
+        a, ok := p.addrConst(e.Left)
+        if !ok { return nil, false }
+        k, err := p.evalConst(e.Right)
+        if err != nil { return nil, false }
+        if e.Op == ast.OpSub { k = -k }
+        a.Index += k
+        return a, true
+    }
+    return nil, false
+}
+
+// evalConst folds an integer constant expression: literals, enum constants,
+// unary and binary arithmetic, shifts, bitwise and logical operators, and
+// casts. sizeof has already been folded to a literal by the parser.
+func (p *Parser) evalConst(e ast.Expr) (int64, error) {
+    v, _, err := p.foldConst(e)
+    return v, err
+}
+
+// foldConst is evalConst that also reports whether the value is unsigned,
+// which only a cast makes it. As at run time, an unsigned operand makes
+// division, right shift and comparison unsigned, and && and || leave their
+// right operand alone when the left decides, so 0 && 1/0 is 0.
+func (p *Parser) foldConst(e ast.Expr) (int64, bool, error) {
+    switch e := e.(type) {
+    case *ast.IntLit:
+        return e.Value, false, nil
+    case *ast.Ident:
+        if v, ok := p.enums[e.Name]; ok { return v, false, nil }
+        return 0, false, fmt.Errorf("%s is not a constant", e.Name)
+    case *ast.CastExpr:
+        v, uns, err := p.foldConst(e.X)
+        if err != nil { return 0, false, err }
+        if e.Ptr || e.TypedefName != "" { return v, uns, nil }
+        switch e.To {
+        case ast.BTChar, ast.BTUChar: v &= 0xFF
+        case ast.BTSChar: v = int64(int8(v))
+        case ast.BTShort: v = int64(int16(v))
+        case ast.BTUShort: v &= 0xFFFF
+        case ast.BTUInt, ast.BTULong: return v, true, nil
+        }
+        return v, false, nil
+    case *ast.UnaryExpr:
+        v, uns, err := p.foldConst(e.X)
+        if err != nil { return 0, false, err }
+        switch e.Op {
+        case ast.OpNeg:
+            return -v, uns, nil
+        case ast.OpBitNot:
+            return ^v, uns, nil
+        case ast.OpLogicalNot:
+            return b2i(v == 0), false, nil
+        }
+        return 0, false, fmt.Errorf("operator not allowed in constant expression")
+    case *ast.BinaryExpr:
+        l, lu, err := p.foldConst(e.Left)
+        if err != nil { return 0, false, err }
+        switch {
+        case e.Op == ast.OpLAnd && l == 0: return 0, false, nil
+        case e.Op == ast.OpLOr && l != 0: return 1, false, nil
+        }
+        r, ru, err := p.foldConst(e.Right)
+        if err != nil { return 0, false, err }
+        uns := lu || ru
+        switch e.Op {
+        case ast.OpAdd: return l + r, uns, nil
+        case ast.OpSub: return l - r, uns, nil
+        case ast.OpMul: return l * r, uns, nil
+        case ast.OpDiv:
+            if r == 0 { return 0, false, fmt.Errorf("division by zero in constant expression") }
+            if uns { return int64(uint64(l) / uint64(r)), true, nil }
+            return l / r, false, nil
+        case ast.OpAnd: return l & r, uns, nil
+        case ast.OpOr: return l | r, uns, nil
+        case ast.OpXor: return l ^ r, uns, nil
+        // a shift has the type of its left operand
+        case ast.OpShl: return l << uint64(r), lu, nil
+        case ast.OpShr:
+            if lu { return int64(uint64(l) >> uint64(r)), true, nil }
+            return l >> uint64(r), false, nil
+        case ast.OpEq: return b2i(l == r), false, nil
+        case ast.OpNe: return b2i(l != r), false, nil
+        case ast.OpLAnd: return b2i(r != 0), false, nil
+        case ast.OpLOr: return b2i(r != 0), false, nil
+        }
+        if uns {
+            a, b := uint64(l), uint64(r)
+            switch e.Op {
+            case ast.OpLt: return b2i(a < b), false, nil
+            case ast.OpLe: return b2i(a <= b), false, nil
+            case ast.OpGt: return b2i(a > b), false, nil
+            case ast.OpGe: return b2i(a >= b), false, nil
+            }
+        }
+        switch e.Op {
+        case ast.OpLt: return b2i(l < r), false, nil
+        case ast.OpLe: return b2i(l <= r), false, nil
+        case ast.OpGt: return b2i(l > r), false, nil
+        case ast.OpGe: return b2i(l >= r), false, nil
+        }
+    }
+    return 0, false, fmt.Errorf("initializer is not a constant expression")
+}
+
+func b2i(b bool) int64 {
+    if b { return 1 }
+    return 0
+}
+
+// parseSizeof parses sizeof '(' type-name ')' and folds it to an integer literal.
+func (p *Parser) parseSizeof() (ast.Expr, error) {
+    kw := p.tok
+    p.next()
+    if _, err := p.expect(lexer.LPAREN); err != nil { return nil, err }
+    size := 0
+    switch p.tok.Type {
+    case lexer.KW_INT, lexer.KW_CHAR, lexer.KW_DOUBLE, lexer.KW_SHORT, lexer.KW_LONG, lexer.KW_SIGNED, lexer.KW_UNSIGNED:
+        bt, err := p.parseTypeSpec()
+        if err != nil { return nil, err }
+        size = basicSize(bt, false)
+    case lexer.KW_STRUCT:
+        p.next()
+        tagTok, err := p.expect(lexer.IDENT)
+        if err != nil { return nil, err }
+        sz, ok := p.structSizes[tagTok.Lex]
+        if !ok && p.tok.Type != lexer.STAR {
+            return nil, fmt.Errorf("sizeof incomplete struct %s at %d:%d", tagTok.Lex, tagTok.Line, tagTok.Col)
+        }
+        size = sz
+    case lexer.IDENT:
+        sz, ok := p.typedefs[p.tok.Lex]
+        if !ok {
+            return nil, fmt.Errorf("sizeof expects a type name, got %s at %d:%d", p.tok.Lex, p.tok.Line, p.tok.Col)
+        }
+        p.next()
+        size = sz
+    default:
+        return nil, fmt.Errorf("sizeof expects a type name at %d:%d", kw.Line, kw.Col)
+    }
+    // any pointer declarator makes it pointer-sized
+    if p.tok.Type == lexer.STAR { size = 8 }
+    for p.tok.Type == lexer.STAR { p.next() }
+    if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
+    return &ast.IntLit{Value: int64(size), Pos: posOf(kw)}, nil
+}
+
+// basicSize is the byte size of a basic type on our target, as it is stored:
+// int is 64-bit like long, and short, though its values are 16-bit, takes 8
+// bytes until codegen has 16-bit loads and stores, so that sizeof agrees
+// with the stride of a short array.
+func basicSize(bt ast.BasicType, ptr bool) int {
+    if ptr { return 8 }
+    switch bt {
+    case ast.BTChar, ast.BTSChar, ast.BTUChar: return 1
+    }
+    return 8
+}
@@ -11,22 +11,91 @@ import (
 type Parser struct {
     lx  *lexer.Lexer
     tok lexer.Token
+    // struct tags declared so far (defined or forward-declared)
+    structs map[string]bool
+    // enum constants declared so far, for contexts that need a value at parse time
+    enums map[string]int64
+    // typedef names declared so far with their sizes, so '(' T ')' can be told
+    // apart from a parenthesized variable and sizeof(T) folds to a constant
+    typedefs map[string]int
+    // byte sizes of defined structs, for sizeof(struct S)
+    structSizes map[string]int
+    // diagnostics from statements and declarations that were skipped
+    errs ErrorList
+    // an already-parsed leading operand for parseUnary to return first
+    primary ast.Expr
 }
 
+// ErrorList collects every diagnostic reported while parsing a file.
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+    if len(l) == 1 { return l[0].Error() }
+    return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// ParseFile parses a whole translation unit. After a syntax error the parser
+// resynchronizes at the next statement or top-level declaration and keeps
+// going; all diagnostics are returned as an ErrorList together with the
+// declarations that did parse.
 func ParseFile(filename, src string) (*ast.File, error) {
-    p := &Parser{lx: lexer.New(src)}
+    p := &Parser{lx: lexer.New(src), structs: map[string]bool{}, enums: map[string]int64{}, typedefs: map[string]int{}, structSizes: map[string]int{}}
     p.next()
     f := &ast.File{}
     for p.tok.Type != lexer.EOF {
         d, err := p.parseDecl()
-        if err != nil { return nil, err }
+        if err != nil {
+            p.errs = append(p.errs, err)
+            p.syncDecl()
+            continue
+        }
         f.Decls = append(f.Decls, d)
     }
+    if len(p.errs) > 0 { return f, p.errs }
     return f, nil
 }
 
+// syncStmt skips to the end of the current statement: past the next ';' at
+// this nesting level or past a balanced '{...}', stopping before a '}' that
+// closes the enclosing block.
+func (p *Parser) syncStmt() {
+    depth := 0
+    for p.tok.Type != lexer.EOF {
+        switch p.tok.Type {
+        case lexer.SEMI:
+            if depth == 0 { p.next(); return }
+        case lexer.LBRACE:
+            depth++
+        case lexer.RBRACE:
+            if depth == 0 { return }
+            depth--
+            if depth == 0 { p.next(); return }
+        }
+        p.next()
+    }
+}
+
+// syncDecl skips the rest of a broken top-level declaration so parsing can
+// resume at the next one.
+func (p *Parser) syncDecl() {
+    start := p.tok
+    p.syncStmt()
+    // a stray '}' at file scope would stop syncStmt without progress
+    if p.tok == start && p.tok.Type != lexer.EOF { p.next() }
+}
+
 func (p *Parser) next() { p.tok = p.lx.Next() }
 
+func posOf(t lexer.Token) ast.Pos { return ast.Pos{Line: t.Line, Col: t.Col} }
+
+// peekIs reports whether the token after the current one has type tt.
+func (p *Parser) peekIs(tt lexer.TokenType) bool {
+    save := *p.lx
+    t := p.lx.Next()
+    *p.lx = save
+    return t.Type == tt
+}
+
 func (p *Parser) expect(tt lexer.TokenType) (lexer.Token, error) {
     if p.tok.Type != tt {
         return lexer.Token{}, fmt.Errorf("expected %v, got %v at %d:%d", tt, p.tok.Type, p.tok.Line, p.tok.Col)
@@ -40,7 +109,7 @@ func (p *Parser) parseDecl() (ast.Decl, error) {
     // Handle struct, enum, typedef declarations first
     switch p.tok.Type {
     case lexer.KW_STRUCT:
-        return p.parseStructDecl()
+        return p.parseStructDecl(qualifiers{})
     case lexer.KW_ENUM:
         return p.parseEnumDecl()
     case lexer.KW_TYPEDEF:
@@ -48,82 +117,184 @@ func (p *Parser) parseDecl() (ast.Decl, error) {
     }
     
     // Either: <type> IDENT(params) { ... }  OR  <type> [*]* IDENT [= INT] ;  (global)
-    // We currently support int and char
-    basict := ast.BTInt
-    if p.tok.Type == lexer.KW_CHAR {
-        basict = ast.BTChar
-    } else if p.tok.Type != lexer.KW_INT {
-        return nil, fmt.Errorf("only 'int'/'char' globals/functions supported at %d:%d", p.tok.Line, p.tok.Col)
+    // A function may also be a prototype ending in ';'. Any of static, extern
+    // and const may come first. We support the integer types
+    posTok := p.tok
+    q := p.parseQualifiers()
+    if q.static && q.extern {
+        return nil, fmt.Errorf("conflicting static and extern at %d:%d", posTok.Line, posTok.Col)
     }
-    p.next()
+    if p.tok.Type == lexer.KW_STRUCT { return p.parseStructDecl(q) }
+    if !isTypeSpec(p.tok.Type) || p.tok.Type == lexer.KW_DOUBLE {
+        return nil, fmt.Errorf("only integer globals/functions supported at %d:%d", p.tok.Line, p.tok.Col)
+    }
+    basict, err := p.parseTypeSpec()
+    if err != nil { return nil, err }
     // optional pointer stars
-    ptr := false
-    for p.tok.Type == lexer.STAR { p.next(); ptr = true }
+    ptr, isConst := p.parseStars()
+    q.isConst = q.isConst || isConst
     nameTok, err := p.expect(lexer.IDENT)
     if err != nil { return nil, err }
     if p.tok.Type == lexer.LPAREN {
         // function
         p.next()
-        params, err := p.parseParams()
+        params, variadic, err := p.parseParams()
         if err != nil { return nil, err }
         if _, err = p.expect(lexer.RPAREN); err != nil { return nil, err }
+        if p.tok.Type == lexer.SEMI {
+            p.next()
+            return &ast.FuncDecl{Name: nameTok.Lex, Params: params, Ret: basict, Static: q.static, Variadic: variadic, Pos: posOf(nameTok)}, nil
+        }
+        // there is no va_list, so a variadic body could not read its arguments
+        if variadic {
+            return nil, fmt.Errorf("variadic function definitions are not supported: %s at %d:%d", nameTok.Lex, nameTok.Line, nameTok.Col)
+        }
+        for _, prm := range params {
+            if prm.Name == "" {
+                return nil, fmt.Errorf("parameter name omitted in definition of %s at %d:%d", nameTok.Lex, nameTok.Line, nameTok.Col)
+            }
+        }
         body, err := p.parseBlock()
         if err != nil { return nil, err }
-        return &ast.FuncDecl{Name: nameTok.Lex, Params: params, Body: body, Ret: basict}, nil
+        return &ast.FuncDecl{Name: nameTok.Lex, Params: params, Body: body, Ret: basict, Static: q.static, Pos: posOf(nameTok)}, nil
     }
     if p.tok.Type == lexer.LBRACK {
-        // global array: int NAME[N];
+        // global array: int NAME[N];  |  char NAME[] = "str";  |  char NAME[N] = "str";
         p.next()
-        szTok, err := p.expect(lexer.INT)
-        if err != nil { return nil, err }
+        size := -1
+        if p.tok.Type != lexer.RBRACK {
+            szTok, err := p.expect(lexer.INT)
+            if err != nil { return nil, err }
+            v, _ := strconv.ParseInt(szTok.Lex, 0, 64)
+            size = int(v)
+        }
         if _, err := p.expect(lexer.RBRACK); err != nil { return nil, err }
+        decl := &ast.GlobalArrayDecl{Name: nameTok.Lex, Size: size, Elem: basict, Ptr: ptr, Static: q.static, Extern: q.extern, Pos: posOf(nameTok)}
+        if p.tok.Type == lexer.ASSIGN && p.peekIs(lexer.LBRACE) {
+            // brace list of constants; missing trailing elements are zero
+            p.next()
+            lbrace := p.tok
+            elems, err := p.parseInitList()
+            if err != nil { return nil, err }
+            for _, e := range elems {
+                v, err := p.evalConst(e)
+                if err != nil { return nil, fmt.Errorf("%v in initializer of %s at %d:%d", err, nameTok.Lex, lbrace.Line, lbrace.Col) }
+                decl.Elems = append(decl.Elems, v)
+            }
+            if decl.Size, err = initListSize(nameTok, size, len(elems)); err != nil { return nil, err }
+        } else if p.tok.Type == lexer.ASSIGN {
+            p.next()
+            strTok, err := p.expect(lexer.STRING)
+            if err != nil { return nil, err }
+            if basict != ast.BTChar || ptr {
+                return nil, fmt.Errorf("string initializer for non-char array %s at %d:%d", nameTok.Lex, strTok.Line, strTok.Col)
+            }
+            decl.Str, decl.HasStr = strTok.Lex, true
+            // the terminating NUL is dropped only when it exactly doesn't fit
+            if size < 0 {
+                decl.Size = len(strTok.Lex) + 1
+            } else if len(strTok.Lex) > size {
+                return nil, fmt.Errorf("initializer string for %s is too long (%d > %d) at %d:%d", nameTok.Lex, len(strTok.Lex), size, strTok.Line, strTok.Col)
+            }
+        } else if size < 0 && !q.extern {
+            return nil, fmt.Errorf("array size missing for %s at %d:%d", nameTok.Lex, nameTok.Line, nameTok.Col)
+        }
         if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-        v, _ := strconv.ParseInt(szTok.Lex, 10, 64)
-        return &ast.GlobalArrayDecl{Name: nameTok.Lex, Size: int(v), Elem: basict}, nil
+        return decl, nil
     }
-    // global variable
+    // global variable; the initializer must fold to a constant, or for a
+    // pointer be an address constant
     var init *ast.IntLit
+    var addr *ast.AddrConst
     if p.tok.Type == lexer.ASSIGN {
         p.next()
-        if p.tok.Type != lexer.INT { return nil, fmt.Errorf("only int initializers for globals at %d:%d", p.tok.Line, p.tok.Col) }
-        v, _ := strconv.ParseInt(p.tok.Lex, 10, 64)
-        init = &ast.IntLit{Value: v}
-        p.next()
+        start := p.tok
+        e, err := p.parseExpr()
+        if err != nil { return nil, err }
+        v, err := p.evalConst(e)
+        if err != nil {
+            a, ok := p.addrConst(e)
+            if !ptr || !ok { return nil, fmt.Errorf("%v at %d:%d", err, start.Line, start.Col) }
+            addr = a
+        } else {
+            init = &ast.IntLit{Value: v}
+        }
     }
     if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-    return &ast.GlobalDecl{Name: nameTok.Lex, Init: init, Typ: basict, Ptr: ptr}, nil
+    // an initializer turns an extern declaration into a definition
+    return &ast.GlobalDecl{Name: nameTok.Lex, Init: init, AddrInit: addr, Typ: basict, Ptr: ptr, Static: q.static, Extern: q.extern && init == nil && addr == nil, Const: q.isConst, Pos: posOf(nameTok)}, nil
 }
 
-func (p *Parser) parseParams() ([]ast.Param, error) {
+// parseParams parses a parameter list up to the closing ')', reporting
+// whether it ends in ... after at least one named parameter.
+func (p *Parser) parseParams() ([]ast.Param, bool, error) {
     var params []ast.Param
     if p.tok.Type == lexer.RPAREN {
-        return params, nil
+        return params, false, nil
     }
     for {
-        bt := ast.BTInt
-        if p.tok.Type == lexer.KW_CHAR { bt = ast.BTChar } else if p.tok.Type != lexer.KW_INT { return nil, fmt.Errorf("only int/char params supported at %d:%d", p.tok.Line, p.tok.Col) }
-        p.next()
-        ptr := false
-        for p.tok.Type == lexer.STAR { p.next(); ptr = true }
-        nameTok, err := p.expect(lexer.IDENT)
-        if err != nil { return nil, err }
-        params = append(params, ast.Param{Name: nameTok.Lex, Typ: bt, Ptr: ptr})
+        if p.tok.Type == lexer.ELLIPSIS {
+            if len(params) == 0 {
+                return nil, false, fmt.Errorf("... needs a named parameter before it at %d:%d", p.tok.Line, p.tok.Col)
+            }
+            p.next()
+            if p.tok.Type != lexer.RPAREN {
+                return nil, false, fmt.Errorf("... must be the last parameter at %d:%d", p.tok.Line, p.tok.Col)
+            }
+            return params, true, nil
+        }
+        // const is accepted but not enforced
+        if p.tok.Type == lexer.KW_CONST { p.next() }
+        bt, ptr, structType := ast.BTInt, false, ""
+        if p.tok.Type == lexer.KW_STRUCT {
+            // struct S *p; a struct is only passed by its address
+            p.next()
+            tagTok, err := p.expect(lexer.IDENT)
+            if err != nil { return nil, false, err }
+            if !p.structs[tagTok.Lex] {
+                return nil, false, fmt.Errorf("unknown struct type %s at %d:%d", tagTok.Lex, tagTok.Line, tagTok.Col)
+            }
+            if p.tok.Type != lexer.STAR {
+                return nil, false, fmt.Errorf("struct params must be pointers at %d:%d", p.tok.Line, p.tok.Col)
+            }
+            structType = tagTok.Lex
+            ptr, _ = p.parseStars()
+        } else {
+            if !isTypeSpec(p.tok.Type) || p.tok.Type == lexer.KW_DOUBLE { return nil, false, fmt.Errorf("only integer params supported at %d:%d", p.tok.Line, p.tok.Col) }
+            var err error
+            bt, err = p.parseTypeSpec()
+            if err != nil { return nil, false, err }
+            ptr, _ = p.parseStars()
+        }
+        // names are optional so prototypes like int f(int, char *); parse
+        name, pos := "", posOf(p.tok)
+        if p.tok.Type == lexer.IDENT {
+            name = p.tok.Lex
+            p.next()
+        }
+        params = append(params, ast.Param{Name: name, Typ: bt, Ptr: ptr, Pos: pos, StructType: structType})
         if p.tok.Type == lexer.COMMA { p.next(); continue }
         break
     }
-    return params, nil
+    return params, false, nil
 }
 
 func (p *Parser) parseBlock() (*ast.BlockStmt, error) {
-    if _, err := p.expect(lexer.LBRACE); err != nil { return nil, err }
+    lbrace, err := p.expect(lexer.LBRACE)
+    if err != nil { return nil, err }
     var stmts []ast.Stmt
     for p.tok.Type != lexer.RBRACE && p.tok.Type != lexer.EOF {
         s, err := p.parseStmt()
-        if err != nil { return nil, err }
+        if err != nil {
+            // record and skip the broken statement; the block itself still parses
+            p.errs = append(p.errs, err)
+            p.syncStmt()
+            continue
+        }
         stmts = append(stmts, s)
     }
     if _, err := p.expect(lexer.RBRACE); err != nil { return nil, err }
-    return &ast.BlockStmt{Stmts: stmts}, nil
+    return &ast.BlockStmt{Stmts: stmts, Pos: posOf(lbrace)}, nil
 }
 
 func (p *Parser) parseStmt() (ast.Stmt, error) {
@@ -138,45 +309,69 @@ func (p *Parser) parseStmt() (ast.Stmt, error) {
         return &ast.ReturnStmt{Expr: e, Pos: ast.Pos{Line: posTok.Line, Col: posTok.Col}}, nil
     case lexer.KW_STRUCT:
         // struct variable declaration: struct S s;
+        posTok := p.tok
         p.next()
         structNameTok, err := p.expect(lexer.IDENT)
         if err != nil { return nil, err }
+        if !p.structs[structNameTok.Lex] {
+            return nil, fmt.Errorf("unknown struct type %s at %d:%d", structNameTok.Lex, structNameTok.Line, structNameTok.Col)
+        }
+        if p.tok.Type == lexer.STAR {
+            // struct S *p [= expr];
+            p.parseStars()
+            nameTok, err := p.expect(lexer.IDENT)
+            if err != nil { return nil, err }
+            var init ast.Expr
+            if p.tok.Type == lexer.ASSIGN {
+                p.next()
+                if init, err = p.parseExpr(); err != nil { return nil, err }
+            }
+            if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
+            return &ast.DeclStmt{Name: nameTok.Lex, Init: init, Typ: ast.BTInt, Ptr: true, StructType: structNameTok.Lex, Pos: posOf(nameTok)}, nil
+        }
         varNameTok, err := p.expect(lexer.IDENT)
         if err != nil { return nil, err }
         if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-        return &ast.StructVarDeclStmt{Name: varNameTok.Lex, StructType: structNameTok.Lex}, nil
-    case lexer.KW_INT, lexer.KW_CHAR, lexer.KW_DOUBLE:
-        // declaration: T x; | T x = expr; | T a[N];
-        bt := ast.BTInt
-        if p.tok.Type == lexer.KW_CHAR { bt = ast.BTChar }
-        if p.tok.Type == lexer.KW_DOUBLE { bt = ast.BTDouble }
+        return &ast.StructVarDeclStmt{Name: varNameTok.Lex, StructType: structNameTok.Lex, Pos: ast.Pos{Line: posTok.Line, Col: posTok.Col}}, nil
+    case lexer.KW_ENUM:
+        // enum-typed local: enum E x [= expr]; behaves as int
         posTok := p.tok
         p.next()
-        ptr := false
-        for p.tok.Type == lexer.STAR { p.next(); ptr = true }
-        nameTok, err := p.expect(lexer.IDENT)
-        if err != nil { return nil, err }
-        // array declarator
-        if p.tok.Type == lexer.LBRACK {
-            p.next()
-            szTok, err := p.expect(lexer.INT)
-            if err != nil { return nil, err }
-            if _, err := p.expect(lexer.RBRACK); err != nil { return nil, err }
-            if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-            v, _ := strconv.ParseInt(szTok.Lex, 10, 64)
-            return &ast.ArrayDeclStmt{Name: nameTok.Lex, Size: int(v), Elem: bt}, nil
+        if _, err := p.expect(lexer.IDENT); err != nil { return nil, err }
+        return p.parseLocalDecl(ast.BTInt, posTok, qualifiers{})
+    case lexer.KW_INT, lexer.KW_CHAR, lexer.KW_DOUBLE, lexer.KW_SHORT, lexer.KW_LONG, lexer.KW_SIGNED, lexer.KW_UNSIGNED,
+        lexer.KW_CONST, lexer.KW_STATIC, lexer.KW_EXTERN:
+        // declaration: [quals] T x; | T x = expr; | T a[N];
+        posTok := p.tok
+        q := p.parseQualifiers()
+        if !isTypeSpec(p.tok.Type) {
+            return nil, fmt.Errorf("expected type after qualifiers, got %v at %d:%d", p.tok.Type, p.tok.Line, p.tok.Col)
         }
-        var init ast.Expr
+        bt, err := p.parseTypeSpec()
+        if err != nil { return nil, err }
+        return p.parseLocalDecl(bt, posTok, q)
+    case lexer.LBRACE:
+        return p.parseBlock()
+    case lexer.STAR:
+        // store through pointer: *p = expr; | *(p + i) = expr;
+        posTok := p.tok
+        target, err := p.parseUnary()
+        if err != nil { return nil, err }
         if p.tok.Type == lexer.ASSIGN {
+            u := target.(*ast.UnaryExpr)
             p.next()
-            init, err = p.parseExpr()
+            val, err := p.parseExpr()
             if err != nil { return nil, err }
+            if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
+            return &ast.DerefAssignStmt{Ptr: u.X, Value: val, Pos: ast.Pos{Line: posTok.Line, Col: posTok.Col}}, nil
         }
+        // plain expression statement starting with a dereference
+        e, err := p.parseExprFrom(target)
+        if err != nil { return nil, err }
         if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-        return &ast.DeclStmt{Name: nameTok.Lex, Init: init, Typ: bt, Ptr: ptr, Pos: ast.Pos{Line: posTok.Line, Col: posTok.Col}}, nil
-    case lexer.LBRACE:
-        return p.parseBlock()
+        return &ast.ExprStmt{X: e, Pos: posOf(posTok)}, nil
     case lexer.KW_IF:
+        posTok := p.tok
         p.next()
         if _, err := p.expect(lexer.LPAREN); err != nil { return nil, err }
         cond, err := p.parseExpr()
@@ -184,17 +379,17 @@ func (p *Parser) parseStmt() (ast.Stmt, error) {
         if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
         thenBlk, err := p.parseStmt()
         if err != nil { return nil, err }
-        var thenBody *ast.BlockStmt
-        if tb, ok := thenBlk.(*ast.BlockStmt); ok { thenBody = tb } else { thenBody = &ast.BlockStmt{Stmts: []ast.Stmt{thenBlk}} }
+        thenBody := asBlock(thenBlk)
         var elseBody *ast.BlockStmt
         if p.tok.Type == lexer.KW_ELSE {
             p.next()
             elseStmt, err := p.parseStmt()
             if err != nil { return nil, err }
-            if eb, ok := elseStmt.(*ast.BlockStmt); ok { elseBody = eb } else { elseBody = &ast.BlockStmt{Stmts: []ast.Stmt{elseStmt}} }
+            elseBody = asBlock(elseStmt)
         }
-        return &ast.IfStmt{Cond: cond, Then: thenBody, Else: elseBody}, nil
+        return &ast.IfStmt{Cond: cond, Then: thenBody, Else: elseBody, Pos: posOf(posTok)}, nil
     case lexer.KW_WHILE:
+        posTok := p.tok
         p.next()
         if _, err := p.expect(lexer.LPAREN); err != nil { return nil, err }
         cond, err := p.parseExpr()
@@ -202,10 +397,9 @@ func (p *Parser) parseStmt() (ast.Stmt, error) {
         if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
         body, err := p.parseStmt()
         if err != nil { return nil, err }
-        var b *ast.BlockStmt
-        if bb, ok := body.(*ast.BlockStmt); ok { b = bb } else { b = &ast.BlockStmt{Stmts: []ast.Stmt{body}} }
-        return &ast.WhileStmt{Cond: cond, Body: b}, nil
+        return &ast.WhileStmt{Cond: cond, Body: asBlock(body), Pos: posOf(posTok)}, nil
     case lexer.KW_SWITCH:
+        posTok := p.tok
         p.next()
         if _, err := p.expect(lexer.LPAREN); err != nil { return nil, err }
         tag, err := p.parseExpr()
@@ -214,53 +408,69 @@ func (p *Parser) parseStmt() (ast.Stmt, error) {
         if _, err := p.expect(lexer.LBRACE); err != nil { return nil, err }
         var cases []ast.CaseClause
         var defBody *ast.BlockStmt
+        // position of each case value seen so far, to report duplicates
+        seen := map[int64]lexer.Token{}
         for p.tok.Type != lexer.RBRACE && p.tok.Type != lexer.EOF {
             if p.tok.Type == lexer.KW_CASE {
+                caseTok := p.tok
                 // parse one or more case labels possibly sharing a body
                 var values []int64
                 for {
                     p.next()
-                    // only integer literals for now
-                    t, err := p.expect(lexer.INT)
+                    valTok := p.tok
+                    v, err := p.parseConstExpr()
                     if err != nil { return nil, err }
-                    v, _ := strconv.ParseInt(t.Lex, 10, 64)
+                    if prev, dup := seen[v]; dup {
+                        return nil, fmt.Errorf("duplicate case value %d at %d:%d (previous case at %d:%d)", v, valTok.Line, valTok.Col, prev.Line, prev.Col)
+                    }
+                    seen[v] = valTok
                     values = append(values, v)
                     if _, err := p.expect(lexer.COLON); err != nil { return nil, err }
                     if p.tok.Type != lexer.KW_CASE { break }
                 }
                 // gather statements until next case/default or '}'
                 var bodyStmts []ast.Stmt
-                for p.tok.Type != lexer.KW_CASE && p.tok.Type != lexer.KW_DEFAULT && p.tok.Type != lexer.RBRACE {
+                for p.tok.Type != lexer.KW_CASE && p.tok.Type != lexer.KW_DEFAULT && p.tok.Type != lexer.RBRACE && p.tok.Type != lexer.EOF {
                     s, err := p.parseStmt()
-                    if err != nil { return nil, err }
+                    if err != nil {
+                        p.errs = append(p.errs, err)
+                        p.syncStmt()
+                        continue
+                    }
                     bodyStmts = append(bodyStmts, s)
                 }
-                cases = append(cases, ast.CaseClause{Values: values, Body: &ast.BlockStmt{Stmts: bodyStmts}})
+                cases = append(cases, ast.CaseClause{Values: values, Body: &ast.BlockStmt{Stmts: bodyStmts, Pos: posOf(caseTok)}})
                 continue
             }
             if p.tok.Type == lexer.KW_DEFAULT {
+                defTok := p.tok
                 p.next()
                 if _, err := p.expect(lexer.COLON); err != nil { return nil, err }
                 var bodyStmts []ast.Stmt
-                for p.tok.Type != lexer.KW_CASE && p.tok.Type != lexer.RBRACE {
+                for p.tok.Type != lexer.KW_CASE && p.tok.Type != lexer.RBRACE && p.tok.Type != lexer.EOF {
                     s, err := p.parseStmt()
-                    if err != nil { return nil, err }
+                    if err != nil {
+                        p.errs = append(p.errs, err)
+                        p.syncStmt()
+                        continue
+                    }
                     bodyStmts = append(bodyStmts, s)
                 }
-                defBody = &ast.BlockStmt{Stmts: bodyStmts}
+                defBody = &ast.BlockStmt{Stmts: bodyStmts, Pos: posOf(defTok)}
                 continue
             }
             return nil, fmt.Errorf("unexpected token in switch at %d:%d", p.tok.Line, p.tok.Col)
         }
         if _, err := p.expect(lexer.RBRACE); err != nil { return nil, err }
-        return &ast.SwitchStmt{Tag: tag, Cases: cases, Default: defBody}, nil
+        return &ast.SwitchStmt{Tag: tag, Cases: cases, Default: defBody, Pos: posOf(posTok)}, nil
     case lexer.KW_FOR:
+        posTok := p.tok
         p.next()
         if _, err := p.expect(lexer.LPAREN); err != nil { return nil, err }
         // init
         var init ast.Stmt
         if p.tok.Type != lexer.SEMI {
-            s, err := p.parseForInitOrExprNoSemi()
+            s, err := p.parseForClause()
             if err != nil { return nil, err }
             init = s
         }
@@ -276,45 +486,45 @@ func (p *Parser) parseStmt() (ast.Stmt, error) {
         // post
         var post ast.Stmt
         if p.tok.Type != lexer.RPAREN {
-            s, err := p.parseForInitOrExprNoSemi()
+            s, err := p.parseForClause()
             if err != nil { return nil, err }
             post = s
         }
         if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
         body, err := p.parseStmt()
         if err != nil { return nil, err }
-        var b *ast.BlockStmt
-        if bb, ok := body.(*ast.BlockStmt); ok { b = bb } else { b = &ast.BlockStmt{Stmts: []ast.Stmt{body}} }
-        return &ast.ForStmt{Init: init, Cond: cond, Post: post, Body: b}, nil
+        return &ast.ForStmt{Init: init, Cond: cond, Post: post, Body: asBlock(body), Pos: posOf(posTok)}, nil
     case lexer.KW_DO:
+        posTok := p.tok
         p.next()
         body, err := p.parseStmt()
         if err != nil { return nil, err }
-        var b *ast.BlockStmt
-        if bb, ok := body.(*ast.BlockStmt); ok { b = bb } else { b = &ast.BlockStmt{Stmts: []ast.Stmt{body}} }
         if _, err := p.expect(lexer.KW_WHILE); err != nil { return nil, err }
         if _, err := p.expect(lexer.LPAREN); err != nil { return nil, err }
         cond, err := p.parseExpr()
         if err != nil { return nil, err }
         if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
         if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-        return &ast.DoWhileStmt{Body: b, Cond: cond}, nil
+        return &ast.DoWhileStmt{Body: asBlock(body), Cond: cond, Pos: posOf(posTok)}, nil
     case lexer.KW_BREAK:
+        posTok := p.tok
         p.next()
         if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-        return &ast.BreakStmt{}, nil
+        return &ast.BreakStmt{Pos: posOf(posTok)}, nil
     case lexer.KW_CONTINUE:
+        posTok := p.tok
         p.next()
         if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-        return &ast.ContinueStmt{}, nil
+        return &ast.ContinueStmt{Pos: posOf(posTok)}, nil
     case lexer.IDENT:
         // Could be: typedef declaration, assignment, or expr statement
         id := p.tok
         p.next()
         // Check for typedef declaration pattern: IDENT IDENT [= expr] ;
-        // or typedef with pointers: IDENT *IDENT [= expr] ;
-        if p.tok.Type == lexer.IDENT || p.tok.Type == lexer.STAR {
-            // This looks like a typedef declaration
+        // or typedef with pointers: IDENT *IDENT [= expr] ; the latter only for
+        // known typedef names since x * y; is a multiplication
+        _, isTypedef := p.typedefs[id.Lex]
+        if p.tok.Type == lexer.IDENT || (p.tok.Type == lexer.STAR && isTypedef) {
             ptr := false
             for p.tok.Type == lexer.STAR { p.next(); ptr = true }
             if p.tok.Type == lexer.IDENT {
@@ -337,19 +547,25 @@ func (p *Parser) parseStmt() (ast.Stmt, error) {
                     TypedefName: id.Lex,
                 }, nil
             }
-            // If not followed by IDENT, backtrack - this isn't a typedef declaration
-            // This is complex to handle properly, so let's fall through to assignment logic
+            return nil, fmt.Errorf("expected variable name after %s at %d:%d", id.Lex, p.tok.Line, p.tok.Col)
         }
-        if p.tok.Type == lexer.DOT {
-            // field assignment: s.field = value
-            p.next()
-            fieldTok, err := p.expect(lexer.IDENT)
+        if p.tok.Type == lexer.DOT || p.tok.Type == lexer.ARROW {
+            // field assignment: s.field = value; p->field = value;
+            target, err := p.parsePostfix(&ast.Ident{Name: id.Lex, Pos: posOf(id)})
             if err != nil { return nil, err }
-            if _, err := p.expect(lexer.ASSIGN); err != nil { return nil, err }
-            val, err := p.parseExpr()
+            if p.tok.Type == lexer.ASSIGN {
+                fe, ok := target.(*ast.FieldExpr)
+                if !ok { return nil, fmt.Errorf("cannot assign to indexed field expression at %d:%d", p.tok.Line, p.tok.Col) }
+                p.next()
+                val, err := p.parseExpr()
+                if err != nil { return nil, err }
+                if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
+                return &ast.FieldAssignStmt{Base: fe.Base, Field: fe.Field, Arrow: fe.Arrow, Value: val, Pos: posOf(id)}, nil
+            }
+            e, err := p.parseExprFrom(target)
             if err != nil { return nil, err }
             if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-            return &ast.FieldAssignStmt{Base: id.Lex, Field: fieldTok.Lex, Value: val}, nil
+            return &ast.ExprStmt{X: e, Pos: posOf(id)}, nil
         }
         if p.tok.Type == lexer.LBRACK {
             // array element assignment
@@ -357,11 +573,20 @@ func (p *Parser) parseStmt() (ast.Stmt, error) {
             idx, err := p.parseExpr()
             if err != nil { return nil, err }
             if _, err := p.expect(lexer.RBRACK); err != nil { return nil, err }
-            if _, err := p.expect(lexer.ASSIGN); err != nil { return nil, err }
+            if p.tok.Type != lexer.ASSIGN {
+                // an expression using the element, such as a call t[i](x);
+                target, err := p.parsePostfix(&ast.IndexExpr{Base: &ast.Ident{Name: id.Lex, Pos: posOf(id)}, Index: idx, Pos: posOf(id)})
+                if err != nil { return nil, err }
+                e, err := p.parseExprFrom(target)
+                if err != nil { return nil, err }
+                if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
+                return &ast.ExprStmt{X: e, Pos: posOf(id)}, nil
+            }
+            p.next()
             val, err := p.parseExpr()
             if err != nil { return nil, err }
             if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-            return &ast.ArrayAssignStmt{Name: id.Lex, Index: idx, Value: val}, nil
+            return &ast.ArrayAssignStmt{Name: id.Lex, Index: idx, Value: val, Pos: posOf(id)}, nil
         }
         if p.tok.Type == lexer.ASSIGN {
             p.next()
@@ -372,27 +597,212 @@ func (p *Parser) parseStmt() (ast.Stmt, error) {
         }
         // rollback: treat IDENT as start of primary in expr
         // Continue parsing the rest of the expression after this primary
-        left := &ast.Ident{Name: id.Lex}
-        e, err := p.parseAfterPrimary(left)
+        left, err := p.parseIdentTail(id)
+        if err != nil { return nil, err }
+        e, err := p.parseExprFrom(left)
         if err != nil { return nil, err }
         if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-        return &ast.ExprStmt{X: e}, nil
+        return &ast.ExprStmt{X: e, Pos: posOf(id)}, nil
     default:
+        posTok := p.tok
         e, err := p.parseExpr()
         if err != nil { return nil, err }
         if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
-        return &ast.ExprStmt{X: e}, nil
+        return &ast.ExprStmt{X: e, Pos: posOf(posTok)}, nil
+    }
+}
+
+// parseLocalDecl parses the declarator part of a local declaration after the
+// type specifier: [*]* IDENT ( [N] | [= expr] ) ; or a function pointer.
+func (p *Parser) parseLocalDecl(bt ast.BasicType, posTok lexer.Token, q qualifiers) (ast.Stmt, error) {
+    ptr, isConst := p.parseStars()
+    q.isConst = q.isConst || isConst
+    if p.tok.Type == lexer.LPAREN {
+        if ptr {
+            return nil, fmt.Errorf("functions returning pointers are not supported at %d:%d", posTok.Line, posTok.Col)
+        }
+        return p.parseFuncPtrDecl(bt, posTok, q)
+    }
+    nameTok, err := p.expect(lexer.IDENT)
+    if err != nil { return nil, err }
+    // array declarator: T a[N]; | T a[N] = { ... }; | T a[] = { ... };
+    if p.tok.Type == lexer.LBRACK {
+        if q.static || q.extern {
+            return nil, fmt.Errorf("static and extern local arrays are not supported at %d:%d", posTok.Line, posTok.Col)
+        }
+        size, err := p.parseArraySize()
+        if err != nil { return nil, err }
+        decl := &ast.ArrayDeclStmt{Name: nameTok.Lex, Size: size, Elem: bt, Pos: posOf(posTok)}
+        return decl, p.finishArrayDecl(decl, nameTok)
+    }
+    var init ast.Expr
+    if p.tok.Type == lexer.ASSIGN {
+        p.next()
+        initTok := p.tok
+        init, err = p.parseExpr()
+        if err != nil { return nil, err }
+        if q.extern {
+            return nil, fmt.Errorf("extern variable %s has an initializer at %d:%d", nameTok.Lex, initTok.Line, initTok.Col)
+        }
+        // static storage is initialized once, so the value must be constant
+        if q.static {
+            v, err := p.evalConst(init)
+            if err != nil { return nil, fmt.Errorf("%v at %d:%d", err, initTok.Line, initTok.Col) }
+            init = &ast.IntLit{Value: v, Pos: posOf(initTok)}
+        }
+    }
+    if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
+    return &ast.DeclStmt{Name: nameTok.Lex, Init: init, Typ: bt, Ptr: ptr, Pos: ast.Pos{Line: posTok.Line, Col: posTok.Col}, Static: q.static, Extern: q.extern, Const: q.isConst}, nil
+}
+
+// parseFuncPtrDecl parses a function pointer declarator after its return
+// type, up to the ';': ( * IDENT [ '[' [N] ']' ] ) ( params ) [= init]
+// The parameter types are not kept, so calls through the pointer pass their
+// arguments unchecked.
+func (p *Parser) parseFuncPtrDecl(bt ast.BasicType, posTok lexer.Token, q qualifiers) (ast.Stmt, error) {
+    if q.static || q.extern {
+        return nil, fmt.Errorf("static and extern function pointers are not supported at %d:%d", posTok.Line, posTok.Col)
+    }
+    p.next()
+    if _, err := p.expect(lexer.STAR); err != nil { return nil, err }
+    nameTok, err := p.expect(lexer.IDENT)
+    if err != nil { return nil, err }
+    size, isArray := 0, p.tok.Type == lexer.LBRACK
+    if isArray {
+        if size, err = p.parseArraySize(); err != nil { return nil, err }
+    }
+    if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
+    if _, err := p.expect(lexer.LPAREN); err != nil { return nil, err }
+    if _, _, err := p.parseParams(); err != nil { return nil, err }
+    if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
+    if isArray {
+        decl := &ast.ArrayDeclStmt{Name: nameTok.Lex, Size: size, Elem: bt, Func: true, Pos: posOf(posTok)}
+        return decl, p.finishArrayDecl(decl, nameTok)
+    }
+    var init ast.Expr
+    if p.tok.Type == lexer.ASSIGN {
+        p.next()
+        if init, err = p.parseExpr(); err != nil { return nil, err }
+    }
+    if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
+    return &ast.DeclStmt{Name: nameTok.Lex, Init: init, Typ: bt, Func: true, Pos: posOf(posTok), Const: q.isConst}, nil
+}
+
+// parseArraySize parses an array declarator's '[' [N] ']', giving -1 for
+// a size left to the initializer.
+func (p *Parser) parseArraySize() (int, error) {
+    if _, err := p.expect(lexer.LBRACK); err != nil { return 0, err }
+    size := -1
+    if p.tok.Type != lexer.RBRACK {
+        szTok, err := p.expect(lexer.INT)
+        if err != nil { return 0, err }
+        v, _ := strconv.ParseInt(szTok.Lex, 0, 64)
+        size = int(v)
+    }
+    if _, err := p.expect(lexer.RBRACK); err != nil { return 0, err }
+    return size, nil
+}
+
+// finishArrayDecl parses a local array's optional initializer list and the
+// closing ';', settling its size.
+func (p *Parser) finishArrayDecl(decl *ast.ArrayDeclStmt, nameTok lexer.Token) error {
+    if p.tok.Type == lexer.ASSIGN {
+        p.next()
+        elems, err := p.parseInitList()
+        if err != nil { return err }
+        decl.Init = elems
+    }
+    var err error
+    if decl.Size, err = initListSize(nameTok, decl.Size, len(decl.Init)); err != nil { return err }
+    _, err = p.expect(lexer.SEMI)
+    return err
+}
+
+// qualifiers records the storage-class and qualifier keywords of a declaration.
+type qualifiers struct{ static, extern, isConst bool }
+
+// parseQualifiers consumes any run of static, extern and const keywords.
+func (p *Parser) parseQualifiers() qualifiers {
+    var q qualifiers
+    for {
+        switch p.tok.Type {
+        case lexer.KW_STATIC: q.static = true
+        case lexer.KW_EXTERN: q.extern = true
+        case lexer.KW_CONST: q.isConst = true
+        default: return q
+        }
+        p.next()
+    }
+}
+
+// parseStars consumes a declarator's pointer stars along with any const
+// qualifiers among them (char const *const p), reporting both.
+func (p *Parser) parseStars() (ptr bool, isConst bool) {
+    for p.tok.Type == lexer.STAR || p.tok.Type == lexer.KW_CONST {
+        if p.tok.Type == lexer.STAR { ptr = true } else { isConst = true }
+        p.next()
+    }
+    return ptr, isConst
+}
+
+// parseInitList parses a brace-enclosed initializer list: '{' expr { ',' expr } [','] '}'
+func (p *Parser) parseInitList() ([]ast.Expr, error) {
+    if _, err := p.expect(lexer.LBRACE); err != nil { return nil, err }
+    var elems []ast.Expr
+    for p.tok.Type != lexer.RBRACE {
+        e, err := p.parseExpr()
+        if err != nil { return nil, err }
+        elems = append(elems, e)
+        if p.tok.Type != lexer.COMMA { break }
+        p.next()
+    }
+    if _, err := p.expect(lexer.RBRACE); err != nil { return nil, err }
+    return elems, nil
+}
+
+// initListSize checks n initializers against a declared array size, or
+// infers the size from them when it was omitted (declared < 0).
+func initListSize(nameTok lexer.Token, declared, n int) (int, error) {
+    if declared < 0 {
+        if n == 0 { return 0, fmt.Errorf("array size missing for %s at %d:%d", nameTok.Lex, nameTok.Line, nameTok.Col) }
+        return n, nil
+    }
+    if n > declared {
+        return 0, fmt.Errorf("too many initializers for %s (%d > %d) at %d:%d", nameTok.Lex, n, declared, nameTok.Line, nameTok.Col)
     }
+    return declared, nil
 }
 
-// Expr grammar with precedence:
-// expr = equality
+// Expr grammar with precedence, loosest first:
+// expr = assign
+// assign = lor [ = assign ]   (target must be a variable)
+// lor = land { || land }
+// land = bor { && bor }
+// bor = bxor { | bxor };  bxor = band { ^ band };  band = equality { & equality }
 // equality = relational { (==|!=) relational }
-// relational = add { (<|<=|>|>=) add }
+// relational = shift { (<|<=|>|>=) shift }
+// shift = add { (<<|>>) add }
 // add = mul { (+|-) mul }
-// mul = primary { (*|/) primary }
+// mul = unary { (*|/) unary }
+// unary = (&|*|-|~|!|sizeof) unary | primary
 // primary = IDENT | INT | '(' expr ')'
-func (p *Parser) parseExpr() (ast.Expr, error) { return p.parseLogicalOr() }
+func (p *Parser) parseExpr() (ast.Expr, error) { return p.parseAssign() }
+
+// parseAssign parses a right-associative assignment expression. Statements
+// of the form x = e; are still parsed as AssignStmt by parseStmt.
+func (p *Parser) parseAssign() (ast.Expr, error) {
+    left, err := p.parseLogicalOr()
+    if err != nil { return nil, err }
+    if p.tok.Type != lexer.ASSIGN { return left, nil }
+    id, ok := left.(*ast.Ident)
+    if !ok {
+        return nil, fmt.Errorf("assignment target must be a variable at %d:%d", p.tok.Line, p.tok.Col)
+    }
+    p.next()
+    v, err := p.parseAssign()
+    if err != nil { return nil, err }
+    return &ast.AssignExpr{Name: id.Name, Value: v, Pos: id.Pos}, nil
+}
 
 func (p *Parser) parseLogicalOr() (ast.Expr, error) {
     left, err := p.parseLogicalAnd()
@@ -401,7 +811,7 @@ func (p *Parser) parseLogicalOr() (ast.Expr, error) {
         p.next()
         right, err := p.parseLogicalAnd()
         if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpLOr, Left: left, Right: right}
+        left = &ast.BinaryExpr{Op: ast.OpLOr, Left: left, Right: right, Pos: ast.ExprPos(left)}
     }
     return left, nil
 }
@@ -413,17 +823,19 @@ func (p *Parser) parseLogicalAnd() (ast.Expr, error) {
         p.next()
         right, err := p.parseBitwiseOr()
         if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpLAnd, Left: left, Right: right}
+        left = &ast.BinaryExpr{Op: ast.OpLAnd, Left: left, Right: right, Pos: ast.ExprPos(left)}
     }
     return left, nil
 }
 
-func (p *Parser) parseAdd(left ast.Expr) (ast.Expr, error) {
+func (p *Parser) parseAdd() (ast.Expr, error) {
+    left, err := p.parseTerm()
+    if err != nil { return nil, err }
     for p.tok.Type == lexer.PLUS || p.tok.Type == lexer.MINUS {
         op := p.tok.Type; p.next()
         right, err := p.parseTerm()
         if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right}
+        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right, Pos: ast.ExprPos(left)}
     }
     return left, nil
 }
@@ -435,7 +847,7 @@ func (p *Parser) parseTerm() (ast.Expr, error) {
         op := p.tok.Type; p.next()
         right, err := p.parseUnary()
         if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right}
+        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right, Pos: ast.ExprPos(left)}
     }
     return left, nil
 }
@@ -443,49 +855,17 @@ func (p *Parser) parseTerm() (ast.Expr, error) {
 func (p *Parser) parseFactor() (ast.Expr, error) {
     switch p.tok.Type {
     case lexer.IDENT:
-        name := p.tok.Lex
+        id := p.tok
         p.next()
-        if p.tok.Type == lexer.LPAREN {
-            // call
-            p.next()
-            var args []ast.Expr
-            if p.tok.Type != lexer.RPAREN {
-                for {
-                    e, err := p.parseExpr()
-                    if err != nil { return nil, err }
-                    args = append(args, e)
-                    if p.tok.Type == lexer.COMMA { p.next(); continue }
-                    break
-                }
-            }
-            if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
-            return &ast.CallExpr{Name: name, Args: args}, nil
-        }
-        // support postfix indexing
-        var expr ast.Expr = &ast.Ident{Name: name}
-        for p.tok.Type == lexer.LBRACK {
-            p.next()
-            idx, err := p.parseExpr()
-            if err != nil { return nil, err }
-            if _, err := p.expect(lexer.RBRACK); err != nil { return nil, err }
-            expr = &ast.IndexExpr{Base: expr, Index: idx}
-        }
-        // support field access
-        for p.tok.Type == lexer.DOT {
-            p.next()
-            fieldTok, err := p.expect(lexer.IDENT)
-            if err != nil { return nil, err }
-            expr = &ast.FieldExpr{Base: expr, Field: fieldTok.Lex}
-        }
-        return expr, nil
+        return p.parseIdentTail(id)
     case lexer.INT:
-        v, _ := strconv.ParseInt(p.tok.Lex, 10, 64)
-        lit := &ast.IntLit{Value: v}
+        v, _ := strconv.ParseInt(p.tok.Lex, 0, 64)
+        lit := &ast.IntLit{Value: v, Pos: posOf(p.tok)}
         p.next()
         return lit, nil
     case lexer.FLOAT:
         v, _ := strconv.ParseFloat(p.tok.Lex, 64)
-        lit := &ast.FloatLit{Value: v}
+        lit := &ast.FloatLit{Value: v, Pos: posOf(p.tok)}
         p.next()
         return lit, nil
     case lexer.CHAR:
@@ -493,86 +873,147 @@ func (p *Parser) parseFactor() (ast.Expr, error) {
         r := []rune(p.tok.Lex)
         var v int64
         if len(r) > 0 { v = int64(r[0]) }
-        lit := &ast.IntLit{Value: v}
+        lit := &ast.IntLit{Value: v, Pos: posOf(p.tok)}
         p.next()
         return lit, nil
     case lexer.STRING:
-        s := &ast.StringLit{Value: p.tok.Lex}
+        s := &ast.StringLit{Value: p.tok.Lex, Pos: posOf(p.tok)}
         p.next()
         // allow postfix indexing like "str"[i]
-        var expr ast.Expr = s
-        for p.tok.Type == lexer.LBRACK {
-            p.next()
-            idx, err := p.parseExpr()
-            if err != nil { return nil, err }
-            if _, err := p.expect(lexer.RBRACK); err != nil { return nil, err }
-            expr = &ast.IndexExpr{Base: expr, Index: idx}
-        }
-        return expr, nil
+        return p.parsePostfix(s)
     case lexer.LPAREN:
+        lparen := p.tok
         p.next()
         // check for cast: ( type [*] ) unary
-        if p.tok.Type == lexer.KW_INT || p.tok.Type == lexer.KW_CHAR || p.tok.Type == lexer.KW_DOUBLE {
-            bt := ast.BTInt
-            if p.tok.Type == lexer.KW_CHAR { bt = ast.BTChar }
-            if p.tok.Type == lexer.KW_DOUBLE { bt = ast.BTDouble }
+        if isTypeSpec(p.tok.Type) {
+            bt, err := p.parseTypeSpec()
+            if err != nil { return nil, err }
+            cptr := false
+            for p.tok.Type == lexer.STAR { p.next(); cptr = true }
+            if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
+            x, err := p.parseUnary()
+            if err != nil { return nil, err }
+            return &ast.CastExpr{To: bt, Ptr: cptr, X: x, Pos: posOf(lparen)}, nil
+        }
+        // ( typedef-name [*] ) unary; any other identifier starts an expression
+        if _, isTypedef := p.typedefs[p.tok.Lex]; p.tok.Type == lexer.IDENT && isTypedef {
+            name := p.tok.Lex
             p.next()
             cptr := false
             for p.tok.Type == lexer.STAR { p.next(); cptr = true }
             if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
             x, err := p.parseUnary()
             if err != nil { return nil, err }
-            return &ast.CastExpr{To: bt, Ptr: cptr, X: x}, nil
+            return &ast.CastExpr{Ptr: cptr, X: x, TypedefName: name, Pos: posOf(lparen)}, nil
         }
         // otherwise parenthesized expression
         e, err := p.parseExpr()
         if err != nil { return nil, err }
         if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
-        // support postfix indexing on parenthesized expressions
-        var expr ast.Expr = e
-        for p.tok.Type == lexer.LBRACK {
+        // support postfix indexing and field access on parenthesized expressions
+        return p.parsePostfix(e)
+    default:
+        return nil, fmt.Errorf("unexpected token %v at %d:%d", p.tok.Type, p.tok.Line, p.tok.Col)
+    }
+}
+
+// parseIdentTail parses what may follow an already-consumed identifier in
+// expression position: a call argument list, indexing, or field access.
+func (p *Parser) parseIdentTail(id lexer.Token) (ast.Expr, error) {
+    if p.tok.Type == lexer.LPAREN {
+        // call
+        p.next()
+        args, err := p.parseArgs()
+        if err != nil { return nil, err }
+        return &ast.CallExpr{Name: id.Lex, Args: args, Pos: ast.Pos{Line: id.Line, Col: id.Col}}, nil
+    }
+    return p.parsePostfix(&ast.Ident{Name: id.Lex, Pos: posOf(id)})
+}
+
+// parseArgs parses a call's arguments after the '(', through the ')'.
+func (p *Parser) parseArgs() ([]ast.Expr, error) {
+    var args []ast.Expr
+    if p.tok.Type != lexer.RPAREN {
+        for {
+            e, err := p.parseExpr()
+            if err != nil { return nil, err }
+            args = append(args, e)
+            if p.tok.Type == lexer.COMMA { p.next(); continue }
+            break
+        }
+    }
+    if _, err := p.expect(lexer.RPAREN); err != nil { return nil, err }
+    return args, nil
+}
+
+// parsePostfix applies any sequence of postfix indexing [i], field access
+// .f or ->f, and calls through a function pointer (args) to expr.
+func (p *Parser) parsePostfix(expr ast.Expr) (ast.Expr, error) {
+    for {
+        switch p.tok.Type {
+        case lexer.LPAREN:
+            p.next()
+            args, err := p.parseArgs()
+            if err != nil { return nil, err }
+            expr = &ast.CallExpr{Fn: expr, Args: args, Pos: ast.ExprPos(expr)}
+        case lexer.LBRACK:
             p.next()
             idx, err := p.parseExpr()
             if err != nil { return nil, err }
             if _, err := p.expect(lexer.RBRACK); err != nil { return nil, err }
-            expr = &ast.IndexExpr{Base: expr, Index: idx}
+            expr = &ast.IndexExpr{Base: expr, Index: idx, Pos: ast.ExprPos(expr)}
+        case lexer.DOT, lexer.ARROW:
+            arrow := p.tok.Type == lexer.ARROW
+            p.next()
+            fieldTok, err := p.expect(lexer.IDENT)
+            if err != nil { return nil, err }
+            expr = &ast.FieldExpr{Base: expr, Field: fieldTok.Lex, Arrow: arrow, Pos: ast.ExprPos(expr)}
+        default:
+            return expr, nil
         }
-        return expr, nil
-    default:
-        return nil, fmt.Errorf("unexpected token %v at %d:%d", p.tok.Type, p.tok.Line, p.tok.Col)
     }
 }
 
 func (p *Parser) parseUnary() (ast.Expr, error) {
+    if p.primary != nil {
+        // operand already consumed by the statement parser; see parseExprFrom
+        e := p.primary
+        p.primary = nil
+        return e, nil
+    }
+    opTok := p.tok
     if p.tok.Type == lexer.AMP {
         p.next()
         x, err := p.parseUnary()
         if err != nil { return nil, err }
-        return &ast.UnaryExpr{Op: ast.OpAddr, X: x}, nil
+        return &ast.UnaryExpr{Op: ast.OpAddr, X: x, Pos: posOf(opTok)}, nil
     }
     if p.tok.Type == lexer.STAR {
         p.next()
         x, err := p.parseUnary()
         if err != nil { return nil, err }
-        return &ast.UnaryExpr{Op: ast.OpDeref, X: x}, nil
+        return &ast.UnaryExpr{Op: ast.OpDeref, X: x, Pos: posOf(opTok)}, nil
     }
     if p.tok.Type == lexer.MINUS {
         p.next()
         x, err := p.parseUnary()
         if err != nil { return nil, err }
-        return &ast.UnaryExpr{Op: ast.OpNeg, X: x}, nil
+        return &ast.UnaryExpr{Op: ast.OpNeg, X: x, Pos: posOf(opTok)}, nil
     }
     if p.tok.Type == lexer.TILDE {
         p.next()
         x, err := p.parseUnary()
         if err != nil { return nil, err }
-        return &ast.UnaryExpr{Op: ast.OpBitNot, X: x}, nil
+        return &ast.UnaryExpr{Op: ast.OpBitNot, X: x, Pos: posOf(opTok)}, nil
     }
     if p.tok.Type == lexer.BANG {
         p.next()
         x, err := p.parseUnary()
         if err != nil { return nil, err }
-        return &ast.UnaryExpr{Op: ast.OpLogicalNot, X: x}, nil
+        return &ast.UnaryExpr{Op: ast.OpLogicalNot, X: x, Pos: posOf(opTok)}, nil
+    }
+    if p.tok.Type == lexer.KW_SIZEOF {
+        return p.parseSizeof()
     }
     return p.parseFactor()
 }
@@ -584,7 +1025,7 @@ func (p *Parser) parseRelational() (ast.Expr, error) {
         op := p.tok.Type; p.next()
         right, err := p.parseShift()
         if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right}
+        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right, Pos: ast.ExprPos(left)}
     }
     return left, nil
 }
@@ -596,9 +1037,9 @@ func (p *Parser) parseEquality() (ast.Expr, error) {
         op := p.tok.Type; p.next()
         right, err := p.parseRelational()
         if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right}
+        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right, Pos: ast.ExprPos(left)}
     }
-    return p.parseAdd(left)
+    return left, nil
 }
 
 func (p *Parser) parseBitwiseAnd() (ast.Expr, error) {
@@ -608,7 +1049,7 @@ func (p *Parser) parseBitwiseAnd() (ast.Expr, error) {
         p.next()
         right, err := p.parseEquality()
         if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpAnd, Left: left, Right: right}
+        left = &ast.BinaryExpr{Op: ast.OpAnd, Left: left, Right: right, Pos: ast.ExprPos(left)}
     }
     return left, nil
 }
@@ -620,7 +1061,7 @@ func (p *Parser) parseBitwiseXor() (ast.Expr, error) {
         p.next()
         right, err := p.parseBitwiseAnd()
         if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpXor, Left: left, Right: right}
+        left = &ast.BinaryExpr{Op: ast.OpXor, Left: left, Right: right, Pos: ast.ExprPos(left)}
     }
     return left, nil
 }
@@ -632,38 +1073,73 @@ func (p *Parser) parseBitwiseOr() (ast.Expr, error) {
         p.next()
         right, err := p.parseBitwiseXor()
         if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpOr, Left: left, Right: right}
+        left = &ast.BinaryExpr{Op: ast.OpOr, Left: left, Right: right, Pos: ast.ExprPos(left)}
     }
     return left, nil
 }
 
 func (p *Parser) parseShift() (ast.Expr, error) {
-    left, err := p.parseTerm()
+    left, err := p.parseAdd()
     if err != nil { return nil, err }
     for p.tok.Type == lexer.SHL || p.tok.Type == lexer.SHR {
         op := p.tok.Type; p.next()
-        right, err := p.parseTerm()
+        right, err := p.parseAdd()
         if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right}
+        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right, Pos: ast.ExprPos(left)}
     }
     return left, nil
 }
 
+// parseForClause parses a for-loop init or post clause: a comma-separated list
+// of simple statements, run left to right. A list is returned as a BlockStmt.
+// Commas inside call arguments never reach this level since parseExpr stops
+// at the first top-level COMMA.
+func (p *Parser) parseForClause() (ast.Stmt, error) {
+    start := p.tok
+    s, err := p.parseForInitOrExprNoSemi()
+    if err != nil { return nil, err }
+    if p.tok.Type != lexer.COMMA { return s, nil }
+    stmts := []ast.Stmt{s}
+    for p.tok.Type == lexer.COMMA {
+        p.next()
+        s, err := p.parseForInitOrExprNoSemi()
+        if err != nil { return nil, err }
+        stmts = append(stmts, s)
+    }
+    return &ast.BlockStmt{Stmts: stmts, Pos: posOf(start)}, nil
+}
+
+// asBlock wraps a single statement used as a loop or if body in a block.
+func asBlock(s ast.Stmt) *ast.BlockStmt {
+    if b, ok := s.(*ast.BlockStmt); ok { return b }
+    return &ast.BlockStmt{Stmts: []ast.Stmt{s}}
+}
+
 // parse a simple statement used in for-init/post without trailing semicolon
 func (p *Parser) parseForInitOrExprNoSemi() (ast.Stmt, error) {
     switch p.tok.Type {
-    case lexer.KW_INT:
-        p.next()
-        nameTok, err := p.expect(lexer.IDENT)
+    case lexer.KW_INT, lexer.KW_CHAR, lexer.KW_SHORT, lexer.KW_LONG, lexer.KW_SIGNED, lexer.KW_UNSIGNED:
+        // int i = 0, j = n declares every name in the list
+        nameTok0 := p.tok
+        bt, err := p.parseTypeSpec()
         if err != nil { return nil, err }
-        var init ast.Expr
-        if p.tok.Type == lexer.ASSIGN {
-            p.next()
-            e, err := p.parseExpr()
+        var decls []ast.Stmt
+        for {
+            nameTok, err := p.expect(lexer.IDENT)
             if err != nil { return nil, err }
-            init = e
+            var init ast.Expr
+            if p.tok.Type == lexer.ASSIGN {
+                p.next()
+                e, err := p.parseExpr()
+                if err != nil { return nil, err }
+                init = e
+            }
+            decls = append(decls, &ast.DeclStmt{Name: nameTok.Lex, Init: init, Typ: bt, Pos: posOf(nameTok)})
+            if p.tok.Type != lexer.COMMA { break }
+            p.next()
         }
-        return &ast.DeclStmt{Name: nameTok.Lex, Init: init}, nil
+        if len(decls) == 1 { return decls[0], nil }
+        return &ast.BlockStmt{Stmts: decls, Pos: posOf(nameTok0)}, nil
     case lexer.IDENT:
         id := p.tok
         p.next()
@@ -671,111 +1147,30 @@ func (p *Parser) parseForInitOrExprNoSemi() (ast.Stmt, error) {
             p.next()
             e, err := p.parseExpr()
             if err != nil { return nil, err }
-            return &ast.AssignStmt{Name: id.Lex, Value: e}, nil
+            return &ast.AssignStmt{Name: id.Lex, Value: e, Pos: posOf(id)}, nil
         }
         // treat as expression statement starting with this ident
-        left := &ast.Ident{Name: id.Lex}
-        e, err := p.parseAfterPrimary(left)
+        left, err := p.parseIdentTail(id)
+        if err != nil { return nil, err }
+        e, err := p.parseExprFrom(left)
         if err != nil { return nil, err }
-        return &ast.ExprStmt{X: e}, nil
+        return &ast.ExprStmt{X: e, Pos: posOf(id)}, nil
     default:
         // expression
+        posTok := p.tok
         e, err := p.parseExpr()
         if err != nil { return nil, err }
-        return &ast.ExprStmt{X: e}, nil
+        return &ast.ExprStmt{X: e, Pos: posOf(posTok)}, nil
     }
 }
 
-// Continue parsing after an already-read primary expression (IDENT/INT/(...)).
-func (p *Parser) parseAfterPrimary(left ast.Expr) (ast.Expr, error) {
-    // handle * and /
-    for p.tok.Type == lexer.STAR || p.tok.Type == lexer.SLASH {
-        op := p.tok.Type; p.next()
-        right, err := p.parseFactor()
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right}
-    }
-    // handle + and -
-    for p.tok.Type == lexer.PLUS || p.tok.Type == lexer.MINUS {
-        op := p.tok.Type; p.next()
-        right, err := p.parseTerm()
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right}
-    }
-    // shifts
-    for p.tok.Type == lexer.SHL || p.tok.Type == lexer.SHR {
-        op := p.tok.Type; p.next()
-        right, err := p.parseTerm()
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right}
-    }
-    // relational
-    for p.tok.Type == lexer.LT || p.tok.Type == lexer.LE || p.tok.Type == lexer.GT || p.tok.Type == lexer.GE {
-        op := p.tok.Type; p.next()
-        right, err := p.parseAdd(left)
-        if err != nil { return nil, err }
-        // Note: parseAdd ignores its left, so rebuild properly
-        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right}
-    }
-    // equality
-    for p.tok.Type == lexer.EQEQ || p.tok.Type == lexer.NEQ {
-        op := p.tok.Type; p.next()
-        right, err := p.parseRelational()
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: binOpFromToken(op), Left: left, Right: right}
-    }
-    // bitwise and/xor/or using full equality precedence on right
-    for p.tok.Type == lexer.AMP {
-        p.next()
-        right, err := p.parseEquality()
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpAnd, Left: left, Right: right}
-    }
-    for p.tok.Type == lexer.CARET {
-        p.next()
-        right, err := p.parseEquality()
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpXor, Left: left, Right: right}
-    }
-    for p.tok.Type == lexer.PIPE {
-        p.next()
-        right, err := p.parseEquality()
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpOr, Left: left, Right: right}
-    }
-    // bitwise and/xor/or
-    for p.tok.Type == lexer.AMP {
-        p.next()
-        right, err := p.parseAdd(left)
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpAnd, Left: left, Right: right}
-    }
-    for p.tok.Type == lexer.CARET {
-        p.next()
-        right, err := p.parseAdd(left)
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpXor, Left: left, Right: right}
-    }
-    for p.tok.Type == lexer.PIPE {
-        p.next()
-        right, err := p.parseAdd(left)
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpOr, Left: left, Right: right}
-    }
-    // logical and/or
-    for p.tok.Type == lexer.ANDAND {
-        p.next()
-        right, err := p.parseEquality()
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpLAnd, Left: left, Right: right}
-    }
-    for p.tok.Type == lexer.OROR {
-        p.next()
-        right, err := p.parseLogicalAnd()
-        if err != nil { return nil, err }
-        left = &ast.BinaryExpr{Op: ast.OpLOr, Left: left, Right: right}
-    }
-    return left, nil
+// parseExprFrom parses a full expression whose leading operand has already
+// been consumed, as happens when a statement starting with an identifier
+// turns out not to be a declaration or assignment. The operand is handed to
+// parseUnary through p.primary so the normal precedence levels apply.
+func (p *Parser) parseExprFrom(first ast.Expr) (ast.Expr, error) {
+    p.primary = first
+    return p.parseExpr()
 }
 
 func binOpFromToken(t lexer.TokenType) ast.BinOp {
@@ -801,27 +1196,54 @@ func binOpFromToken(t lexer.TokenType) ast.BinOp {
     }
 }
 
-func (p *Parser) parseStructDecl() (ast.Decl, error) {
-    // struct IDENT { field1; field2; ... };
+func (p *Parser) parseStructDecl(q qualifiers) (ast.Decl, error) {
+    // struct IDENT { field1; field2; ... };  or a global: struct IDENT name;
     if _, err := p.expect(lexer.KW_STRUCT); err != nil { return nil, err }
     
     nameTok, err := p.expect(lexer.IDENT)
     if err != nil { return nil, err }
+    if p.tok.Type == lexer.IDENT {
+        if !p.structs[nameTok.Lex] {
+            return nil, fmt.Errorf("unknown struct type %s at %d:%d", nameTok.Lex, nameTok.Line, nameTok.Col)
+        }
+        varTok := p.tok
+        p.next()
+        if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
+        return &ast.GlobalStructDecl{Name: varTok.Lex, StructType: nameTok.Lex, Static: q.static, Extern: q.extern, Pos: posOf(varTok)}, nil
+    }
+    p.structs[nameTok.Lex] = true
+    
+    // forward declaration: struct S;
+    if p.tok.Type == lexer.SEMI {
+        p.next()
+        return &ast.StructDecl{Name: nameTok.Lex, Forward: true}, nil
+    }
     
     if _, err := p.expect(lexer.LBRACE); err != nil { return nil, err }
     
     var fields []ast.StructField
     for p.tok.Type != lexer.RBRACE {
-        // Parse field: <type> [*]* name;
+        // Parse field: <type> [*]* name;  |  struct T *name;
         var fieldType ast.BasicType
-        if p.tok.Type == lexer.KW_INT {
-            fieldType = ast.BTInt
-        } else if p.tok.Type == lexer.KW_CHAR {
-            fieldType = ast.BTChar
+        structType := ""
+        if isTypeSpec(p.tok.Type) && p.tok.Type != lexer.KW_DOUBLE {
+            bt, err := p.parseTypeSpec()
+            if err != nil { return nil, err }
+            fieldType = bt
+        } else if p.tok.Type == lexer.KW_STRUCT {
+            p.next()
+            tagTok, err := p.expect(lexer.IDENT)
+            if err != nil { return nil, err }
+            if !p.structs[tagTok.Lex] {
+                return nil, fmt.Errorf("unknown struct type %s at %d:%d", tagTok.Lex, tagTok.Line, tagTok.Col)
+            }
+            structType = tagTok.Lex
+            if p.tok.Type != lexer.STAR {
+                return nil, fmt.Errorf("struct members of struct type must be pointers at %d:%d", p.tok.Line, p.tok.Col)
+            }
         } else {
-            return nil, fmt.Errorf("only int/char field types supported at %d:%d", p.tok.Line, p.tok.Col)
+            return nil, fmt.Errorf("only integer/struct pointer field types supported at %d:%d", p.tok.Line, p.tok.Col)
         }
-        p.next()
         
         // optional pointer stars
         ptr := false
@@ -836,38 +1258,52 @@ func (p *Parser) parseStructDecl() (ast.Decl, error) {
             Name: fieldNameTok.Lex,
             Typ:  fieldType,
             Ptr:  ptr,
+            StructType: structType,
         })
     }
     
     if _, err := p.expect(lexer.RBRACE); err != nil { return nil, err }
     if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
     
+    // each field sits at a multiple of its size, matching the IR layout
+    size, align := 0, 1
+    for _, f := range fields {
+        fs := basicSize(f.Typ, f.Ptr)
+        size = (size + fs - 1) / fs * fs + fs
+        if fs > align { align = fs }
+    }
+    p.structSizes[nameTok.Lex] = (size + align - 1) / align * align
+    
     return &ast.StructDecl{Name: nameTok.Lex, Fields: fields}, nil
 }
 
 func (p *Parser) parseEnumDecl() (ast.Decl, error) {
-    // enum IDENT { A=1, B=2 };
+    // enum [IDENT] { A, B = 5, C };  values count up from the previous one
     if _, err := p.expect(lexer.KW_ENUM); err != nil { return nil, err }
     
-    nameTok, err := p.expect(lexer.IDENT)
-    if err != nil { return nil, err }
+    name := ""
+    if p.tok.Type == lexer.IDENT {
+        name = p.tok.Lex
+        p.next()
+    }
     
     if _, err := p.expect(lexer.LBRACE); err != nil { return nil, err }
     
     var values []ast.EnumValue
+    next := int64(0)
     for p.tok.Type != lexer.RBRACE {
         enumNameTok, err := p.expect(lexer.IDENT)
         if err != nil { return nil, err }
         
-        // expect =value
-        if _, err := p.expect(lexer.ASSIGN); err != nil { return nil, err }
-        
-        valueTok, err := p.expect(lexer.INT)
-        if err != nil { return nil, err }
-        
-        // parse value
-        value, err := strconv.ParseInt(valueTok.Lex, 10, 64)
-        if err != nil { return nil, fmt.Errorf("invalid enum value %s", valueTok.Lex) }
+        // optional =value
+        value := next
+        if p.tok.Type == lexer.ASSIGN {
+            p.next()
+            value, err = p.parseConstExpr()
+            if err != nil { return nil, err }
+        }
+        next = value + 1
+        p.enums[enumNameTok.Lex] = value
         
         values = append(values, ast.EnumValue{
             Name:  enumNameTok.Lex,
@@ -884,22 +1320,18 @@ func (p *Parser) parseEnumDecl() (ast.Decl, error) {
     if _, err := p.expect(lexer.RBRACE); err != nil { return nil, err }
     if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
     
-    return &ast.EnumDecl{Name: nameTok.Lex, Values: values}, nil
+    return &ast.EnumDecl{Name: name, Values: values}, nil
 }
 
 func (p *Parser) parseTypedefDecl() (ast.Decl, error) {
     // typedef <type> [*]* name;
     if _, err := p.expect(lexer.KW_TYPEDEF); err != nil { return nil, err }
     
-    var baseType ast.BasicType
-    if p.tok.Type == lexer.KW_INT {
-        baseType = ast.BTInt
-    } else if p.tok.Type == lexer.KW_CHAR {
-        baseType = ast.BTChar
-    } else {
-        return nil, fmt.Errorf("only int/char base types supported in typedef at %d:%d", p.tok.Line, p.tok.Col)
+    if !isTypeSpec(p.tok.Type) || p.tok.Type == lexer.KW_DOUBLE {
+        return nil, fmt.Errorf("only integer base types supported in typedef at %d:%d", p.tok.Line, p.tok.Col)
     }
-    p.next()
+    baseType, err := p.parseTypeSpec()
+    if err != nil { return nil, err }
     
     // optional pointer stars
     ptr := false
@@ -909,6 +1341,7 @@ func (p *Parser) parseTypedefDecl() (ast.Decl, error) {
     if err != nil { return nil, err }
     
     if _, err := p.expect(lexer.SEMI); err != nil { return nil, err }
+    p.typedefs[nameTok.Lex] = basicSize(baseType, ptr)
     
     return &ast.TypedefDecl{Name: nameTok.Lex, Typ: baseType, Ptr: ptr}, nil
 }
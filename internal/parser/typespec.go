@@ -0,0 +1,73 @@
+package parser
+
+import (
+    "fmt"
+
+    "github.com/tinyrange/cc/internal/ast"
+    "github.com/tinyrange/cc/internal/lexer"
+)
+
+// isTypeSpec reports whether tt can start a basic type specifier.
+func isTypeSpec(tt lexer.TokenType) bool {
+    switch tt {
+    case lexer.KW_INT, lexer.KW_CHAR, lexer.KW_DOUBLE, lexer.KW_SHORT, lexer.KW_LONG, lexer.KW_SIGNED, lexer.KW_UNSIGNED:
+        return true
+    }
+    return false
+}
+
+// parseTypeSpec consumes a run of basic type specifier keywords in any order,
+// such as unsigned long int or short, and combines them into one BasicType.
+func (p *Parser) parseTypeSpec() (ast.BasicType, error) {
+    start := p.tok
+    var nInt, nChar, nDouble, nShort, nLong, nSigned, nUnsigned int
+    for isTypeSpec(p.tok.Type) {
+        switch p.tok.Type {
+        case lexer.KW_INT: nInt++
+        case lexer.KW_CHAR: nChar++
+        case lexer.KW_DOUBLE: nDouble++
+        case lexer.KW_SHORT: nShort++
+        case lexer.KW_LONG: nLong++
+        case lexer.KW_SIGNED: nSigned++
+        case lexer.KW_UNSIGNED: nUnsigned++
+        }
+        p.next()
+    }
+    bad := func(what string) (ast.BasicType, error) {
+        return ast.BTInt, fmt.Errorf("invalid type specifier: %s at %d:%d", what, start.Line, start.Col)
+    }
+    if nInt+nChar+nDouble+nShort+nLong+nSigned+nUnsigned == 0 {
+        return bad(fmt.Sprintf("expected a type, got %v", p.tok.Type))
+    }
+    if nInt > 1 || nChar > 1 || nDouble > 1 || nShort > 1 || nSigned > 1 || nUnsigned > 1 || nLong > 2 {
+        return bad("duplicate keyword")
+    }
+    if nInt+nChar+nDouble > 1 {
+        return bad("more than one base type")
+    }
+    if nSigned > 0 && nUnsigned > 0 {
+        return bad("both signed and unsigned")
+    }
+    if nShort > 0 && nLong > 0 {
+        return bad("both short and long")
+    }
+    unsigned := nUnsigned > 0
+    switch {
+    case nDouble > 0:
+        if nShort+nSigned+nUnsigned > 0 || nLong > 1 { return bad("modifier on double") }
+        return ast.BTDouble, nil
+    case nChar > 0:
+        if nShort+nLong > 0 { return bad("short or long char") }
+        if unsigned { return ast.BTUChar, nil }
+        if nSigned > 0 { return ast.BTSChar, nil }
+        return ast.BTChar, nil
+    case nShort > 0:
+        if unsigned { return ast.BTUShort, nil }
+        return ast.BTShort, nil
+    case nLong > 0:
+        if unsigned { return ast.BTULong, nil }
+        return ast.BTLong, nil
+    }
+    if unsigned { return ast.BTUInt, nil }
+    return ast.BTInt, nil
+}
@@ -4,7 +4,9 @@ package types
 type Kind int
 
 const (
-    Int8 Kind = iota
+    // Invalid is the zero Kind, so the zero Type stands for an unknown type.
+    Invalid Kind = iota
+    Int8
     Int16
     Int32
     Int64
@@ -16,13 +18,16 @@ const (
     Float64
     Ptr
     Byte // alias for Uint8
+    Struct // a struct named by Tag; only ever pointed to
+    Func   // a function returning *Elem; only ever pointed to
 )
 
 // Type is a minimal description of a value's type.
 // For now we only track 64-bit integers and pointers to another Type.
 type Type struct {
     K    Kind
-    Elem *Type // non-nil only when K==Ptr
+    Elem *Type // non-nil only when K==Ptr, or the return type when K==Func
+    Tag  string // struct name when K==Struct
 }
 
 func Int() Type { return Type{K: Int64} }
@@ -35,6 +40,8 @@ func Uint32T() Type { return Type{K: Uint32} }
 func Uint64T() Type { return Type{K: Uint64} }
 
 func PointerTo(elem Type) Type { return Type{K: Ptr, Elem: &elem} }
+func StructOf(tag string) Type { return Type{K: Struct, Tag: tag} }
+func FuncOf(ret Type) Type { return Type{K: Func, Elem: &ret} }
 
 // Size returns the size in bytes for this type on our target.
 func (t Type) Size() int {
@@ -42,7 +49,9 @@ func (t Type) Size() int {
     case Int8, Uint8, Byte:
         return 1
     case Int16, Uint16:
-        return 2
+        // held in 64 bits, like int, until codegen learns 16-bit loads and
+        // stores; Bits is the width of the value
+        return 8
     case Int32, Uint32, Float32:
         return 4
     case Int64, Uint64, Float64:
@@ -55,6 +64,21 @@ func (t Type) Size() int {
     }
 }
 
+// Bits returns the width in bits of an integer's value, which is held in 64
+// bits extended according to its signedness.
+func (t Type) Bits() int {
+    switch t.K {
+    case Int8, Uint8, Byte:
+        return 8
+    case Int16, Uint16:
+        return 16
+    case Int32, Uint32:
+        return 32
+    default:
+        return 64
+    }
+}
+
 // ElemSize returns the pointee size if pointer, else 0.
 func (t Type) ElemSize() int {
     if t.K == Ptr && t.Elem != nil {
@@ -65,6 +89,9 @@ func (t Type) ElemSize() int {
 
 func (t Type) IsPointer() bool { return t.K == Ptr }
 
+// IsFuncPointer reports whether t points to a function.
+func (t Type) IsFuncPointer() bool { return t.K == Ptr && t.Elem != nil && t.Elem.K == Func }
+
 func ByteT() Type { return Type{K: Byte} }
 func CharT() Type { return Type{K: Byte} } // char is unsigned byte by default
 func Float64T() Type { return Type{K: Float64} }
@@ -105,28 +132,3 @@ type StructType struct {
     Name string
     Def  interface{} // will be *ir.StructDef but we avoid the import cycle
 }
-
-// FromBasicType converts AST BasicType to internal Type
-// Note: This will need ast import - will be updated in ir.go where it's used
-func FromBasicType(bt int, isPtr bool) Type {
-    // bt values: 0=BTInt, 1=BTChar, 2=BTDouble (from ast.go BasicType constants)
-    if isPtr {
-        switch bt {
-        case 1: // BTChar
-            return PointerTo(CharT())
-        case 2: // BTDouble
-            return PointerTo(DoubleT())
-        default: // BTInt
-            return PointerTo(Int())
-        }
-    } else {
-        switch bt {
-        case 1: // BTChar
-            return CharT()
-        case 2: // BTDouble
-            return DoubleT()
-        default: // BTInt
-            return Int()
-        }
-    }
-}
@@ -0,0 +1,10 @@
+// FLAGS: -finline-threshold=0
+// each function starts 16-byte aligned with its type, and ends with its
+// size; each global has its type and size, static or not, in .data or .bss
+struct P { int x; int y; };
+struct P pt;
+static char buf[5] = "abc";
+int n = 3;
+int tab[3] = {1, 2};
+static int helper(int x) { return x + n; }
+int main() { return helper(pt.x) + buf[0] + tab[1]; }
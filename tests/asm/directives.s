@@ -0,0 +1,74 @@
+.text
+.p2align 4
+.type helper, @function
+helper:
+  push %rbp
+  mov %rsp, %rbp
+  push %rdi
+  pop %rax
+  mov %rax, %rdx
+  lea n(%rip), %r8
+  mov %r8, %rcx
+  mov (%rcx), %r9
+  mov %rdx, %r8
+  add %r9, %r8
+  mov %r8, %rax
+  pop %rbp
+  ret
+.size helper, .-helper
+.p2align 4
+.globl main
+.type main, @function
+main:
+  push %rbp
+  mov %rsp, %rbp
+  lea pt(%rip), %rdx
+  mov %rdx, %rcx
+  mov (%rcx), %r8
+  mov %r8, %rdi
+  call helper
+  mov %rax, %rdx
+  lea buf(%rip), %r8
+  mov %r8, %rcx
+  movzbq (%rcx), %r9
+  mov %rdx, %r8
+  add %r9, %r8
+  lea tab(%rip), %rdx
+  mov $8, %r9
+  mov %rdx, %r10
+  add $8, %r10
+  mov %r10, %rcx
+  mov (%rcx), %rdx
+  mov %r8, %r9
+  add %rdx, %r9
+  mov %r9, %rax
+  pop %rbp
+  ret
+.size main, .-main
+.data
+.type buf, @object
+.size buf, 5
+buf:
+  .ascii "abc"
+  .zero 2
+.globl n
+.type n, @object
+.size n, 8
+  .balign 8
+n:
+  .quad 3
+.globl tab
+.type tab, @object
+.size tab, 24
+  .balign 8
+tab:
+  .quad 1
+  .quad 2
+  .zero 8
+.bss
+.globl pt
+.type pt, @object
+.size pt, 16
+  .balign 8
+pt:
+  .zero 16
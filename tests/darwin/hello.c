@@ -0,0 +1,26 @@
+// EXPECT: EXIT 42
+// FLAGS: -finline-threshold=0
+// STDOUT: hello, world
+// hello world for macOS: puts is _puts, the string literal is in
+// __TEXT,__cstring under a label starting L, the switch's jump table, of
+// absolute addresses, in __DATA,__const, and the globals in .data and .bss
+// under their underscored names.
+int puts(const char *s);
+int count;
+static int seen[4];
+int *where = &count;
+static int pick(int x) {
+    switch (x) {
+    case 0: return 10;
+    case 1: return 11;
+    case 2: return 12;
+    case 3: return 13;
+    }
+    return 0;
+}
+int main() {
+    puts("hello, world");
+    for (int i = 0; i < 4; i = i + 1) { count = count + pick(i); }
+    seen[1] = *where;
+    return seen[1] - 4;
+}
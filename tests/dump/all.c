@@ -0,0 +1,8 @@
+// FLAGS: --dump-ir-after=all
+// a header per pass, in pipeline order; const-fold, simplify and phis repeat
+// until neither changes anything
+int main() {
+    int x = 2;
+    if (x * 0) return 1;
+    return x + 3;
+}
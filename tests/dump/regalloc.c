@@ -0,0 +1,16 @@
+// FLAGS: -finline-threshold=0 -fverbose-regalloc
+// a..m are all live across the call to g: five get callee-saved registers,
+// the caller-saved ones left are stored around the call, and the rest stay
+// in memory
+int g(int x) { return x + 1; }
+
+int f(int p) {
+    int a = p + 1; int b = p + 2; int c = p + 3; int d = p + 4;
+    int e = p + 5; int h = p + 6; int i = p + 7; int j = p + 8;
+    int k = p + 9; int l = p + 10; int m = p + 11; int n = p + 12;
+    int q = p + 13; int r = p + 14;
+    int s = g(p);
+    return s + a + b + c + d + e + h + i + j + k + l + m + n + q + r;
+}
+
+int main() { return f(0) - 100; }
@@ -0,0 +1,4 @@
+// FLAGS: --dump-ir-after=inline -fstats
+// the IR after inlining each function, then what every pass changed
+int twice(int x) { return x + x; }
+int main() { return twice(3) * 4; }
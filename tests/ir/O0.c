@@ -0,0 +1,5 @@
+// FLAGS: -O0
+int main() {
+    int x = 6 * 7;
+    return x - 2 * 3;
+}
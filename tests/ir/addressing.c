@@ -0,0 +1,9 @@
+// loads and stores of int elements take their address in one operand
+int get(int *a, int i) { return *(a + i); }
+int put(int *a, int i, int v) { *(a + i) = v; return 0; }
+// the displacement folds in too
+int next(int *a, int i) { return *(a + i + 2); }
+// i * 8 is also returned, so it is computed once and only the add folds
+int shared(int *a, int i) { return *(a + i) + i * 8; }
+// a byte load is left alone
+int byte(char *s, int i) { return *(s + i); }
@@ -0,0 +1,3 @@
+int g = 5;
+int twice(int x) { return x + x; }
+int main() { return twice(g) * 2 - 1; }
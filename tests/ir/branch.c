@@ -0,0 +1,5 @@
+int max(int a, int b) {
+    int m = b;
+    if (a > b) { m = a; }
+    return m;
+}
@@ -0,0 +1,6 @@
+int g;
+int f(int a, int b, int c) {
+    if (a && b || c) { g = 1; } else { g = 2; }
+    if (!a) { g = g + 4; }
+    return g;
+}
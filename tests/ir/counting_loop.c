@@ -0,0 +1,11 @@
+// FLAGS: -O0
+// a counting loop has exactly one phi, for its induction variable: n and
+// step are read in the loop but never assigned there, so the phis the
+// builder would place for them at the header merge one value and are
+// removed as the loop is built
+int count(int n) {
+    int step = 2;
+    int i = 0;
+    while (i < n) i = i + step;
+    return i;
+}
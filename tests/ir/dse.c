@@ -0,0 +1,7 @@
+// The first store to *(p + i) is overwritten before anything can read it,
+// and nothing reads the array b at all.
+int f(int *p, int i, int x) { *(p + i) = 0; *(p + i) = x; return 0; }
+int g() { int b[4]; b[1] = 3; b[2] = 4; return 7; }
+// the call in between may read *p, so both stores stay
+int use(int *q);
+int h(int *p, int x) { *p = 1; use(p); *p = x; return 0; }
@@ -0,0 +1,6 @@
+// 1.5 + 2.25 folds to 3.75; 0.0 / 0.0 is NaN and stays for run time, as
+// does anything computed from it, and inf - inf, which gives NaN
+int sum() { return (int)(1.5 + 2.25); }
+int nan() { return (int)(0.0 / 0.0); }
+int nanplus() { return (int)(0.0 / 0.0 + 1.0); }
+int infminusinf() { return (int)(100000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000.0 * 100000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000.0 - 100000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000.0 * 100000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000.0); }
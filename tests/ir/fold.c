@@ -0,0 +1,5 @@
+int main() {
+    int a = 6;
+    int b = a * 7;
+    return b - 0;
+}
@@ -0,0 +1,13 @@
+// FLAGS: -O2
+// The address of p[i] is computed in both arms; it is hoisted into entry,
+// while the loads stay in the arms. In sum, x * y is computed once.
+int pick(int *p, int i, int c) {
+    int r;
+    if (c) { r = p[i] + 1; } else { r = p[i] * 3; }
+    return r;
+}
+int sum(int x, int y) {
+    int s = x * y;
+    if (x > 0) { s = s + y * x; }
+    return s;
+}
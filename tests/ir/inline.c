@@ -0,0 +1,5 @@
+// sq is one block; its body replaces the call. abs has two returns, which
+// meet in a phi in the block after the call.
+int sq(int x) { return x * x; }
+int abs(int x) { if (x < 0) { return 0 - x; } return x; }
+int f(int a, int b) { return sq(a) + abs(b); }
@@ -0,0 +1,12 @@
+// g is loaded once in twice; in written, the store in between means the
+// second read is the stored value and the third, after the call, loads again.
+int g;
+int twice() { return g + g; }
+int bump(int x);
+int written() {
+    int a = g;
+    g = a + 1;
+    int b = g;
+    bump(b);
+    return a + b + g;
+}
@@ -0,0 +1,13 @@
+int add0(int x) { return x + 0; }
+int zeroadd(int x) { return 0 + x; }
+int sub0(int x) { return x - 0; }
+int subself(int x) { return x - x; }
+int mul1(int x) { return x * 1; }
+int mul0(int x) { return x * 0; }
+int div1(int x) { return x / 1; }
+int and0(int x) { return x & 0; }
+int or0(int x) { return x | 0; }
+int xorself(int x) { return x ^ x; }
+int shl0(int x) { return x << 0; }
+int index(char *p, int i) { return p[i]; }
+int main() { return subself(7) + 3; }
@@ -0,0 +1,14 @@
+int count(int n) {
+    int i;
+    int hits = 0;
+    for (i = 0; i < n; i = i + 1) {
+        switch (i) {
+        case 2:
+            continue;
+        case 3:
+            break;
+        }
+        hits = hits + 1;
+    }
+    return hits;
+}
@@ -0,0 +1,6 @@
+// The self tail call becomes a jump to a header whose phis take the
+// arguments in place of the params.
+int sum(int n, int acc) {
+    if (n == 0) { return acc; }
+    return sum(n - 1, acc + n);
+}
@@ -0,0 +1,7 @@
+// one function per identity: each returns its parameter, or a constant
+int notconst() { return ~5; }
+int lnotconst() { return !5 + !0; }
+int negneg(int x) { return -(-x); }
+int notnot(int x) { return ~~x; }
+int subneg(int x) { int n = 0 - x; return 0 - n; }
+int negtwice(int x) { int a = -x; int b = -a; return -(-b); }
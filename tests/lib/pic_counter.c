@@ -0,0 +1,6 @@
+// Defines a global and a function that t181 reaches from another object.
+int counter = 40;
+int bump(int x) {
+    counter = counter + x;
+    return counter;
+}
@@ -0,0 +1,13 @@
+# misaligned returns how far %rsp was from a multiple of 16 at the call that
+# reached it, which the System V ABI requires to be 0. The other names take
+# stack arguments, which it ignores, so that a caller pads for them.
+.text
+.globl misaligned
+.globl misaligned7
+.globl misaligned8
+misaligned:
+misaligned7:
+misaligned8:
+  lea 8(%rsp), %rax
+  and $15, %rax
+  ret
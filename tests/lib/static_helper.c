@@ -0,0 +1,7 @@
+// Linked into t122_static_linkage.c; see there.
+static int counter = 100;
+static int helper(int x) { return x * 2; }
+int lib_value(int x) {
+    counter = counter + 1;
+    return helper(x) + counter;
+}
@@ -0,0 +1,33 @@
+// EXPECT: EXIT 61
+// values merging at joins after branches, where copies from phis can share
+// a register with their sources
+int classify(int x, int lo, int hi) {
+    int r = 0;
+    int w = x;
+    if (x < lo) {
+        r = 1;
+        w = lo - x;
+    } else if (x > hi) {
+        r = 2;
+        w = x - hi;
+    } else {
+        w = x + lo;
+    }
+    int s = 0;
+    int i = 0;
+    while (i < w) {
+        if (i < r) { s = s + 2; } else { s = s + 1; }
+        i = i + 1;
+    }
+    return s + r * 10;
+}
+
+int main() {
+    int t = 0;
+    int x = 0;
+    while (x < 12) {
+        t = t + classify(x, 3, 8);
+        x = x + 1;
+    }
+    return t - 100;
+}
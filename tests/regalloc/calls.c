@@ -0,0 +1,14 @@
+// EXPECT: EXIT 48
+// FLAGS: -finline-threshold=0
+// many values live across calls, more than there are callee-saved
+// registers
+int twice(int x) { return x + x; }
+
+int f(int a, int b, int c, int d, int e, int g, int h) {
+    int x = twice(a);
+    int y = twice(b + x);
+    int z = twice(c + y);
+    return a + b + c + d + e + g + h + x + y + z - 12;
+}
+
+int main() { return f(1, 2, 3, 4, 5, 6, 7); }
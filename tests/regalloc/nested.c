@@ -0,0 +1,18 @@
+// EXPECT: EXIT 50
+// fourteen params read in a doubly nested loop: more values live at once
+// than there are registers
+int f(int a, int b, int c, int d, int e, int g, int h, int k, int m, int n, int o, int p, int q, int r) {
+    int s = 0;
+    int i = 0;
+    while (i < 3) {
+        int j = 0;
+        while (j < 4) {
+            s = s + a + b + c + d + e + g + h + k + m + n + o + p + q + r + i;
+            j = j + 1;
+        }
+        i = i + 1;
+    }
+    return s;
+}
+
+int main() { return f(1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1) - 130; }
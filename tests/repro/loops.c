@@ -0,0 +1,32 @@
+// Nested loops and a switch behind them give the linear scan many
+// intervals starting at the same block boundary, whose order used to
+// follow a map's and so change from run to run.
+int scale(int n, int k) {
+    int total = 0;
+    for (int i = 0; i < n; i = i + 1) {
+        int j = 0;
+        while (j < n) {
+            if (j == 1) { j = j + 1; continue; }
+            total = total + k;
+            j = j + 1;
+        }
+    }
+    return total;
+}
+int tail(int n, int s) {
+    int acc = 0;
+    for (int i = 0; i < n; i = i + 1) {
+        if (i == 2) continue;
+        acc = acc + i;
+    }
+    switch (n) {
+        case 5:
+            return acc + s;
+        default:
+            return s;
+    }
+}
+int main() {
+    // 3 * 2 * 4 = 24, then 0 + 1 + 3 + 4 + 55
+    return scale(3, 4) + tail(5, 55) - tail(1, 0);
+}
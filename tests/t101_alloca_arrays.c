@@ -0,0 +1,29 @@
+// EXPECT: EXIT 93
+// Local arrays and structs each take one frame region sized in bytes, and
+// survive the optimizer even when only some elements are ever touched.
+// tiny's frame is just its 256-byte array, as all its values are in
+// registers; it used to be one slot per element on top of a slot for every
+// value id ever issued.
+// ASM: sub $256, %rsp
+struct pair { int a; int b; };
+int tiny() {
+    int big[32];
+    big[5] = 2;
+    big[6] = 2;
+    // the first load is not known from the last store, so the array stays
+    return big[5] + big[6];
+}
+int fill(int n) {
+    int big[32];
+    char tag[5];
+    struct pair p;
+    for (int i = 0; i < 32; i = i + 1) big[i] = i * n;
+    tag[4] = 7;
+    p.b = big[31];
+    return p.b + tag[4];
+}
+int main() {
+    int a[3];
+    a[1] = fill(3);
+    return a[1] - 3 - tiny();
+}
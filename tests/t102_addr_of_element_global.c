@@ -0,0 +1,25 @@
+// EXPECT: EXIT 52
+// &a[i] and &global give pointers that writes go through.
+int counter = 5;
+char gbuf[4];
+int set(int *p, int v) { *p = v; return 0; }
+int setc(char *p, int v) { *p = v; return 0; }
+int bump(int *p) { *p = *p + 1; return *p; }
+int main() {
+    int a[4] = {1, 2, 3, 4};
+    char s[3];
+    set(&a[2], 30);
+    int *q = &a[1];
+    *q = 20;
+    setc(&s[1], 7);
+    setc(&gbuf[3], 9);
+    int *c = &counter;
+    bump(c);
+    bump(&counter);
+    static int calls;
+    bump(&calls);
+    int k = 3;
+    set(&a[k], a[k] + 1);
+    // 1 + 20 + 30 + 5 = 56, s[1] + gbuf[3] = 16, counter 7, calls 1
+    return a[0] + a[1] + a[2] + a[3] + s[1] + gbuf[3] + counter + calls - 28;
+}
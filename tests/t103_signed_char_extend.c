@@ -0,0 +1,22 @@
+// EXPECT: EXIT 59
+// A negative signed char compares below zero; narrowing wraps.
+// ASM: movsbq %al, %rax
+
+int is_negative(signed char c) {
+    if (c < 0) { return 1; }
+    return 0;
+}
+
+int main() {
+    signed char s = -1;
+    int r = 0;
+    if (s < 0) { r = r + 1; }
+    int n = 200;
+    signed char w = (signed char)n;
+    if (w < 0) { r = r + 2; }
+    if (w == -56) { r = r + 4; }
+    char c = n + 100;
+    r = r + c;
+    r = r + is_negative(w) * 8;
+    return r;
+}
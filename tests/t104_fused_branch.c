@@ -0,0 +1,19 @@
+// EXPECT: EXIT 46
+// Loop and if conditions compare and jump directly; only a stored
+// comparison is turned into a 0/1 value. The loop's body comes next, so
+// the loop leaves on the opposite comparison instead.
+// ASM: jge .Lmain.for.end
+// ASM: jge .Lmain.then
+// ASM: sete %al
+// ASM-NOT: setl
+// ASM-NOT: setge
+
+int main() {
+    int sum = 0;
+    for (int i = 0; i < 10; i = i + 1) {
+        if (i >= 8) { sum = sum + 1; }
+        sum = sum + i;
+    }
+    int eq = sum == 47;
+    return sum - eq;
+}
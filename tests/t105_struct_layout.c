@@ -0,0 +1,29 @@
+// EXPECT: EXIT 47
+// Fields are naturally aligned and read back through a struct pointer.
+struct Pair { char tag; int value; };
+struct Node { int v; struct Node *next; };
+
+int sum(struct Pair *p) {
+    return p->tag + p->value;
+}
+
+int bump(struct Pair *p) {
+    p->value = p->value + 1;
+    return 0;
+}
+
+int main() {
+    struct Pair a;
+    a.tag = 7;
+    a.value = 30;
+    bump(&a);
+    struct Pair *q = &a;
+    q->tag = q->tag + 1;
+    struct Node n;
+    struct Node m;
+    n.v = 2;
+    n.next = &m;
+    m.v = 6;
+    struct Node *np = &n;
+    return sum(&a) + np->next->v + sizeof(struct Pair) - 16 + np->v;
+}
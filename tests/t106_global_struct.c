@@ -0,0 +1,26 @@
+// EXPECT: EXIT 42
+// A global struct written in one function is seen by another.
+// ASM: .balign 8
+// ASM: .zero 24
+struct Point { int x; char tag; int y; };
+char pad;
+struct Point origin;
+
+int move(int dx, int dy) {
+    origin.x = origin.x + dx;
+    origin.y = origin.y + dy;
+    origin.tag = 'p';
+    return 0;
+}
+
+int total(struct Point *p) {
+    return p->x + p->y;
+}
+
+int main() {
+    pad = 1;
+    move(10, 20);
+    move(3, 9);
+    if (origin.tag != 'p') return 1;
+    return total(&origin);
+}
@@ -0,0 +1,20 @@
+// EXPECT: EXIT 42
+// Pointer globals initialized with addresses of globals and string literals.
+// ASM: .quad .Lstr
+// ASM: .quad table+16
+int x = 30;
+int table[4] = {1, 2, 9, 4};
+char *greeting = "hi!";
+int *px = &x;
+int *third = &table[2];
+int *last = table + 3;
+char *bang = "hi!" + 2;
+
+int main() {
+    if (greeting[0] != 'h') return 1;
+    if (greeting[1] != 'i') return 2;
+    if (*bang != '!') return 3;
+    *px = *px + 1;
+    if (x != 31) return 4;
+    return *px + *third + *last - 2;
+}
@@ -0,0 +1,6 @@
+// EXPECT: COMPILE-FAIL
+// A scalar's value is not an address constant.
+// DIAG: initializer element of p is not constant at 5:10
+int y = 3;
+int *p = y;
+int main() { return *p; }
@@ -0,0 +1,16 @@
+// EXPECT: EXIT 80
+// Arguments past the sixth are passed on the stack.
+int sum8(int a, int b, int c, int d, int e, int f, int g, int h) {
+    return a + b + c + d + e + f + g + h;
+}
+
+int pick7(int a, int b, int c, int d, int e, int f, char g) {
+    return g - a;
+}
+
+int main() {
+    int x = 3;
+    int s = sum8(1, 2, x, 4, 5, 6, 7, 8);
+    int t = sum8(s, 0, 0, 0, 0, 0, x * 2, s);
+    return t - s - s + pick7(1, 2, 3, 4, 5, 6, 80) - 5;
+}
@@ -0,0 +1,17 @@
+// EXPECT: EXIT 13
+// LINK: libc
+// STDOUT: a\b
+// STDOUT: say "hi"
+// ASM: .asciz "say \"hi\"\012"
+// ASM: .asciz "a\\b\012"
+// ASM: .asciz "ab\000cd"
+// ASM: .asciz "\001\0012\377"
+// ASM-NOT: .Lstr4:
+int printf(const char *fmt, ...);
+int strlen(const char *s);
+int greet() { return printf("say \"hi\"\n"); }
+int main() {
+    printf("a\\b\n");
+    greet();
+    return strlen("say \"hi\"\n") + strlen("ab\0cd") + strlen("\1\0012\xff") - 2;
+}
@@ -0,0 +1,23 @@
+// EXPECT: EXIT 136
+// DIAG-NOT: on one path
+// Pointers advanced around a loop reach the loop header through phis, which
+// keep their element sizes: c steps a byte at a time and n a whole int.
+int nums[4];
+int walk(char *c, int *n, int k) {
+    int t = 0;
+    int *last = 0;
+    int i;
+    for (i = 0; i < k; i = i + 1) {
+        t = t + c[0] + *(c + 1) + n[0];
+        c = c + 2;
+        last = n;
+        n = n + 1;
+    }
+    if (n - last != 1) return 1;
+    return t;
+}
+int main() {
+    int i;
+    for (i = 0; i < 4; i = i + 1) nums[i] = 10 * (i + 1);
+    return walk("\1\2\3\4\5\6\7\10", &nums[0], 4);
+}
@@ -0,0 +1,14 @@
+// EXPECT: EXIT 44
+// ASM: movzbq %al, %rax
+// ASM: movsbq %al, %rax
+// A value returned from a char function is converted to char, as gcc does:
+// 1 + 300 wraps to 45, and 100 + 100 in a signed char is -56.
+char f(int x) { return x + 300; }
+signed char g(int x) { return x + 100; }
+int main() {
+    if (f(1) != 45) return 1;
+    if (g(100) != -56) return 2;
+    if (g(100) + 56 != 0) return 3;
+    char c = f(0);
+    return c;
+}
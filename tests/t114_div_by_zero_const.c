@@ -0,0 +1,6 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: main:5:16: division by zero
+int main() {
+    int x = 5;
+    return x / 0;
+}
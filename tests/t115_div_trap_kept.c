@@ -0,0 +1,9 @@
+// EXPECT: EXIT 136
+// ASM: idiv
+// A division whose result is unused is still performed, since it may trap:
+// dividing by zero raises SIGFPE, which the shell reports as 128 + 8.
+int check(int a, int b) {
+    a / b;
+    return 7;
+}
+int main() { return check(7, 0); }
@@ -0,0 +1,24 @@
+// EXPECT: EXIT 6
+// FLAGS: -Wconstant-condition
+// DIAG: main:12:9: condition is always false
+// DIAG: main:13:12: condition is always false
+// DIAG: main:14:9: condition is always true
+// DIAG-NOT: main:16:
+// DIAG-NOT: main:20:
+// Conditions that fold to a constant are reported, apart from the literal
+// conditions of intentional infinite loops.
+int main() {
+    int n = 0;
+    if (0) n = 100;
+    while (1 == 2) n = n + 100;
+    if (3 > 2) n = n + 1;
+    for (;;) {
+        while (1) {
+            n = n + 2;
+            break;
+        }
+        if (n < 5) continue;
+        break;
+    }
+    return n + 1;
+}
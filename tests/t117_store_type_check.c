@@ -0,0 +1,22 @@
+// EXPECT: EXIT 42
+// Stores through pointers convert integers to the pointee type and accept a
+// pointer to the pointee type, a null constant, or a cast.
+struct N { int v; char *name; int *p; };
+int main() {
+    int x = 0;
+    char c = 0;
+    int *ip = &x;
+    char *cp = &c;
+    struct N n;
+    *cp = 300;
+    *ip = c;
+    n.name = 0;
+    n.name = cp;
+    n.p = (int *)cp;
+    n.p = ip;
+    n.v = *n.name;
+    if (n.v != 44) return 1;
+    if (x != 44) return 2;
+    *n.p = 42;
+    return x;
+}
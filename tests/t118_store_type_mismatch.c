@@ -0,0 +1,9 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: main:7:14: type error: cannot store int* into char*
+struct N { char *name; };
+int main() {
+    int x = 0;
+    struct N n;
+    n.name = &x;
+    return x;
+}
@@ -0,0 +1,8 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: main:6:11: type error: cannot store char* into int
+int main() {
+    int x = 0;
+    int *ip = &x;
+    *ip = "a";
+    return x;
+}
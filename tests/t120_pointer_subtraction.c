@@ -0,0 +1,19 @@
+// EXPECT: EXIT 42
+// Subtracting pointers to the same type counts elements between them, a
+// global pointer's type included.
+int nums[8];
+int *gp;
+int span(int *p, int *q) { return q - p; }
+int bytes(char *p, char *q) { return q - p; }
+int main() {
+    char *s = "abcdef";
+    int *p = &nums[1];
+    int *q = &nums[6];
+    if (span(p, q) != 5) return 1;
+    if (span(q, p) != -5) return 2;
+    if (bytes(s, s + 5) != 5) return 3;
+    if (q - p + (p - q) != 0) return 4;
+    gp = &nums[2];
+    if (q - gp != 4) return 5;
+    return span(&nums[0], &nums[6]) * 7;
+}
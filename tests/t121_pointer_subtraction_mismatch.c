@@ -0,0 +1,7 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: main:6:12: type error: cannot subtract char* from int*
+int main() {
+    int x = 0;
+    char *s = "abc";
+    return &x - s;
+}
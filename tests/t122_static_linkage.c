@@ -0,0 +1,14 @@
+// EXPECT: EXIT 42
+// WITH: lib/static_helper.c
+// ASM-NOT: .globl helper
+// ASM-NOT: .globl counter
+// Each file has its own static helper and counter. They stay local to their
+// objects, so linking the two resolves every use within its own file.
+static int counter = 1;
+static int helper(int x) { return x + 1; }
+int lib_value(int x);
+int main() {
+    counter = counter + 1;
+    // lib_value(5) is 5 * 2 + 101, and helper(counter) here is 2 + 1
+    return lib_value(5) - helper(counter) - 66;
+}
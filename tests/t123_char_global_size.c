@@ -0,0 +1,18 @@
+// EXPECT: EXIT 42
+// ASM: .byte 7
+// ASM: .balign 8
+// A char global takes one byte next to an int global, which stays aligned.
+char c = 7;
+int n = 1000;
+char d;
+int main() {
+    if (c != 7) return 1;
+    c = 300;
+    d = c + 1;
+    if (c != 44) return 2;
+    if (d != 45) return 3;
+    if (n != 1000) return 4;
+    n = n - 958;
+    if (c != 44 || d != 45) return 5;
+    return n;
+}
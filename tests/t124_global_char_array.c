@@ -0,0 +1,17 @@
+// EXPECT: EXIT 42
+// ASM-NOT: .zero 256
+// A global char array is written and read a byte at a time, without
+// touching the global that follows it.
+char buf[32];
+int after = 7;
+int main() {
+    int i;
+    for (i = 0; i < 32; i = i + 1) buf[i] = i + 'a';
+    for (i = 0; i < 32; i = i + 1) {
+        if (buf[i] != i + 'a') return 1;
+    }
+    buf[31] = 300;
+    if (buf[31] != 44) return 2;
+    if (buf[30] != 30 + 'a') return 3;
+    return after * 6;
+}
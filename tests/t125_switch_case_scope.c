@@ -0,0 +1,24 @@
+// EXPECT: EXIT 42
+// Each case body is a scope of its own: two cases may declare the same name,
+// and falling through starts the next case's variables afresh.
+int pick(int k) {
+    int r = 0;
+    switch (k) {
+    case 1:
+        int v = 10;
+        r = r + v;
+    case 2:
+        int v = 30;
+        r = r + v;
+        break;
+    default:
+        int v = 2;
+        r = v;
+    }
+    return r;
+}
+int main() {
+    if (pick(2) != 30) return 1;
+    if (pick(7) != 2) return 2;
+    return pick(1) + pick(7);
+}
@@ -0,0 +1,13 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: f:9:16: undefined variable tmp
+// A case's locals are not in scope in the case it falls through to.
+int f(int k) {
+    switch (k) {
+    case 1:
+        int tmp = 5;
+    case 2:
+        return tmp;
+    }
+    return 0;
+}
+int main() { return f(1); }
@@ -0,0 +1,57 @@
+// EXPECT: EXIT 42
+// continue inside a switch goes to the enclosing loop's next iteration,
+// while break only leaves the switch.
+int in_for(int n) {
+    int i;
+    int skipped = 0;
+    int rest = 0;
+    for (i = 0; i < n; i = i + 1) {
+        switch (i & 3) {
+        case 0:
+            skipped = skipped + 1;
+            continue;
+        case 1:
+            break;
+        default:
+            rest = rest + 1;
+        }
+        rest = rest + 10;
+    }
+    return skipped * 100 + rest;
+}
+int in_while(int n) {
+    int i = 0;
+    int skipped = 0;
+    while (i < n) {
+        i = i + 1;
+        switch (i) {
+        case 2:
+        case 4:
+            skipped = skipped + 1;
+            continue;
+        }
+        skipped = skipped + 100;
+    }
+    return skipped;
+}
+int in_do(int n) {
+    int i = 0;
+    int hits = 0;
+    do {
+        i = i + 1;
+        switch (i & 1) {
+        case 1:
+            continue;
+        }
+        hits = hits + 1;
+    } while (i < n);
+    return hits;
+}
+int main() {
+    // i = 0..9: 0, 4, 8 continue; the other seven add 10, and 2, 3, 6, 7
+    // one more in the default case
+    if (in_for(10) != 300 + 7 * 10 + 4) return 1;
+    if (in_while(5) != 2 + 300) return 2;
+    if (in_do(9) != 4) return 3;
+    return 42;
+}
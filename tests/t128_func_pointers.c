@@ -0,0 +1,19 @@
+// EXPECT: EXIT 37
+// ASM: call *%r11
+int add(int a, int b) { return a + b; }
+int sub(int a, int b) { return a - b; }
+int apply(int x) { return x * 2; }
+int main() {
+    int (*ops[2])(int, int) = { add, &sub };
+    int (*fp)(int) = apply;
+    int r = 0;
+    int i;
+    for (i = 0; i < 2; i = i + 1) {
+        r = r + ops[i](10, 3);
+    }
+    ops[1] = add;
+    ops[1](1, 1);
+    r = r + (*fp)(5) + fp(1);
+    fp = &apply;
+    return r + (*ops[1])(2, 3) + fp(0);
+}
@@ -0,0 +1,6 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: called object of type int is not a function pointer
+int main() {
+    int n = 3;
+    return n(1);
+}
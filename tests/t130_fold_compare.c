@@ -0,0 +1,5 @@
+// EXPECT: EXIT 1
+// ASM: mov $1, %rax
+// ASM-NOT: cmp
+// ASM-NOT: setl
+int main() { return 3 < 5; }
@@ -0,0 +1,8 @@
+// EXPECT: EXIT 27
+// ASM: mov $27, %rax
+// ASM-NOT: cmp
+// ASM-NOT: set
+int main() {
+    int x = -1;
+    return (3 < 5) + (5 <= 5) * 2 + (2 > 7) * 4 + (x >= -2) * 8 + (4 == 4) * 16 + (4 != 4) * 32;
+}
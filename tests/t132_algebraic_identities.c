@@ -0,0 +1,5 @@
+// EXPECT: EXIT 24
+int f(int x, int y) {
+    return (x + 0) * 1 + (y - y) + (x ^ x) + (y | 0) + (x & 0) + (x * 0) + (y / 1) + (x << 0);
+}
+int main() { return f(5, 7); }
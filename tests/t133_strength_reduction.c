@@ -0,0 +1,18 @@
+// EXPECT: EXIT 26
+// ASM: shl $2
+// ASM: sar $2
+// ASM-NOT: imul
+// ASM-NOT: idiv
+int main() {
+    int a[8];
+    int i;
+    int s = 0;
+    for (i = 0; i < 8; i = i + 1) {
+        a[i] = i * 4 - 9;
+    }
+    // negative quotients must round toward zero, as idiv does
+    for (i = 0; i < 8; i = i + 1) {
+        s = s + a[i] / 4 + a[i] / 2;
+    }
+    return s;
+}
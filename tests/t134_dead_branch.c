@@ -0,0 +1,18 @@
+// EXPECT: EXIT 7
+// ASM-NOT: 12345
+// ASM-NOT: while
+// ASM-NOT: .Lf.then_1:
+int f(int x) {
+    if (0) {
+        x = x * 12345;
+        x = x + 12345;
+        while (x > 0) { x = x - 12345; }
+    }
+    if (3 < 5) {
+        x = x + 2;
+    } else {
+        x = x - 12345;
+    }
+    return x;
+}
+int main() { return f(5); }
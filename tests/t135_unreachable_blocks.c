@@ -0,0 +1,19 @@
+// EXPECT: EXIT 3
+// ASM-NOT: for.post
+// ASM-NOT: .Lf.endif
+// ASM-NOT: while.end
+// the step reads i, though nothing reaches it: the body always returns
+int f(int n) {
+    int i;
+    for (i = 0; i < n; i = i + 1) {
+        if (n > 3) { return 1; } else { return 2; }
+    }
+    return 0;
+}
+int g(int n) {
+    while (1) {
+        if (n) { return n; }
+        return 0;
+    }
+}
+int main() { return f(5) + f(0) + g(2); }
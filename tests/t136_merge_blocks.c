@@ -0,0 +1,12 @@
+// EXPECT: EXIT 10
+// ASM-NOT: do.body_2:
+// ASM-NOT: do.cond_3:
+int main() {
+    int i = 0;
+    int s = 0;
+    do {
+        s = s + i;
+        i = i + 1;
+    } while (i < 5);
+    return s;
+}
@@ -0,0 +1,18 @@
+// EXPECT: EXIT 25
+// ASM-NOT: log.end
+// ASM-NOT: _to_
+int calls;
+int bump(int v) { calls = calls + 1; return v; }
+int f(int a, int b, int c) {
+    int r = 0;
+    if (a && b || c) { r = 1; }
+    if (!(a || b)) { r = r + 2; }
+    return r;
+}
+int main() {
+    int n = 0;
+    // the right operand is evaluated only when the left does not decide
+    if (bump(0) && bump(1)) { n = 100; }
+    if (bump(1) || bump(1)) { n = n + 1; }
+    return f(1, 1, 0) * 16 + f(0, 0, 0) * 4 + f(1, 0, 1) + calls * 4 + n - 9;
+}
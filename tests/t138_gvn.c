@@ -0,0 +1,26 @@
+// EXPECT: EXIT 1
+// FLAGS: -O2
+int g = 3;
+int pick(int *p, int i, int c) {
+    int r;
+    if (c) { r = p[i] + 1; } else { r = p[i] - 1; }
+    return r;
+}
+// the second load of g follows a store, so it must not reuse the first
+int reload() {
+    int a = g + 1;
+    g = 10;
+    int b = g + 1;
+    return a + b;
+}
+// n * n is computed once, in the block dominating the if
+int squares(int n) {
+    int s = n * n;
+    if (n > 2) { s = s + n * n; }
+    return s;
+}
+int main() {
+    int a[4];
+    a[0] = 1; a[1] = 5; a[2] = 9; a[3] = 2;
+    return pick(&a[0], 2, 1) + pick(&a[0], 1, 0) + reload() - squares(4) + squares(2);
+}
@@ -0,0 +1,23 @@
+// EXPECT: EXIT 26
+// ASM-NOT: call sq
+// ASM-NOT: call clamp
+// ASM: call fact
+int g;
+int sq(int x) { return x * x; }
+int clamp(int x) {
+    if (x < 0) { return 0; }
+    if (x > 9) { return 9; }
+    return x;
+}
+// falls off its end
+int bump(int n) { g = g + n; }
+// recursive, so never inlined
+int fact(int n) { if (n < 2) { return 1; } return n * fact(n - 1); }
+int main() {
+    int i;
+    int s = 0;
+    for (i = 0; i < 4; i = i + 1) { s = s + sq(i) + clamp(i * 5 - 3); }
+    bump(3);
+    bump(4);
+    return s - fact(3) + g - 7;
+}
@@ -0,0 +1,5 @@
+// EXPECT: EXIT 9
+// FLAGS: -finline-threshold=0
+// ASM: call sq
+int sq(int x) { return x * x; }
+int main() { return sq(3); }
@@ -0,0 +1,17 @@
+// EXPECT: EXIT 32
+// ASM: jmp .Lsum.tail.head
+// ASM: jmp .Lgcd.tail.head
+// A million frames would overflow the stack; as a loop it runs in one.
+int sum(int n, int acc) {
+    if (n == 0) { return acc; }
+    return sum(n - 1, acc + n);
+}
+int gcd(int a, int b) {
+    if (b == 0) { return a; }
+    if (a < b) { return gcd(b, a); }
+    return gcd(a - b, b);
+}
+int main() {
+    // 500000500000 is 32 modulo 256
+    return sum(1000000, 0) - 500000500000 + gcd(96, 36) + 20;
+}
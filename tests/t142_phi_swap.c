@@ -0,0 +1,11 @@
+// EXPECT: EXIT 21
+// The loop's phis swap a and b: their copies on the back edge happen at
+// once, so one old value is saved before it is overwritten.
+int main() {
+    int a = 1;
+    int b = 2;
+    int i;
+    int t;
+    for (i = 0; i < 3; i = i + 1) { t = a; a = b; b = t; }
+    return a * 10 + b;
+}
@@ -0,0 +1,24 @@
+// EXPECT: EXIT 40
+// ASM-NOT: $77
+// ASM-NOT: $55
+// ASM: $66
+int set(int *p, int x) {
+    *p = 77;
+    *p = x;
+    return 0;
+}
+int scratch() {
+    int t[2];
+    t[0] = 55;
+    t[1] = 55;
+    return 1;
+}
+int main() {
+    int a[2];
+    a[0] = 66;
+    // the call may read a[0], so the store before it stays
+    set(&a[0], a[0] - 30);
+    a[1] = 3;
+    a[1] = 4;
+    return a[0] + a[1] - scratch() + 1;
+}
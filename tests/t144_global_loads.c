@@ -0,0 +1,16 @@
+// EXPECT: EXIT 41
+// Repeated reads of a global share one load, but never across a write to
+// it, whether direct, through a pointer, or by a call.
+int g = 5;
+int h = 1;
+int setg(int x) { g = x; return 0; }
+int main() {
+    int *p = &g;
+    int a = g + g;
+    *p = 7;
+    int b = g + h;
+    setg(9);
+    int c = g + g;
+    h = g;
+    return a + b + c + h - 4;
+}
@@ -0,0 +1,14 @@
+// EXPECT: EXIT 47
+// keep is computed before the loop and only used after it, so its register
+// must survive every iteration; step is only read on the way round.
+int main() {
+    int keep = 40;
+    int step = 3;
+    int s = 0;
+    int i = 0;
+    while (i < 5) {
+        s = s + i;
+        i = i + step - 2;
+    }
+    return keep + s + step - 6;
+}
@@ -0,0 +1,10 @@
+// EXPECT: EXIT 36
+// FLAGS: -O0
+// ASM: imul $7
+// ASM: imul $3
+// ASM-NOT: $36
+// -O0 runs no passes, so the arithmetic is done at run time
+int main() {
+    int x = 6 * 7;
+    return x - 2 * 3;
+}
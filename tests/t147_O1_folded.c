@@ -0,0 +1,8 @@
+// EXPECT: EXIT 36
+// ASM: mov $36, %rax
+// ASM-NOT: imul
+// the same as t146, at the default -O1, which folds it all away
+int main() {
+    int x = 6 * 7;
+    return x - 2 * 3;
+}
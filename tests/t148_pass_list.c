@@ -0,0 +1,8 @@
+// EXPECT: EXIT 38
+// FLAGS: -fpass=const-fold,dce
+// ASM: call f
+// ASM: imul $8
+// ASM: $6
+// only the passes named run: no inlining, and no strength reduction
+int f(int x) { return x * 8 + 2 * 3; }
+int main() { return f(4); }
@@ -0,0 +1,8 @@
+// EXPECT: EXIT 38
+// FLAGS: -fno-inline -fno-strength
+// ASM: call f
+// ASM: imul $8
+// ASM: $6
+// the rest of the -O1 pipeline still runs, folding 2 * 3
+int f(int x) { return x * 8 + 2 * 3; }
+int main() { return f(4); }
@@ -0,0 +1,4 @@
+// EXPECT: COMPILE-FAIL
+// FLAGS: -fno-nope
+// DIAG: unknown pass "nope"
+int main() { return 0; }
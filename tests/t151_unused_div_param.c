@@ -0,0 +1,8 @@
+// EXPECT: EXIT 3
+// ASM: idiv
+// q is never read, but dividing by a parameter may trap, so it stays
+int f(int n, int d) {
+    int q = n / d;
+    return 3;
+}
+int main() { return f(12, 4); }
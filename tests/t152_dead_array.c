@@ -0,0 +1,17 @@
+// EXPECT: EXIT 45
+// ASM-NOT: $100
+// dead is written but never read: its stores go, and live, next to it in
+// the frame, must keep its own contents
+int fill(int k) {
+    int dead[4];
+    int live[4];
+    int i;
+    int s = 0;
+    for (i = 0; i < 4; i = i + 1) {
+        live[i] = k + i;
+        dead[i] = 100;
+    }
+    for (i = 0; i < 4; i = i + 1) { s = s + live[i]; }
+    return s;
+}
+int main() { return fill(3) + fill(5) + 1; }
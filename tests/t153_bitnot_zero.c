@@ -0,0 +1,5 @@
+// EXPECT: EXIT 255
+// ASM: mov $-1, %rax
+// ASM-NOT: not
+// ~0 folds to -1, which the shell sees as 255
+int main() { return ~0; }
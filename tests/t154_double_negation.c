@@ -0,0 +1,6 @@
+// EXPECT: EXIT 17
+// ASM-NOT: not
+// ASM-NOT: neg
+// ~~x and -(-x) are x, as a bit trick from a macro might leave them
+int f(int x) { return ~~x + -(-x) - (0 - (0 - x)); }
+int main() { return f(17); }
@@ -0,0 +1,50 @@
+// EXPECT: EXIT 20
+// ASM: cmp $32, %rax
+// ASM: jmp *(%rcx,%rax,8)
+// ASM: .quad .Lsel.case.31_
+// ASM-NOT: cmp $17
+// 32 dense cases dispatch through a table with one bounds check, rather
+// than comparing against each value in turn
+int sel(int x) {
+    switch (x) {
+    case 0: return 1;
+    case 1: return 4;
+    case 2: return 7;
+    case 3: return 10;
+    case 4: return 13;
+    case 5: return 16;
+    case 6: return 19;
+    case 7: return 22;
+    case 8: return 25;
+    case 9: return 28;
+    case 10: return 31;
+    case 11: return 34;
+    case 12: return 37;
+    case 13: return 40;
+    case 14: return 43;
+    case 15: return 46;
+    case 16: return 49;
+    case 17: return 52;
+    case 18: return 55;
+    case 19: return 58;
+    case 20: return 61;
+    case 21: return 64;
+    case 22: return 67;
+    case 23: return 70;
+    case 24: return 73;
+    case 25: return 76;
+    case 26: return 79;
+    case 27: return 82;
+    case 28: return 85;
+    case 29: return 88;
+    case 30: return 91;
+    case 31: return 94;
+    default: return 1000;
+    }
+}
+int main() {
+    int i;
+    int s = 0;
+    for (i = -2; i < 35; i = i + 1) { s = s + sel(i); }
+    return s - 6500;
+}
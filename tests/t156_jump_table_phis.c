@@ -0,0 +1,31 @@
+// EXPECT: EXIT 158
+// ASM: jmp *(%rcx,%rax,8)
+// ASM: sub $-3, %rax
+// cases from -3 with holes, which go to the default, grouped values, a
+// fallthrough and break, and a variable each case sets that is read after
+// the switch, so that the table's targets need phis
+int pick(int x) {
+    int r = 0;
+    switch (x) {
+    case -3: r = 1; break;
+    case -2: case -1: r = 2; break;
+    case 1: r = 3;
+    case 2: r = r + 4; break;
+    case 4: r = 5; break;
+    default: r = 9;
+    }
+    return r * 2 + x;
+}
+int main() {
+    int i;
+    int s = 0;
+    for (i = -5; i < 7; i = i + 1) { s = s + pick(i); }
+    // a constant value picks its case at compile time
+    switch (3) {
+    case 0: s = s + 100; break;
+    case 1: s = s + 200; break;
+    case 2: s = s + 300; break;
+    case 3: s = s + 2; break;
+    }
+    return s;
+}
@@ -0,0 +1,14 @@
+// EXPECT: EXIT 6
+// ASM-NOT: jmp *
+// ASM: cmp $1000
+// values too far apart for a table keep the compare chain
+int f(int x) {
+    switch (x) {
+    case 1: return 1;
+    case 10: return 2;
+    case 100: return 3;
+    case 1000: return 4;
+    }
+    return 0;
+}
+int main() { return f(1) + f(1000) + f(100) - f(10) + f(5); }
@@ -0,0 +1,24 @@
+// EXPECT: EXIT 150
+// ASM: ,8), %
+// ASM-NOT: shl $3
+// the element address a + i*8 is one operand of the load and the store,
+// rather than a shift and an add before each
+int sum(int *a, int n) {
+    int s = 0;
+    int i = 0;
+    while (i < n) {
+        s = s + *(a + i);
+        i = i + 1;
+    }
+    return s;
+}
+
+int main() {
+    int a[5];
+    int i = 0;
+    while (i < 5) {
+        *(&a[0] + i) = (i + 1) * 10;
+        i = i + 1;
+    }
+    return sum(&a[0], 5);
+}
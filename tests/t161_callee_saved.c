@@ -0,0 +1,19 @@
+// EXPECT: EXIT 55
+// FLAGS: -finline-threshold=0
+// ASM: push %rbx
+// ASM: pop %rbx
+// ASM-NOT: (%rbp), %rbx
+// s and i are live across the call in the loop body, so they stay in
+// callee-saved registers, saved once in the prologue, rather than going
+// through the stack every iteration
+int id(int x) { return x; }
+
+int main() {
+    int s = 0;
+    int i = 1;
+    while (i <= 10) {
+        s = s + id(i);
+        i = i + 1;
+    }
+    return s;
+}
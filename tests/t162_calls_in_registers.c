@@ -0,0 +1,14 @@
+// EXPECT: EXIT 84
+// FLAGS: -finline-threshold=0
+// ASM-NOT: (%rbp)
+// a, b and x are live across the calls after them; they sit in callee-saved
+// registers throughout, so nothing is stored to or loaded from the frame
+int twice(int x) { return x + x; }
+
+int f(int a, int b) {
+    int x = twice(a);
+    int y = twice(b);
+    return a + b + x + y;
+}
+
+int main() { return f(10, 18); }
@@ -0,0 +1,16 @@
+// EXPECT: EXIT 44
+// FLAGS: -finline-threshold=0
+// ASM: mov %rdx, -48(%rbp)
+// ASM: mov -48(%rbp), %rdx
+// seven params are live across both calls, two more than there are
+// callee-saved registers: the other two keep caller-saved registers, which
+// are saved to their slots around each call rather than living there
+int twice(int x) { return x + x; }
+
+int f(int a, int b, int c, int d, int e, int g, int h) {
+    int x = twice(a);
+    int y = twice(h);
+    return a + b + c + d + e + g + h + x + y;
+}
+
+int main() { return f(1, 2, 3, 4, 5, 6, 7); }
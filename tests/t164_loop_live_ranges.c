@@ -0,0 +1,24 @@
+// EXPECT: EXIT 150
+// FLAGS: -finline-threshold=0
+// k is defined before the loop and read on every iteration, and t is a
+// temporary inside it; the join after the if reads d, defined in its then
+// block. Each stays live across the back edge or the join, so none may share
+// a register with a value live at the same time
+int step(int x) { return x; }
+
+int sum(int k, int n) {
+    int s = 0;
+    int i = 0;
+    while (i < n) {
+        int t = i * k;
+        s = s + t;
+        i = i + 1;
+    }
+    int d = 0;
+    if (s > 100) {
+        d = step(15);
+    }
+    return s + d;
+}
+
+int main() { return sum(3, 10); }
@@ -0,0 +1,17 @@
+// EXPECT: EXIT 68
+// ASM: sub $32, %rsp
+// ASM-NOT: sub $48, %rsp
+// mix's values all fit in registers, so its frame is only the 32 bytes of
+// a; a slot per value would make it several times that
+int mix(int x, int y) {
+    int a[4];
+    int p = x + y;
+    int q = x - y;
+    int r = p * q;
+    int s = r + p + q;
+    *(&a[0] + 1) = s;
+    *(&a[0] + 2) = r;
+    return *(&a[0] + 1) - *(&a[0] + 2) + p + q;
+}
+
+int main() { return mix(17, 6); }
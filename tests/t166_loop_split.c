@@ -0,0 +1,21 @@
+// EXPECT: EXIT 53
+// ASM-NOT: cmp -
+// Fourteen temporaries live at once before the loop push a and n out of
+// registers, but the loop has registers to spare: both are split into
+// registers for it, loaded on the jump in, so neither the condition nor the
+// body reads memory on each iteration.
+int f(int a, int n) {
+    int t1 = a + 1; int t2 = a + 2; int t3 = a + 3; int t4 = a + 4;
+    int t5 = a + 5; int t6 = a + 6; int t7 = a + 7; int t8 = a + 8;
+    int t9 = a + 9; int t10 = a + 10; int t11 = a + 11; int t12 = a + 12;
+    int t13 = a + 13; int t14 = a + 14;
+    int u = t14 + t13 + t12 + t11 + t10 + t9 + t8 + t7 + t6 + t5 + t4 + t3 + t2 + t1;
+    int s = 0;
+    int i = 0;
+    while (i < n) {
+        s = s + a * i;
+        i = i + 1;
+    }
+    return s + u;
+}
+int main() { return f(2, 5) - 100; }
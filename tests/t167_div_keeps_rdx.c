@@ -0,0 +1,12 @@
+// EXPECT: EXIT 45
+// FLAGS: -finline-threshold=0
+// a, k and m are live across the division, whose idiv overwrites %rdx with the
+// remainder, so none may be given %rdx
+int f(int a, int b) {
+    int k = a + 1;
+    int m = b + 2;
+    int q = a / b;
+    return k + m + q + a;
+}
+
+int main() { return f(17, 3); }
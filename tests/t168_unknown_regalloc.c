@@ -0,0 +1,4 @@
+// EXPECT: COMPILE-FAIL
+// FLAGS: -fregalloc=greedy
+// DIAG: unknown register allocator "greedy" (known: linear, color)
+int main() { return 0; }
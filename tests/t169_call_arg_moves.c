@@ -0,0 +1,19 @@
+// EXPECT: EXIT 25
+// FLAGS: -finline-threshold=0 -fregalloc=color
+// ASM: mov %rsi, %rax
+// ASM: mov %rax, %r8
+// the seven values die at the call, so they may be given the registers the
+// arguments go to, out of order: here the value in %rsi goes to %r8 while
+// the one in %r8 goes to %rsi, a cycle broken through %rax, and each other
+// arg register is read before it is overwritten
+int pick(int a, int b, int c, int d, int e, int f, int g) {
+    return a + 2 * b + 3 * c + 4 * d + 5 * e + 6 * f + 7 * g;
+}
+
+int mix(int p) {
+    int a = p + 1; int b = p + 2; int c = p + 3; int d = p + 4;
+    int e = p + 5; int f = p + 6; int g = p + 7;
+    return pick(f, g, a, b, c, d, e);
+}
+
+int main() { return mix(0) - 80; }
@@ -0,0 +1,18 @@
+// EXPECT: EXIT 20
+// ASM: movzbq (%rcx)
+// ASM: movb %al, (%rcx)
+// copies a string into a char array a byte at a time, then sums the bytes
+// back out of the array: "hello" adds up to 532, which exits as 20
+int main() {
+    char buf[16];
+    char *s = "hello";
+    int i = 0;
+    while (*(s + i) != 0) {
+        buf[i] = *(s + i);
+        i = i + 1;
+    }
+    buf[i] = 0;
+    int sum = 0;
+    for (int j = 0; buf[j] != 0; j = j + 1) sum = sum + buf[j];
+    return sum;
+}
@@ -0,0 +1,6 @@
+// EXPECT: EXIT 42
+// FLAGS: -O0
+// ASM: not %rax
+// unfolded, ~x is a not: ~(-43) is 42, and ~~x is x again
+int flip(int x) { return ~x; }
+int main() { return flip(-43) + ~~flip(0) + 1; }
@@ -0,0 +1,13 @@
+// EXPECT: EXIT 0
+// LINK: libc
+// STDOUT: hello, world
+// ASM: .section .rodata
+// ASM: .asciz "hello, world"
+// ASM-NOT: .globl .Lstr
+// the literal is read-only data local to the module, passed to puts by
+// its address
+int puts(const char *s);
+int main() {
+    puts("hello, world");
+    return 0;
+}
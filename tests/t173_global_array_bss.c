@@ -0,0 +1,17 @@
+// EXPECT: EXIT 42
+// ASM: .bss
+// ASM: .zero 8000
+// table takes all 8000 bytes, in .bss as it has no initializer, so writing
+// its last element leaves guard, right after it, and the scalars alone
+int before = 7;
+int table[1000];
+int guard[2];
+int after = 35;
+int main() {
+    table[999] = 1000;
+    table[0] = 1;
+    if (guard[0] != 0) return 1;
+    guard[0] = 5;
+    if (table[999] != 1000) return 2;
+    return before + after;
+}
@@ -0,0 +1,20 @@
+// EXPECT: EXIT 42
+// ASM: .byte 7
+// ASM: .quad 1000
+// ASM: .quad c
+// ASM: .zero 1
+// ASM-NOT: .quad 0
+// each initialized global takes the directive of its size, aligned to it;
+// the zero ones, z, zn and the null pointer, are room in .bss instead
+char c = 7;
+int n = 1000;
+char *p = &c;
+char z;
+int zn = 0;
+char *np = 0;
+int main() {
+    if (*p != 7 || z != 0 || zn != 0 || np != 0) return 1;
+    z = 1;
+    zn = 2;
+    return n / 25 + z + zn - 1;
+}
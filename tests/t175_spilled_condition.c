@@ -0,0 +1,15 @@
+// EXPECT: EXIT 106
+// ASM: cmpq $0, -
+// the conditions a and o are plain values left in memory, so each branch
+// compares a slot with an immediate, where only the suffix gives the width
+int f(int p) {
+    int a = p + 1; int b = p + 2; int c = p + 3; int d = p + 4;
+    int e = p + 5; int g = p + 6; int h = p + 7; int i = p + 8;
+    int j = p + 9; int k = p + 10; int l = p + 11; int m = p + 12;
+    int n = p + 13; int o = p + 14;
+    int t = 0;
+    if (a) t = 1;
+    while (b) { b = b - 1; if (o) t = t + 1; }
+    return t + a + b + c + d + e + g + h + i + j + k + l + m + n + o;
+}
+int main() { return f(0); }
@@ -0,0 +1,7 @@
+// EXPECT: EXIT 42
+// FLAGS: -finline-threshold=0
+// ASM: imul $10, %
+// a multiply by a constant is imul's three-operand form, which the
+// assembler takes: immediate, the register x is in, the product's register
+int f(int x) { return x * 10; }
+int main() { return f(4) + 2; }
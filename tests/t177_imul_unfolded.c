@@ -0,0 +1,9 @@
+// EXPECT: EXIT 42
+// FLAGS: -O0
+// ASM: imul $10, %
+// with no optimization, 4 * 10 is multiplied at run time, the constant 4 in a
+// register and 10 the immediate
+int main() {
+    int x = 4;
+    return x * 10 + 2;
+}
@@ -0,0 +1,26 @@
+// EXPECT: EXIT 42
+// FLAGS: -finline-threshold=0
+// WITH: lib/stack_align.s
+// %rsp is 16-byte aligned at every call: from a function with no frame,
+// one pushing an odd number of callee-saved registers, and around one and
+// two stack arguments, where only the odd one needs padding
+int misaligned();
+int misaligned7(int a, int b, int c, int d, int e, int f, int g);
+int misaligned8(int a, int b, int c, int d, int e, int f, int g, int h);
+
+int leaf() { return misaligned(); }
+
+int saves(int x) {
+    int y = x + 1;
+    int m = misaligned();
+    return m + misaligned() + y - x - 1;
+}
+
+int args(int x) {
+    return misaligned7(x, x, x, x, x, x, x) + misaligned8(x, x, x, x, x, x, x, x);
+}
+
+int main() {
+    int bad = leaf() + saves(3) + args(5) + misaligned7(1, 2, 3, 4, 5, 6, 7);
+    return bad + 42;
+}
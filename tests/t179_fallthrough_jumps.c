@@ -0,0 +1,18 @@
+// EXPECT: EXIT 42
+// ASM: jge .Lmain.while.end
+// ASM: jmp .Lmain.while.cond
+// ASM-NOT: jmp .Lmain.while.body
+// ASM-NOT: jmp .Lmain.while.end
+// ASM-NOT: jl .L
+// the blocks are laid out cond, body, end: the entry falls into the
+// condition, which leaves the loop when i >= 10 and otherwise falls into
+// the body, so the only jump left is the one back to the condition
+int main() {
+    int i = 0;
+    int sum = 0;
+    while (i < 10) {
+        sum = sum + i;
+        i = i + 1;
+    }
+    return sum - 3;
+}
@@ -0,0 +1,20 @@
+// EXPECT: EXIT 42
+// ASM: cmp $7, %
+// ASM: cmp $6, %
+// ASM-NOT: mov $7,
+// ASM-NOT: mov $6,
+// ASM: setl %al
+// each loop's bounds check is a cmp against the immediate, on the register
+// the counter is in, and a jump: the bound is never loaded anywhere. The
+// comparison stored in small is still made a 0/1 value.
+int main() {
+    int n = 0;
+    int small = 0;
+    for (int i = 0; i < 7; i = i + 1) {
+        for (int j = 0; j < 6; j = j + 1) {
+            n = n + 1;
+        }
+        small = i < 3;
+    }
+    return n - small;
+}
@@ -0,0 +1,40 @@
+// EXPECT: EXIT 42
+// FLAGS: -fpic -finline-threshold=0
+// LINK: pie
+// WITH: lib/pic_counter.c
+// STDOUT: pic
+// ASM: call puts@PLT
+// ASM: call bump@PLT
+// ASM: call thrice@PLT
+// ASM: mov counter@GOTPCREL(%rip), %
+// ASM: call twice
+// ASM-NOT: call twice@PLT
+// ASM: lea .Lstr0(%rip)
+// ASM: add %rcx, %rax
+// ASM-NOT: .quad .L
+// with -fpic, a symbol that is not static, which in a shared object another
+// object could define instead, is called through the PLT and addressed
+// through the GOT, thrice as much as what pic_counter.c defines; the static
+// twice and the string literal are reached directly. The switch's jump table
+// holds offsets from itself rather than addresses, so the PIE it runs as
+// links with no text relocations.
+int puts(const char *s);
+int bump(int x);
+extern int counter;
+static int twice(int x) { return x + x; }
+int thrice(int x) { return x + x + x; }
+int pick(int k) {
+    switch (k) {
+    case 0: return 3;
+    case 1: return 5;
+    case 2: return 7;
+    case 3: return 11;
+    case 4: return 13;
+    }
+    return 0;
+}
+int main() {
+    puts("pic");
+    bump(twice(0) + thrice(0) + pick(4) - 12);
+    return counter + 1;
+}
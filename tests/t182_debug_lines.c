@@ -0,0 +1,22 @@
+// EXPECT: EXIT 42
+// FLAGS: -g -finline-threshold=0
+// ASM: .file 1 "tests/t182_debug_lines.c"
+// ASM: .loc 1 11 5
+// LINES: 11 13 14 16 19 20 21
+// with -g, each instruction is marked with its source line, and the
+// assembler builds a DWARF line table from the marks: each prologue is on
+// its function's line and the loop on the lines of the for and its body.
+// objdump --dwarf=decodedline must show code for each line listed; int s = 0
+// has none, its constant being the loop's initial value.
+int sum(int n) {
+    int s = 0;
+    for (int i = 0; i < n; i = i + 1) {
+        s = s + i;
+    }
+    return s;
+}
+
+int main() {
+    int r = sum(10);
+    return r - 3;
+}
@@ -0,0 +1,14 @@
+// EXPECT: EXIT 44
+// more values live at once than there are registers: when linear scan
+// spills the interval ending last to give its register to the current one,
+// the current one must get the spilled interval's register, not that of
+// whichever interval the active list shifted into its place
+int main() {
+    int x = 299;
+    int c = (x + 1) & 255;
+    int d = (x & 255) * 2;
+    int e = (x + 257) & 255;
+    if (d != 86) return 1;
+    if (e != c) return 2;
+    return (x) - 255;
+}
@@ -0,0 +1,21 @@
+// EXPECT: EXIT 42
+// a file-scope declaration without an initializer is a tentative
+// definition: it may be repeated, and one of the declarations may have the
+// initializer, before or after the others. Each global is emitted once.
+int count;
+int count;
+int total;
+int total = 30;
+int *where = &total;
+int *where;
+char buf[4];
+char buf[4];
+struct P { int x; int y; };
+struct P pt;
+struct P pt;
+int main() {
+    count = count + 2;
+    buf[1] = 'a';
+    pt.y = 7;
+    return count + *where + buf[1] - 'a' + pt.y + 3;
+}
@@ -0,0 +1,14 @@
+// EXPECT: EXIT 7
+// a global array of pointers holds pointers: its elements are stored and
+// loaded as the pointer type it was declared with, eight bytes each, char
+// pointers included, and read back through
+int *ptrs[4];
+char *names[3];
+int x;
+int main() {
+    x = 4;
+    ptrs[1] = &x;
+    names[2] = "abc";
+    *ptrs[1] = *ptrs[1] + 1;
+    return x + names[2][1] - 'a' + (ptrs[0] == 0);
+}
@@ -0,0 +1,46 @@
+// EXPECT: EXIT 255
+// ASM: div %rcx
+// ASM-NOT: idiv
+// ASM: shr $1,
+// ASM: movswq %ax, %rax
+// ASM: setb %al
+// unsigned long arithmetic wraps and compares, divides and shifts right as
+// unsigned, and short and unsigned char values wrap at their width when
+// stored or passed, initializers included; the exit code is what gcc
+// gives. Each check sets one bit.
+short g = 40000;
+short ga[2] = {1, 40000};
+struct P { short a; unsigned char b; };
+unsigned long half(unsigned long x) { return x / 2; }
+unsigned long over(unsigned long x, unsigned long d) { return x / d; }
+short narrow(long x) { return x; }
+long widen(short x) { return x; }
+int main() {
+    int r = 0;
+    unsigned long x = 0;
+    x = x - 1;
+    if (x > 5) r = r + 1;
+    if (half(x) == 9223372036854775807 && over(x, 3) == 6148914691236517205) r = r + 2;
+    short s = 40000;
+    if (s < 0 && s == -25536) r = r + 4;
+    unsigned char u = 255;
+    u = u + 1;
+    if (u == 0) r = r + 8;
+    unsigned short us = 65535;
+    us = us + 2;
+    short a[3];
+    a[1] = 32768;
+    if (us == 1 && a[1] == -32768 && narrow(65537) == 1) r = r + 16;
+    long n = 0;
+    for (unsigned long i = 3; i < 10; i = i - 1) n = n + 1;
+    if (n == 4 && (x >> 60) == 15 && (short)70000 == 4464) r = r + 32;
+    int below = x < 1;
+    int signedBelow = -1 < 1;
+    if (!below && signedBelow) r = r + 64;
+    short la[2] = {40000, 2};
+    struct P p;
+    p.a = 32769;
+    p.b = 300;
+    if (g == -25536 && ga[1] == -25536 && la[0] == -25536 && widen(40000) == -25536 && p.a == -32767 && p.b == 44) r = r + 128;
+    return r;
+}
@@ -0,0 +1,20 @@
+// EXPECT: EXIT 33
+// a && or || inside an operand of a condition, rather than at its top,
+// is built as a value in blocks of its own, and the branch on the
+// condition leaves from the last of them
+int main() {
+    int a = 0;
+    int r = 0;
+    if ((a || 4) * 2) r = r + 1;
+    if ((a && 4) * 2) r = r + 100;
+    if (((a || 3) + 1) == 2) r = r + 4;
+    int x = 1;
+    int y = 1;
+    int n = 0;
+    while ((x && y) + 1 == 2) {
+        n = n + 1;
+        if (n == 8) y = 0;
+    }
+    for (int i = 0; i < 4 && (i || 1) + i < 4; i = i + 1) r = r + 8;
+    return r + n - 4;
+}
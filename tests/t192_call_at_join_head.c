@@ -0,0 +1,23 @@
+// EXPECT: EXIT 122
+// FLAGS: -finline-threshold=0
+// the switch's end block is laid out before its cases and starts with
+// the call to f0, so the values merged there are live into it at the
+// call: each must be in a callee-saved register or saved around it, as
+// with any call it is live across, or f0 clobbers it
+int f0(int a, int b) { return a / (b + 1) + 1; }
+int pick(int k, int m) {
+    int a = 0;
+    int b = 0;
+    int c = 0;
+    int d = 0;
+    int e = 0;
+    int g = 0;
+    switch (k) {
+    case 0: a = m + 1; b = m + 2; c = m + 3; d = m + 4; e = m + 5; g = m + 6; break;
+    case 1: a = m + 6; b = m + 7; c = m + 8; d = m + 9; e = m + 10; g = m + 11; break;
+    default: a = m; b = m; c = m; d = m; e = m; g = m;
+    }
+    int w = f0(k, m);
+    return a + b * 2 + c * 3 + d * 4 + e * 5 + g * 6 + w;
+}
+int main() { return pick(1, 0) + pick(5, 1) - 100; }
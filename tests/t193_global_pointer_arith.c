@@ -0,0 +1,15 @@
+// EXPECT: EXIT 42
+// a global pointer reads as the pointer type it was declared with, so
+// arithmetic on it is scaled by its element size, and the address of one
+// points to that pointer type
+long ga[4] = {1, 2, 3, 4};
+long *gq = &ga[1];
+long *gp;
+int main() {
+    gp = &ga[2];
+    long *r = *&gp;
+    if (*(gq + 1) != 3) return 1;
+    if (*(r + 1) != 4) return 2;
+    if (gp - gq != 1) return 3;
+    return *(gq + 2) * 10 + *(gp - 1);
+}
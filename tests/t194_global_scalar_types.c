@@ -0,0 +1,19 @@
+// EXPECT: EXIT 42
+// loads and stores of a global scalar follow its declared type: a signed
+// char reads sign-extended, a short wraps at 16 bits when stored, and a
+// global pointer indexes by its element size
+signed char gc = -1;
+short gs;
+unsigned char gu;
+long ga[4] = {1, 2, 3, 4};
+long *gq = &ga[1];
+int main() {
+    gs = 40000;
+    gu = 300;
+    if (gc != -1) return 1;
+    if (gs != -25536) return 2;
+    if (gu != 44) return 3;
+    gc = gc - 1;
+    if (gc + 2 != 0) return 4;
+    return gq[2] * 10 + gq[0];
+}
@@ -0,0 +1,19 @@
+// EXPECT: EXIT 42
+// LINK: libc
+// STDOUT: hi 2
+// a global array named as a value is the address of its first element,
+// typed as a pointer to its elements, rather than a load of it
+int printf(const char *fmt, ...);
+char gs[] = "hi";
+long gl[3] = {40, 1, 2};
+long sum(long *p, int n) {
+    long s = 0;
+    for (int i = 0; i < n; i = i + 1) s = s + p[i];
+    return s;
+}
+int main() {
+    long *p = gl + 1;
+    printf("%s %d\n", gs, *(p + 1));
+    if (*gs != 'h') return 1;
+    return sum(gl, 2) + *p;
+}
@@ -0,0 +1,19 @@
+// EXPECT: EXIT 63
+// ~ and unary - keep an unsigned operand's type, so shifting or comparing
+// the result is unsigned, and so does reading an unsigned global; the exit
+// code is what gcc gives. Each check sets one bit.
+unsigned long gu;
+unsigned long gz = 0;
+int main() {
+    int r = 0;
+    unsigned long u = 0;
+    gu = gu - 1;
+    if (gu > 5) r = r + 1;
+    if (gu / 2 == 9223372036854775807) r = r + 2;
+    if ((~u) >> 63 == 1) r = r + 4;
+    if (-gz - 1 > 0 && (-(u + 1)) >> 62 == 3) r = r + 8;
+    if (~u > 0) r = r + 16;
+    long s = 0;
+    if ((~s) >> 63 == -1) r = r + 32;
+    return r;
+}
@@ -0,0 +1,21 @@
+// EXPECT: EXIT 63
+// Constant initializers fold as the code would run: && and || skip an
+// operand the left one decides, even a division by zero, and a cast to
+// unsigned makes division, right shift and comparison unsigned. The exit
+// code is what gcc gives. Each check sets one bit.
+long a = 0 && 1 / 0;
+long b = 1 || 1 / 0;
+long c = (unsigned long)-1 / 2;
+long d = (unsigned long)-1 >> 62;
+long e = (unsigned long)-1 > 0;
+enum { K = -(unsigned long)1 >> 63, S = -1 >> 63 };
+int main() {
+    int r = 0;
+    if (a == 0) r = r + 1;
+    if (b == 1) r = r + 2;
+    if (c == 9223372036854775807) r = r + 4;
+    if (d == 3) r = r + 8;
+    if (e == 1) r = r + 16;
+    if (K == 1 && S == -1) r = r + 32;
+    return r;
+}
@@ -0,0 +1,14 @@
+// EXPECT: EXIT 42
+// Store through int* and char* including pointer arithmetic on the left-hand side
+int set(int *p, int v){ *p = v; return 0; }
+int main() {
+    int x = 1;
+    int *p = &x;
+    *p = 30;
+    set(&x, x + 10);
+    char c = 65;
+    char *q = &c;
+    *q = 2;
+    *(q + 0) = *q;
+    return x + c;
+}
@@ -0,0 +1,10 @@
+// EXPECT: EXIT 21
+// Member access on both sides of an assignment, including a parenthesized base
+struct P { int x; int y; };
+int main(){
+    struct P p;
+    p.x = 4;
+    p.y = p.x + 3;
+    p.x = p.y * (p).x;
+    return p.x - p.y;
+}
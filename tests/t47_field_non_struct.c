@@ -0,0 +1,2 @@
+// EXPECT: COMPILE-FAIL
+int main(){ int x = 0; x.f = 1; return x; }
@@ -0,0 +1,15 @@
+// EXPECT: EXIT 17
+// Multiple struct definitions, a forward declaration, and pointer members
+struct Node;
+struct List { struct Node *head; int len; };
+struct Node { int val; struct Node *next; char tag; };
+int main(){
+    struct List l;
+    struct Node n;
+    l.len = 4;
+    n.val = 5;
+    n.next = 0;
+    n.tag = 8;
+    l.head = 0;
+    return l.len + n.val + n.tag;
+}
@@ -0,0 +1,3 @@
+// EXPECT: COMPILE-FAIL
+struct A { int x; };
+int main(){ struct B b; return 0; }
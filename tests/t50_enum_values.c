@@ -0,0 +1,8 @@
+// EXPECT: EXIT 42
+enum Color { RED, GREEN = 5, BLUE };
+enum { NEG = -3, AFTER_NEG, LAST = BLUE };
+
+int main() {
+    // RED=0 GREEN=5 BLUE=6 NEG=-3 AFTER_NEG=-2 LAST=6
+    return RED + GREEN * 6 + BLUE + NEG + AFTER_NEG + LAST + 5;
+}
@@ -0,0 +1,22 @@
+// EXPECT: EXIT 28
+enum Color { RED, GREEN = 10, BLUE };
+
+int g = GREEN;
+
+int score(int c) {
+    switch (c) {
+    case RED:
+        return 1;
+    case GREEN:
+        return 2;
+    case BLUE:
+        return 17;
+    default:
+        return 100;
+    }
+}
+
+int main() {
+    enum Color c = BLUE;
+    return score(c) + score(RED) + g;
+}
@@ -0,0 +1,14 @@
+// EXPECT: EXIT 44
+typedef char byte;
+
+int main() {
+    int x = 299;
+    int c = (char)(x + 1);
+    int d = (char)x * 2;
+    int e = (byte)(x + 257);
+    // 300 & 255 = 44, (299 & 255) * 2 = 86, 556 & 255 = 44
+    if (d != 86) return 1;
+    if (e != c) return 2;
+    // a parenthesized variable is still an expression
+    return (x) - 255;
+}
@@ -0,0 +1,12 @@
+// EXPECT: EXIT 42
+int main() {
+    int x = 42;
+    char *cp = (char *)&x;
+    // arithmetic scales by the pointee of the cast type
+    int d1 = (int)(cp + 2) - (int)cp;
+    int d2 = (int)((int *)cp + 2) - (int)cp;
+    if (d1 != 2) return 1;
+    if (d2 != 16) return 2;
+    if (*cp != 42) return 3;
+    return *(int *)cp;
+}
@@ -0,0 +1,13 @@
+// EXPECT: EXIT 16
+int length(char *s) {
+    int n = 0;
+    while (s[n] != 0) n = n + 1;
+    return n;
+}
+
+int main() {
+    char *greet = "hello";
+    char *again = "hello";
+    if (greet != again) return 1;
+    return length(greet) + length("world!") + length("hello");
+}
@@ -0,0 +1,4 @@
+// EXPECT: EXIT 42
+extern int twice(int);
+int main() { return twice(21); }
+int twice(int x) { return x + x; }
@@ -0,0 +1,6 @@
+// EXPECT: EXIT 9
+int add(int a, int b);
+char first(char *s);
+int main() { return add(4, 5) + first("") ; }
+int add(int a, int b) { return a + b; }
+char first(char *s) { return s[0]; }
@@ -0,0 +1,4 @@
+// EXPECT: COMPILE-FAIL
+int f(int a);
+int f(int a, int b) { return a + b; }
+int main() { return f(1, 2); }
@@ -0,0 +1,17 @@
+// EXPECT: EXIT 54
+int main() {
+    int a[6];
+    int i;
+    int j;
+    for (i = 0; i < 6; i = i + 1) a[i] = i + 1;
+    // reverse in place by walking from both ends
+    for (i = 0, j = 5; i < j; i = i + 1, j = j - 1) {
+        int t = a[i];
+        a[i] = a[j];
+        a[j] = t;
+    }
+    int s = 0;
+    for (int k = 0, w = 10; k < 3; k = k + 1, w = w - 1) s = s + w;
+    // a is now 6 5 4 3 2 1; s is 10 + 9 + 8
+    return a[0] * 4 + a[5] + a[2] + s - 2;
+}
@@ -0,0 +1,16 @@
+// EXPECT: EXIT 49
+enum { K = 3 };
+struct P { int x; char c; };
+int size = 4 * 1024;
+int neg = -1;
+int nested = ((2 + 3) * (K - 1)) << 1;
+int mask = ~0 & 240 >> 4;
+int bytes = sizeof(struct P) + sizeof(char) + sizeof(int *);
+int main() {
+    if (size != 4096) return 1;
+    if (neg != -1) return 2;
+    if (nested != 20) return 3;
+    if (mask != 15) return 4;
+    if (bytes != 25) return 5;
+    return nested + bytes + 4 + neg * 0;
+}
@@ -0,0 +1,4 @@
+// EXPECT: COMPILE-FAIL
+int a = 1;
+int b = a + 1;
+int main() { return b; }
@@ -0,0 +1,22 @@
+// EXPECT: EXIT 23
+char msg[] = "hello";
+char buf[16] = "hi";
+char exact[3] = "abc";
+int count(char c) {
+    int n = 0;
+    int i = 0;
+    while (msg[i] != 0) {
+        if (msg[i] == c) n = n + 1;
+        i = i + 1;
+    }
+    return n;
+}
+int main() {
+    int len = 0;
+    while (msg[len] != 0) len = len + 1;
+    if (buf[2] != 0) return 1;
+    if (buf[15] != 0) return 2;
+    if (exact[2] != 'c') return 3;
+    // 5 + 2 * 2 + 14
+    return len + count('l') * 2 + sizeof(int) + 6;
+}
@@ -0,0 +1,3 @@
+// EXPECT: COMPILE-FAIL
+char s[2] = "abc";
+int main() { return s[0]; }
@@ -0,0 +1,22 @@
+// EXPECT: EXIT 60
+int g[5] = {10, 20, 3 * 10};
+char gc[] = {'a', 'b', 'c', 0};
+int sum(int n) {
+    int s = 0;
+    for (int i = 0; i < n; i = i + 1) s = s + g[i];
+    return s;
+}
+int main() {
+    int a[4] = {1, 2, 3, 4};
+    int part[6] = {7, 8};
+    char c[3] = {'x', 'y'};
+    if (g[3] != 0) return 1;
+    if (g[4] != 0) return 2;
+    if (part[2] != 0) return 3;
+    if (part[5] != 0) return 4;
+    if (c[2] != 0) return 5;
+    if (gc[1] != 'b') return 6;
+    if (c[1] != 'y') return 7;
+    // 60 + 10 + 15 - 25
+    return sum(5) + a[0] + a[1] + a[2] + a[3] + part[0] + part[1] - 25;
+}
@@ -0,0 +1,29 @@
+// EXPECT: EXIT 61
+enum Color { RED, GREEN = 5, BLUE };
+char s[] = "a ixA";
+int classify(int c) {
+    switch (c) {
+    case 'a': case 'e': case 'i': case 'o': case 'u':
+        return 1;
+    case ' ':
+        return 2;
+    case RED:
+        return 3;
+    case BLUE:
+        return 4;
+    case 1 + 2:
+        return 5;
+    case -1:
+        return 6;
+    case 0x41:
+        return 7;
+    default:
+        return 0;
+    }
+}
+int main() {
+    int n = 0;
+    for (int i = 0; i < 5; i = i + 1) n = n * 2 + classify(s[i]);
+    // 1,2,1,0,7 -> ((((1*2+2)*2+1)*2+0)*2+7) = 43
+    return n + classify(0) + classify(6) + classify(3) + classify(-1);
+}
@@ -0,0 +1,9 @@
+// EXPECT: COMPILE-FAIL
+int main() {
+    int x = 2;
+    switch (x) {
+    case 2: return 1;
+    case 1 + 1: return 2;
+    }
+    return 0;
+}
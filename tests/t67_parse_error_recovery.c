@@ -0,0 +1,16 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: at 8:13
+// DIAG: at 9:19
+// DIAG: at 13:14
+// DIAG: at 15:5
+int f(int a) {
+    int x = 1;
+    x = x + ;
+    int y = (2 + 3;
+    return x + y;
+}
+int g(int a) {
+    return a a;
+}
+int 5;
+int main() { return f(1) + g(2); }
@@ -0,0 +1,11 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: main:7:17: undefined variable cnt
+int main() {
+    int i = 0;
+    int n = 0;
+    while (i < 3) {
+        n = n + cnt;
+        i = i + 1;
+    }
+    return n;
+}
@@ -0,0 +1,25 @@
+// EXPECT: EXIT 162
+// Expressions in statement position must parse exactly like the same
+// expressions inside a return; short-circuiting makes the tree observable.
+int hits = 0;
+int bump() { hits = hits + 1; return 1; }
+int main() {
+    int x = 2;
+    int y = 1;
+    x < y + 1 && bump();
+    x + 1 == 3 && bump();
+    x * 2 + 1 > 4 || bump();
+    x - y - 1 || bump();
+    x & 1 | 2 == 2 && bump();
+    x << 1 + 1 == 8 && bump();
+    if (hits != 4) return hits;
+    hits = 0;
+    int a = x < y + 1 && bump();
+    int b = x + 1 == 3 && bump();
+    int c = x * 2 + 1 > 4 || bump();
+    int d = x - y - 1 || bump();
+    int e = x & 1 | 2 == 2 && bump();
+    int f = x << 1 + 1 == 8 && bump();
+    if (hits != 4) return 10 + hits;
+    return 100 + a * 1 + b * 2 + c * 4 + d * 8 + e * 16 + f * 32;
+}
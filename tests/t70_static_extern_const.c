@@ -0,0 +1,20 @@
+// EXPECT: EXIT 38
+// static symbols stay local to the object; extern declarations emit no
+// storage until a definition appears; const is accepted and recorded.
+// ASM-NOT: .globl counter
+// ASM-NOT: .globl helper
+// ASM: .globl shared
+// ASM: .globl main
+static int counter = 30;
+extern int shared;
+extern int later(int x);
+static int helper(const int x) { return x + 1; }
+int shared = 5;
+const char *name = 0;
+int later(int x) { return x * 2; }
+int main() {
+    extern int shared;
+    const int k = 2;
+    counter = counter + k;
+    return counter + helper(shared) - 2 + later(k) - 2;
+}
@@ -0,0 +1,19 @@
+// EXPECT: EXIT 63
+// A static local keeps its value across calls and is only initialized once.
+// ASM-NOT: .globl next.n
+int next() {
+    static int n = 10;
+    n = n + 1;
+    return n;
+}
+int other() {
+    static int n;
+    n = n + 100;
+    return n;
+}
+int main() {
+    next();
+    next();
+    other();
+    return next() + other() - 150;
+}
@@ -0,0 +1,4 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: conflicting static and extern at 3:1
+static extern int x;
+int main() { return 0; }
@@ -0,0 +1,19 @@
+// EXPECT: EXIT 115
+// Assignments inside conditions update the variable for the body, for the
+// code after the loop, and for the test itself.
+int g = 0;
+int half(int x) { return x / 2; }
+int main() {
+    int n = 12345;
+    int digits = 1;
+    while ((n = n / 10) != 0) digits = digits + 1;
+    if (n != 0) return 1;
+    int x = 100;
+    int steps = 0;
+    for (; (x = half(x)) > 3; ) steps = steps + x;
+    int a;
+    int b;
+    a = b = 7;
+    if ((g = a + b) != 14) return 2;
+    return digits + steps + x + a + g - b;
+}
@@ -0,0 +1,14 @@
+// EXPECT: EXIT 7
+// LINK: libc
+// STDOUT: 3 + 4 = 7
+// STDOUT: done
+// ASM: xor %eax, %eax
+int printf(const char *fmt, ...);
+int add(int a, int b) { return a + b; }
+int main() {
+    int a = 3;
+    int b = 4;
+    printf("%d + %d = %d\n", a, b, add(a, b));
+    printf("done\n");
+    return add(a, b);
+}
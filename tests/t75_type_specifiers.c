@@ -0,0 +1,37 @@
+// EXPECT: EXIT 42
+// Combined type specifiers parse in any order and carry their sizes; a
+// short is stored in 8 bytes, which sizeof gives, and its array's stride.
+unsigned long total = 0;
+long long big = 5;
+unsigned char flags = 255;
+typedef unsigned short u16;
+struct P { short a; unsigned char b; long c; };
+short twice(short x) { return x * 2; }
+unsigned int count(unsigned n, signed char step) {
+    unsigned int i;
+    long k = 0;
+    for (i = 0; i < n; i = i + 1) k = k + step;
+    return k;
+}
+int main() {
+    short s = 3;
+    unsigned u = 4;
+    long int l = 6;
+    int unsigned iu = 1;
+    signed si = 2;
+    if (sizeof(short) != 8) return 1;
+    if (sizeof(unsigned short int) != 8) return 2;
+    if (sizeof(unsigned char) != 1) return 3;
+    if (sizeof(signed char) != 1) return 4;
+    if (sizeof(long) != 8) return 5;
+    if (sizeof(long long) != 8) return 6;
+    short pair[2];
+    if (sizeof(u16) != (char *)&pair[1] - (char *)&pair[0]) return 7;
+    if (sizeof(unsigned long *) != 8) return 8;
+    if (flags != 255) return 9;
+    if ((unsigned char)300 != 44) return 10;
+    total = s + u + l + iu + si;
+    for (unsigned long j = 0; j < 2; j = j + 1) total = total + j;
+    // 17 + 6 + 9 + 10
+    return total + twice(s) + count(3, 3) + big * 2;
+}
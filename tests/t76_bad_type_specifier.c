@@ -0,0 +1,6 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: invalid type specifier: short or long char at 4:5
+int main() {
+    long char c = 1;
+    return c;
+}
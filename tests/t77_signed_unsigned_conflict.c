@@ -0,0 +1,4 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: invalid type specifier: both signed and unsigned at 3:1
+signed unsigned int x;
+int main() { return 0; }
@@ -0,0 +1,18 @@
+// EXPECT: EXIT 95
+// Parameters keep their declared types: a char * parameter is indexed a
+// byte at a time, and a char parameter only sees the low byte.
+int sum(char *s, int n) {
+    int t = 0;
+    int i;
+    for (i = 0; i < n; i = i + 1) t = t + s[i];
+    return t;
+}
+char second(char *s) { return *(s + 1); }
+int digits(int a, int b, int c, int d) { return a * 1000 + b * 100 + c * 10 + d; }
+int low(char a, int b, char c) { return a + b + c; }
+int main() {
+    if (sum("\001\002\003\004", 4) != 10) return 1;
+    if (second("AB") != 66) return 2;
+    if (digits(1, 2, 3, 4) != 1234) return 3;
+    return low(300, 1, 2) * 2 + 1;
+}
@@ -0,0 +1,7 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: main:5:12: too few arguments to add: want 2, got 1
+int add(int a, int b);
+int main() {
+    return add(1);
+}
+int add(int a, int b) { return a + b; }
@@ -0,0 +1,4 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: main:4:21: too many arguments to add: want 2, got 3
+int add(int a, int b) { return a + b; }
+int main() { return add(1, 2, 3); }
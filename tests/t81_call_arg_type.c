@@ -0,0 +1,6 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: main:5:29: type error: argument 1 of first: cannot pass int as pointer
+char first(char *s) { return *s; }
+int main() {
+    return first(0) + first(65);
+}
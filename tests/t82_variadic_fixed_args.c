@@ -0,0 +1,4 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: main:4:21: too few arguments to printf: want 1, got 0
+int printf(char *fmt, ...);
+int main() { return printf(); }
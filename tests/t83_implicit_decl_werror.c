@@ -0,0 +1,8 @@
+// EXPECT: COMPILE-FAIL
+// FLAGS: -Werror
+// DIAG: warning: main:7:12: implicit declaration of function prnt
+// DIAG: warnings treated as errors
+int print(int x) { return x; }
+int main() {
+    return prnt(1);
+}
@@ -0,0 +1,11 @@
+// EXPECT: EXIT 10
+// LINK: libc
+// A call with no prototype only warns; a prototype keeps it quiet.
+// DIAG: warning: main:9:22: implicit declaration of function labs
+// DIAG-NOT: implicit declaration of function abs
+// DIAG-NOT: implicit declaration of function twice
+int abs(int x);
+int main() {
+    return abs(-3) + labs(-3) + twice(2);
+}
+int twice(int x) { return x * 2; }
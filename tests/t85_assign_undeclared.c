@@ -0,0 +1,8 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: main:6:5: assignment to undeclared variable 'totl'
+int main() {
+    int total = 0;
+    total = 3;
+    totl = 5;
+    return total;
+}
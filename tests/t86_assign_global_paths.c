@@ -0,0 +1,18 @@
+// EXPECT: EXIT 29
+// Assignments still reach globals, extern declarations, and static locals.
+int total = 1;
+int bump() {
+    static int calls;
+    calls = calls + 1;
+    return calls;
+}
+int main() {
+    extern int total;
+    total = total + 10;
+    int seen;
+    if ((total = total + 5) != 16) return 1;
+    seen = bump();
+    seen = bump();
+    for (total = total; total < 20; total = total + 1) seen = seen + 1;
+    return total + seen + bump();
+}
@@ -0,0 +1,30 @@
+// EXPECT: EXIT 74
+// A declaration in an inner block shadows the outer one only until the
+// block ends; both keep their own values.
+int x = 100;
+int main() {
+    int r = 0;
+    int x = 1;
+    {
+        int x = 2;
+        x = x + 5;
+        r = r + x;            // 7
+        {
+            int *x = &r;
+            *x = *x + 10;     // r = 17
+        }
+        r = r + x;            // 24
+    }
+    r = r + x;                // 25
+    int i = 40;
+    for (int i = 0; i < 3; i = i + 1) {
+        int y = i;
+        r = r + y;            // 28
+    }
+    r = r + i;                // 68
+    if (r > 0) {
+        int x = 5;
+        r = r + x;            // 73
+    }
+    return r + x;             // 74
+}
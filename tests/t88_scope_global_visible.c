@@ -0,0 +1,19 @@
+// EXPECT: EXIT 12
+// Once an inner local goes out of scope, the global of that name is
+// visible again and assignments reach it.
+int g = 3;
+int main() {
+    {
+        int g = 50;
+        g = g + 1;
+    }
+    g = g + 4;
+    {
+        int g = 0;
+        {
+            g = 9;
+        }
+        if (g != 9) return 1;
+    }
+    return g + 5;
+}
@@ -0,0 +1,10 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: main:7:9: redeclaration of x (previous declaration at 5:9)
+int main() {
+    {
+        int x = 1;
+        x = x + 1;
+        int x = 2;
+        return x;
+    }
+}
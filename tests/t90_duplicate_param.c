@@ -0,0 +1,4 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: sum:3:20: redeclaration of a (previous declaration at 3:13)
+int sum(int a, int a) { return a + a; }
+int main() { return sum(1, 2); }
@@ -0,0 +1,5 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: redefinition of count at 4:5 (previous definition at 3:5)
+int count = 1;
+int count = 2;
+int main() { return count; }
@@ -0,0 +1,6 @@
+// EXPECT: COMPILE-FAIL
+// DIAG: redefinition of twice at 5:5 (previous definition at 4:5)
+int twice(int n);
+int twice(int n) { return n * 2; }
+int twice(int n) { return n + n; }
+int main() { return twice(3); }
@@ -0,0 +1,17 @@
+// EXPECT: EXIT 27
+// Prototypes before definitions, extern before a definition, and shadowing
+// in nested scopes are all declarations that may repeat a name.
+int twice(int n);
+int twice(int n);
+extern int base;
+int base = 10;
+int twice(int n) { return n * 2; }
+int main() {
+    int x = 1;
+    {
+        int x = 5;
+        for (int x = 0; x < 2; x = x + 1) { int x = 100; }
+        base = base + x;
+    }
+    return twice(x) + base + 10;
+}
@@ -0,0 +1,13 @@
+// EXPECT: EXIT 7
+// FLAGS: -Wuninitialized
+// DIAG: warning: main:11:13: 'x' is used uninitialized
+// DIAG-NOT: 'y'
+// DIAG-NOT: 'z'
+int main() {
+    int x;
+    int y;
+    int z;
+    y = 3;
+    z = 4 + x;
+    return y + z;
+}
@@ -0,0 +1,15 @@
+// EXPECT: EXIT 8
+// FLAGS: -Wuninitialized
+// DIAG: warning: f:13:12: 'r' may be used uninitialized
+// DIAG: warning: f:13:16: 's' may be used uninitialized
+// DIAG-NOT: 'i'
+// DIAG-NOT: 't'
+int f(int c) {
+    int r;
+    int s;
+    int t;
+    if (c > 0) { r = c; t = 1; } else { t = 2; }
+    for (int i = 0; i < c; i = i + 1) s = i;
+    return r + s + t;
+}
+int main() { return f(4); }
@@ -0,0 +1,7 @@
+// EXPECT: EXIT 5
+// Without -Wuninitialized, reading an unassigned local stays quiet.
+// DIAG-NOT: uninitialized
+int main() {
+    int x;
+    return x + 5;
+}
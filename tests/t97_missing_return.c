@@ -0,0 +1,16 @@
+// EXPECT: EXIT 0
+// DIAG: warning: sign:6:5: control reaches end of non-void function
+// DIAG-NOT: warning: main
+// ASM: mov $0, %eax
+// the block that falls off the end returns 0 where it ends
+int sign(int x) {
+    if (x > 0) {
+        return 1;
+    } else if (x < 0) {
+        return -1;
+    }
+}
+int main() {
+    if (sign(5) != 1) return 1;
+    return 0;
+}
@@ -0,0 +1,25 @@
+// EXPECT: EXIT 13
+// Every path returns, or ends in a loop that only exits by returning, so
+// each function ends at its last real ret, with no default epilogue.
+// DIAG-NOT: control reaches end
+// ASM-NOT: mov $0, %eax
+int clamp(int x) {
+    if (x > 10) return 10;
+    else if (x < 0) return 0;
+    else return x;
+}
+int first_over(int x, int limit) {
+    while (1) {
+        if (x > limit) return x;
+        x = x * 2;
+    }
+}
+int spin(int n) {
+    for (;;) {
+        n = n + 1;
+        if (n == 3) return n;
+    }
+}
+int main() {
+    return clamp(42) + first_over(1, 1) - spin(0) + 4;
+}
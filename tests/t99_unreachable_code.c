@@ -0,0 +1,38 @@
+// EXPECT: EXIT 26
+// Statements after return, break and continue warn once per block and are
+// not compiled.
+// DIAG: warning: sum:16:13: unreachable code
+// DIAG: warning: sum:21:13: unreachable code
+// DIAG: warning: pick:30:13: unreachable code
+// DIAG: warning: pick:35:5: unreachable code
+// DIAG-NOT: pick:36:5
+// ASM-NOT: call dead
+int dead(int x) { return x; }
+int sum(int n) {
+    int s = 0;
+    for (int i = 0; i < n; i = i + 1) {
+        if (i == 2) {
+            continue;
+            s = s + dead(100);
+        }
+        s = s + i;
+        if (s > 10) {
+            break;
+            s = dead(s);
+        }
+    }
+    return s;
+}
+int pick(int n) {
+    switch (n) {
+        case 6:
+            return 9;
+            dead(6);
+        default:
+            break;
+    }
+    return 4;
+    dead(7);
+    return 5;
+}
+int main() { return sum(6) + pick(6) + pick(1); }
@@ -16,29 +16,146 @@ tmpdir=$(pwd)/.test-tmp
 rm -rf "$tmpdir" && mkdir -p "$tmpdir"
 trap 'rm -rf "$tmpdir"' EXIT
 
-for c in tests/*.c; do
+# Every '// DIAG: <text>' line in a test must appear in the compiler output
+# and no '// DIAG-NOT: <text>' line may.
+check_diags() {
+  local src="$1" log="$2" want
+  while IFS= read -r want; do
+    if ! grep -qF -- "$want" "$log"; then
+      echo "FAIL $(basename "$src") (missing diagnostic: $want)"
+      return 1
+    fi
+  done < <(sed -n 's#^\(//\|;\) DIAG: ##p' "$src")
+  while IFS= read -r want; do
+    if grep -qF -- "$want" "$log"; then
+      echo "FAIL $(basename "$src") (unexpected diagnostic: $want)"
+      return 1
+    fi
+  done < <(sed -n 's#^\(//\|;\) DIAG-NOT: ##p' "$src")
+  return 0
+}
+
+# Every '// ASM: <text>' line must appear in the generated assembly and no
+# '// ASM-NOT: <text>' line may.
+check_asm() {
+  local src="$1" asm="$2" want
+  while IFS= read -r want; do
+    if ! grep -qF -- "$want" "$asm"; then
+      echo "FAIL $(basename "$src") (missing in assembly: $want)"
+      return 1
+    fi
+  done < <(sed -n 's#^\(//\|;\) ASM: ##p' "$src")
+  while IFS= read -r want; do
+    if grep -qF -- "$want" "$asm"; then
+      echo "FAIL $(basename "$src") (unexpected in assembly: $want)"
+      return 1
+    fi
+  done < <(sed -n 's#^\(//\|;\) ASM-NOT: ##p' "$src")
+  return 0
+}
+
+# Each '// LINES: <n> ...' line lists source lines the binary's DWARF line
+# table (from -g) must map some code to.
+check_lines() {
+  local src="$1" bin="$2" n
+  grep -Eq '^(//|;) LINES: ' "$src" || return 0
+  objdump --dwarf=decodedline "$bin" > "$bin.lines"
+  for n in $(sed -n 's#^\(//\|;\) LINES: ##p' "$src"); do
+    if ! grep -Eq "^$(basename "$src")[[:space:]]+$n[[:space:]]" "$bin.lines"; then
+      echo "FAIL $(basename "$src") (no code for line $n)"
+      return 1
+    fi
+  done
+  return 0
+}
+
+# With '// STDOUT: <line>' lines, the program's output must be exactly those lines.
+check_stdout() {
+  local src="$1" out="$2"
+  grep -Eq '^(//|;) STDOUT: ' "$src" || return 0
+  if ! diff -u <(sed -n 's#^\(//\|;\) STDOUT: ##p' "$src") "$out" > "$out.diff"; then
+    echo "FAIL $(basename "$src") (unexpected output)"
+    cat "$out.diff"
+    return 1
+  fi
+  return 0
+}
+
+# A textual IR test must print, once parsed, IR that parses and prints the
+# same again.
+check_roundtrip() {
+  local src="$1" dir="$tmpdir/roundtrip"
+  [[ "$src" == *.ir ]] || return 0
+  mkdir -p "$dir"
+  after_parse() { ./ccomp --emit=ir "$1" | awk '/^;; after /{p = ($0 == ";; after parse"); next} p'; }
+  after_parse "$src" > "$dir/$(basename "$src")"
+  if ! diff -u "$dir/$(basename "$src")" <(after_parse "$dir/$(basename "$src")") > "$dir/diff"; then
+    echo "FAIL $(basename "$src") (IR does not round-trip)"
+    cat "$dir/diff"
+    return 1
+  fi
+  return 0
+}
+
+# Tests are C sources, or textual IR (.ir) for testing the phases after the
+# front end; in IR, directives start with ';' instead of '//'.
+for c in tests/*.c tests/*.ir; do
   (( ++total ))
   name=$(basename "$c")
   first=$(head -n1 "$c")
   # Format: // EXPECT: EXIT <n>  OR  // EXPECT: COMPILE-FAIL
   expect_type=$(echo "$first" | awk '{print $3}')
   expect_val=$(echo "$first" | awk '{print $4}')
-  s="$tmpdir/${name%.c}.s"
-  bin="$tmpdir/${name%.c}.bin"
+  # '// FLAGS: <flags>' passes extra compiler flags
+  read -r -a flags <<< "$(sed -n 's#^\(//\|;\) FLAGS: ##p' "$c")"
+  s="$tmpdir/${name%.*}.s"
+  bin="$tmpdir/${name%.*}.bin"
 
   if [[ "$expect_type" == "EXIT" ]]; then
-    if ! ./ccomp -o "$s" "$c" > "$tmpdir/$name.log" 2>&1; then
+    if ! ./ccomp "${flags[@]}" -o "$s" "$c" > "$tmpdir/$name.log" 2>&1; then
       echo "FAIL $name (expected EXIT $expect_val): compile error"
       (( ++fail ))
       continue
     fi
-    if ! gcc -nostdlib "$s" runtime/start_linux_amd64.s -o "$bin" >> "$tmpdir/$name.log" 2>&1; then
+    # '// WITH: <file>' compiles tests/<file> on its own and links it in; a
+    # .s file is linked in as written
+    objs=("$s")
+    while IFS= read -r with; do
+      if [[ "$with" == *.s ]]; then
+        objs+=("tests/$with")
+        continue
+      fi
+      objs+=("$tmpdir/$(basename "${with%.c}").with.s")
+      if ! ./ccomp -o "${objs[-1]}" "tests/$with" >> "$tmpdir/$name.log" 2>&1; then
+        echo "FAIL $name (compile error in $with)"
+        (( ++fail ))
+        continue 2
+      fi
+    done < <(sed -n 's#^\(//\|;\) WITH: ##p' "$c")
+    # the assembler must take the output without so much as a warning, such
+    # as one about an operand size it had to guess
+    if ! as --fatal-warnings -o /dev/null "$s" >> "$tmpdir/$name.log" 2>&1; then
+      echo "FAIL $name (assembler error or warning)"
+      (( ++fail ))
+      continue
+    fi
+    # '// LINK: libc' links against the C library and its startup code, and
+    # '// LINK: pie' does too, as a position-independent executable, which
+    # may not need any relocation in its read-only segments
+    if grep -Eq '^(//|;) LINK: pie' "$c"; then
+      link=(gcc -pie -Wl,-z,text "${objs[@]}" -o "$bin")
+    elif grep -Eq '^(//|;) LINK: libc' "$c"; then
+      link=(gcc -no-pie "${objs[@]}" -o "$bin")
+    else
+      link=(gcc -nostdlib "${objs[@]}" runtime/start_linux_amd64.s -o "$bin")
+    fi
+    if ! "${link[@]}" >> "$tmpdir/$name.log" 2>&1; then
       echo "FAIL $name (link error)"
       (( ++fail ))
       continue
     fi
     set +e
-    tools/with_timeout.sh 1 "$bin"
+    tools/with_timeout.sh 1 "$bin" > "$tmpdir/$name.out" 2>> "$tmpdir/$name.log"
     code=$?
     set -e
     if [[ "$code" == "124" ]]; then
@@ -47,6 +164,10 @@ for c in tests/*.c; do
       continue
     fi
     if [[ "$code" == "$expect_val" ]]; then
+      if ! check_diags "$c" "$tmpdir/$name.log" || ! check_asm "$c" "$s" || ! check_stdout "$c" "$tmpdir/$name.out" || ! check_lines "$c" "$bin" || ! check_roundtrip "$c"; then
+        (( ++fail ))
+        continue
+      fi
       echo "PASS $name (exit=$code)"
       (( ++pass ))
     else
@@ -54,9 +175,11 @@ for c in tests/*.c; do
       (( ++fail ))
     fi
   elif [[ "$expect_type" == "COMPILE-FAIL" ]]; then
-    if ./ccomp -o "$s" "$c" > "$tmpdir/$name.log" 2>&1; then
+    if ./ccomp "${flags[@]}" -o "$s" "$c" > "$tmpdir/$name.log" 2>&1; then
       echo "FAIL $name (expected COMPILE-FAIL, compiled successfully)"
       (( ++fail ))
+    elif ! check_diags "$c" "$tmpdir/$name.log"; then
+      (( ++fail ))
     else
       echo "PASS $name (compile-fail)"
       (( ++pass ))
@@ -67,6 +190,202 @@ for c in tests/*.c; do
   fi
 done
 
+# macOS: tests/darwin/<name>.c are compiled with --target=x86_64-darwin.
+# On macOS they are linked by clang and run like the tests above; elsewhere
+# they are only assembled as Mach-O, if llvm-mc is there to do it.
+for c in tests/darwin/*.c; do
+  name=darwin/$(basename "$c")
+  s="$tmpdir/darwin.$(basename "${c%.c}").s"
+  bin="${s%.s}.bin"
+  read -r -a flags <<< "$(sed -n 's#^// FLAGS: ##p' "$c")"
+  if [[ "$(uname -s)" != Darwin ]] && ! command -v llvm-mc > /dev/null; then continue; fi
+  (( ++total ))
+  if ! ./ccomp --target=x86_64-darwin "${flags[@]}" -o "$s" "$c" > "$tmpdir/$(basename "$c").log" 2>&1; then
+    echo "FAIL $name (compile error)"
+    (( ++fail ))
+    continue
+  fi
+  if [[ "$(uname -s)" != Darwin ]]; then
+    if llvm-mc -triple x86_64-apple-darwin -filetype=obj -o "${s%.s}.o" "$s" >> "$tmpdir/$(basename "$c").log" 2>&1; then
+      echo "PASS $name (assembled)"
+      (( ++pass ))
+    else
+      echo "FAIL $name (assembler error)"
+      (( ++fail ))
+    fi
+    continue
+  fi
+  expect_val=$(head -n1 "$c" | awk '{print $4}')
+  if ! clang -arch x86_64 -o "$bin" "$s" >> "$tmpdir/$(basename "$c").log" 2>&1; then
+    echo "FAIL $name (link error)"
+    (( ++fail ))
+    continue
+  fi
+  set +e
+  tools/with_timeout.sh 1 "$bin" > "$bin.out" 2>> "$tmpdir/$(basename "$c").log"
+  code=$?
+  set -e
+  if [[ "$code" != "$expect_val" ]]; then
+    echo "FAIL $name (exit=$code expected=$expect_val)"
+    (( ++fail ))
+  elif ! check_stdout "$c" "$bin.out"; then
+    (( ++fail ))
+  else
+    echo "PASS $name (exit=$code)"
+    (( ++pass ))
+  fi
+done
+
+# Golden IR dumps: tests/ir/<name>.c must print exactly <name>.ir with
+# --emit=ir, given its '// FLAGS:'. Regenerate with:
+# ./ccomp --emit=ir [flags] tests/ir/x.c -o tests/ir/x.ir
+for c in tests/ir/*.c; do
+  (( ++total ))
+  name=ir/$(basename "$c")
+  out="$tmpdir/$(basename "${c%.c}").ir"
+  read -r -a flags <<< "$(sed -n 's#^// FLAGS: ##p' "$c")"
+  if ! ./ccomp "${flags[@]}" --emit=ir -o "$out" "$c" > "$tmpdir/$(basename "$c").log" 2>&1; then
+    echo "FAIL $name (compile error)"
+    (( ++fail ))
+  elif ! diff -u "${c%.c}.ir" "$out" > "$out.diff"; then
+    echo "FAIL $name (IR differs from ${c%.c}.ir)"
+    cat "$out.diff"
+    (( ++fail ))
+  else
+    echo "PASS $name (ir)"
+    (( ++pass ))
+  fi
+done
+
+# Golden assembly: tests/asm/<name>.c must compile, given its '// FLAGS:',
+# to exactly <name>.s, which pins the directives around the code as well as
+# the code. Regenerate with:
+# ./ccomp [flags] -o tests/asm/x.s tests/asm/x.c
+for c in tests/asm/*.c; do
+  (( ++total ))
+  name=asm/$(basename "$c")
+  out="$tmpdir/$(basename "${c%.c}").s"
+  read -r -a flags <<< "$(sed -n 's#^// FLAGS: ##p' "$c")"
+  if ! ./ccomp "${flags[@]}" -o "$out" "$c" > "$tmpdir/$(basename "$c").log" 2>&1; then
+    echo "FAIL $name (compile error)"
+    (( ++fail ))
+  elif ! diff -u "${c%.c}.s" "$out" > "$out.diff"; then
+    echo "FAIL $name (assembly differs from ${c%.c}.s)"
+    cat "$out.diff"
+    (( ++fail ))
+  else
+    echo "PASS $name (asm)"
+    (( ++pass ))
+  fi
+done
+
+# Pass dumps: tests/dump/<name>.c or <name>.ir, compiled with its FLAGS
+# (which ask for --dump-ir-after or -fstats), must write exactly <name>.dump
+# into --dump-dir. Regenerate with:
+# ./ccomp [flags] --dump-dir=tests/dump -o /dev/null tests/dump/x.c
+mkdir -p "$tmpdir/dump"
+for c in tests/dump/*.c tests/dump/*.ir; do
+  (( ++total ))
+  name=dump/$(basename "$c")
+  out="$tmpdir/dump/$(basename "$c").dump"
+  read -r -a flags <<< "$(sed -n 's#^\(//\|;\) FLAGS: ##p' "$c")"
+  if ! ./ccomp "${flags[@]}" --dump-dir="$tmpdir/dump" -o /dev/null "$c" > "$tmpdir/$(basename "$c").log" 2>&1; then
+    echo "FAIL $name (compile error)"
+    (( ++fail ))
+  elif ! diff -u "${c%.*}.dump" "$out" > "$out.diff"; then
+    echo "FAIL $name (dump differs from ${c%.*}.dump)"
+    cat "$out.diff"
+    (( ++fail ))
+  else
+    echo "PASS $name (dump)"
+    (( ++pass ))
+  fi
+done
+
+# Register allocators: tests/regalloc/<name>.c, compiled with its FLAGS
+# by each allocator, must exit as its EXPECT line says, in exactly as many
+# instructions as <name>.counts records, so that a change that makes either
+# allocator better or worse shows. Regenerate with:
+# for a in linear color; do echo "$a $(./ccomp [flags] -fregalloc=$a tests/regalloc/x.c | grep -c '^  [a-z]')"; done > tests/regalloc/x.counts
+for c in tests/regalloc/*.c; do
+  (( ++total ))
+  name=regalloc/$(basename "$c")
+  base="$tmpdir/$(basename "${c%.c}")"
+  expect_val=$(head -n1 "$c" | awk '{print $4}')
+  read -r -a flags <<< "$(sed -n 's#^// FLAGS: ##p' "$c")"
+  : > "$base.counts"
+  for a in linear color; do
+    if ! ./ccomp "${flags[@]}" -fregalloc=$a -o "$base.$a.s" "$c" > "$base.log" 2>&1 ||
+       ! gcc -nostdlib "$base.$a.s" runtime/start_linux_amd64.s -o "$base.$a.bin" >> "$base.log" 2>&1; then
+      echo "FAIL $name (build error with -fregalloc=$a)"
+      (( ++fail ))
+      continue 2
+    fi
+    set +e
+    tools/with_timeout.sh 1 "$base.$a.bin" > /dev/null 2>> "$base.log"
+    code=$?
+    set -e
+    if [[ "$code" != "$expect_val" ]]; then
+      echo "FAIL $name (exit=$code expected=$expect_val with -fregalloc=$a)"
+      (( ++fail ))
+      continue 2
+    fi
+    echo "$a $(grep -c '^  [a-z]' "$base.$a.s")" >> "$base.counts"
+  done
+  if ! diff -u "${c%.c}.counts" "$base.counts" > "$base.diff"; then
+    echo "FAIL $name (instruction counts differ from ${c%.c}.counts)"
+    cat "$base.diff"
+    (( ++fail ))
+  else
+    echo "PASS $name (regalloc)"
+    (( ++pass ))
+  fi
+done
+
+# Reproducible builds: tests/repro/<name>.c, compiled 50 times by each
+# register allocator, must give the same assembly every time.
+for c in tests/repro/*.c; do
+  (( ++total ))
+  name=repro/$(basename "$c")
+  base="$tmpdir/$(basename "${c%.c}")"
+  ok=1
+  for a in linear color; do
+    ./ccomp -fregalloc=$a -o "$base.$a.s" "$c" > "$base.log" 2>&1 || ok=0
+    for i in $(seq 49); do
+      ./ccomp -fregalloc=$a -o "$base.again.s" "$c" >> "$base.log" 2>&1 || ok=0
+      cmp -s "$base.$a.s" "$base.again.s" || ok=0
+    done
+  done
+  if [[ $ok == 1 ]]; then
+    echo "PASS $name (repro)"
+    (( ++pass ))
+  else
+    echo "FAIL $name (assembly differs between runs, or a compile error)"
+    (( ++fail ))
+  fi
+done
+
+# Analyses: tests/<kind>/<name>.ir must print exactly <name>.<kind> with
+# --emit=<kind>, the answers worked out by hand; dom is dominators and live
+# is liveness.
+for src in tests/dom/*.ir tests/live/*.ir; do
+  (( ++total ))
+  kind=$(basename "$(dirname "$src")")
+  name=$kind/$(basename "$src")
+  out="$tmpdir/$(basename "${src%.ir}").$kind"
+  if ! ./ccomp --emit="$kind" -o "$out" "$src" > "$tmpdir/$(basename "$src").log" 2>&1; then
+    echo "FAIL $name (compile error)"
+    (( ++fail ))
+  elif ! diff -u "${src%.ir}.$kind" "$out" > "$out.diff"; then
+    echo "FAIL $name (output differs from ${src%.ir}.$kind)"
+    cat "$out.diff"
+    (( ++fail ))
+  else
+    echo "PASS $name ($kind)"
+    (( ++pass ))
+  fi
+done
+
 echo
 echo "Summary: $pass passed, $fail failed, $total total"
 [[ $fail -eq 0 ]]